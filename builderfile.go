@@ -41,6 +41,7 @@ var (
 	TOOLPREFIX = detectToolPrefix()
 	CC         = TOOLPREFIX + "gcc"
 	LD         = TOOLPREFIX + "ld"
+	OBJCOPY    = TOOLPREFIX + "objcopy"
 
 	CFLAGS  = initCflags()
 	LDFLAGS = initLdflags()
@@ -80,8 +81,8 @@ func Kernel() error {
 }
 
 func Boot64() error {
-	compileCfile("boot/boot64.S", "-m64")
-	compileCfile("boot/boot64main.c", "-m64")
+	compileCfile("pkg/base/boot/boot64.S", "-m64")
+	compileCfile("pkg/base/boot/boot64main.c", "-m64")
 	ldflags := "-Ttext 0x3200000 -m elf_x86_64 -o boot64.elf boot64.o boot64main.o"
 	ldArgs := append([]string{}, LDFLAGS...)
 	ldArgs = append(ldArgs, strings.Fields(ldflags)...)
@@ -91,8 +92,8 @@ func Boot64() error {
 // Multiboot target build Multiboot specification compatible elf format, generate multiboot.elf
 func Multiboot() error {
 	utils.Deps(Boot64)
-	compileCfile("boot/multiboot.c", "-m32")
-	compileCfile("boot/multiboot_header.S", "-m32")
+	compileCfile("pkg/base/boot/multiboot.c", "-m32")
+	compileCfile("pkg/base/boot/multiboot_header.S", "-m32")
 	ldflags := "-Ttext 0x3300000 -m elf_i386 -o multiboot.elf multiboot.o multiboot_header.o -b binary boot64.elf"
 	ldArgs := append([]string{}, LDFLAGS...)
 	ldArgs = append(ldArgs, strings.Fields(ldflags)...)
@@ -106,6 +107,29 @@ func Multiboot() error {
 	)
 }
 
+// Multiboot64 target build the loader used by Firecracker, generate multiboot64.elf.
+// Firecracker only loads ELF64 kernels and enters them through the PVH note,
+// so the 32-bit loader is linked into a single segment that also holds the
+// note and then rewrapped as ELF64.
+func Multiboot64() error {
+	utils.Deps(Multiboot)
+	ldflags := "-Ttext-segment 0x3300000 -m elf_i386 -o multiboot32.elf multiboot.o multiboot_header.o -b binary boot64.elf"
+	ldArgs := append([]string{}, LDFLAGS...)
+	ldArgs = append(ldArgs, strings.Fields(ldflags)...)
+	err := sh.RunV(LD, ldArgs...)
+	if err != nil {
+		return err
+	}
+	err = sh.RunV(OBJCOPY, "-I", "elf32-i386", "-O", "elf64-x86-64", "multiboot32.elf", "multiboot64.elf")
+	if err != nil {
+		return err
+	}
+	return sh.Copy(
+		filepath.Join("cmd", "server", "assets", "boot", "multiboot64.elf"),
+		"multiboot64.elf",
+	)
+}
+
 func Test() error {
 	utils.Deps(BhojpurKernel)
 
@@ -182,6 +206,8 @@ func Clean() {
 	rmGlob("*.o")
 	rmGlob("kernel.elf")
 	rmGlob("multiboot.elf")
+	rmGlob("multiboot32.elf")
+	rmGlob("multiboot64.elf")
 	rmGlob("qemu.log")
 	rmGlob("qemu.pcap")
 	rmGlob("bhojpur-kernel.iso")
@@ -0,0 +1,195 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bhojpur/kernel/pkg/manifest"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var manifestFile string
+var rebuildImages, keepVolumes bool
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Create or update the images, volumes and instances described in a manifest",
+	Long: `Reads a YAML manifest describing images, volumes and instances,
+compares it with what the daemon currently has and makes the changes
+needed to match it.
+
+Images are built when missing, or rebuilt when their provider, compiler or
+mount points changed. The daemon does not record the sources an image was
+built from, so use --rebuild after changing sources.
+Instances are run when missing, started or resumed when stopped or paused,
+and replaced when their image is rebuilt. Replicas beyond the declared
+count are deleted. Volumes are only ever created.
+
+Resources that are not named in the manifest are left alone.
+Run 'kernctl diff' first to see what would change.
+
+Example manifest:
+	images:
+	  - name: web
+	    base: rump
+	    language: go
+	    provider: qemu
+	    path: ./web
+	    mountpoints: [/data]
+	volumes:
+	  - name: web-data
+	    provider: qemu
+	    size: 100
+	instances:
+	  - name: web
+	    image: web
+	    memory: 256
+	    env:
+	      LOG_LEVEL: debug
+	    mounts:
+	      /data: web-data
+
+Example usage:
+	kernctl apply -f kernel.yaml
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := func() error {
+			plan, err := planManifest(false)
+			if err != nil {
+				return err
+			}
+			if plan.Empty() {
+				fmt.Println("nothing to do")
+				return nil
+			}
+			printPlan(plan)
+			return plan.Execute(host)
+		}(); err != nil {
+			logrus.Errorf("apply failed: %v", err)
+			os.Exit(-1)
+		}
+	},
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show what 'kernctl apply' would change",
+	Long: `Compares a manifest with what the daemon currently has and prints
+the steps 'kernctl apply' would take, without changing anything.
+
+Example usage:
+	kernctl diff -f kernel.yaml
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := func() error {
+			plan, err := planManifest(false)
+			if err != nil {
+				return err
+			}
+			if plan.Empty() {
+				fmt.Println("up to date")
+				return nil
+			}
+			printPlan(plan)
+			return nil
+		}(); err != nil {
+			logrus.Errorf("diff failed: %v", err)
+			os.Exit(-1)
+		}
+	},
+}
+
+var destroyCmd = &cobra.Command{
+	Use:   "destroy",
+	Short: "Delete the images, volumes and instances described in a manifest",
+	Long: `Deletes every instance, image and volume named in a manifest,
+including replicas left over from scaling down.
+Use --keep-volumes to keep the data volumes.
+
+Example usage:
+	kernctl destroy -f kernel.yaml --keep-volumes
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := func() error {
+			plan, err := planManifest(true)
+			if err != nil {
+				return err
+			}
+			if plan.Empty() {
+				fmt.Println("nothing to do")
+				return nil
+			}
+			printPlan(plan)
+			return plan.Execute(host)
+		}(); err != nil {
+			logrus.Errorf("destroy failed: %v", err)
+			os.Exit(-1)
+		}
+	},
+}
+
+func planManifest(destroy bool) (*manifest.Plan, error) {
+	if manifestFile == "" {
+		return nil, errors.New("--file must be set", nil)
+	}
+	m, err := manifest.Load(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := readClientConfig(); err != nil {
+		return nil, err
+	}
+	if host == "" {
+		host = clientConfig.Host
+	}
+	current, err := manifest.Current(host)
+	if err != nil {
+		return nil, err
+	}
+	if destroy {
+		return manifest.NewDestroyPlan(m, current, keepVolumes), nil
+	}
+	return manifest.NewPlan(m, current, manifest.PlanOptions{Rebuild: rebuildImages}), nil
+}
+
+func printPlan(plan *manifest.Plan) {
+	fmt.Printf("%-8s %-9s %-20s %s\n", "ACTION", "KIND", "NAME", "REASON")
+	for _, step := range plan.Steps {
+		fmt.Printf("%-8.8s %-9.9s %-20.20s %s\n", step.Action, step.Kind, step.Name, step.Reason)
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(applyCmd)
+	RootCmd.AddCommand(diffCmd)
+	RootCmd.AddCommand(destroyCmd)
+	for _, c := range []*cobra.Command{applyCmd, diffCmd, destroyCmd} {
+		c.Flags().StringVarP(&manifestFile, "file", "f", "", "<string,required> path to the manifest")
+	}
+	for _, c := range []*cobra.Command{applyCmd, diffCmd} {
+		c.Flags().BoolVar(&rebuildImages, "rebuild", false, "<bool,optional> rebuild every image, e.g. after changing sources")
+	}
+	destroyCmd.Flags().BoolVar(&keepVolumes, "keep-volumes", false, "<bool,optional> do not delete the volumes in the manifest")
+}
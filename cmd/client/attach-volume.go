@@ -32,9 +32,8 @@ import (
 var mountPoint string
 
 var attachCmd = &cobra.Command{
-	Use:     "attach-volume",
-	Aliases: []string{"attach"},
-	Short:   "Attach a volume to a stopped instance",
+	Use:   "attach-volume",
+	Short: "Attach a volume to a stopped instance",
 	Long: `Attaches a volume to a stopped instance at a specified mount point.
 You specify the volume by name or id.
 
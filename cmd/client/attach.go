@@ -0,0 +1,124 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bhojpur/kernel/pkg/client"
+	"github.com/bhojpur/kernel/pkg/util"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var detachKeys string
+var noTty bool
+
+var attachConsoleCmd = &cobra.Command{
+	Use:   "attach",
+	Short: "Attach to the serial console of a running instance",
+	Long: `Connects your terminal to the serial console of a running instance,
+so you can use interactive unikernels such as the Bhojpur kernel shell.
+The terminal is put in raw mode, unless --no-tty is given or stdin is not
+a terminal. Detach with the --detach-keys sequence, ctrl-p ctrl-q by
+default; the instance keeps running.
+
+Supported by the qemu, firecracker and ukvm providers.
+You may specify the instance by name or id.
+
+Example usage:
+    kernctl attach --instance myInstance`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := func() error {
+			if err := readClientConfig(); err != nil {
+				return err
+			}
+			if host == "" {
+				host = clientConfig.Host
+			}
+			if instanceName == "" {
+				return errors.New("must specify --instance", nil)
+			}
+			keys, err := util.ParseDetachKeys(detachKeys)
+			if err != nil {
+				return err
+			}
+			logrus.WithFields(logrus.Fields{"host": host, "instance": instanceName}).Info("attaching to console")
+			console, err := client.KernelClient(host).Instances().AttachConsole(instanceName)
+			if err != nil {
+				return err
+			}
+			defer console.Close()
+
+			fd := int(os.Stdin.Fd())
+			if !noTty && term.IsTerminal(fd) {
+				state, err := term.MakeRaw(fd)
+				if err != nil {
+					return errors.New("putting terminal in raw mode", err)
+				}
+				defer term.Restore(fd, state)
+			}
+			fmt.Fprintf(os.Stderr, "attached to %s, detach with %s\r\n", instanceName, detachKeys)
+
+			outputDone := make(chan error, 1)
+			go func() {
+				_, err := io.Copy(os.Stdout, console)
+				outputDone <- err
+			}()
+			inputDone := make(chan error, 1)
+			go func() {
+				_, err := io.Copy(console, util.NewDetachReader(os.Stdin, keys))
+				inputDone <- err
+			}()
+
+			select {
+			case err := <-inputDone:
+				if err == util.ErrDetached {
+					fmt.Fprintf(os.Stderr, "\r\ndetached from %s\r\n", instanceName)
+					return nil
+				}
+				if err != nil {
+					return errors.New("sending input", err)
+				}
+				// stdin was a pipe that ran dry; keep showing output
+				// until the console closes
+				<-outputDone
+			case <-outputDone:
+			}
+			fmt.Fprintf(os.Stderr, "\r\nconsole of %s closed\r\n", instanceName)
+			return nil
+		}(); err != nil {
+			logrus.Errorf("failed attaching to console: %v", err)
+			os.Exit(-1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(attachConsoleCmd)
+	attachConsoleCmd.Flags().StringVar(&instanceName, "instance", "", "<string,required> name or id of instance. Bhojpur Kernel accepts a prefix of the name or id")
+	attachConsoleCmd.Flags().StringVar(&detachKeys, "detach-keys", util.DefaultDetachKeys, "<string,optional> key sequence that detaches from the console, e.g. ctrl-p,ctrl-q or ctrl-]")
+	attachConsoleCmd.Flags().BoolVar(&noTty, "no-tty", false, "<bool,optional> do not put the terminal in raw mode")
+}
@@ -21,6 +21,7 @@ package cmd
 // THE SOFTWARE.
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 
@@ -33,7 +34,7 @@ import (
 
 var name, sourcePath, base, lang, provider, runArgs string
 var mountPoints []string
-var force, noCleanup bool
+var force, noCleanup, detach bool
 
 var buildCmd = &cobra.Command{
 	Use:   "build",
@@ -48,7 +49,9 @@ Images must be compiled using a specific compiler. Compilers are composed of thr
 In order to see a list of all supported base/language/provider combinations, run 'kernctl compilers'
 
 Images must be compiled for a specific provider, specified with the '--provider' flag
-To see a list of available providers, run 'unik providers'
+To see a list of available providers, run 'kernctl providers'
+When the daemon has several accounts of a provider, choose one with '--provider type/name',
+e.g. '--provider aws/us-east-1-prod'
 
 A unikernel base that is compatible with the provider must be specified with the '--base' flag.
 A language runtime that is compatible with the base must be specified with the '--language' flag.
@@ -75,6 +78,9 @@ Example usage:
 
 Another example (using only the required parameters):
 	kernctl build -name anotherUnikernel -path ./anotherApp/src --base includeos --language cpp --provider virtualbox
+
+Builds can run in the background with the --detach flag. The build id is printed
+and can be used with 'kernctl build-logs' and 'kernctl cancel-build'
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := func() error {
@@ -119,6 +125,14 @@ Another example (using only the required parameters):
 				return errors.New("failed to tar sources", err)
 			}
 			logrus.Infof("Application packaged as tarball: %s\n", sourceTar.Name())
+			if detach {
+				job, err := client.KernelClient(host).Images().BuildDetached(name, sourceTar.Name(), base, lang, provider, runArgs, mountPoints, force, noCleanup)
+				if err != nil {
+					return errors.New("queueing build failed", err)
+				}
+				fmt.Println(job.Id)
+				return nil
+			}
 			image, err := client.KernelClient(host).Images().Build(name, sourceTar.Name(), base, lang, provider, runArgs, mountPoints, force, noCleanup)
 			if err != nil {
 				return errors.New("building image failed", err)
@@ -143,4 +157,5 @@ func init() {
 	buildCmd.Flags().StringSliceVar(&mountPoints, "mountpoint", []string{}, "<string,repeated> specify up to 8 mount points for volumes")
 	buildCmd.Flags().BoolVar(&force, "force", false, "<bool, optional> force overwriting a previously existing")
 	buildCmd.Flags().BoolVar(&noCleanup, "no-cleanup", false, "<bool, optional> for debugging; do not clean up artifacts for images that fail to build")
+	buildCmd.Flags().BoolVar(&detach, "detach", false, "<bool, optional> queue the build and print its id without waiting for it to finish")
 }
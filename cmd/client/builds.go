@@ -0,0 +1,149 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bhojpur/kernel/pkg/client"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var buildId string
+
+var buildsCmd = &cobra.Command{
+	Use:   "builds",
+	Short: "List image builds",
+	Long: `Lists image builds known to the daemon, queued, running and
+recently finished.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := func() error {
+			if err := readClientConfig(); err != nil {
+				return err
+			}
+			if host == "" {
+				host = clientConfig.Host
+			}
+			logrus.WithField("host", host).Info("listing builds")
+			jobs, err := client.KernelClient(host).Builds().All()
+			if err != nil {
+				return errors.New("listing builds failed", err)
+			}
+			printBuilds(jobs...)
+			return nil
+		}(); err != nil {
+			logrus.Errorf("failed listing builds: %v", err)
+			os.Exit(-1)
+		}
+	},
+}
+
+var buildLogsCmd = &cobra.Command{
+	Use:   "build-logs",
+	Short: "retrieve the output of an image build",
+	Long: `Retrieves the compiler output of an image build.
+
+Use the --follow flag to stream the output until the build finishes.
+
+Example usage:
+	kernctl build-logs --build 1c6b1c1e-4a3c-4b8e-9f0d-3d2e4c5b6a7f --follow
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := func() error {
+			if err := readClientConfig(); err != nil {
+				return err
+			}
+			if host == "" {
+				host = clientConfig.Host
+			}
+			if buildId == "" {
+				return errors.New("must specify --build", nil)
+			}
+			if !follow {
+				data, err := client.KernelClient(host).Builds().GetLogs(buildId)
+				if err != nil {
+					return err
+				}
+				fmt.Print(data)
+				return nil
+			}
+			r, err := client.KernelClient(host).Builds().AttachLogs(buildId)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			if _, err := io.Copy(os.Stdout, bufio.NewReader(r)); err != nil {
+				return err
+			}
+			job, err := client.KernelClient(host).Builds().Get(buildId)
+			if err != nil {
+				return err
+			}
+			printBuilds(job)
+			return nil
+		}(); err != nil {
+			logrus.Errorf("failed retrieving build logs: %v", err)
+			os.Exit(-1)
+		}
+	},
+}
+
+var cancelBuildCmd = &cobra.Command{
+	Use:   "cancel-build",
+	Short: "Cancel a queued or running image build",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := func() error {
+			if err := readClientConfig(); err != nil {
+				return err
+			}
+			if host == "" {
+				host = clientConfig.Host
+			}
+			if buildId == "" {
+				return errors.New("must specify --build", nil)
+			}
+			logrus.WithFields(logrus.Fields{"host": host, "build": buildId}).Info("cancelling build")
+			job, err := client.KernelClient(host).Builds().Cancel(buildId)
+			if err != nil {
+				return err
+			}
+			printBuilds(job)
+			return nil
+		}(); err != nil {
+			logrus.Errorf("failed cancelling build: %v", err)
+			os.Exit(-1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(buildsCmd)
+	RootCmd.AddCommand(buildLogsCmd)
+	buildLogsCmd.Flags().StringVar(&buildId, "build", "", "<string,required> id of the build")
+	buildLogsCmd.Flags().BoolVar(&follow, "follow", false, "<bool,optional> stream the output until the build finishes")
+	RootCmd.AddCommand(cancelBuildCmd)
+	cancelBuildCmd.Flags().StringVar(&buildId, "build", "", "<string,required> id of the build")
+}
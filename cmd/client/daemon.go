@@ -80,6 +80,7 @@ Example usage:
 			for _, vsphereConfig := range daemonConfig.Providers.Vsphere {
 				redactions = append(redactions, vsphereConfig.VspherePassword, url.QueryEscape(vsphereConfig.VspherePassword))
 			}
+			redactions = append(redactions, daemonConfig.Auth.Tokens...)
 			logrus.SetFormatter(&kutil.RedactedTextFormatter{
 				Redactions: redactions,
 			})
@@ -0,0 +1,76 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bhojpur/kernel/pkg/client"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var refreshDrift bool
+
+var driftCmd = &cobra.Command{
+	Use:   "drift",
+	Short: "Show differences between daemon state and provider infrastructure",
+	Long: `The daemon periodically compares the state it keeps for each provider
+with what actually exists, e.g. qemu processes and image files.
+Instances that died or were lost track of are fixed automatically;
+leaked images and volumes are only reported.
+
+This command shows the result of the last comparison.
+Use --refresh to run a new comparison first.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := func() error {
+			if err := readClientConfig(); err != nil {
+				return err
+			}
+			if host == "" {
+				host = clientConfig.Host
+			}
+			report, err := client.KernelClient(host).Drift(refreshDrift)
+			if err != nil {
+				return errors.New("getting drift report failed", err)
+			}
+			fmt.Printf("checked at %s\n", report.Time.String())
+			fmt.Printf("%-25s %-9s %-20s %-45s %s\n", "PROVIDER", "KIND", "NAME", "PROBLEM", "ACTION")
+			for _, d := range report.Drift {
+				fmt.Printf("%-25.25s %-9.9s %-20.20s %-45.45s %s\n", d.Provider, d.Kind, d.Name, d.Problem, d.Action)
+			}
+			for provider, err := range report.Errors {
+				logrus.Warnf("could not check %s: %s", provider, err)
+			}
+			return nil
+		}(); err != nil {
+			logrus.Errorf("failed getting drift: %v", err)
+			os.Exit(-1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(driftCmd)
+	driftCmd.Flags().BoolVar(&refreshDrift, "refresh", false, "<bool,optional> run a new comparison instead of showing the last one")
+}
@@ -0,0 +1,108 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bhojpur/kernel/pkg/client"
+	"github.com/bhojpur/kernel/pkg/types"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var eventKinds, eventProviders []string
+var eventsJson bool
+
+var eventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "Stream image, instance and volume lifecycle events",
+	Long: `Prints lifecycle events from the daemon as they happen, e.g. instances
+being created, changing state or being removed.
+
+Example usage:
+	kernctl events --kind instance --provider aws/us-east-1-prod
+
+	# will print every change to instances on the us-east-1-prod aws account
+
+	kernctl events --json
+
+	# will print every event as a json object, one per line
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := func() error {
+			if err := readClientConfig(); err != nil {
+				return err
+			}
+			if host == "" {
+				host = clientConfig.Host
+			}
+			logrus.WithFields(logrus.Fields{"host": host, "kinds": eventKinds, "providers": eventProviders}).Info("streaming events")
+			stream, err := client.KernelClient(host).Events(eventKinds, eventProviders)
+			if err != nil {
+				return err
+			}
+			defer stream.Close()
+			if !eventsJson {
+				fmt.Printf("%-30s %-9s %-8s %-25s %-20s %-20s %s\n", "TIME", "KIND", "ACTION", "PROVIDER", "NAME", "ID", "STATE")
+			}
+			for {
+				event, err := stream.Next()
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if eventsJson {
+					data, err := json.Marshal(event)
+					if err != nil {
+						return err
+					}
+					fmt.Println(string(data))
+					continue
+				}
+				printEvent(event)
+			}
+		}(); err != nil {
+			logrus.Errorf("failed streaming events: %v", err)
+			os.Exit(-1)
+		}
+	},
+}
+
+func printEvent(event *types.Event) {
+	state := ""
+	if event.Instance != nil {
+		state = string(event.Instance.State)
+	}
+	fmt.Printf("%-30.30s %-9.9s %-8.8s %-25.25s %-20.20s %-20.20s %s\n", event.Time.String(), event.Kind, event.Action, event.Provider, event.Name, event.Id, state)
+}
+
+func init() {
+	RootCmd.AddCommand(eventsCmd)
+	eventsCmd.Flags().StringSliceVar(&eventKinds, "kind", []string{}, "<string,repeated> only show events for image, instance or volume")
+	eventsCmd.Flags().StringSliceVar(&eventProviders, "provider", []string{}, "<string,repeated> only show events from this provider type or account, e.g. aws or aws/us-east-1-prod")
+	eventsCmd.Flags().BoolVar(&eventsJson, "json", false, "<bool,optional> print events as json, one per line")
+}
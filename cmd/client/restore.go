@@ -0,0 +1,76 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"os"
+
+	"github.com/bhojpur/kernel/pkg/client"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var snapshotId string
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Start an instance from a snapshot",
+	Long: `Starts a new instance that resumes from a snapshot taken with
+'kernctl snapshot'. The instance takes the name of the snapshotted
+instance unless --name is given.
+
+Firecracker instances resume with the IP address of the snapshotted
+instance, so only one of them can run at a time.
+You may specify the snapshot by name or id.
+
+Example usage:
+    kernctl restore --snapshot warm --name myInstance-2`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := func() error {
+			if err := readClientConfig(); err != nil {
+				return err
+			}
+			if host == "" {
+				host = clientConfig.Host
+			}
+			if snapshotId == "" {
+				return errors.New("must specify --snapshot", nil)
+			}
+			logrus.WithFields(logrus.Fields{"host": host, "snapshot": snapshotId, "name": instanceName}).Info("restoring snapshot")
+			instance, err := client.KernelClient(host).Snapshots().Restore(snapshotId, instanceName)
+			if err != nil {
+				return err
+			}
+			printInstances(instance)
+			return nil
+		}(); err != nil {
+			logrus.Errorf("failed restoring snapshot: %v", err)
+			os.Exit(-1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(restoreCmd)
+	restoreCmd.Flags().StringVar(&snapshotId, "snapshot", "", "<string,required> name or id of snapshot. Bhojpur Kernel accepts a prefix of the name or id")
+	restoreCmd.Flags().StringVar(&instanceName, "name", "", "<string,optional> name of the restored instance")
+}
@@ -21,13 +21,13 @@ package cmd
 // THE SOFTWARE.
 
 import (
-	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"runtime"
 	"sort"
 
+	"github.com/bhojpur/kernel/pkg/client"
 	"github.com/bhojpur/kernel/pkg/config"
 	"github.com/bhojpur/kernel/pkg/types"
 	"github.com/sirupsen/logrus"
@@ -73,13 +73,16 @@ func readClientConfig() error {
 Try setting your config with 'kernctl target --host HOST_URL'`)
 		return err
 	}
-	data = bytes.Replace(data, []byte("\n"), []byte{}, -1)
 	if err := yaml.Unmarshal(data, &clientConfig); err != nil {
 		logrus.WithError(err).Errorf("failed to parse client configuration yaml at " + clientConfigFile + `
 Please ensure config file contains valid yaml.'\n
 Try setting your config with 'kernctl target --host HOST_URL'`)
 		return err
 	}
+	if err := client.UseConfig(clientConfig); err != nil {
+		logrus.WithError(err).Errorf("failed to load credentials from client configuration at " + clientConfigFile)
+		return err
+	}
 	return nil
 }
 
@@ -104,6 +107,13 @@ func printImages(images ...*types.Image) {
 	}
 }
 
+func printBuilds(jobs ...*types.BuildJob) {
+	fmt.Printf("%-36s %-20s %-15s %-10s %-30s %s\n", "ID", "IMAGE", "INFRASTRUCTURE", "STATE", "CREATED", "ERROR")
+	for _, job := range jobs {
+		fmt.Printf("%-36.36s %-20.20s %-15.15s %-10.10s %-30.30s %s\n", job.Id, job.ImageName, job.Provider, job.State, job.Created.String(), job.Error)
+	}
+}
+
 func printImage(image *types.Image) {
 	for i, deviceMapping := range image.RunSpec.DeviceMappings {
 		//ignore root device mount point
@@ -23,12 +23,15 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"bufio"
 	"net"
 
 	"github.com/bhojpur/kernel/pkg/client"
+	"github.com/bhojpur/kernel/pkg/daemon"
+	"github.com/bhojpur/kernel/pkg/types"
 	"github.com/bhojpur/kernel/pkg/util/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -37,6 +40,10 @@ import (
 var instanceName, imageName string
 var volumes, envPairs []string
 var instanceMemory, debugPort int
+var vcpuCount int
+var cpuTemplate, kernelArgs, kernelPath string
+var restartPolicy, healthCheck string
+var healthInterval, healthTimeout, healthRetries, healthGracePeriod int
 
 var runCmd = &cobra.Command{
 	Use:   "run",
@@ -66,6 +73,15 @@ Example usage:
 	# instance will boot with env variable 'another' set to 'one'
 	# instance will get 1234 MB of memory
 
+	kernctl run --instanceName fastInstance --imageName myFirecrackerImage --vcpus 4 --cpu-template T2 --kernel-args "quiet"
+
+	# on firecracker, the microVM gets 4 vCPUs, the T2 CPU template, and "quiet" appended to the kernel command line
+
+	kernctl run --instanceName web --imageName myImage --restart on-failure:5 --health-check http:8080/healthz
+
+	# the daemon restarts the instance up to 5 times when it crashes, or when
+	# GET http://<instance ip>:8080/healthz fails 3 times in a row
+
 	# note that run must take exactly one --vol argument for each mount point defined in the image specification
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -105,6 +121,22 @@ Example usage:
 				env[key] = val
 			}
 
+			policy, err := types.ParseRestartPolicy(restartPolicy)
+			if err != nil {
+				return err
+			}
+			var check *types.HealthCheck
+			if healthCheck != "" {
+				check, err = parseHealthCheck(healthCheck)
+				if err != nil {
+					return err
+				}
+				check.IntervalSeconds = healthInterval
+				check.TimeoutSeconds = healthTimeout
+				check.FailureThreshold = healthRetries
+				check.GracePeriodSeconds = healthGracePeriod
+			}
+
 			logrus.WithFields(logrus.Fields{
 				"instanceName": instanceName,
 				"imageName":    imageName,
@@ -112,7 +144,22 @@ Example usage:
 				"mounts":       mountPointsToVols,
 				"host":         host,
 			}).Infof("running kernctl run")
-			instance, err := client.KernelClient(host).Instances().Run(instanceName, imageName, mountPointsToVols, env, instanceMemory, noCleanup, debugMode)
+			instance, err := client.KernelClient(host).Instances().RunWithRequest(daemon.RunInstanceRequest{
+				InstanceName:  instanceName,
+				ImageName:     imageName,
+				Mounts:        mountPointsToVols,
+				Env:           env,
+				MemoryMb:      instanceMemory,
+				NoCleanup:     noCleanup,
+				DebugMode:     debugMode,
+				VcpuCount:     vcpuCount,
+				CpuTemplate:   cpuTemplate,
+				KernelArgs:    kernelArgs,
+				KernelPath:    kernelPath,
+				Provider:      provider,
+				RestartPolicy: policy,
+				HealthCheck:   check,
+			})
 			if err != nil {
 				return errors.New("running image failed: %v", err)
 			}
@@ -138,10 +185,42 @@ func init() {
 	to the instance at boot time. volumes must be attached to the instance for each mount point expected by the image.
 	run 'kernctl image <image_name>' to see the mount points required for the image.
 	specified in the format 'volume_id:mount_point'`)
+	runCmd.Flags().StringVar(&provider, "provider", "", "<string, optional> provider account to run on, e.g. aws/us-east-1-prod. by default the account holding the image is used")
 	runCmd.Flags().IntVar(&instanceMemory, "instanceMemory", 0, "<int, optional> amount of memory (in MB) to assign to the instance. if none is given, the provider default will be used")
+	runCmd.Flags().IntVar(&vcpuCount, "vcpus", 0, "<int, optional> number of vCPUs to give the instance. if none is given, the provider default will be used. Currently only supported on Firecracker provider")
+	runCmd.Flags().StringVar(&cpuTemplate, "cpu-template", "", "<string, optional> CPU template (C3 or T2) to boot the instance with. Currently only supported on Firecracker provider")
+	runCmd.Flags().StringVar(&kernelArgs, "kernel-args", "", "<string, optional> extra kernel command line arguments, appended to the provider defaults. Currently only supported on Firecracker provider")
+	runCmd.Flags().StringVar(&kernelPath, "kernel", "", "<string, optional> kernel image to boot instead of the provider's configured kernel, a file in the kernels_dir of the daemon's firecracker config. Currently only supported on Firecracker provider")
 	runCmd.Flags().BoolVar(&noCleanup, "no-cleanup", false, "<bool, optional> for debugging; do not clean up artifacts for instances that fail to launch")
 	runCmd.Flags().BoolVar(&debugMode, "debug-mode", false, "<bool, optional> runs the instance in Debug mode so GDB can be attached. Currently only supported on QEMU provider")
 	runCmd.Flags().IntVar(&debugPort, "debug-port", 3001, "<int, optional> target port for debugger tcp connections. used in conjunction with --debug-mode")
+	runCmd.Flags().StringVar(&restartPolicy, "restart", "", "<string, optional> restart policy: never (default), on-failure[:max-retries] or always")
+	runCmd.Flags().StringVar(&healthCheck, "health-check", "", "<string, optional> probe the instance ip with 'http:PORT/PATH' or 'tcp:PORT'. unhealthy instances are restarted unless the restart policy is never")
+	runCmd.Flags().IntVar(&healthInterval, "health-interval", 0, "<int, optional> seconds between health probes. defaults to 10")
+	runCmd.Flags().IntVar(&healthTimeout, "health-timeout", 0, "<int, optional> seconds before a health probe times out. defaults to 2")
+	runCmd.Flags().IntVar(&healthRetries, "health-retries", 0, "<int, optional> failed probes in a row before the instance is unhealthy. defaults to 3")
+	runCmd.Flags().IntVar(&healthGracePeriod, "health-grace-period", 0, "<int, optional> seconds after the instance starts during which failed probes are not counted")
+}
+
+// parseHealthCheck parses http:PORT/PATH or tcp:PORT.
+func parseHealthCheck(s string) (*types.HealthCheck, error) {
+	pair := strings.SplitN(s, ":", 2)
+	if len(pair) != 2 {
+		return nil, errors.New(fmt.Sprintf("invalid format for health-check flag: %s", s), nil)
+	}
+	check := &types.HealthCheck{Type: pair[0]}
+	port := pair[1]
+	if i := strings.Index(port, "/"); i >= 0 {
+		port, check.Path = port[:i], port[i:]
+	}
+	var err error
+	if check.Port, err = strconv.Atoi(port); err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid port in health-check flag: %s", s), nil)
+	}
+	if check.Type == "tcp" && check.Path != "" {
+		return nil, errors.New("tcp health checks do not take a path", nil)
+	}
+	return check, check.Validate()
 }
 
 func connectDebugger() {
@@ -0,0 +1,99 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bhojpur/kernel/pkg/client"
+	"github.com/bhojpur/kernel/pkg/types"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var snapshotsCmd = &cobra.Command{
+	Use:   "snapshots",
+	Short: "List instance snapshots",
+	Long:  `Lists the instance snapshots of all providers that support them.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := func() error {
+			if err := readClientConfig(); err != nil {
+				return err
+			}
+			if host == "" {
+				host = clientConfig.Host
+			}
+			logrus.WithField("host", host).Info("listing snapshots")
+			snapshots, err := client.KernelClient(host).Snapshots().All()
+			if err != nil {
+				return errors.New("listing snapshots failed", err)
+			}
+			printSnapshots(snapshots...)
+			return nil
+		}(); err != nil {
+			logrus.Errorf("failed listing snapshots: %v", err)
+			os.Exit(-1)
+		}
+	},
+}
+
+var rmsCmd = &cobra.Command{
+	Use:     "delete-snapshot",
+	Aliases: []string{"rms"},
+	Short:   "Delete an instance snapshot",
+	Long: `Deletes a snapshot. Instances restored from it keep running.
+You may specify the snapshot by name or id.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := func() error {
+			if err := readClientConfig(); err != nil {
+				return err
+			}
+			if snapshotId == "" {
+				return errors.New("must specify --snapshot", nil)
+			}
+			if host == "" {
+				host = clientConfig.Host
+			}
+			logrus.WithFields(logrus.Fields{"host": host, "snapshot": snapshotId}).Info("deleting snapshot")
+			return client.KernelClient(host).Snapshots().Delete(snapshotId)
+		}(); err != nil {
+			logrus.Errorf("failed deleting snapshot: %v", err)
+			os.Exit(-1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(snapshotsCmd)
+	RootCmd.AddCommand(rmsCmd)
+	rmsCmd.Flags().StringVar(&snapshotId, "snapshot", "", "<string,required> name or id of snapshot. Bhojpur Kernel accepts a prefix of the name or id")
+}
+
+func printSnapshots(snapshots ...*types.Snapshot) {
+	fmt.Printf("%-20.20s %-15.15s %-14.14s %-30.30s %-20.20s %-12.12s\n",
+		"NAME", "INSTANCE", "INFRASTRUCTURE", "CREATED", "IMAGE", "SIZE(MB)")
+	for _, snapshot := range snapshots {
+		fmt.Printf("%-20.20s %-15.15s %-14.14s %-30.30s %-20.20s %-12.12d\n",
+			snapshot.Name, snapshot.InstanceName, snapshot.Infrastructure, snapshot.Created.String(), snapshot.ImageId, snapshot.SizeMb)
+	}
+}
@@ -32,7 +32,7 @@ import (
 var startCmd = &cobra.Command{
 	Use:   "start",
 	Short: "Start a stopped unikernel instance",
-	Long: `Starts a stopped instance.
+	Long: `Starts a stopped instance, or resumes a paused one.
 You may specify the instance by name or id.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := func() error {
@@ -35,6 +35,7 @@ import (
 )
 
 var show bool
+var caFile, certFile, keyFile, token string
 
 var targetCmd = &cobra.Command{
 	Use:   "target",
@@ -46,20 +47,43 @@ args:
 --host: <string, required>: host/ip address of the host running the Bhojpur Kernel daemon
 --port: <int, optional>: port the daemon is running on (default: 3000)
 
---show: <bool,optional>: shows the current target that is set`,
+--ca-file: <string, optional>: CA bundle used to verify the daemon's TLS certificate
+--cert-file, --key-file: <string, optional>: client certificate for daemons requiring mutual TLS
+--token: <string, optional>: bearer token for daemons with token auth enabled
+
+Setting --ca-file or --cert-file, or prefixing the host with https://,
+makes the client connect over TLS.
+
+--show: <bool,optional>: shows the current target that is set
+
+Example usage:
+	kernctl target --host build01.example.com --ca-file ca.pem --token $KERNEL_TOKEN`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := func() error {
 			if show {
 				if err := readClientConfig(); err != nil {
 					return err
 				}
-				logrus.Infof("Current target: %s", clientConfig.Host)
+				logrus.WithFields(logrus.Fields{
+					"ca-file":   clientConfig.CAFile,
+					"cert-file": clientConfig.CertFile,
+					"token-set": clientConfig.Token != "",
+				}).Infof("Current target: %s", clientConfig.Host)
 				return nil
 			}
 			if host == "" {
 				return errors.New("--host must be set for target", nil)
 			}
-			if err := setClientConfig(host, port); err != nil {
+			if (certFile == "") != (keyFile == "") {
+				return errors.New("--cert-file and --key-file must be set together", nil)
+			}
+			if err := setClientConfig(config.ClientConfig{
+				Host:     fmt.Sprintf("%s:%v", host, port),
+				CAFile:   absPath(caFile),
+				CertFile: absPath(certFile),
+				KeyFile:  absPath(keyFile),
+				Token:    token,
+			}); err != nil {
 				return errors.New("failed to save target to config file", err)
 			}
 			logrus.Infof("target set: %s:%v", host, port)
@@ -71,19 +95,36 @@ args:
 	},
 }
 
-func setClientConfig(host string, port int) error {
-	data, err := yaml.Marshal(config.ClientConfig{Host: fmt.Sprintf("%s:%v", host, port)})
+func setClientConfig(c config.ClientConfig) error {
+	data, err := yaml.Marshal(c)
 	if err != nil {
 		return errors.New("failed to convert config to yaml string ", err)
 	}
 	os.MkdirAll(filepath.Dir(clientConfigFile), 0755)
-	if err := ioutil.WriteFile(clientConfigFile, data, 0644); err != nil {
+	// the file may hold a token
+	if err := ioutil.WriteFile(clientConfigFile, data, 0600); err != nil {
 		return errors.New("failed writing config to file "+clientConfigFile, err)
 	}
+	os.Chmod(clientConfigFile, 0600)
 	return nil
 }
 
+// absPath keeps file references valid when kernctl runs from another dir.
+func absPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
 func init() {
 	RootCmd.AddCommand(targetCmd)
 	targetCmd.Flags().BoolVar(&show, "show", false, "<bool,optional>: shows the current target that is set")
+	targetCmd.Flags().StringVar(&caFile, "ca-file", "", "<string,optional>: CA bundle for verifying the daemon certificate")
+	targetCmd.Flags().StringVar(&certFile, "cert-file", "", "<string,optional>: client certificate for mutual TLS")
+	targetCmd.Flags().StringVar(&keyFile, "key-file", "", "<string,optional>: client key for mutual TLS")
+	targetCmd.Flags().StringVar(&token, "token", "", "<string,optional>: bearer token for the daemon")
 }
@@ -21,6 +21,7 @@ package build
 // THE SOFTWARE.
 
 import (
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -34,6 +35,11 @@ type Config struct {
 	BuildTest     bool
 	KernelVersion string
 	GoArgs        []string
+
+	// Stdout and Stderr receive the output of the go tool, default to
+	// os.Stdout and os.Stderr
+	Stdout io.Writer
+	Stderr io.Writer
 }
 
 type Builder struct {
@@ -74,6 +80,29 @@ func (b *Builder) gobin() string {
 	return filepath.Join(b.cfg.GoRoot, "bin", "go")
 }
 
+// gocmd returns a go tool command running in the configured WorkDir.
+func (b *Builder) gocmd(args ...string) *exec.Cmd {
+	cmd := exec.Command(b.gobin(), args...)
+	if b.cfg.WorkDir != "" {
+		cmd.Dir = b.cfg.WorkDir
+	}
+	return cmd
+}
+
+func (b *Builder) stdout() io.Writer {
+	if b.cfg.Stdout == nil {
+		return os.Stdout
+	}
+	return b.cfg.Stdout
+}
+
+func (b *Builder) stderr() io.Writer {
+	if b.cfg.Stderr == nil {
+		return os.Stderr
+	}
+	return b.cfg.Stderr
+}
+
 func (b *Builder) fixGoTags() bool {
 	args := b.cfg.GoArgs
 	for i, arg := range args {
@@ -114,14 +143,13 @@ func (b *Builder) buildPkg() error {
 		"CGO_ENABLED=0",
 	}...)
 
-	cmd := exec.Command(b.gobin(), buildArgs...)
+	cmd := b.gocmd(buildArgs...)
 	cmd.Env = env
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if b.cfg.WorkDir != "" {
-		cmd.Dir = b.cfg.WorkDir
+	if b.cfg.Stdout == nil {
+		cmd.Stdin = os.Stdin
 	}
+	cmd.Stdout = b.stdout()
+	cmd.Stderr = b.stderr()
 	err := cmd.Run()
 	return err
 }
@@ -23,9 +23,9 @@ package build
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"text/template"
@@ -73,9 +73,11 @@ func (b *Builder) overlayFile() string {
 }
 
 func (b *Builder) buildPrepare() error {
-	var err error
-
-	if !b.modHasBhojpur() {
+	hasBhojpur, err := b.modHasBhojpur()
+	if err != nil {
+		return err
+	}
+	if !hasBhojpur {
 		log.Printf("bhojpur kernel not found in go.mod")
 		err = b.editGoMod()
 		if err != nil {
@@ -107,7 +109,7 @@ func writeOverlayFile(overlayFile, dest, source string) error {
 
 func (b *Builder) readGomodule() (*gomodule, error) {
 	var buf bytes.Buffer
-	cmd := exec.Command(b.gobin(), "mod", "edit", "-json")
+	cmd := b.gocmd("mod", "edit", "-json")
 	cmd.Stdout = &buf
 	err := cmd.Run()
 	if err != nil {
@@ -121,21 +123,25 @@ func (b *Builder) readGomodule() (*gomodule, error) {
 	return &mod, nil
 }
 
-func (b *Builder) modHasBhojpur() bool {
-	if b.currentModulePath() == bhojpurModulePath {
-		return true
+func (b *Builder) modHasBhojpur() (bool, error) {
+	modulePath, err := b.currentModulePath()
+	if err != nil {
+		return false, err
+	}
+	if modulePath == bhojpurModulePath {
+		return true, nil
 	}
 
 	mods, err := b.readGomodule()
 	if err != nil {
-		panic(err)
+		return false, err
 	}
 	for _, mod := range mods.Require {
 		if mod.Path == bhojpurModulePath {
-			return true
+			return true, nil
 		}
 	}
-	return false
+	return false, nil
 }
 
 func (b *Builder) editGoMod() error {
@@ -149,34 +155,36 @@ func (b *Builder) editGoMod() error {
 		"GOARCH=amd64",
 	}
 	env = append(env, os.Environ()...)
-	cmd := exec.Command(b.gobin(), "get", getPath)
+	cmd := b.gocmd("get", getPath)
 	cmd.Env = env
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = b.stdout()
+	cmd.Stderr = b.stderr()
 	return cmd.Run()
 }
 
-func (b *Builder) currentPkgName() string {
-	out, err := exec.Command(b.gobin(), "list", "-f", `{{.Name}}`).CombinedOutput()
+func (b *Builder) currentPkgName() (string, error) {
+	out, err := b.gocmd("list", "-f", `{{.Name}}`).CombinedOutput()
 	if err != nil {
-		log.Panicf("get current package name:%s", out)
+		return "", fmt.Errorf("get current package name:%s", out)
 	}
-	return strings.TrimSpace(string(out))
+	return strings.TrimSpace(string(out)), nil
 }
 
-func (b *Builder) currentModulePath() string {
-	out, err := exec.Command(b.gobin(), "list", "-f", `{{.Module.Path}}`).CombinedOutput()
+func (b *Builder) currentModulePath() (string, error) {
+	out, err := b.gocmd("list", "-f", `{{.Module.Path}}`).CombinedOutput()
 	if err != nil {
-		log.Panicf("get current module path:%s", out)
+		return "", fmt.Errorf("get current module path:%s", out)
 	}
-	return strings.TrimSpace(string(out))
-
+	return strings.TrimSpace(string(out)), nil
 }
 
 func (b *Builder) writeImportFile(fname string) error {
-	pkgname := b.currentPkgName()
+	pkgname, err := b.currentPkgName()
+	if err != nil {
+		return err
+	}
 	var rawFile bytes.Buffer
-	err := bhojpurImportTpl.Execute(&rawFile, map[string]interface{}{
+	err = bhojpurImportTpl.Execute(&rawFile, map[string]interface{}{
 		"name": pkgname,
 	})
 	if err != nil {
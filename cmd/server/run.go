@@ -27,6 +27,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/bhojpur/kernel/cmd/server/assets"
@@ -41,8 +42,18 @@ const (
 
 var (
 	ports []string
+	nic   string
+	disk  string
+	cpus  int
 )
 
+// nicDevices maps the --nic values to qemu network devices
+var nicDevices = map[string]string{
+	"e1000":             "e1000",
+	"virtio-net":        "virtio-net-pci",
+	"virtio-net-legacy": "virtio-net-pci,disable-modern=on",
+}
+
 // runCmd represents the run command
 var runCmd = &cobra.Command{
 	Use:   "run <kernel>",
@@ -56,6 +67,11 @@ var runCmd = &cobra.Command{
 }
 
 func runKernel(args []string) error {
+	nicDevice, ok := nicDevices[nic]
+	if !ok {
+		return fmt.Errorf("unknown nic %q, expected one of e1000, virtio-net, virtio-net-legacy", nic)
+	}
+
 	base, err := ioutil.TempDir("", "bhojpur-run")
 	if err != nil {
 		return err
@@ -102,8 +118,16 @@ func runKernel(args []string) error {
 	}
 
 	runArgs = append(runArgs, "-m", "256M", "-no-reboot", "-serial", "mon:stdio")
+	if cpus > 1 {
+		runArgs = append(runArgs, "-smp", strconv.Itoa(cpus))
+	}
 	runArgs = append(runArgs, "-netdev", "user,id=eth0"+portMapingArgs())
-	runArgs = append(runArgs, "-device", "e1000,netdev=eth0")
+	runArgs = append(runArgs, "-device", nicDevice+",netdev=eth0")
+	if disk != "" {
+		// shows up as blk://vda inside the kernel
+		runArgs = append(runArgs, "-drive", "file="+disk+",format=raw,if=none,id=disk0")
+		runArgs = append(runArgs, "-device", "virtio-blk-pci,drive=disk0")
+	}
 	runArgs = append(runArgs, "-device", "isa-debug-exit")
 	runArgs = append(runArgs, qemuArgs...)
 
@@ -163,4 +187,7 @@ func portMapingArgs() string {
 func init() {
 	rootCmd.AddCommand(runCmd)
 	runCmd.Flags().StringSliceVarP(&ports, "port", "p", nil, "port mapping from host to Bhojpur Kernel, format $host_port:$kernel_port")
+	runCmd.Flags().StringVar(&nic, "nic", "e1000", "network card to emulate: e1000, virtio-net or virtio-net-legacy")
+	runCmd.Flags().StringVar(&disk, "disk", "", "raw disk image to attach as a virtio-blk device")
+	runCmd.Flags().IntVar(&cpus, "cpus", 1, "number of cpus of the virtual machine")
 }
@@ -25,7 +25,9 @@ import (
 	"net/url"
 
 	"github.com/bhojpur/kernel/pkg/base/app"
+	"github.com/bhojpur/kernel/pkg/base/drivers/blk"
 	"github.com/bhojpur/kernel/pkg/base/fs"
+	"github.com/bhojpur/kernel/pkg/base/fs/fat"
 	"github.com/bhojpur/kernel/pkg/base/fs/smb"
 	"github.com/bhojpur/kernel/pkg/base/fs/stripprefix"
 )
@@ -42,6 +44,8 @@ func mountmain(ctx *app.Context) error {
 	switch uri.Scheme {
 	case "smb":
 		return mountsmb(uri, target)
+	case "blk":
+		return mountblk(uri, target)
 	default:
 		return errors.New("unsupported scheme " + uri.Scheme)
 	}
@@ -61,6 +65,26 @@ func mountsmb(uri *url.URL, target string) error {
 	return fs.Mount(target, stripprefix.New("/", smbfs))
 }
 
+// mountblk mounts the FAT32 filesystem of a block device, as in
+// blk://vda. With blk://vda?mkfs=1 a device without a filesystem is
+// formatted first.
+func mountblk(uri *url.URL, target string) error {
+	dev, err := blk.Get(uri.Host)
+	if err != nil {
+		return err
+	}
+	fatfs, err := fat.New(dev)
+	if err == fat.ErrNotFAT32 && uri.Query().Get("mkfs") != "" {
+		if err = fat.Format(dev, ""); err == nil {
+			fatfs, err = fat.New(dev)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return fs.Mount(target, fatfs)
+}
+
 func init() {
 	app.Register("mount", mountmain)
 }
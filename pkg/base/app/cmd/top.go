@@ -31,27 +31,49 @@ import (
 )
 
 func printstat(ctx *app.Context) {
-	var stat1, stat2 [20]int64
-	kernel.ThreadStat(&stat1)
+	stat1 := make([]kernel.ThreadCounter, kernel.NumThread())
+	cpu1 := make([]kernel.CPUCounter, kernel.NumCPU())
+	cpu2 := make([]kernel.CPUCounter, kernel.NumCPU())
+	kernel.ThreadStat(stat1)
+	kernel.CPUStat(cpu1)
 	time.Sleep(time.Second)
-	kernel.ThreadStat(&stat2)
+	// threads created meanwhile are left out
+	stat2 := make([]kernel.ThreadCounter, len(stat1))
+	kernel.ThreadStat(stat2)
+	kernel.CPUStat(cpu2)
 
 	var sum int64
 	for i := range stat1 {
-		sum += stat2[i] - stat1[i]
+		sum += stat2[i].Counter - stat1[i].Counter
 	}
 	var tids []string
 	var percents []string
+	var cpuids []string
 	for i := range stat1 {
-		if stat1[i] == 0 {
+		if stat1[i].Counter == 0 {
 			continue
 		}
-		tids = append(tids, fmt.Sprintf("%3d", i))
-		percent := int(float32(stat2[i]-stat1[i]) / float32(sum) * 100)
+		tids = append(tids, fmt.Sprintf("%3d", stat1[i].ID))
+		percent := int(float32(stat2[i].Counter-stat1[i].Counter) / float32(sum) * 100)
 		percents = append(percents, fmt.Sprintf("%3d", percent))
+		cpuids = append(cpuids, fmt.Sprintf("%3d", stat2[i].CPU))
 	}
 	fmt.Fprintf(ctx.Stdout, "%s\n", strings.Join(tids, " "))
-	fmt.Fprintf(ctx.Stdout, "%s\n\n", strings.Join(percents, " "))
+	fmt.Fprintf(ctx.Stdout, "%s\n", strings.Join(percents, " "))
+	fmt.Fprintf(ctx.Stdout, "%s\n", strings.Join(cpuids, " "))
+
+	// busy percent of each cpu, the idle thread does not count
+	var usage []string
+	for i := range cpu1 {
+		busy := cpu2[i].Busy - cpu1[i].Busy
+		total := busy + cpu2[i].Idle - cpu1[i].Idle
+		percent := 0
+		if total > 0 {
+			percent = int(busy * 100 / total)
+		}
+		usage = append(usage, fmt.Sprintf("cpu%d %3d%%", i, percent))
+	}
+	fmt.Fprintf(ctx.Stdout, "%s\n\n", strings.Join(usage, " "))
 }
 
 func topmain(ctx *app.Context) error {
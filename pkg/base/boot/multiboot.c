@@ -32,6 +32,10 @@ typedef unsigned long long uint64;
 
 #include "elf.h"
 #include "multiboot.h"
+#include "pvh.h"
+
+#define PVH_MAX_MODS 4
+#define PVH_MAX_MMAP 32
 
 extern char _binary_boot64_elf_start[];
 
@@ -39,6 +43,7 @@ void memcpy(char *dst, char *src, int count);
 void memset(char *addr, char data, int cnt);
 uint64 loadelf(char *image);
 uint64 loadKernelElf(multiboot_info_t *info);
+void multibootmain(unsigned long magic, multiboot_info_t *mbi);
 typedef void (*boot64_entry_t)(uint32, uint32, uint32);
 
 void multibootmain(unsigned long magic, multiboot_info_t *mbi)
@@ -61,6 +66,79 @@ void multibootmain(unsigned long magic, multiboot_info_t *mbi)
     boot64_entry((uint32)entry_addr, (uint32)magic, (uint32)mbi);
 }
 
+// the multiboot information pvhmain builds from the PVH start info
+multiboot_info_t pvh_mbi;
+multiboot_module_t pvh_mods[PVH_MAX_MODS];
+multiboot_memory_map_t pvh_mmap[PVH_MAX_MMAP];
+
+void pvhmain(struct hvm_start_info *si)
+{
+    multiboot_info_t *mbi = &pvh_mbi;
+    uint32 i, n;
+
+    if (si->magic != XEN_HVM_START_MAGIC)
+    {
+        return;
+    }
+
+    if (si->cmdline_paddr != 0)
+    {
+        mbi->flags |= MULTIBOOT_INFO_CMDLINE;
+        mbi->cmdline = (uint32)si->cmdline_paddr;
+    }
+
+    struct hvm_modlist_entry *mods = (struct hvm_modlist_entry *)(uint32)si->modlist_paddr;
+    n = si->nr_modules;
+    if (n > PVH_MAX_MODS)
+    {
+        n = PVH_MAX_MODS;
+    }
+    for (i = 0; i < n; i++)
+    {
+        pvh_mods[i].mod_start = (uint32)mods[i].paddr;
+        pvh_mods[i].mod_end = (uint32)(mods[i].paddr + mods[i].size);
+        pvh_mods[i].cmdline = (uint32)mods[i].cmdline_paddr;
+        pvh_mods[i].pad = 0;
+    }
+    mbi->flags |= MULTIBOOT_INFO_MODS;
+    mbi->mods_count = n;
+    mbi->mods_addr = (uint32)pvh_mods;
+
+    if (si->version >= 1 && si->memmap_paddr != 0)
+    {
+        struct hvm_memmap_table_entry *mem = (struct hvm_memmap_table_entry *)(uint32)si->memmap_paddr;
+        n = si->memmap_entries;
+        if (n > PVH_MAX_MMAP)
+        {
+            n = PVH_MAX_MMAP;
+        }
+        for (i = 0; i < n; i++)
+        {
+            pvh_mmap[i].size = sizeof(multiboot_memory_map_t) - sizeof(pvh_mmap[i].size);
+            pvh_mmap[i].addr = mem[i].addr;
+            pvh_mmap[i].len = mem[i].size;
+            pvh_mmap[i].type = mem[i].type;
+            if (mem[i].type != MULTIBOOT_MEMORY_AVAILABLE)
+            {
+                continue;
+            }
+            if (mem[i].addr == 0)
+            {
+                mbi->mem_lower = (uint32)(mem[i].size >> 10);
+            }
+            else if (mem[i].addr == 0x100000)
+            {
+                mbi->mem_upper = (uint32)(mem[i].size >> 10);
+            }
+        }
+        mbi->flags |= MULTIBOOT_INFO_MEMORY | MULTIBOOT_INFO_MEM_MAP;
+        mbi->mmap_addr = (uint32)pvh_mmap;
+        mbi->mmap_length = n * sizeof(multiboot_memory_map_t);
+    }
+
+    multibootmain(MULTIBOOT_BOOTLOADER_MAGIC, mbi);
+}
+
 uint64 loadelf(char *image)
 {
     struct elfhdr *elf;
@@ -0,0 +1,71 @@
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+
+// PVH is the boot protocol of Firecracker and Xen for kernels that aren't
+// Linux. The kernel is entered in 32-bit protected mode at the address
+// found in its XEN_ELFNOTE_PHYS32_ENTRY note, with %ebx pointing to the
+// start info below.
+//
+// https://xenbits.xen.org/docs/unstable/misc/pvh.html
+
+#ifndef PVH_HEADER
+#define PVH_HEADER 1
+
+#define XEN_ELFNOTE_PHYS32_ENTRY 18
+#define XEN_HVM_START_MAGIC 0x336ec578
+
+#ifndef ASM_FILE
+
+struct hvm_start_info
+{
+    multiboot_uint32_t magic;
+    multiboot_uint32_t version;
+    multiboot_uint32_t flags;
+    multiboot_uint32_t nr_modules;
+    multiboot_uint64_t modlist_paddr;
+    multiboot_uint64_t cmdline_paddr;
+    multiboot_uint64_t rsdp_paddr;
+    /* only valid from version 1 on */
+    multiboot_uint64_t memmap_paddr;
+    multiboot_uint32_t memmap_entries;
+    multiboot_uint32_t reserved;
+};
+
+struct hvm_modlist_entry
+{
+    multiboot_uint64_t paddr;
+    multiboot_uint64_t size;
+    multiboot_uint64_t cmdline_paddr;
+    multiboot_uint64_t reserved;
+};
+
+/* the types are those of the e820 map, which multiboot uses too */
+struct hvm_memmap_table_entry
+{
+    multiboot_uint64_t addr;
+    multiboot_uint64_t size;
+    multiboot_uint32_t type;
+    multiboot_uint32_t reserved;
+};
+
+#endif /* ! ASM_FILE */
+
+#endif /* ! PVH_HEADER */
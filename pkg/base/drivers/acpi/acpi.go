@@ -0,0 +1,161 @@
+package acpi
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package acpi finds the ACPI system description tables left in memory by
+// the firmware. Tables above the identity mapped memory are mapped on
+// demand, so it can be used before the Go runtime is initialised.
+
+import (
+	"unsafe"
+
+	"github.com/bhojpur/kernel/pkg/base/kernel/mm"
+)
+
+const (
+	// the RSDP is on a 16 byte boundary of the BIOS read-only area
+	biosStart = 0xe0000
+	biosEnd   = 0x100000
+)
+
+// Header is the common header of all system description tables.
+type Header struct {
+	Signature       [4]byte
+	Length          uint32
+	Revision        uint8
+	Checksum        uint8
+	OEMID           [6]byte
+	OEMTableID      [8]byte
+	OEMRevision     uint32
+	CreatorID       uint32
+	CreatorRevision uint32
+}
+
+type rsdp struct {
+	Signature   [8]byte
+	Checksum    uint8
+	OEMID       [6]byte
+	Revision    uint8
+	RsdtAddr    uint32
+	Length      uint32
+	XsdtAddr    uint64
+	ExtChecksum uint8
+	_           [3]byte
+}
+
+var (
+	// root is the RSDT or, on ACPI 2.0 and later, the XSDT
+	root *Header
+	// entrySize is the size of the table pointers following root
+	entrySize uintptr
+)
+
+//go:nosplit
+func mapPhys(addr, size uintptr) {
+	p := addr &^ (mm.PGSIZE - 1)
+	for ; p < addr+size; p += mm.PGSIZE {
+		if !mm.Mapped(p) {
+			mm.Fixmap(p, p, mm.PGSIZE)
+		}
+	}
+}
+
+//go:nosplit
+func checksum(addr, size uintptr) bool {
+	var sum uint8
+	for i := uintptr(0); i < size; i++ {
+		sum += *(*uint8)(unsafe.Pointer(addr + i))
+	}
+	return sum == 0
+}
+
+//go:nosplit
+func findRSDP() *rsdp {
+	const sig = "RSD PTR "
+	for p := uintptr(biosStart); p < biosEnd; p += 16 {
+		r := (*rsdp)(unsafe.Pointer(p))
+		if string(r.Signature[:]) != sig {
+			continue
+		}
+		if checksum(p, 20) {
+			return r
+		}
+	}
+	return nil
+}
+
+//go:nosplit
+func mapTable(addr uintptr) *Header {
+	if addr == 0 {
+		return nil
+	}
+	mapPhys(addr, unsafe.Sizeof(Header{}))
+	h := (*Header)(unsafe.Pointer(addr))
+	mapPhys(addr, uintptr(h.Length))
+	if !checksum(addr, uintptr(h.Length)) {
+		return nil
+	}
+	return h
+}
+
+// Init locates the root table and reports whether ACPI is available.
+//
+//go:nosplit
+func Init() bool {
+	r := findRSDP()
+	if r == nil {
+		return false
+	}
+	if r.Revision >= 2 && r.XsdtAddr != 0 {
+		root = mapTable(uintptr(r.XsdtAddr))
+		entrySize = 8
+	}
+	if root == nil {
+		root = mapTable(uintptr(r.RsdtAddr))
+		entrySize = 4
+	}
+	return root != nil
+}
+
+// FindTable returns the first table with the signature sig, or nil if the
+// firmware does not provide it.
+//
+//go:nosplit
+func FindTable(sig string) *Header {
+	if root == nil {
+		return nil
+	}
+	start := uintptr(unsafe.Pointer(root)) + unsafe.Sizeof(*root)
+	end := uintptr(unsafe.Pointer(root)) + uintptr(root.Length)
+	for p := start; p+entrySize <= end; p += entrySize {
+		var addr uintptr
+		if entrySize == 8 {
+			addr = uintptr(*(*uint64)(unsafe.Pointer(p)))
+		} else {
+			addr = uintptr(*(*uint32)(unsafe.Pointer(p)))
+		}
+		h := mapTable(addr)
+		if h != nil && string(h.Signature[:]) == sig {
+			return h
+		}
+	}
+	return nil
+}
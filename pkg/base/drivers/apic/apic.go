@@ -0,0 +1,430 @@
+package apic
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package apic drives the local APIC of each cpu and the IO APICs that
+// replace the 8259 PIC on multi-processor machines. The cpus and IO APICs
+// are found in the ACPI MADT.
+
+import (
+	"unsafe"
+
+	"github.com/bhojpur/kernel/pkg/base/drivers/acpi"
+	"github.com/bhojpur/kernel/pkg/base/kernel/mm"
+	"github.com/bhojpur/kernel/pkg/base/kernel/sys"
+)
+
+const (
+	MaxCPU = 32
+
+	SpuriousVector = 0xff
+)
+
+// local APIC registers
+const (
+	lapicID    = 0x020
+	lapicTPR   = 0x080
+	lapicEOI   = 0x0b0
+	lapicSVR   = 0x0f0
+	lapicESR   = 0x280
+	lapicICRLO = 0x300
+	lapicICRHI = 0x310
+	lapicTimer = 0x320
+	lapicLINT0 = 0x350
+	lapicLINT1 = 0x360
+	lapicError = 0x370
+	lapicTICR  = 0x380
+	lapicTCCR  = 0x390
+	lapicTDCR  = 0x3e0
+
+	svrEnable     = 0x100
+	lvtMasked     = 0x10000
+	lvtNMI        = 0x400
+	timerPeriodic = 0x20000
+	// divide the bus clock by 16
+	timerDiv16 = 0x3
+
+	icrInit       = 0x500
+	icrStartup    = 0x600
+	icrDelivs     = 0x1000
+	icrAssert     = 0x4000
+	icrLevel      = 0x8000
+	icrAllButSelf = 0xc0000
+)
+
+// IO APIC registers and redirection entry bits
+const (
+	ioregsel = 0x00
+	iowin    = 0x10
+
+	ioapicVer    = 0x01
+	ioapicRedtbl = 0x10
+
+	redMasked   = 0x10000
+	redLevel    = 0x8000
+	redActiveLo = 0x2000
+)
+
+// MADT entry types
+const (
+	madtLapic       = 0
+	madtIOApic      = 1
+	madtOverride    = 2
+	madtLapicAddr   = 5
+	madtLapicActive = 1
+)
+
+type madt struct {
+	acpi.Header
+	LapicAddr uint32
+	Flags     uint32
+}
+
+type ioapic struct {
+	base    uintptr
+	gsiBase uint32
+	pins    uint32
+}
+
+var (
+	enabled   bool
+	lapicBase uintptr
+	bspID     uint8
+
+	ids  [MaxCPU]uint8
+	ncpu int
+
+	ioapics  [8]ioapic
+	nioapics int
+
+	// the ISA irq to GSI mapping and MPS INTI flags from interrupt source
+	// overrides, identity and bus default when absent
+	isaGSI   [16]uint32
+	isaFlags [16]uint16
+
+	// ioapic registers are accessed through an index/data pair
+	iolock sys.Spinlock
+)
+
+//go:nosplit
+func read(reg uintptr) uint32 {
+	return *(*uint32)(unsafe.Pointer(lapicBase + reg))
+}
+
+//go:nosplit
+func write(reg uintptr, v uint32) {
+	*(*uint32)(unsafe.Pointer(lapicBase + reg)) = v
+	// wait for the write to finish by reading
+	read(lapicID)
+}
+
+//go:nosplit
+func mapMMIO(addr uintptr) {
+	if !mm.Mapped(addr) {
+		mm.Fixmap(addr, addr, mm.PGSIZE)
+	}
+}
+
+//go:nosplit
+func parseMADT(m *madt) {
+	lapicBase = uintptr(m.LapicAddr)
+	for i := range isaGSI {
+		isaGSI[i] = uint32(i)
+	}
+
+	p := uintptr(unsafe.Pointer(m)) + unsafe.Sizeof(*m)
+	end := uintptr(unsafe.Pointer(m)) + uintptr(m.Length)
+	for p+2 <= end {
+		typ := *(*uint8)(unsafe.Pointer(p))
+		length := uintptr(*(*uint8)(unsafe.Pointer(p + 1)))
+		if length < 2 {
+			break
+		}
+		switch typ {
+		case madtLapic:
+			id := *(*uint8)(unsafe.Pointer(p + 3))
+			flags := *(*uint32)(unsafe.Pointer(p + 4))
+			if flags&madtLapicActive != 0 && ncpu < MaxCPU {
+				ids[ncpu] = id
+				ncpu++
+			}
+		case madtIOApic:
+			if nioapics < len(ioapics) {
+				io := &ioapics[nioapics]
+				io.base = uintptr(*(*uint32)(unsafe.Pointer(p + 4)))
+				io.gsiBase = *(*uint32)(unsafe.Pointer(p + 8))
+				nioapics++
+			}
+		case madtOverride:
+			bus := *(*uint8)(unsafe.Pointer(p + 2))
+			src := *(*uint8)(unsafe.Pointer(p + 3))
+			if bus == 0 && int(src) < len(isaGSI) {
+				isaGSI[src] = *(*uint32)(unsafe.Pointer(p + 4))
+				isaFlags[src] = *(*uint16)(unsafe.Pointer(p + 8))
+			}
+		case madtLapicAddr:
+			lapicBase = uintptr(*(*uint64)(unsafe.Pointer(p + 4)))
+		}
+		p += length
+	}
+}
+
+// Init finds the local and IO APICs, masks every IO APIC pin and enables
+// the local APIC of the calling cpu, which becomes the boot cpu. It reports
+// false when the machine has no MADT, leaving the 8259 PIC in charge.
+//
+//go:nosplit
+func Init() bool {
+	if !acpi.Init() {
+		return false
+	}
+	m := (*madt)(unsafe.Pointer(acpi.FindTable("APIC")))
+	if m == nil {
+		return false
+	}
+	parseMADT(m)
+	if ncpu == 0 || nioapics == 0 {
+		return false
+	}
+
+	mapMMIO(lapicBase)
+	bspID = ID()
+	// keep the boot cpu first
+	for i := 1; i < ncpu; i++ {
+		if ids[i] == bspID {
+			ids[0], ids[i] = ids[i], ids[0]
+		}
+	}
+
+	for i := 0; i < nioapics; i++ {
+		io := &ioapics[i]
+		mapMMIO(io.base)
+		io.pins = (ioread(io, ioapicVer)>>16)&0xff + 1
+		for pin := uint32(0); pin < io.pins; pin++ {
+			iowrite(io, ioapicRedtbl+2*pin, redMasked)
+			iowrite(io, ioapicRedtbl+2*pin+1, 0)
+		}
+	}
+
+	InitCPU()
+	enabled = true
+	return true
+}
+
+// Enabled reports whether interrupts are delivered through the APICs.
+//
+//go:nosplit
+func Enabled() bool {
+	return enabled
+}
+
+// NumCPU returns the number of usable cpus found in the MADT.
+//
+//go:nosplit
+func NumCPU() int {
+	return ncpu
+}
+
+// CPUID returns the local APIC id of the i-th cpu, the boot cpu being 0.
+//
+//go:nosplit
+func CPUID(i int) uint8 {
+	return ids[i]
+}
+
+// ID returns the local APIC id of the calling cpu.
+//
+//go:nosplit
+func ID() uint8 {
+	return uint8(read(lapicID) >> 24)
+}
+
+// InitCPU enables the local APIC of the calling cpu.
+//
+//go:nosplit
+func InitCPU() {
+	write(lapicSVR, svrEnable|SpuriousVector)
+	write(lapicTimer, lvtMasked)
+	// the 8259 is not used, LINT1 carries NMIs
+	write(lapicLINT0, lvtMasked)
+	write(lapicLINT1, lvtNMI)
+	write(lapicError, lvtMasked)
+	// clear errors, the register has to be written twice
+	write(lapicESR, 0)
+	write(lapicESR, 0)
+	write(lapicEOI, 0)
+	write(lapicTPR, 0)
+}
+
+// EOI signals the end of the interrupt being serviced on the calling cpu.
+//
+//go:nosplit
+func EOI() {
+	write(lapicEOI, 0)
+}
+
+//go:nosplit
+func sendICR(id uint8, cmd uint32) {
+	write(lapicICRHI, uint32(id)<<24)
+	write(lapicICRLO, cmd)
+	for read(lapicICRLO)&icrDelivs != 0 {
+		sys.Pause()
+	}
+}
+
+// SendInit sends an INIT IPI to the cpu id.
+//
+//go:nosplit
+func SendInit(id uint8) {
+	sendICR(id, icrInit|icrLevel|icrAssert)
+}
+
+// SendStartup sends a STARTUP IPI that makes cpu id run the real mode code
+// at addr, which must be page aligned and below 1MB.
+//
+//go:nosplit
+func SendStartup(id uint8, addr uintptr) {
+	sendICR(id, icrStartup|uint32(addr>>12))
+}
+
+// SendIPI sends an interrupt with vector to the cpu id.
+//
+//go:nosplit
+func SendIPI(id uint8, vector uint8) {
+	sendICR(id, uint32(vector))
+}
+
+// BroadcastIPI sends an interrupt with vector to every cpu but the caller.
+//
+//go:nosplit
+func BroadcastIPI(vector uint8) {
+	sendICR(0, icrAllButSelf|uint32(vector))
+}
+
+// StartTimer makes the local timer of the calling cpu raise vector every
+// count ticks, as measured by CalibrateTimer.
+//
+//go:nosplit
+func StartTimer(vector uint8, count uint32) {
+	write(lapicTDCR, timerDiv16)
+	write(lapicTimer, timerPeriodic|uint32(vector))
+	write(lapicTICR, count)
+}
+
+// StartOneShot makes the local timer of the calling cpu raise vector once,
+// count ticks from now. It replaces any count already running.
+//
+//go:nosplit
+func StartOneShot(vector uint8, count uint32) {
+	write(lapicTDCR, timerDiv16)
+	write(lapicTimer, uint32(vector))
+	write(lapicTICR, count)
+}
+
+// CalibrateTimer returns the number of local timer ticks elapsed during
+// wait.
+//
+//go:nosplit
+func CalibrateTimer(wait func()) uint32 {
+	write(lapicTDCR, timerDiv16)
+	write(lapicTimer, lvtMasked)
+	write(lapicTICR, 0xffffffff)
+	wait()
+	n := 0xffffffff - read(lapicTCCR)
+	write(lapicTICR, 0)
+	return n
+}
+
+//go:nosplit
+func ioread(io *ioapic, reg uint32) uint32 {
+	*(*uint32)(unsafe.Pointer(io.base + ioregsel)) = reg
+	return *(*uint32)(unsafe.Pointer(io.base + iowin))
+}
+
+//go:nosplit
+func iowrite(io *ioapic, reg, v uint32) {
+	*(*uint32)(unsafe.Pointer(io.base + ioregsel)) = reg
+	*(*uint32)(unsafe.Pointer(io.base + iowin)) = v
+}
+
+//go:nosplit
+func findIOApic(gsi uint32) *ioapic {
+	for i := 0; i < nioapics; i++ {
+		io := &ioapics[i]
+		if gsi >= io.gsiBase && gsi < io.gsiBase+io.pins {
+			return io
+		}
+	}
+	return nil
+}
+
+// redirection returns the IO APIC pin of the legacy irq line together with
+// its trigger mode and polarity.
+//
+//go:nosplit
+func redirection(line uint16) (*ioapic, uint32, uint32) {
+	gsi := uint32(line)
+	var flags uint32
+	if int(line) < len(isaGSI) {
+		gsi = isaGSI[line]
+		// MPS INTI flags, 0 means the ISA default of edge and active high
+		inti := isaFlags[line]
+		if inti&0x3 == 0x3 {
+			flags |= redActiveLo
+		}
+		if inti&0xc == 0xc {
+			flags |= redLevel
+		}
+	}
+	io := findIOApic(gsi)
+	if io == nil {
+		return nil, 0, 0
+	}
+	return io, gsi - io.gsiBase, flags
+}
+
+// EnableIRQ routes the legacy irq line to vector on the boot cpu.
+//
+//go:nosplit
+func EnableIRQ(line uint16, vector uint8) {
+	io, pin, flags := redirection(line)
+	if io == nil {
+		return
+	}
+	iolock.Lock()
+	iowrite(io, ioapicRedtbl+2*pin+1, uint32(bspID)<<24)
+	iowrite(io, ioapicRedtbl+2*pin, flags|uint32(vector))
+	iolock.Unlock()
+}
+
+// DisableIRQ masks the legacy irq line.
+//
+//go:nosplit
+func DisableIRQ(line uint16) {
+	io, pin, _ := redirection(line)
+	if io == nil {
+		return
+	}
+	iolock.Lock()
+	v := ioread(io, ioapicRedtbl+2*pin)
+	iowrite(io, ioapicRedtbl+2*pin, v|redMasked)
+	iolock.Unlock()
+}
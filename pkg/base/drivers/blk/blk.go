@@ -0,0 +1,228 @@
+package blk
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package blk is the block device layer of the kernel. Block drivers
+// register their disks here and filesystems look them up by name.
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// SectorSize is the unit block devices are addressed in.
+const SectorSize = 512
+
+var (
+	ErrNotFound   = errors.New("block device not found")
+	ErrReadOnly   = errors.New("block device is read only")
+	ErrOutOfRange = errors.New("access beyond end of block device")
+)
+
+// Device is a disk addressed in sectors of SectorSize bytes.
+type Device interface {
+	Name() string
+	// Sectors returns the capacity of the device.
+	Sectors() uint64
+	ReadOnly() bool
+	// ReadSectors and WriteSectors transfer len(buf) bytes, which must be
+	// a multiple of SectorSize, starting at sector.
+	ReadSectors(sector uint64, buf []byte) error
+	WriteSectors(sector uint64, buf []byte) error
+	// Flush makes completed writes durable.
+	Flush() error
+}
+
+var (
+	devicesLock sync.Mutex
+	devices     []Device
+)
+
+// Register makes d available to Get.
+func Register(d Device) {
+	devicesLock.Lock()
+	defer devicesLock.Unlock()
+	devices = append(devices, d)
+}
+
+// Get returns the registered device called name.
+func Get(name string) (Device, error) {
+	devicesLock.Lock()
+	defer devicesLock.Unlock()
+	for _, d := range devices {
+		if d.Name() == name {
+			return d, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Devices returns all registered devices.
+func Devices() []Device {
+	devicesLock.Lock()
+	defer devicesLock.Unlock()
+	return append([]Device(nil), devices...)
+}
+
+// ReadWriterAt gives byte granular access to a device.
+type ReadWriterAt interface {
+	io.ReaderAt
+	io.WriterAt
+	// Size returns the size of the device in bytes.
+	Size() int64
+	Flush() error
+}
+
+// NewReadWriterAt wraps d. Unaligned writes read the partial sectors
+// first. The result is not safe for concurrent use.
+func NewReadWriterAt(d Device) ReadWriterAt {
+	return &readWriterAt{dev: d}
+}
+
+type readWriterAt struct {
+	dev Device
+	buf [SectorSize]byte
+}
+
+func (r *readWriterAt) Size() int64 {
+	return int64(r.dev.Sectors()) * SectorSize
+}
+
+func (r *readWriterAt) Flush() error {
+	return r.dev.Flush()
+}
+
+func (r *readWriterAt) check(off int64, n int) error {
+	if off < 0 || off+int64(n) > r.Size() {
+		return ErrOutOfRange
+	}
+	return nil
+}
+
+func (r *readWriterAt) ReadAt(p []byte, off int64) (int, error) {
+	if err := r.check(off, len(p)); err != nil {
+		return 0, err
+	}
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		sector, skip := uint64(pos/SectorSize), int(pos%SectorSize)
+		// whole sectors go straight into p
+		if whole := (len(p) - n) / SectorSize * SectorSize; skip == 0 && whole > 0 {
+			if err := r.dev.ReadSectors(sector, p[n:n+whole]); err != nil {
+				return n, err
+			}
+			n += whole
+			continue
+		}
+		if err := r.dev.ReadSectors(sector, r.buf[:]); err != nil {
+			return n, err
+		}
+		n += copy(p[n:], r.buf[skip:])
+	}
+	return n, nil
+}
+
+func (r *readWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	if r.dev.ReadOnly() {
+		return 0, ErrReadOnly
+	}
+	if err := r.check(off, len(p)); err != nil {
+		return 0, err
+	}
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		sector, skip := uint64(pos/SectorSize), int(pos%SectorSize)
+		if whole := (len(p) - n) / SectorSize * SectorSize; skip == 0 && whole > 0 {
+			if err := r.dev.WriteSectors(sector, p[n:n+whole]); err != nil {
+				return n, err
+			}
+			n += whole
+			continue
+		}
+		if err := r.dev.ReadSectors(sector, r.buf[:]); err != nil {
+			return n, err
+		}
+		m := copy(r.buf[skip:], p[n:])
+		if err := r.dev.WriteSectors(sector, r.buf[:]); err != nil {
+			return n, err
+		}
+		n += m
+	}
+	return n, nil
+}
+
+// MemDevice is a device backed by memory, used for ramdisks and tests.
+type MemDevice struct {
+	name string
+	data []byte
+}
+
+// NewMemDevice returns a zeroed device of the given number of sectors.
+func NewMemDevice(name string, sectors uint64) *MemDevice {
+	return &MemDevice{
+		name: name,
+		data: make([]byte, sectors*SectorSize),
+	}
+}
+
+func (m *MemDevice) Name() string {
+	return m.name
+}
+
+func (m *MemDevice) Sectors() uint64 {
+	return uint64(len(m.data) / SectorSize)
+}
+
+func (m *MemDevice) ReadOnly() bool {
+	return false
+}
+
+func (m *MemDevice) rangeOf(sector uint64, n int) ([]byte, error) {
+	if n%SectorSize != 0 || sector+uint64(n/SectorSize) > m.Sectors() {
+		return nil, ErrOutOfRange
+	}
+	off := sector * SectorSize
+	return m.data[off : off+uint64(n)], nil
+}
+
+func (m *MemDevice) ReadSectors(sector uint64, buf []byte) error {
+	b, err := m.rangeOf(sector, len(buf))
+	if err != nil {
+		return err
+	}
+	copy(buf, b)
+	return nil
+}
+
+func (m *MemDevice) WriteSectors(sector uint64, buf []byte) error {
+	b, err := m.rangeOf(sector, len(buf))
+	if err != nil {
+		return err
+	}
+	copy(b, buf)
+	return nil
+}
+
+func (m *MemDevice) Flush() error {
+	return nil
+}
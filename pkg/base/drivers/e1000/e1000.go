@@ -237,6 +237,7 @@ func (d *driver) Init(dev *pci.Device) error {
 	d.readmac()
 	log.Infof("[e1000] mac:%x", d.mac)
 	// go d.recvloop()
+	inet.RegisterDevice(d)
 	return nil
 }
 
@@ -324,7 +325,5 @@ func (d *driver) readpkt() bool {
 }
 
 func init() {
-	d := newDriver()
-	inet.RegisterDevice(d)
-	pci.Register(d)
+	pci.Register(newDriver())
 }
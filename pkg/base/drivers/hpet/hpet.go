@@ -0,0 +1,124 @@
+package hpet
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package hpet reads the main counter of the High Precision Event Timer
+// described by the ACPI HPET table. The comparators are left alone, the
+// counter is only used as a clocksource and to calibrate the TSC.
+
+import (
+	"unsafe"
+
+	"github.com/bhojpur/kernel/pkg/base/drivers/acpi"
+	"github.com/bhojpur/kernel/pkg/base/kernel/mm"
+)
+
+// registers
+const (
+	regCap     = 0x000
+	regConfig  = 0x010
+	regCounter = 0x0f0
+
+	capCount64 = 1 << 13
+	cfgEnable  = 1
+
+	// the specification caps the tick at 100ns
+	maxPeriod = 100000000
+)
+
+type table struct {
+	acpi.Header
+	BlockID uint32
+	// the generic address structure of the register block
+	AddressSpace uint8
+	BitWidth     uint8
+	BitOffset    uint8
+	AccessSize   uint8
+	AddressLo    uint32
+	AddressHi    uint32
+}
+
+var (
+	enabled bool
+	base    uintptr
+	// femtoseconds per counter tick
+	period uint32
+)
+
+//go:nosplit
+func read(reg uintptr) uint64 {
+	return *(*uint64)(unsafe.Pointer(base + reg))
+}
+
+//go:nosplit
+func write(reg uintptr, v uint64) {
+	*(*uint64)(unsafe.Pointer(base + reg)) = v
+}
+
+// Init finds the HPET and starts its main counter. It reports false when
+// the firmware doesn't describe one or its counter is only 32 bits wide.
+// acpi.Init must have been called.
+//
+//go:nosplit
+func Init() bool {
+	t := (*table)(unsafe.Pointer(acpi.FindTable("HPET")))
+	// only memory mapped register blocks exist in practice
+	if t == nil || t.AddressSpace != 0 {
+		return false
+	}
+	base = uintptr(t.AddressHi)<<32 | uintptr(t.AddressLo)
+	if !mm.Mapped(base) {
+		mm.Fixmap(base, base, mm.PGSIZE)
+	}
+	caps := read(regCap)
+	if caps&capCount64 == 0 {
+		return false
+	}
+	period = uint32(caps >> 32)
+	if period == 0 || period > maxPeriod {
+		return false
+	}
+	// leave the legacy replacement route off, the PIT keeps irq 0
+	write(regConfig, read(regConfig)|cfgEnable)
+	enabled = true
+	return true
+}
+
+// Enabled reports whether Init found a usable HPET.
+//
+//go:nosplit
+func Enabled() bool {
+	return enabled
+}
+
+// Period returns the length of a counter tick in femtoseconds.
+//
+//go:nosplit
+func Period() uint32 {
+	return period
+}
+
+// Counter returns the main counter.
+//
+//go:nosplit
+func Counter() uint64 {
+	return read(regCounter)
+}
@@ -48,8 +48,11 @@ func (a Address) ReadBAR(bar uint8) (addr, len uint32, prefetch, isMem bool) {
 		// 16-bit address. Not used.
 		return 0, 0, false, false
 	case 0b10:
-		// 64-bit address.
-		return 0, 0, false, false
+		// 64-bit address, only usable when it lies below 4GB.
+		if bar == 0x5 || a.ReadPCIRegister(reg+4) != 0 {
+			return 0, 0, false, false
+		}
+		fallthrough
 	case 0b00:
 		a.WritePCIRegister(reg, 0xffffffff)
 		len = ^(a.ReadPCIRegister(reg) & 0xfffffff0) + 1
@@ -63,6 +66,24 @@ func (a Address) ReadCapOffset() uint8 {
 	return uint8(a.ReadPCIRegister(0x34)) &^ 0x3
 }
 
+// ReadCapabilities returns the config space offsets of the capabilities
+// with the given id.
+func (a Address) ReadCapabilities(id uint8) []uint8 {
+	var offsets []uint8
+	if a.ReadStatus()&(1<<4) == 0 {
+		return nil
+	}
+	// guard against malformed lists that loop
+	for off, n := a.ReadCapOffset(), 0; off != 0 && n < 48; n++ {
+		reg := a.ReadPCIRegister(off)
+		if uint8(reg) == id {
+			offsets = append(offsets, off)
+		}
+		off = uint8(reg>>8) &^ 0x3
+	}
+	return offsets
+}
+
 func (a Address) ReadStatus() uint16 {
 	return uint16(a.ReadPCIRegister(0x4) >> 16)
 }
@@ -20,7 +20,10 @@ package pic
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
-import "github.com/bhojpur/kernel/pkg/base/kernel/sys"
+import (
+	"github.com/bhojpur/kernel/pkg/base/drivers/apic"
+	"github.com/bhojpur/kernel/pkg/base/kernel/sys"
+)
 
 const (
 	PIC1_CMD  = 0x20
@@ -38,6 +41,15 @@ const (
 	LINE_COM1  = 4
 	LINE_COM2  = 3
 	LINE_MOUSE = 12
+
+	// the IO APIC has 24 lines, the 8259 pair 16
+	MAX_LINES = 24
+)
+
+var (
+	// lines masked by Defer until their handler calls EOI
+	deferred uint32
+	lock     sys.Spinlock
 )
 
 //go:nosplit
@@ -67,8 +79,20 @@ func Init() {
 	EnableIRQ(0x02)
 }
 
+// Disable masks every line of the 8259 pair once the APICs take over.
+//
+//go:nosplit
+func Disable() {
+	sys.Outb(PIC1_DATA, 0xff)
+	sys.Outb(PIC2_DATA, 0xff)
+}
+
 //go:nosplit
 func EnableIRQ(line uint16) {
+	if apic.Enabled() {
+		apic.EnableIRQ(line, byte(IRQ_BASE+line))
+		return
+	}
 	var port uint16 = PIC1_DATA
 	if line >= 8 {
 		port = PIC2_DATA
@@ -79,6 +103,10 @@ func EnableIRQ(line uint16) {
 
 //go:nosplit
 func DisableIRQ(line uint16) {
+	if apic.Enabled() {
+		apic.DisableIRQ(line)
+		return
+	}
 	var port uint16 = PIC1_DATA
 	if line >= 8 {
 		port = PIC2_DATA
@@ -87,8 +115,39 @@ func DisableIRQ(line uint16) {
 	sys.Outb(port, byte(sys.Inb(port)|(1<<line)))
 }
 
+// Defer is called on the trap path for an irq whose handler runs later on
+// the trap thread, maybe on another cpu. The local APIC must see the EOI on
+// the cpu that took the interrupt, so the line is masked and acknowledged
+// here and unmasked again by the EOI of the handler.
+//
+//go:nosplit
+func Defer(irq uintptr) {
+	if !apic.Enabled() {
+		return
+	}
+	line := uint16(irq - IRQ_BASE)
+	lock.Lock()
+	apic.DisableIRQ(line)
+	deferred |= 1 << line
+	lock.Unlock()
+	apic.EOI()
+}
+
 //go:nosplit
 func EOI(irq uintptr) {
+	if apic.Enabled() {
+		line := uint16(irq - IRQ_BASE)
+		lock.Lock()
+		if deferred&(1<<line) == 0 {
+			lock.Unlock()
+			apic.EOI()
+			return
+		}
+		deferred &^= 1 << line
+		apic.EnableIRQ(line, byte(irq))
+		lock.Unlock()
+		return
+	}
 	if irq >= 0x28 {
 		sys.Outb(PIC2_CMD, 0x20)
 	}
@@ -0,0 +1,200 @@
+package virtio
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/bhojpur/kernel/pkg/base/kernel/mm"
+	"github.com/bhojpur/kernel/pkg/base/kernel/sys"
+)
+
+const (
+	descFlagNext  = 1
+	descFlagWrite = 2
+
+	availFlagNoInterrupt = 1
+	usedFlagNoNotify     = 1
+)
+
+type desc struct {
+	addr  uint64
+	len   uint32
+	flags uint16
+	next  uint16
+}
+
+type usedElem struct {
+	id  uint32
+	len uint32
+}
+
+// Buffer is a physically contiguous piece of memory handed to the device.
+type Buffer struct {
+	Addr uintptr
+	Len  int
+	// Write marks buffers the device writes into instead of reading.
+	Write bool
+}
+
+// Queue is a split virtqueue. Requests are chains of descriptors whose
+// head identifies them until the device hands them back. A Queue is not
+// safe for concurrent use.
+type Queue struct {
+	idx  uint16
+	size uint16
+	t    Transport
+
+	desc, avail, used uintptr
+
+	descs     []desc
+	availRing []uint16
+	usedRing  []usedElem
+
+	availFlags uint16
+	availIdx   uint16
+	lastUsed   uint16
+
+	freeHead uint16
+	numFree  uint16
+}
+
+func pageAlign(n uintptr) uintptr {
+	return (n + sys.PageSize - 1) &^ (sys.PageSize - 1)
+}
+
+// newQueue allocates a queue in the layout the legacy interface expects:
+// the descriptor table and the available ring, followed by the used ring
+// on the next page boundary. Modern devices accept it too.
+func newQueue(idx, size uint16, t Transport) *Queue {
+	n := uintptr(size)
+	usedOff := pageAlign(16*n + 6 + 2*n)
+	total := usedOff + pageAlign(6+8*n)
+	base := mm.AllocContig(int(total / sys.PageSize))
+
+	q := &Queue{
+		idx:     idx,
+		size:    size,
+		t:       t,
+		desc:    base,
+		avail:   base + 16*n,
+		used:    base + usedOff,
+		numFree: size,
+	}
+	q.descs = (*[1 << 15]desc)(unsafe.Pointer(q.desc))[:size:size]
+	q.availRing = (*[1 << 15]uint16)(unsafe.Pointer(q.avail + 4))[:size:size]
+	q.usedRing = (*[1 << 15]usedElem)(unsafe.Pointer(q.used + 4))[:size:size]
+	for i := range q.descs[:size-1] {
+		q.descs[i].next = uint16(i + 1)
+	}
+	return q
+}
+
+// Size returns the number of descriptors in the queue.
+func (q *Queue) Size() int {
+	return int(q.size)
+}
+
+// NumFree returns the number of descriptors not owned by the device.
+func (q *Queue) NumFree() int {
+	return int(q.numFree)
+}
+
+// publishAvail writes the flags and index of the available ring in one
+// store, which is also a full memory barrier.
+func (q *Queue) publishAvail() {
+	atomic.StoreUint32((*uint32)(unsafe.Pointer(q.avail)), uint32(q.availIdx)<<16|uint32(q.availFlags))
+}
+
+func (q *Queue) loadUsed() (flags, idx uint16) {
+	v := atomic.LoadUint32((*uint32)(unsafe.Pointer(q.used)))
+	return uint16(v), uint16(v >> 16)
+}
+
+// DisableInterrupts asks the device not to interrupt when it returns
+// requests of this queue; the driver polls them instead.
+func (q *Queue) DisableInterrupts() {
+	q.availFlags |= availFlagNoInterrupt
+	q.publishAvail()
+}
+
+// Add chains bufs into one request and makes it available to the device.
+// It returns the head of the chain, or false if the queue is short of
+// descriptors. The device is not notified until Kick.
+func (q *Queue) Add(bufs ...Buffer) (uint16, bool) {
+	if len(bufs) == 0 || len(bufs) > int(q.numFree) {
+		return 0, false
+	}
+	head := q.freeHead
+	i := head
+	for n, b := range bufs {
+		d := &q.descs[i]
+		d.addr = uint64(b.Addr)
+		d.len = uint32(b.Len)
+		d.flags = 0
+		if b.Write {
+			d.flags |= descFlagWrite
+		}
+		if n < len(bufs)-1 {
+			d.flags |= descFlagNext
+			i = d.next
+		}
+	}
+	q.freeHead = q.descs[i].next
+	q.numFree -= uint16(len(bufs))
+
+	q.availRing[q.availIdx%q.size] = head
+	q.availIdx++
+	q.publishAvail()
+	return head, true
+}
+
+// Kick notifies the device of newly available requests, unless it asked
+// not to be notified.
+func (q *Queue) Kick() {
+	if flags, _ := q.loadUsed(); flags&usedFlagNoNotify != 0 {
+		return
+	}
+	q.t.Notify(q.idx)
+}
+
+// Pop returns the head of the next request the device is done with and
+// the number of bytes it wrote into the request, and frees its
+// descriptors.
+func (q *Queue) Pop() (head uint16, written int, ok bool) {
+	if _, idx := q.loadUsed(); idx == q.lastUsed {
+		return 0, 0, false
+	}
+	e := q.usedRing[q.lastUsed%q.size]
+	q.lastUsed++
+
+	head = uint16(e.id)
+	i, n := head, uint16(1)
+	for q.descs[i].flags&descFlagNext != 0 {
+		i = q.descs[i].next
+		n++
+	}
+	q.descs[i].next = q.freeHead
+	q.freeHead = head
+	q.numFree += n
+	return head, int(e.len), true
+}
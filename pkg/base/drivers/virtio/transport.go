@@ -0,0 +1,316 @@
+package virtio
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/bhojpur/kernel/pkg/base/drivers/pci"
+	"github.com/bhojpur/kernel/pkg/base/kernel/mm"
+	"github.com/bhojpur/kernel/pkg/base/kernel/sys"
+)
+
+// Transport is the way a driver reaches the registers of a virtio device.
+type Transport interface {
+	// Modern reports whether the device is driven through the virtio 1.0
+	// interface rather than the legacy one.
+	Modern() bool
+	Reset()
+	Status() uint8
+	SetStatus(status uint8)
+	Features() uint64
+	SetFeatures(features uint64)
+	// QueueSize returns the maximum size of queue idx, 0 if the device
+	// does not have it.
+	QueueSize(idx uint16) uint16
+	ActivateQueue(idx, size uint16, desc, avail, used uintptr)
+	Notify(idx uint16)
+	// ISR reads and acknowledges the interrupt status.
+	ISR() uint8
+	ConfigRead8(off uintptr) uint8
+	ConfigRead16(off uintptr) uint16
+	ConfigRead32(off uintptr) uint32
+}
+
+// PCI capability describing the virtio 1.0 register layout.
+const (
+	pciCapVendor = 0x09
+
+	capCommonCfg = 1
+	capNotifyCfg = 2
+	capISRCfg    = 3
+	capDeviceCfg = 4
+)
+
+// NewTransport picks the modern transport when the device advertises the
+// virtio 1.0 capabilities and falls back to the legacy I/O port one.
+func NewTransport(dev *pci.Device) (Transport, error) {
+	if t := newModernTransport(dev); t != nil {
+		return t, nil
+	}
+	addr, _, _, ismem := dev.Addr.ReadBAR(0)
+	if ismem || addr == 0 {
+		return nil, errors.New("no usable virtio transport")
+	}
+	return &legacyTransport{port: uint16(addr)}, nil
+}
+
+// Legacy register offsets in the I/O BAR.
+const (
+	legacyDeviceFeatures = 0x00
+	legacyDriverFeatures = 0x04
+	legacyQueuePFN       = 0x08
+	legacyQueueSize      = 0x0c
+	legacyQueueSelect    = 0x0e
+	legacyQueueNotify    = 0x10
+	legacyStatus         = 0x12
+	legacyISR            = 0x13
+	// device config follows the common header when MSI-X is disabled
+	legacyConfig = 0x14
+)
+
+type legacyTransport struct {
+	port uint16
+}
+
+func (t *legacyTransport) Modern() bool {
+	return false
+}
+
+func (t *legacyTransport) Reset() {
+	sys.Outb(t.port+legacyStatus, 0)
+}
+
+func (t *legacyTransport) Status() uint8 {
+	return sys.Inb(t.port + legacyStatus)
+}
+
+func (t *legacyTransport) SetStatus(status uint8) {
+	sys.Outb(t.port+legacyStatus, status)
+}
+
+func (t *legacyTransport) Features() uint64 {
+	return uint64(sys.Inl(t.port + legacyDeviceFeatures))
+}
+
+func (t *legacyTransport) SetFeatures(features uint64) {
+	sys.Outl(t.port+legacyDriverFeatures, uint32(features))
+}
+
+func (t *legacyTransport) QueueSize(idx uint16) uint16 {
+	sys.Outw(t.port+legacyQueueSelect, idx)
+	return sys.Inw(t.port + legacyQueueSize)
+}
+
+func (t *legacyTransport) ActivateQueue(idx, size uint16, desc, avail, used uintptr) {
+	// the legacy layout is implied by the queue size and the address of
+	// the descriptor table, see newQueue.
+	sys.Outw(t.port+legacyQueueSelect, idx)
+	sys.Outl(t.port+legacyQueuePFN, uint32(desc/sys.PageSize))
+}
+
+func (t *legacyTransport) Notify(idx uint16) {
+	sys.Outw(t.port+legacyQueueNotify, idx)
+}
+
+func (t *legacyTransport) ISR() uint8 {
+	return sys.Inb(t.port + legacyISR)
+}
+
+func (t *legacyTransport) ConfigRead8(off uintptr) uint8 {
+	return sys.Inb(t.port + legacyConfig + uint16(off))
+}
+
+func (t *legacyTransport) ConfigRead16(off uintptr) uint16 {
+	return sys.Inw(t.port + legacyConfig + uint16(off))
+}
+
+func (t *legacyTransport) ConfigRead32(off uintptr) uint32 {
+	return sys.Inl(t.port + legacyConfig + uint16(off))
+}
+
+// Modern common configuration offsets.
+const (
+	commonDeviceFeatureSelect = 0x00
+	commonDeviceFeature       = 0x04
+	commonDriverFeatureSelect = 0x08
+	commonDriverFeature       = 0x0c
+	commonStatus              = 0x14
+	commonQueueSelect         = 0x16
+	commonQueueSize           = 0x18
+	commonQueueEnable         = 0x1c
+	commonQueueNotifyOff      = 0x1e
+	commonQueueDesc           = 0x20
+	commonQueueDriver         = 0x28
+	commonQueueDevice         = 0x30
+)
+
+type modernTransport struct {
+	common, notify, isr, device uintptr
+	notifyMultiplier            uint32
+	// notify addresses of the activated queues, looked up once so that
+	// notifying does not race with other users of the queue select
+	notifyAddrs map[uint16]uintptr
+}
+
+func newModernTransport(dev *pci.Device) *modernTransport {
+	t := &modernTransport{
+		notifyAddrs: map[uint16]uintptr{},
+	}
+	mapped := map[uint8]uintptr{}
+	for _, off := range dev.Addr.ReadCapabilities(pciCapVendor) {
+		header := dev.Addr.ReadPCIRegister(off)
+		bar := uint8(dev.Addr.ReadPCIRegister(off + 4))
+		offset := dev.Addr.ReadPCIRegister(off + 8)
+		typ := uint8(header >> 24)
+		if bar > 5 || typ < capCommonCfg || typ > capDeviceCfg {
+			continue
+		}
+		base, ok := mapped[bar]
+		if !ok {
+			addr, blen, _, ismem := dev.Addr.ReadBAR(bar)
+			if !ismem || addr == 0 {
+				continue
+			}
+			base = uintptr(addr)
+			mm.SysFixedMmap(base, base, uintptr(blen))
+			mapped[bar] = base
+		}
+		// the first capability of each type is the preferred one
+		addr := base + uintptr(offset)
+		switch {
+		case typ == capCommonCfg && t.common == 0:
+			t.common = addr
+		case typ == capNotifyCfg && t.notify == 0:
+			t.notify = addr
+			t.notifyMultiplier = dev.Addr.ReadPCIRegister(off + 16)
+		case typ == capISRCfg && t.isr == 0:
+			t.isr = addr
+		case typ == capDeviceCfg && t.device == 0:
+			t.device = addr
+		}
+	}
+	if t.common == 0 || t.notify == 0 || t.isr == 0 {
+		return nil
+	}
+	return t
+}
+
+func (t *modernTransport) read8(addr uintptr) uint8 {
+	return *(*uint8)(unsafe.Pointer(addr))
+}
+
+func (t *modernTransport) write8(addr uintptr, v uint8) {
+	*(*uint8)(unsafe.Pointer(addr)) = v
+}
+
+func (t *modernTransport) read16(addr uintptr) uint16 {
+	return *(*uint16)(unsafe.Pointer(addr))
+}
+
+func (t *modernTransport) write16(addr uintptr, v uint16) {
+	*(*uint16)(unsafe.Pointer(addr)) = v
+}
+
+func (t *modernTransport) read32(addr uintptr) uint32 {
+	return atomic.LoadUint32((*uint32)(unsafe.Pointer(addr)))
+}
+
+func (t *modernTransport) write32(addr uintptr, v uint32) {
+	atomic.StoreUint32((*uint32)(unsafe.Pointer(addr)), v)
+}
+
+func (t *modernTransport) write64(addr uintptr, v uint64) {
+	t.write32(addr, uint32(v))
+	t.write32(addr+4, uint32(v>>32))
+}
+
+func (t *modernTransport) Modern() bool {
+	return true
+}
+
+func (t *modernTransport) Reset() {
+	t.write8(t.common+commonStatus, 0)
+	// the reset is complete once the status reads back as zero
+	for t.read8(t.common+commonStatus) != 0 {
+	}
+}
+
+func (t *modernTransport) Status() uint8 {
+	return t.read8(t.common + commonStatus)
+}
+
+func (t *modernTransport) SetStatus(status uint8) {
+	t.write8(t.common+commonStatus, status)
+}
+
+func (t *modernTransport) Features() uint64 {
+	t.write32(t.common+commonDeviceFeatureSelect, 0)
+	lo := t.read32(t.common + commonDeviceFeature)
+	t.write32(t.common+commonDeviceFeatureSelect, 1)
+	hi := t.read32(t.common + commonDeviceFeature)
+	return uint64(hi)<<32 | uint64(lo)
+}
+
+func (t *modernTransport) SetFeatures(features uint64) {
+	t.write32(t.common+commonDriverFeatureSelect, 0)
+	t.write32(t.common+commonDriverFeature, uint32(features))
+	t.write32(t.common+commonDriverFeatureSelect, 1)
+	t.write32(t.common+commonDriverFeature, uint32(features>>32))
+}
+
+func (t *modernTransport) QueueSize(idx uint16) uint16 {
+	t.write16(t.common+commonQueueSelect, idx)
+	return t.read16(t.common + commonQueueSize)
+}
+
+func (t *modernTransport) ActivateQueue(idx, size uint16, desc, avail, used uintptr) {
+	t.write16(t.common+commonQueueSelect, idx)
+	t.write16(t.common+commonQueueSize, size)
+	t.write64(t.common+commonQueueDesc, uint64(desc))
+	t.write64(t.common+commonQueueDriver, uint64(avail))
+	t.write64(t.common+commonQueueDevice, uint64(used))
+	off := t.read16(t.common + commonQueueNotifyOff)
+	t.notifyAddrs[idx] = t.notify + uintptr(off)*uintptr(t.notifyMultiplier)
+	t.write16(t.common+commonQueueEnable, 1)
+}
+
+func (t *modernTransport) Notify(idx uint16) {
+	t.write16(t.notifyAddrs[idx], idx)
+}
+
+func (t *modernTransport) ISR() uint8 {
+	return t.read8(t.isr)
+}
+
+func (t *modernTransport) ConfigRead8(off uintptr) uint8 {
+	return t.read8(t.device + off)
+}
+
+func (t *modernTransport) ConfigRead16(off uintptr) uint16 {
+	return t.read16(t.device + off)
+}
+
+func (t *modernTransport) ConfigRead32(off uintptr) uint32 {
+	return t.read32(t.device + off)
+}
@@ -0,0 +1,124 @@
+package virtio
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package virtio implements the parts of the virtio 1.0 specification
+// shared by the virtio device drivers: the legacy and modern PCI
+// transports, feature negotiation and split virtqueues.
+import (
+	"errors"
+
+	"github.com/bhojpur/kernel/pkg/base/drivers/pci"
+	"github.com/bhojpur/kernel/pkg/base/log"
+)
+
+// Device status bits.
+const (
+	StatusAcknowledge = 1
+	StatusDriver      = 2
+	StatusDriverOK    = 4
+	StatusFeaturesOK  = 8
+	StatusFailed      = 128
+)
+
+// FeatureVersion1 is offered by modern devices and must be accepted by
+// drivers talking to them through the modern transport.
+const FeatureVersion1 = 1 << 32
+
+// maxQueueSize bounds the size of the queues we set up on modern devices,
+// which let the driver pick a size smaller than the device maximum.
+const maxQueueSize = 256
+
+// Device is a virtio device that has been reset and whose features have
+// been negotiated.
+type Device struct {
+	Transport
+
+	// Features holds the negotiated feature bits.
+	Features uint64
+
+	name string
+}
+
+// Open resets the virtio device behind dev and negotiates the subset of
+// features that both the device and the driver support. The driver must
+// set up its queues and then call Ready.
+func Open(name string, dev *pci.Device, features uint64) (*Device, error) {
+	dev.Addr.EnableBusMaster()
+	t, err := NewTransport(dev)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Reset()
+	t.SetStatus(StatusAcknowledge)
+	t.SetStatus(StatusAcknowledge | StatusDriver)
+
+	if t.Modern() {
+		features |= FeatureVersion1
+	}
+	offered := t.Features()
+	features &= offered
+	t.SetFeatures(features)
+	if t.Modern() {
+		t.SetStatus(StatusAcknowledge | StatusDriver | StatusFeaturesOK)
+		if t.Status()&StatusFeaturesOK == 0 {
+			t.SetStatus(StatusFailed)
+			return nil, errors.New("device rejected features")
+		}
+	}
+	log.Infof("[%s] modern:%v features offered:%x accepted:%x", name, t.Modern(), offered, features)
+	return &Device{
+		Transport: t,
+		Features:  features,
+		name:      name,
+	}, nil
+}
+
+// HasFeature reports whether feature was negotiated.
+func (d *Device) HasFeature(feature uint64) bool {
+	return d.Features&feature != 0
+}
+
+// SetupQueue allocates virtqueue idx and hands it to the device.
+func (d *Device) SetupQueue(idx uint16) (*Queue, error) {
+	size := d.QueueSize(idx)
+	if size == 0 {
+		return nil, errors.New("queue not available")
+	}
+	if d.Modern() && size > maxQueueSize {
+		size = maxQueueSize
+	}
+	q := newQueue(idx, size, d.Transport)
+	d.ActivateQueue(idx, size, q.desc, q.avail, q.used)
+	log.Infof("[%s] queue %d size %d", d.name, idx, size)
+	return q, nil
+}
+
+// Ready tells the device that the driver is set up and may be used.
+func (d *Device) Ready() {
+	d.SetStatus(d.Status() | StatusDriverOK)
+}
+
+// Fail tells the device that the driver gave up on it.
+func (d *Device) Fail() {
+	d.SetStatus(d.Status() | StatusFailed)
+}
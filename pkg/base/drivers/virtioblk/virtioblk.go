@@ -0,0 +1,234 @@
+package virtioblk
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"sync"
+	"unsafe"
+
+	"github.com/bhojpur/kernel/pkg/base/drivers/blk"
+	"github.com/bhojpur/kernel/pkg/base/drivers/pci"
+	"github.com/bhojpur/kernel/pkg/base/drivers/pic"
+	"github.com/bhojpur/kernel/pkg/base/drivers/virtio"
+	"github.com/bhojpur/kernel/pkg/base/kernel/mm"
+	"github.com/bhojpur/kernel/pkg/base/kernel/sys"
+	"github.com/bhojpur/kernel/pkg/base/log"
+)
+
+var (
+	_ pci.Driver = (*driver)(nil)
+	_ blk.Device = disk{}
+)
+
+// Feature bits.
+const (
+	featReadOnly = 1 << 5
+	featFlush    = 1 << 9
+)
+
+// Request types.
+const (
+	reqIn    = 0
+	reqOut   = 1
+	reqFlush = 4
+)
+
+const statusOK = 0
+
+// reqHdr is read by the device ahead of the data of every request.
+type reqHdr struct {
+	typ      uint32
+	reserved uint32
+	sector   uint64
+}
+
+// dmaPages is the size of the bounce buffer; larger transfers are split.
+const dmaPages = 16
+
+type driver struct {
+	dev  *pci.Device
+	vdev *virtio.Device
+	q    *virtio.Queue
+
+	sectors uint64
+
+	// mu serializes requests, there is only ever one in flight
+	mu sync.Mutex
+	// hdr and status share a page, data is the bounce buffer for the
+	// caller's memory which is not mapped one to one
+	hdr, status, data uintptr
+	intr              chan struct{}
+}
+
+func newDriver() *driver {
+	return &driver{
+		intr: make(chan struct{}, 1),
+	}
+}
+
+func (d *driver) Name() string {
+	return "virtio-blk"
+}
+
+func (d *driver) Idents() []pci.Identity {
+	return []pci.Identity{
+		// transitional device, legacy and modern interface
+		{0x1af4, 0x1001},
+		// modern only device
+		{0x1af4, 0x1042},
+	}
+}
+
+func (d *driver) Init(dev *pci.Device) error {
+	d.dev = dev
+	vdev, err := virtio.Open("virtio-blk", dev, featReadOnly|featFlush)
+	if err != nil {
+		log.Infof("[virtio-blk] %s", err)
+		return err
+	}
+	d.vdev = vdev
+	d.sectors = uint64(vdev.ConfigRead32(0)) | uint64(vdev.ConfigRead32(4))<<32
+
+	if d.q, err = vdev.SetupQueue(0); err != nil {
+		vdev.Fail()
+		return err
+	}
+	d.hdr = mm.Alloc()
+	d.status = d.hdr + unsafe.Sizeof(reqHdr{})
+	d.data = mm.AllocContig(dmaPages)
+	vdev.Ready()
+
+	log.Infof("[virtio-blk] %s: %d sectors, read only:%v", disk{d}.Name(), d.sectors, d.ReadOnly())
+	blk.Register(disk{d})
+	return nil
+}
+
+// disk is the blk.Device side of the driver, pci.Driver already took Name.
+type disk struct {
+	*driver
+}
+
+// Name follows the Linux naming of virtio disks. The pci layer binds a
+// driver to a single device, so there is only ever one.
+func (disk) Name() string {
+	return "vda"
+}
+
+func (d *driver) Sectors() uint64 {
+	return d.sectors
+}
+
+func (d *driver) ReadOnly() bool {
+	return d.vdev.HasFeature(featReadOnly)
+}
+
+func (d *driver) ReadSectors(sector uint64, buf []byte) error {
+	return d.transfer(reqIn, sector, buf)
+}
+
+func (d *driver) WriteSectors(sector uint64, buf []byte) error {
+	if d.ReadOnly() {
+		return blk.ErrReadOnly
+	}
+	return d.transfer(reqOut, sector, buf)
+}
+
+func (d *driver) Flush() error {
+	if !d.vdev.HasFeature(featFlush) {
+		// without the feature the device writes through
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.do(reqFlush, 0, 0)
+}
+
+func (d *driver) transfer(typ uint32, sector uint64, buf []byte) error {
+	if len(buf)%blk.SectorSize != 0 || sector+uint64(len(buf)/blk.SectorSize) > d.sectors {
+		return blk.ErrOutOfRange
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dma := sys.UnsafeBuffer(d.data, dmaPages*mm.PGSIZE)
+	for len(buf) > 0 {
+		n := len(buf)
+		if n > len(dma) {
+			n = len(dma)
+		}
+		if typ == reqOut {
+			copy(dma, buf[:n])
+		}
+		if err := d.do(typ, sector, n); err != nil {
+			return err
+		}
+		if typ == reqIn {
+			copy(buf[:n], dma)
+		}
+		buf = buf[n:]
+		sector += uint64(n / blk.SectorSize)
+	}
+	return nil
+}
+
+// do runs one request with n bytes of the bounce buffer and waits for it
+// to complete. d.mu must be held.
+func (d *driver) do(typ uint32, sector uint64, n int) error {
+	*(*reqHdr)(unsafe.Pointer(d.hdr)) = reqHdr{typ: typ, sector: sector}
+	*(*uint8)(unsafe.Pointer(d.status)) = 0xff
+
+	bufs := []virtio.Buffer{{Addr: d.hdr, Len: int(unsafe.Sizeof(reqHdr{}))}}
+	if n > 0 {
+		bufs = append(bufs, virtio.Buffer{Addr: d.data, Len: n, Write: typ == reqIn})
+	}
+	bufs = append(bufs, virtio.Buffer{Addr: d.status, Len: 1, Write: true})
+	if _, ok := d.q.Add(bufs...); !ok {
+		return errors.New("virtio-blk: queue full")
+	}
+	d.q.Kick()
+	for {
+		if _, _, ok := d.q.Pop(); ok {
+			break
+		}
+		<-d.intr
+	}
+	if *(*uint8)(unsafe.Pointer(d.status)) != statusOK {
+		return errors.New("virtio-blk: io error")
+	}
+	return nil
+}
+
+func (d *driver) Intr() {
+	defer pic.EnableIRQ(uint16(d.dev.IRQLine))
+	defer pic.EOI(uintptr(d.dev.IRQNO))
+	// reading the ISR acknowledges the interrupt, the waiting request
+	// collects the result itself
+	d.vdev.ISR()
+	select {
+	case d.intr <- struct{}{}:
+	default:
+	}
+}
+
+func init() {
+	pci.Register(newDriver())
+}
@@ -0,0 +1,338 @@
+package virtionet
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/binary"
+	"errors"
+	"unsafe"
+
+	"github.com/bhojpur/kernel/pkg/base/drivers/pci"
+	"github.com/bhojpur/kernel/pkg/base/drivers/pic"
+	"github.com/bhojpur/kernel/pkg/base/drivers/virtio"
+	"github.com/bhojpur/kernel/pkg/base/inet"
+	"github.com/bhojpur/kernel/pkg/base/kernel/mm"
+	"github.com/bhojpur/kernel/pkg/base/kernel/sys"
+	"github.com/bhojpur/kernel/pkg/base/log"
+
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+var (
+	_ pci.Driver             = (*driver)(nil)
+	_ inet.Device            = (*driver)(nil)
+	_ inet.ChecksumOffloader = (*driver)(nil)
+)
+
+// Feature bits.
+const (
+	featCsum      = 1 << 0
+	featGuestCsum = 1 << 1
+	featMac       = 1 << 5
+)
+
+// netHdr flags.
+const (
+	hdrNeedsCsum = 1
+	hdrDataValid = 2
+)
+
+const (
+	rxQueue = 0
+	txQueue = 1
+)
+
+// netHdr prefixes every frame. numBuffers is only part of the header
+// with the modern interface.
+type netHdr struct {
+	flags      uint8
+	gsoType    uint8
+	hdrLen     uint16
+	gsoSize    uint16
+	csumStart  uint16
+	csumOffset uint16
+	numBuffers uint16
+}
+
+// hdrStride is the spacing of the headers in the header area, large
+// enough for both header sizes.
+const hdrStride = 16
+
+// slot is a header and a frame buffer, posted as a two descriptor chain.
+type slot struct {
+	hdr, buf uintptr
+}
+
+type driver struct {
+	dev  *pci.Device
+	vdev *virtio.Device
+	mac  [6]byte
+
+	hdrLen int
+
+	rxq, txq *virtio.Queue
+
+	rxslots, txslots []slot
+	// slots of the requests owned by the device, by descriptor head
+	rxinflight, txinflight []int
+	txfree                 []int
+
+	rxfunc func([]byte, bool)
+}
+
+func newDriver() *driver {
+	return &driver{}
+}
+
+func (d *driver) Name() string {
+	return "virtio-net"
+}
+
+func (d *driver) Idents() []pci.Identity {
+	return []pci.Identity{
+		// transitional device, legacy and modern interface
+		{0x1af4, 0x1000},
+		// modern only device
+		{0x1af4, 0x1041},
+	}
+}
+
+func (d *driver) Mac() [6]byte {
+	return d.mac
+}
+
+func (d *driver) SetReceiveCallback(cb func([]byte)) {
+	d.rxfunc = func(b []byte, _ bool) {
+		cb(b)
+	}
+}
+
+func (d *driver) SetChecksumReceiveCallback(cb func([]byte, bool)) {
+	d.rxfunc = cb
+}
+
+// Capabilities offers transmit checksum offload when the device accepts
+// partially checksummed frames. Receive offload is reported per frame.
+func (d *driver) Capabilities() stack.LinkEndpointCapabilities {
+	if d.vdev.HasFeature(featCsum) {
+		return stack.CapabilityTXChecksumOffload
+	}
+	return 0
+}
+
+func allocSlots(n int) []slot {
+	slots := make([]slot, n)
+	hdrs := mm.AllocContig(int(pageAlign(uintptr(n*hdrStride)) / mm.PGSIZE))
+	for i := range slots {
+		slots[i] = slot{
+			hdr: hdrs + uintptr(i*hdrStride),
+			buf: mm.Alloc(),
+		}
+	}
+	return slots
+}
+
+func pageAlign(n uintptr) uintptr {
+	return (n + mm.PGSIZE - 1) &^ (mm.PGSIZE - 1)
+}
+
+func (d *driver) Init(dev *pci.Device) error {
+	if unsafe.Sizeof(netHdr{}) != 12 {
+		panic("bad netHdr size")
+	}
+	d.dev = dev
+
+	vdev, err := virtio.Open(d.Name(), dev, featMac|featCsum|featGuestCsum)
+	if err != nil {
+		log.Infof("[virtio-net] %s", err)
+		return err
+	}
+	d.vdev = vdev
+
+	d.hdrLen = 10
+	if vdev.Modern() {
+		d.hdrLen = 12
+	}
+
+	if vdev.HasFeature(featMac) {
+		for i := range d.mac {
+			d.mac[i] = vdev.ConfigRead8(uintptr(i))
+		}
+	} else {
+		d.mac = [6]byte{0x52, 0x54, 0x00, 0x12, 0x34, 0x56}
+	}
+
+	if d.rxq, err = vdev.SetupQueue(rxQueue); err != nil {
+		vdev.Fail()
+		return err
+	}
+	if d.txq, err = vdev.SetupQueue(txQueue); err != nil {
+		vdev.Fail()
+		return err
+	}
+	// sent frames are reclaimed on the next Transmit
+	d.txq.DisableInterrupts()
+
+	d.rxslots = allocSlots(d.rxq.Size() / 2)
+	d.rxinflight = make([]int, d.rxq.Size())
+	d.txslots = allocSlots(d.txq.Size() / 2)
+	d.txinflight = make([]int, d.txq.Size())
+	for i := range d.txslots {
+		d.txfree = append(d.txfree, i)
+	}
+	for i := range d.rxslots {
+		d.postrx(i)
+	}
+
+	vdev.Ready()
+	d.rxq.Kick()
+
+	log.Infof("[virtio-net] mac:%x", d.mac)
+	inet.RegisterDevice(d)
+	return nil
+}
+
+func (d *driver) postrx(i int) {
+	s := d.rxslots[i]
+	head, _ := d.rxq.Add(
+		virtio.Buffer{Addr: s.hdr, Len: d.hdrLen, Write: true},
+		virtio.Buffer{Addr: s.buf, Len: mm.PGSIZE, Write: true},
+	)
+	d.rxinflight[head] = i
+}
+
+func (d *driver) reclaimtx() {
+	for {
+		head, _, ok := d.txq.Pop()
+		if !ok {
+			return
+		}
+		d.txfree = append(d.txfree, d.txinflight[head])
+	}
+}
+
+func (d *driver) Transmit(pkt *stack.PacketBuffer) error {
+	d.reclaimtx()
+	if len(d.txfree) == 0 {
+		return errors.New("tx queue full")
+	}
+	i := d.txfree[len(d.txfree)-1]
+	d.txfree = d.txfree[:len(d.txfree)-1]
+	s := d.txslots[i]
+
+	txbuf := sys.UnsafeBuffer(s.buf, mm.PGSIZE)
+	r := buffer.NewVectorisedView(pkt.Size(), pkt.Views())
+	pktlen, _ := r.Read(txbuf)
+
+	hdr := (*netHdr)(unsafe.Pointer(s.hdr))
+	*hdr = netHdr{}
+	if d.vdev.HasFeature(featCsum) {
+		setPartialChecksum(hdr, txbuf[:pktlen])
+	}
+
+	head, _ := d.txq.Add(
+		virtio.Buffer{Addr: s.hdr, Len: d.hdrLen},
+		virtio.Buffer{Addr: s.buf, Len: pktlen},
+	)
+	d.txinflight[head] = i
+	d.txq.Kick()
+	return nil
+}
+
+// setPartialChecksum leaves the checksum of IPv4 TCP and UDP frames to the
+// device, which is what the stack expects once it was told about the
+// offload. The checksum field is seeded with the pseudo header sum.
+func setPartialChecksum(hdr *netHdr, frame []byte) {
+	const ethLen = 14
+	if len(frame) < ethLen+20 || binary.BigEndian.Uint16(frame[12:]) != 0x0800 {
+		return
+	}
+	ip := frame[ethLen:]
+	ihl := int(ip[0]&0xf) * 4
+	totalLen := int(binary.BigEndian.Uint16(ip[2:]))
+	// fragments do not carry a complete transport packet
+	if binary.BigEndian.Uint16(ip[6:])&0x3fff != 0 {
+		return
+	}
+	var csumOffset int
+	switch ip[9] {
+	case 6:
+		csumOffset = 16
+	case 17:
+		csumOffset = 6
+	default:
+		return
+	}
+	if ihl < 20 || totalLen > len(ip) || totalLen < ihl+csumOffset+2 {
+		return
+	}
+
+	sum := uint32(ip[9]) + uint32(totalLen-ihl)
+	for i := 12; i < 20; i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(ip[i:]))
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	binary.BigEndian.PutUint16(ip[ihl+csumOffset:], uint16(sum))
+
+	hdr.flags = hdrNeedsCsum
+	hdr.csumStart = uint16(ethLen + ihl)
+	hdr.csumOffset = uint16(csumOffset)
+}
+
+func (d *driver) Intr() {
+	defer pic.EnableIRQ(uint16(d.dev.IRQLine))
+	defer pic.EOI(uintptr(d.dev.IRQNO))
+	// reading the ISR acknowledges the interrupt
+	d.vdev.ISR()
+
+	received := false
+	for d.readpkt() {
+		received = true
+	}
+	if received {
+		d.rxq.Kick()
+	}
+}
+
+func (d *driver) readpkt() bool {
+	head, n, ok := d.rxq.Pop()
+	if !ok {
+		return false
+	}
+	i := d.rxinflight[head]
+	s := d.rxslots[i]
+	if n > d.hdrLen && d.rxfunc != nil {
+		hdr := (*netHdr)(unsafe.Pointer(s.hdr))
+		// frames from the host may carry a partial checksum; they are
+		// as trustworthy as the ones the device validated
+		csumValid := d.vdev.HasFeature(featGuestCsum) && hdr.flags&(hdrNeedsCsum|hdrDataValid) != 0
+		d.rxfunc(sys.UnsafeBuffer(s.buf, n-d.hdrLen), csumValid)
+	}
+	d.postrx(i)
+	return true
+}
+
+func init() {
+	pci.Register(newDriver())
+}
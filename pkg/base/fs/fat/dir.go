@@ -0,0 +1,516 @@
+package fat
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/binary"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf16"
+)
+
+// Directory entry attributes.
+const (
+	attrReadOnly  = 0x01
+	attrVolumeID  = 0x08
+	attrDirectory = 0x10
+	attrArchive   = 0x20
+	attrLongName  = 0x0f
+
+	entrySize  = 32
+	entryFree  = 0xe5
+	entryEnd   = 0x00
+	maxNameLen = 255
+
+	// NTRes flags for short names written in lower case
+	lowerBase = 0x08
+	lowerExt  = 0x10
+)
+
+// offsets of the 13 name characters in a long name entry
+var lfnCharOffsets = [13]int{1, 3, 5, 7, 9, 14, 16, 18, 20, 22, 24, 28, 30}
+
+type dirEntry struct {
+	name    string
+	short   [11]byte
+	attr    uint8
+	cluster uint32
+	size    uint32
+	mtime   time.Time
+
+	// cluster of the parent directory
+	parent uint32
+	// device offsets of the long name entries and of the short entry,
+	// which comes last. The root directory has none.
+	slots []int64
+
+	// open handles, only counted for entries in Fs.open
+	refs    int
+	removed bool
+}
+
+func (e *dirEntry) isDir() bool {
+	return e.attr&attrDirectory != 0
+}
+
+func (e *dirEntry) isRoot() bool {
+	return len(e.slots) == 0
+}
+
+func (e *dirEntry) offset() int64 {
+	return e.slots[len(e.slots)-1]
+}
+
+func (e *dirEntry) mode() os.FileMode {
+	mode := os.FileMode(0666)
+	if e.isDir() {
+		mode = os.ModeDir | 0777
+	}
+	if e.attr&attrReadOnly != 0 {
+		mode &^= 0222
+	}
+	return mode
+}
+
+func (fs *Fs) rootEntry() *dirEntry {
+	return &dirEntry{
+		name:    "/",
+		attr:    attrDirectory,
+		cluster: fs.rootCluster,
+	}
+}
+
+func shortChecksum(short []byte) byte {
+	var sum byte
+	for _, c := range short[:11] {
+		sum = (sum&1)<<7 + sum>>1 + c
+	}
+	return sum
+}
+
+func shortToName(short []byte, ntres byte) string {
+	base := strings.TrimRight(string(short[:8]), " ")
+	ext := strings.TrimRight(string(short[8:11]), " ")
+	if len(base) > 0 && base[0] == 0x05 {
+		base = "\xe5" + base[1:]
+	}
+	if ntres&lowerBase != 0 {
+		base = strings.ToLower(base)
+	}
+	if ntres&lowerExt != 0 {
+		ext = strings.ToLower(ext)
+	}
+	if ext == "" {
+		return base
+	}
+	return base + "." + ext
+}
+
+func shortLabel(label string) []byte {
+	if label == "" {
+		label = "NO NAME"
+	}
+	b := []byte(strings.ToUpper(label) + strings.Repeat(" ", 11))
+	return b[:11]
+}
+
+// shortChars maps a name to the characters allowed in short names.
+func shortChars(s string, max int) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(s) {
+		if b.Len() == max {
+			break
+		}
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune("!#$%&'()-@^_`{}~", r):
+			b.WriteRune(r)
+		case r == ' ' || r == '.':
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// makeShortName derives a unique short name in the style of NAME~1.EXT.
+func makeShortName(name string, taken func([11]byte) bool) [11]byte {
+	base, ext := name, ""
+	if i := strings.LastIndex(name, "."); i > 0 {
+		base, ext = name[:i], name[i+1:]
+	}
+	base, ext = shortChars(base, 8), shortChars(ext, 3)
+	if base == "" {
+		base = "_"
+	}
+	var short [11]byte
+	for n := 1; ; n++ {
+		tail := "~" + strconv.Itoa(n)
+		b := base
+		if len(b)+len(tail) > 8 {
+			b = b[:8-len(tail)]
+		}
+		copy(short[:], []byte(b + tail + "        ")[:8])
+		copy(short[8:], []byte(ext + "   ")[:3])
+		if !taken(short) {
+			return short
+		}
+	}
+}
+
+func validName(name string) error {
+	if name == "" || name == "." || name == ".." || len(utf16.Encode([]rune(name))) > maxNameLen {
+		return syscall.EINVAL
+	}
+	for _, r := range name {
+		if r < 0x20 || strings.ContainsRune("\"*/:<>?\\|", r) {
+			return syscall.EINVAL
+		}
+	}
+	return nil
+}
+
+func fatTime(t time.Time) (date, clock uint16) {
+	if t.Year() < 1980 {
+		return 0x21, 0
+	}
+	date = uint16(t.Year()-1980)<<9 | uint16(t.Month())<<5 | uint16(t.Day())
+	clock = uint16(t.Hour())<<11 | uint16(t.Minute())<<5 | uint16(t.Second()/2)
+	return date, clock
+}
+
+func parseFatTime(date, clock uint16) time.Time {
+	return time.Date(int(date>>9)+1980, time.Month(date>>5&0xf), int(date&0x1f),
+		int(clock>>11), int(clock>>5&0x3f), int(clock&0x1f)*2, 0, time.Local)
+}
+
+// readDir returns the entries of the directory starting at cluster,
+// without "." and "..".
+func (fs *Fs) readDir(cluster uint32) ([]*dirEntry, error) {
+	clusters, err := fs.chain(cluster)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		entries []*dirEntry
+		lfn     []uint16
+		lfnSum  byte
+		lfnNext byte
+		slots   []int64
+	)
+	le := binary.LittleEndian
+	buf := make([]byte, fs.clusterSize)
+	for _, c := range clusters {
+		if _, err := fs.dev.ReadAt(buf, fs.clusterOffset(c)); err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(buf); i += entrySize {
+			raw := buf[i : i+entrySize]
+			off := fs.clusterOffset(c) + int64(i)
+			switch {
+			case raw[0] == entryEnd:
+				return entries, nil
+			case raw[0] == entryFree:
+				lfn = nil
+				continue
+			case raw[11]&0x3f == attrLongName:
+				ord := raw[0] & 0x1f
+				if raw[0]&0x40 != 0 {
+					// the last part of the name comes first
+					lfn = make([]uint16, int(ord)*13)
+					lfnSum = raw[13]
+					slots = nil
+				} else if lfn == nil || ord != lfnNext || raw[13] != lfnSum {
+					lfn = nil
+					continue
+				}
+				if ord == 0 {
+					lfn = nil
+					continue
+				}
+				for j, o := range lfnCharOffsets {
+					lfn[int(ord-1)*13+j] = le.Uint16(raw[o:])
+				}
+				lfnNext = ord - 1
+				slots = append(slots, off)
+				continue
+			}
+			if raw[11]&attrVolumeID != 0 || raw[0] == '.' {
+				lfn = nil
+				continue
+			}
+			e := &dirEntry{
+				attr:    raw[11],
+				cluster: uint32(le.Uint16(raw[20:]))<<16 | uint32(le.Uint16(raw[26:])),
+				size:    le.Uint32(raw[28:]),
+				mtime:   parseFatTime(le.Uint16(raw[24:]), le.Uint16(raw[22:])),
+				parent:  cluster,
+			}
+			copy(e.short[:], raw[:11])
+			if lfn != nil && lfnNext == 0 && shortChecksum(raw) == lfnSum {
+				for j, u := range lfn {
+					if u == 0 {
+						lfn = lfn[:j]
+						break
+					}
+				}
+				e.name = string(utf16.Decode(lfn))
+				e.slots = append(slots, off)
+			} else {
+				e.name = shortToName(raw, raw[12])
+				e.slots = []int64{off}
+			}
+			lfn = nil
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func findEntry(entries []*dirEntry, name string) *dirEntry {
+	for _, e := range entries {
+		if strings.EqualFold(e.name, name) {
+			return e
+		}
+	}
+	return nil
+}
+
+// shared returns the entry of the open file at the same place as e, so
+// that all handles see the same size and clusters.
+func (fs *Fs) shared(e *dirEntry) *dirEntry {
+	if e.isRoot() {
+		return e
+	}
+	if o, ok := fs.open[e.offset()]; ok {
+		return o
+	}
+	return e
+}
+
+// lookup resolves a cleaned absolute path.
+func (fs *Fs) lookup(name string) (*dirEntry, error) {
+	e := fs.rootEntry()
+	for _, part := range strings.Split(name, "/") {
+		if part == "" {
+			continue
+		}
+		if !e.isDir() {
+			return nil, syscall.ENOTDIR
+		}
+		entries, err := fs.readDir(e.cluster)
+		if err != nil {
+			return nil, err
+		}
+		if e = findEntry(entries, part); e == nil {
+			return nil, os.ErrNotExist
+		}
+		e = fs.shared(e)
+	}
+	return e, nil
+}
+
+// findSlots returns the offsets of n consecutive unused entries in the
+// directory, growing it if needed.
+func (fs *Fs) findSlots(dir uint32, n int) ([]int64, error) {
+	clusters, err := fs.chain(dir)
+	if err != nil {
+		return nil, err
+	}
+	var run []int64
+	buf := make([]byte, fs.clusterSize)
+	for _, c := range clusters {
+		if _, err := fs.dev.ReadAt(buf, fs.clusterOffset(c)); err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(buf); i += entrySize {
+			if buf[i] != entryFree && buf[i] != entryEnd {
+				run = run[:0]
+				continue
+			}
+			if run = append(run, fs.clusterOffset(c)+int64(i)); len(run) == n {
+				return run, nil
+			}
+		}
+	}
+	last := clusters[len(clusters)-1]
+	for {
+		c, err := fs.allocZeroed(last)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < fs.clusterSize; i += entrySize {
+			if run = append(run, fs.clusterOffset(c)+int64(i)); len(run) == n {
+				return run, nil
+			}
+		}
+		last = c
+	}
+}
+
+func putCluster(raw []byte, cluster uint32) {
+	binary.LittleEndian.PutUint16(raw[20:], uint16(cluster>>16))
+	binary.LittleEndian.PutUint16(raw[26:], uint16(cluster))
+}
+
+// addEntry writes e, named e.name, to the directory starting at dir and
+// records where it went.
+func (fs *Fs) addEntry(dir uint32, e *dirEntry) error {
+	entries, err := fs.readDir(dir)
+	if err != nil {
+		return err
+	}
+	e.short = makeShortName(e.name, func(short [11]byte) bool {
+		for _, o := range entries {
+			if o.short == short {
+				return true
+			}
+		}
+		return false
+	})
+	sum := shortChecksum(e.short[:])
+
+	name := utf16.Encode([]rune(e.name))
+	parts := (len(name) + 12) / 13
+	padded := make([]uint16, parts*13)
+	for i := range padded {
+		switch {
+		case i < len(name):
+			padded[i] = name[i]
+		case i > len(name):
+			padded[i] = 0xffff
+		}
+	}
+	slots, err := fs.findSlots(dir, parts+1)
+	if err != nil {
+		return err
+	}
+
+	le := binary.LittleEndian
+	for i, off := range slots[:parts] {
+		raw := make([]byte, entrySize)
+		ord := parts - i
+		raw[0] = byte(ord)
+		if i == 0 {
+			raw[0] |= 0x40
+		}
+		raw[11] = attrLongName
+		raw[13] = sum
+		for j, o := range lfnCharOffsets {
+			le.PutUint16(raw[o:], padded[(ord-1)*13+j])
+		}
+		if _, err := fs.dev.WriteAt(raw, off); err != nil {
+			return err
+		}
+	}
+
+	raw := make([]byte, entrySize)
+	copy(raw, e.short[:])
+	raw[11] = e.attr
+	date, clock := fatTime(e.mtime)
+	le.PutUint16(raw[14:], clock)
+	le.PutUint16(raw[16:], date)
+	le.PutUint16(raw[18:], date)
+	le.PutUint16(raw[22:], clock)
+	le.PutUint16(raw[24:], date)
+	putCluster(raw, e.cluster)
+	le.PutUint32(raw[28:], e.size)
+	if _, err := fs.dev.WriteAt(raw, slots[parts]); err != nil {
+		return err
+	}
+	e.parent = dir
+	e.slots = slots
+	return nil
+}
+
+// updateEntry writes the attributes, first cluster, size and times of e
+// back to its short entry.
+func (fs *Fs) updateEntry(e *dirEntry) error {
+	if e.isRoot() || e.removed {
+		return nil
+	}
+	raw := make([]byte, entrySize)
+	if _, err := fs.dev.ReadAt(raw, e.offset()); err != nil {
+		return err
+	}
+	le := binary.LittleEndian
+	raw[11] = e.attr
+	date, clock := fatTime(e.mtime)
+	le.PutUint16(raw[18:], date)
+	le.PutUint16(raw[22:], clock)
+	le.PutUint16(raw[24:], date)
+	putCluster(raw, e.cluster)
+	le.PutUint32(raw[28:], e.size)
+	_, err := fs.dev.WriteAt(raw, e.offset())
+	return err
+}
+
+// deleteEntry marks all entries of e unused.
+func (fs *Fs) deleteEntry(e *dirEntry) error {
+	for _, off := range e.slots {
+		if _, err := fs.dev.WriteAt([]byte{entryFree}, off); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// initDir writes the "." and ".." entries of a new directory.
+func (fs *Fs) initDir(e *dirEntry, parent uint32) error {
+	buf := make([]byte, 2*entrySize)
+	le := binary.LittleEndian
+	date, clock := fatTime(e.mtime)
+	for i, name := range []string{".", ".."} {
+		raw := buf[i*entrySize : (i+1)*entrySize]
+		copy(raw, name+"          ")
+		raw[11] = attrDirectory
+		le.PutUint16(raw[14:], clock)
+		le.PutUint16(raw[16:], date)
+		le.PutUint16(raw[22:], clock)
+		le.PutUint16(raw[24:], date)
+	}
+	putCluster(buf, e.cluster)
+	putCluster(buf[entrySize:], fs.dotDotCluster(parent))
+	_, err := fs.dev.WriteAt(buf, fs.clusterOffset(e.cluster))
+	return err
+}
+
+// dotDotCluster is what ".." entries store for parent, the root being 0.
+func (fs *Fs) dotDotCluster(parent uint32) uint32 {
+	if parent == fs.rootCluster {
+		return 0
+	}
+	return parent
+}
+
+// reparent updates the ".." entry of a directory moved to parent.
+func (fs *Fs) reparent(e *dirEntry, parent uint32) error {
+	off := fs.clusterOffset(e.cluster) + entrySize
+	raw := make([]byte, entrySize)
+	if _, err := fs.dev.ReadAt(raw, off); err != nil {
+		return err
+	}
+	putCluster(raw, fs.dotDotCluster(parent))
+	_, err := fs.dev.WriteAt(raw, off)
+	return err
+}
@@ -0,0 +1,380 @@
+package fat
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package fat implements a FAT32 filesystem on top of a block device.
+// The allocation table is kept in memory and written back to every copy
+// on disk at the end of each operation that changes it. Long file names
+// are supported, the short names written alongside them are generated.
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bhojpur/kernel/pkg/base/drivers/blk"
+)
+
+const (
+	fatEntryMask = 0x0fffffff
+	fatFree      = 0
+	fatBad       = 0x0ffffff7
+	fatEOC       = 0x0ffffff8
+	fatEOCMark   = 0x0fffffff
+
+	// first byte of the boot sector signature
+	bootSignatureOffset = 510
+
+	fsInfoLeadSig   = 0x41615252
+	fsInfoStructSig = 0x61417272
+	fsInfoTrailSig  = 0xaa550000
+)
+
+// ErrNotFAT32 is returned by New for devices without a FAT32 filesystem.
+var ErrNotFAT32 = errors.New("not a FAT32 filesystem")
+
+// Fs is a mounted FAT32 filesystem. It is safe for concurrent use.
+type Fs struct {
+	mu  sync.Mutex
+	dev blk.ReadWriterAt
+
+	readOnly bool
+
+	clusterSize int
+	// byte offsets of the first FAT, the FSInfo sector (0 if there is
+	// none) and the data region
+	fatStart, fsInfo, dataStart int64
+	fatBytes                    int64
+	numFATs                     int
+	rootCluster                 uint32
+	// number of data clusters, valid cluster numbers are 2..clusters+1
+	clusters uint32
+
+	fat      []uint32
+	dirty    map[int64]bool
+	nextFree uint32
+	free     uint32
+
+	// entries of the open files, by the offset of their directory entry
+	open map[int64]*dirEntry
+
+	now func() time.Time
+}
+
+// New mounts the FAT32 filesystem on dev.
+func New(dev blk.Device) (*Fs, error) {
+	rw := blk.NewReadWriterAt(dev)
+	var bs [blk.SectorSize]byte
+	if _, err := rw.ReadAt(bs[:], 0); err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	if le.Uint16(bs[bootSignatureOffset:]) != 0xaa55 {
+		return nil, ErrNotFAT32
+	}
+	bytesPerSector := int64(le.Uint16(bs[11:]))
+	sectorsPerCluster := int64(bs[13])
+	reserved := int64(le.Uint16(bs[14:]))
+	numFATs := int64(bs[16])
+	totalSectors := int64(le.Uint16(bs[19:]))
+	if totalSectors == 0 {
+		totalSectors = int64(le.Uint32(bs[32:]))
+	}
+	fatSize16 := le.Uint16(bs[22:])
+	fatSize := int64(le.Uint32(bs[36:]))
+	// FAT12 and FAT16 have a fixed size root directory and 16 bit FAT size
+	if bytesPerSector != blk.SectorSize || sectorsPerCluster == 0 || numFATs == 0 || fatSize16 != 0 || fatSize == 0 {
+		return nil, ErrNotFAT32
+	}
+	if totalSectors > int64(dev.Sectors()) {
+		return nil, errors.New("filesystem is larger than the device")
+	}
+
+	fs := &Fs{
+		dev:         rw,
+		readOnly:    dev.ReadOnly(),
+		clusterSize: int(sectorsPerCluster * bytesPerSector),
+		fatStart:    reserved * bytesPerSector,
+		fatBytes:    fatSize * bytesPerSector,
+		numFATs:     int(numFATs),
+		dataStart:   (reserved + numFATs*fatSize) * bytesPerSector,
+		rootCluster: le.Uint32(bs[44:]),
+		dirty:       map[int64]bool{},
+		open:        map[int64]*dirEntry{},
+		now:         time.Now,
+	}
+	fs.clusters = uint32((totalSectors - reserved - numFATs*fatSize) / sectorsPerCluster)
+	if int64(fs.clusters+2)*4 > fs.fatBytes {
+		fs.clusters = uint32(fs.fatBytes/4) - 2
+	}
+	if !fs.validCluster(fs.rootCluster) {
+		return nil, ErrNotFAT32
+	}
+	if sector := int64(le.Uint16(bs[48:])); sector != 0 && sector != 0xffff {
+		fs.fsInfo = sector * bytesPerSector
+	}
+
+	if err := fs.loadFAT(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func (fs *Fs) loadFAT() error {
+	raw := make([]byte, (fs.clusters+2)*4)
+	if _, err := fs.dev.ReadAt(raw, fs.fatStart); err != nil {
+		return err
+	}
+	fs.fat = make([]uint32, fs.clusters+2)
+	for i := range fs.fat {
+		fs.fat[i] = binary.LittleEndian.Uint32(raw[i*4:])
+		if i >= 2 && fs.fat[i]&fatEntryMask == fatFree {
+			fs.free++
+		}
+	}
+	fs.nextFree = 2
+	if fs.fsInfo != 0 {
+		var info [blk.SectorSize]byte
+		if _, err := fs.dev.ReadAt(info[:], fs.fsInfo); err != nil {
+			return err
+		}
+		le := binary.LittleEndian
+		if le.Uint32(info[0:]) == fsInfoLeadSig && le.Uint32(info[484:]) == fsInfoStructSig {
+			if next := le.Uint32(info[492:]); fs.validCluster(next) {
+				fs.nextFree = next
+			}
+		} else {
+			fs.fsInfo = 0
+		}
+	}
+	return nil
+}
+
+func (fs *Fs) validCluster(c uint32) bool {
+	return c >= 2 && c < fs.clusters+2
+}
+
+func (fs *Fs) clusterOffset(c uint32) int64 {
+	return fs.dataStart + int64(c-2)*int64(fs.clusterSize)
+}
+
+func (fs *Fs) next(c uint32) uint32 {
+	return fs.fat[c] & fatEntryMask
+}
+
+func (fs *Fs) setFAT(c, v uint32) {
+	fs.fat[c] = fs.fat[c]&^fatEntryMask | v
+	fs.dirty[int64(c)*4/blk.SectorSize] = true
+}
+
+// chain returns the clusters of the chain starting at first.
+func (fs *Fs) chain(first uint32) ([]uint32, error) {
+	var clusters []uint32
+	for c := first; c != 0 && c < fatEOC; c = fs.next(c) {
+		if !fs.validCluster(c) || len(clusters) > int(fs.clusters) {
+			return nil, syscall.EIO
+		}
+		clusters = append(clusters, c)
+	}
+	return clusters, nil
+}
+
+// alloc takes a free cluster and links it after prev, if prev is not 0.
+func (fs *Fs) alloc(prev uint32) (uint32, error) {
+	if fs.free == 0 {
+		return 0, syscall.ENOSPC
+	}
+	c := fs.nextFree
+	for fs.fat[c]&fatEntryMask != fatFree {
+		if c++; c >= fs.clusters+2 {
+			c = 2
+		}
+	}
+	fs.setFAT(c, fatEOCMark)
+	if prev != 0 {
+		fs.setFAT(prev, c)
+	}
+	fs.free--
+	fs.nextFree = c
+	return c, nil
+}
+
+// allocZeroed is alloc for clusters that are read before being written,
+// such as directories.
+func (fs *Fs) allocZeroed(prev uint32) (uint32, error) {
+	c, err := fs.alloc(prev)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := fs.dev.WriteAt(make([]byte, fs.clusterSize), fs.clusterOffset(c)); err != nil {
+		return 0, err
+	}
+	return c, nil
+}
+
+// freeChain releases the chain starting at first.
+func (fs *Fs) freeChain(first uint32) error {
+	clusters, err := fs.chain(first)
+	if err != nil {
+		return err
+	}
+	for _, c := range clusters {
+		fs.setFAT(c, fatFree)
+		fs.free++
+	}
+	return nil
+}
+
+// sync writes the changed parts of the FAT to all of its copies, updates
+// FSInfo and flushes the device.
+func (fs *Fs) sync() error {
+	var buf [blk.SectorSize]byte
+	for sector := range fs.dirty {
+		first := sector * blk.SectorSize / 4
+		for i := 0; i < len(buf)/4; i++ {
+			v := uint32(0)
+			if int(first)+i < len(fs.fat) {
+				v = fs.fat[int(first)+i]
+			}
+			binary.LittleEndian.PutUint32(buf[i*4:], v)
+		}
+		for n := 0; n < fs.numFATs; n++ {
+			off := fs.fatStart + int64(n)*fs.fatBytes + sector*blk.SectorSize
+			if _, err := fs.dev.WriteAt(buf[:], off); err != nil {
+				return err
+			}
+		}
+		delete(fs.dirty, sector)
+	}
+	if fs.fsInfo != 0 && !fs.readOnly {
+		var info [8]byte
+		binary.LittleEndian.PutUint32(info[0:], fs.free)
+		binary.LittleEndian.PutUint32(info[4:], fs.nextFree)
+		if _, err := fs.dev.WriteAt(info[:], fs.fsInfo+488); err != nil {
+			return err
+		}
+	}
+	return fs.dev.Flush()
+}
+
+// Format writes an empty FAT32 filesystem to dev.
+func Format(dev blk.Device, label string) error {
+	if dev.ReadOnly() {
+		return blk.ErrReadOnly
+	}
+	total := dev.Sectors()
+	if total > 0xffffffff {
+		total = 0xffffffff
+	}
+	const (
+		reserved  = 32
+		numFATs   = 2
+		mediaType = 0xf8
+	)
+	var spc uint64
+	switch mb := total * blk.SectorSize >> 20; {
+	case mb <= 260:
+		spc = 1
+	case mb <= 8<<10:
+		spc = 8
+	case mb <= 16<<10:
+		spc = 16
+	case mb <= 32<<10:
+		spc = 32
+	default:
+		spc = 64
+	}
+	// see the FAT specification for the derivation
+	tmp2 := (256*spc + numFATs) / 2
+	fatSize := (total - reserved + tmp2 - 1) / tmp2
+	clusters := (total - reserved - numFATs*fatSize) / spc
+	// fewer clusters make it a FAT16 filesystem by definition
+	if clusters < 65525 {
+		return errors.New("device too small for FAT32")
+	}
+
+	le := binary.LittleEndian
+	var bs [blk.SectorSize]byte
+	copy(bs[0:], []byte{0xeb, 0x58, 0x90})
+	copy(bs[3:], "BHOJPUR ")
+	le.PutUint16(bs[11:], blk.SectorSize)
+	bs[13] = byte(spc)
+	le.PutUint16(bs[14:], reserved)
+	bs[16] = numFATs
+	bs[21] = mediaType
+	le.PutUint16(bs[24:], 32)
+	le.PutUint16(bs[26:], 64)
+	le.PutUint32(bs[32:], uint32(total))
+	le.PutUint32(bs[36:], uint32(fatSize))
+	le.PutUint32(bs[44:], 2)
+	le.PutUint16(bs[48:], 1)
+	le.PutUint16(bs[50:], 6)
+	bs[64] = 0x80
+	bs[66] = 0x29
+	le.PutUint32(bs[67:], uint32(time.Now().Unix()))
+	copy(bs[71:82], shortLabel(label))
+	copy(bs[82:], "FAT32   ")
+	le.PutUint16(bs[bootSignatureOffset:], 0xaa55)
+
+	var info [blk.SectorSize]byte
+	le.PutUint32(info[0:], fsInfoLeadSig)
+	le.PutUint32(info[484:], fsInfoStructSig)
+	le.PutUint32(info[488:], uint32(clusters-1))
+	le.PutUint32(info[492:], 3)
+	le.PutUint32(info[508:], fsInfoTrailSig)
+
+	rw := blk.NewReadWriterAt(dev)
+	// the boot sector goes last so that a half formatted device does
+	// not mount
+	zero := make([]byte, 64<<10)
+	for off, end := int64(blk.SectorSize), int64(reserved+numFATs*fatSize+spc)*blk.SectorSize; off < end; off += int64(len(zero)) {
+		n := end - off
+		if n > int64(len(zero)) {
+			n = int64(len(zero))
+		}
+		if _, err := rw.WriteAt(zero[:n], off); err != nil {
+			return err
+		}
+	}
+	var fat [12]byte
+	le.PutUint32(fat[0:], 0x0fffff00|mediaType)
+	le.PutUint32(fat[4:], fatEOCMark)
+	// the root directory
+	le.PutUint32(fat[8:], fatEOCMark)
+	for n := uint64(0); n < numFATs; n++ {
+		if _, err := rw.WriteAt(fat[:], int64(reserved+n*fatSize)*blk.SectorSize); err != nil {
+			return err
+		}
+	}
+	for _, sector := range []int64{1, 7} {
+		if _, err := rw.WriteAt(info[:], sector*blk.SectorSize); err != nil {
+			return err
+		}
+	}
+	if _, err := rw.WriteAt(bs[:], 6*blk.SectorSize); err != nil {
+		return err
+	}
+	if _, err := rw.WriteAt(bs[:], 0); err != nil {
+		return err
+	}
+	return rw.Flush()
+}
@@ -0,0 +1,188 @@
+package fat
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/bhojpur/kernel/pkg/base/drivers/blk"
+	"github.com/spf13/afero"
+)
+
+func newTestFs(t *testing.T) (*Fs, blk.Device) {
+	dev := blk.NewMemDevice("ram0", 40<<20/blk.SectorSize)
+	if err := Format(dev, "test"); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := New(dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs, dev
+}
+
+func remount(t *testing.T, dev blk.Device) *Fs {
+	fs, err := New(dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestPersistence(t *testing.T) {
+	fs, dev := newTestFs(t)
+	free := fs.free
+
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	if err := fs.MkdirAll("/a/b/c", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fs, "/a/b/c/A Long File Name.data", data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fs, "/hello.txt", []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("/a/b/c/A Long File Name.data", "/renamed.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("/a/b", "/b"); err != nil {
+		t.Fatal(err)
+	}
+
+	fs = remount(t, dev)
+	got, err := afero.ReadFile(fs, "/RENAMED.BIN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("renamed file content differs")
+	}
+	names, err := afero.ReadDir(fs, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list []string
+	for _, info := range names {
+		list = append(list, fmt.Sprintf("%s:%v:%d", info.Name(), info.IsDir(), info.Size()))
+	}
+	want := []string{"a:true:0", "b:true:0", "hello.txt:false:5", "renamed.bin:false:10000"}
+	if !reflect.DeepEqual(list, want) {
+		t.Fatalf("got %v, want %v", list, want)
+	}
+	if _, err := fs.Stat("/b/c"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.Remove("/b"); !isErrno(err, syscall.ENOTEMPTY) {
+		t.Fatalf("removing a non empty directory: %v", err)
+	}
+	for _, name := range []string{"/a", "/b", "/hello.txt", "/renamed.bin"} {
+		if err := fs.RemoveAll(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs = remount(t, dev)
+	if fs.free != free {
+		t.Fatalf("%d clusters leaked", free-fs.free)
+	}
+}
+
+func isErrno(err error, errno syscall.Errno) bool {
+	perr, ok := err.(*os.PathError)
+	return ok && perr.Err == errno
+}
+
+func TestFileOps(t *testing.T) {
+	fs, dev := newTestFs(t)
+
+	f, err := fs.OpenFile("/log", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(f, "line %d\n", i)
+	}
+	f.Close()
+
+	f, err = fs.OpenFile("/log", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sparse write past the end is zero filled
+	if _, err := f.WriteAt([]byte("end"), 2000); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(1500); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	got, err := afero.ReadFile(remount(t, dev), "/log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1500 || !bytes.HasPrefix(got, []byte("line 0\nline 1\n")) || got[1499] != 0 {
+		t.Fatalf("unexpected content %q", got)
+	}
+
+	// enough entries to grow the root directory past one cluster
+	for i := 0; i < 100; i++ {
+		if err := afero.WriteFile(fs, fmt.Sprintf("/file-%03d.txt", i), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	infos, err := afero.ReadDir(remount(t, dev), "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 101 {
+		t.Fatalf("got %d entries", len(infos))
+	}
+
+	if _, err := fs.OpenFile("/log", os.O_CREATE|os.O_EXCL, 0644); !os.IsExist(err) {
+		t.Fatalf("exclusive create of an existing file: %v", err)
+	}
+	if _, err := fs.Open("/missing/file"); !os.IsNotExist(err) {
+		t.Fatalf("open of a missing file: %v", err)
+	}
+	if _, err := ioutil.ReadAll(mustOpen(t, fs, "/log")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustOpen(t *testing.T, fs *Fs, name string) afero.File {
+	f, err := fs.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
@@ -0,0 +1,461 @@
+package fat
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io"
+	"os"
+	"path"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// assert that fat.File implements afero.File.
+var _ afero.File = (*File)(nil)
+
+// File is an open file or directory of a Fs.
+type File struct {
+	fs     *Fs
+	name   string
+	entry  *dirEntry
+	flag   int
+	pos    int64
+	closed bool
+
+	// entries not yet returned by Readdir, loaded on the first call
+	dirents []os.FileInfo
+	dirRead bool
+}
+
+type fileInfo struct {
+	name  string
+	size  int64
+	mode  os.FileMode
+	mtime time.Time
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.mtime }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() interface{}   { return nil }
+
+func newFileInfo(e *dirEntry) *fileInfo {
+	return &fileInfo{
+		name:  e.name,
+		size:  int64(e.size),
+		mode:  e.mode(),
+		mtime: e.mtime,
+	}
+}
+
+func pathError(op, name string, err error) error {
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+// each maps the n bytes at off of the file made of clusters to runs of
+// contiguous bytes on the device.
+func (fs *Fs) each(clusters []uint32, off int64, n int, fn func(devOff int64, start, end int) error) error {
+	cs := int64(fs.clusterSize)
+	for done := 0; done < n; {
+		pos := off + int64(done)
+		ci := int(pos / cs)
+		if ci >= len(clusters) {
+			return syscall.EIO
+		}
+		length := cs - pos%cs
+		for j := ci + 1; j < len(clusters) && clusters[j] == clusters[j-1]+1 && int64(done)+length < int64(n); j++ {
+			length += cs
+		}
+		if rest := int64(n - done); length > rest {
+			length = rest
+		}
+		if err := fn(fs.clusterOffset(clusters[ci])+pos%cs, done, done+int(length)); err != nil {
+			return err
+		}
+		done += int(length)
+	}
+	return nil
+}
+
+func (fs *Fs) readAt(e *dirEntry, p []byte, off int64) (int, error) {
+	if e.isDir() {
+		return 0, syscall.EISDIR
+	}
+	if off >= int64(e.size) {
+		return 0, io.EOF
+	}
+	n := len(p)
+	if rest := int64(e.size) - off; int64(n) > rest {
+		n = int(rest)
+	}
+	clusters, err := fs.chain(e.cluster)
+	if err != nil {
+		return 0, err
+	}
+	err = fs.each(clusters, off, n, func(devOff int64, start, end int) error {
+		_, err := fs.dev.ReadAt(p[start:end], devOff)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// grow makes the cluster chain of e long enough for size bytes.
+func (fs *Fs) grow(e *dirEntry, size int64) ([]uint32, error) {
+	clusters, err := fs.chain(e.cluster)
+	if err != nil {
+		return nil, err
+	}
+	need := int((size + int64(fs.clusterSize) - 1) / int64(fs.clusterSize))
+	for len(clusters) < need {
+		var prev uint32
+		if len(clusters) > 0 {
+			prev = clusters[len(clusters)-1]
+		}
+		c, err := fs.alloc(prev)
+		if err != nil {
+			return clusters, err
+		}
+		if e.cluster == 0 {
+			e.cluster = c
+		}
+		clusters = append(clusters, c)
+	}
+	return clusters, nil
+}
+
+func (fs *Fs) zero(clusters []uint32, off int64, n int) error {
+	zeros := make([]byte, fs.clusterSize)
+	return fs.each(clusters, off, n, func(devOff int64, start, end int) error {
+		for start < end {
+			m := end - start
+			if m > len(zeros) {
+				m = len(zeros)
+			}
+			if _, err := fs.dev.WriteAt(zeros[:m], devOff); err != nil {
+				return err
+			}
+			start += m
+			devOff += int64(m)
+		}
+		return nil
+	})
+}
+
+func (fs *Fs) writeAt(e *dirEntry, p []byte, off int64) (n int, err error) {
+	switch {
+	case fs.readOnly:
+		return 0, syscall.EROFS
+	case e.isDir():
+		return 0, syscall.EISDIR
+	case e.removed:
+		return 0, syscall.ENOENT
+	case off+int64(len(p)) > 0xffffffff:
+		return 0, syscall.EFBIG
+	}
+	// the entry and the FAT are updated even after a partial write, the
+	// clusters allocated so far are part of the file
+	defer func() {
+		e.mtime = fs.now()
+		e.attr |= attrArchive
+		if uerr := fs.updateEntry(e); err == nil {
+			err = uerr
+		}
+		if serr := fs.sync(); err == nil {
+			err = serr
+		}
+	}()
+
+	end := off + int64(len(p))
+	clusters, err := fs.grow(e, end)
+	if err != nil {
+		return 0, err
+	}
+	if size := int64(e.size); off > size {
+		if err := fs.zero(clusters, size, int(off-size)); err != nil {
+			return 0, err
+		}
+	}
+	err = fs.each(clusters, off, len(p), func(devOff int64, start, end int) error {
+		m, err := fs.dev.WriteAt(p[start:end], devOff)
+		n += m
+		return err
+	})
+	if off+int64(n) > int64(e.size) {
+		e.size = uint32(off + int64(n))
+	}
+	return n, err
+}
+
+func (fs *Fs) truncate(e *dirEntry, size int64) error {
+	switch {
+	case fs.readOnly:
+		return syscall.EROFS
+	case e.isDir():
+		return syscall.EISDIR
+	case size < 0:
+		return syscall.EINVAL
+	case size > 0xffffffff:
+		return syscall.EFBIG
+	}
+	if size > int64(e.size) {
+		// zero filling is a write past the end
+		clusters, err := fs.grow(e, size)
+		if err == nil {
+			err = fs.zero(clusters, int64(e.size), int(size-int64(e.size)))
+		}
+		if err != nil {
+			fs.sync()
+			return err
+		}
+	} else {
+		clusters, err := fs.chain(e.cluster)
+		if err != nil {
+			return err
+		}
+		keep := int((size + int64(fs.clusterSize) - 1) / int64(fs.clusterSize))
+		if keep == 0 && e.cluster != 0 {
+			if err := fs.freeChain(e.cluster); err != nil {
+				return err
+			}
+			e.cluster = 0
+		} else if keep < len(clusters) {
+			if err := fs.freeChain(clusters[keep]); err != nil {
+				return err
+			}
+			fs.setFAT(clusters[keep-1], fatEOCMark)
+		}
+	}
+	e.size = uint32(size)
+	e.mtime = fs.now()
+	if err := fs.updateEntry(e); err != nil {
+		return err
+	}
+	return fs.sync()
+}
+
+func (f *File) readable() error {
+	switch {
+	case f.closed:
+		return os.ErrClosed
+	case f.flag&(os.O_RDONLY|os.O_WRONLY|os.O_RDWR) == os.O_WRONLY:
+		return syscall.EBADF
+	}
+	return nil
+}
+
+func (f *File) writable() error {
+	switch {
+	case f.closed:
+		return os.ErrClosed
+	case f.flag&(os.O_WRONLY|os.O_RDWR) == 0:
+		return syscall.EBADF
+	}
+	return nil
+}
+
+// Close releases the file.
+func (f *File) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return pathError("close", f.name, os.ErrClosed)
+	}
+	f.closed = true
+	e := f.entry
+	if e.isRoot() {
+		return nil
+	}
+	if e.refs--; e.refs == 0 && f.fs.open[e.offset()] == e {
+		delete(f.fs.open, e.offset())
+	}
+	return nil
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.pos)
+	f.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.readable(); err != nil {
+		return 0, pathError("read", f.name, err)
+	}
+	if off < 0 {
+		return 0, pathError("read", f.name, syscall.EINVAL)
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	n, err := f.fs.readAt(f.entry, p, off)
+	if err != nil && err != io.EOF {
+		err = pathError("read", f.name, err)
+	}
+	return n, err
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, pathError("seek", f.name, os.ErrClosed)
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		f.fs.mu.Lock()
+		offset += int64(f.entry.size)
+		f.fs.mu.Unlock()
+	}
+	if offset < 0 {
+		return 0, pathError("seek", f.name, syscall.EINVAL)
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	if f.flag&os.O_APPEND != 0 {
+		f.fs.mu.Lock()
+		f.pos = int64(f.entry.size)
+		f.fs.mu.Unlock()
+	}
+	n, err := f.WriteAt(p, f.pos)
+	f.pos += int64(n)
+	return n, err
+}
+
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.writable(); err != nil {
+		return 0, pathError("write", f.name, err)
+	}
+	if off < 0 {
+		return 0, pathError("write", f.name, syscall.EINVAL)
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	n, err := f.fs.writeAt(f.entry, p, off)
+	if err != nil {
+		err = pathError("write", f.name, err)
+	}
+	return n, err
+}
+
+func (f *File) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *File) Name() string {
+	return f.name
+}
+
+// Readdir returns the next count entries of the directory, or all of the
+// remaining ones if count is not positive.
+func (f *File) Readdir(count int) ([]os.FileInfo, error) {
+	if f.closed {
+		return nil, pathError("readdir", f.name, os.ErrClosed)
+	}
+	if !f.entry.isDir() {
+		return nil, pathError("readdir", f.name, syscall.ENOTDIR)
+	}
+	if !f.dirRead {
+		f.fs.mu.Lock()
+		entries, err := f.fs.readDir(f.entry.cluster)
+		f.fs.mu.Unlock()
+		if err != nil {
+			return nil, pathError("readdir", f.name, err)
+		}
+		for _, e := range entries {
+			f.dirents = append(f.dirents, newFileInfo(e))
+		}
+		sort.Slice(f.dirents, func(i, j int) bool {
+			return f.dirents[i].Name() < f.dirents[j].Name()
+		})
+		f.dirRead = true
+	}
+	if count <= 0 {
+		infos := f.dirents
+		f.dirents = nil
+		return infos, nil
+	}
+	if len(f.dirents) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(f.dirents) {
+		count = len(f.dirents)
+	}
+	infos := f.dirents[:count]
+	f.dirents = f.dirents[count:]
+	return infos, nil
+}
+
+func (f *File) Readdirnames(n int) ([]string, error) {
+	infos, err := f.Readdir(n)
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name()
+	}
+	return names, err
+}
+
+func (f *File) Stat() (os.FileInfo, error) {
+	if f.closed {
+		return nil, pathError("stat", f.name, os.ErrClosed)
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	info := newFileInfo(f.entry)
+	info.name = path.Base(f.name)
+	return info, nil
+}
+
+func (f *File) Sync() error {
+	if f.closed {
+		return pathError("sync", f.name, os.ErrClosed)
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	return f.fs.sync()
+}
+
+func (f *File) Truncate(size int64) error {
+	if err := f.writable(); err != nil {
+		return pathError("truncate", f.name, err)
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.fs.truncate(f.entry, size); err != nil {
+		return pathError("truncate", f.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,394 @@
+package fat
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	iofs "io/fs"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// assert that fat.Fs implements afero.Fs.
+var _ afero.Fs = (*Fs)(nil)
+
+func clean(name string) string {
+	return path.Clean("/" + name)
+}
+
+// The name of this FileSystem
+func (fs *Fs) Name() string {
+	return "fatfs"
+}
+
+// Create creates a file in the filesystem, returning the file and an
+// error, if any happens.
+func (fs *Fs) Create(name string) (afero.File, error) {
+	return fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// Open opens a file, returning it or an error, if any happens.
+func (fs *Fs) Open(name string) (afero.File, error) {
+	return fs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens a file using the given flags and the given mode.
+func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	name = clean(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	e, err := fs.lookup(name)
+	switch {
+	case err == nil && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, pathError("open", name, os.ErrExist)
+	case err == nil:
+	case errors.Is(err, os.ErrNotExist) && flag&os.O_CREATE != 0:
+		if e, err = fs.create(name, perm); err != nil {
+			return nil, pathError("open", name, err)
+		}
+	default:
+		return nil, pathError("open", name, err)
+	}
+
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		switch {
+		case e.isDir():
+			return nil, pathError("open", name, syscall.EISDIR)
+		case fs.readOnly:
+			return nil, pathError("open", name, syscall.EROFS)
+		case e.attr&attrReadOnly != 0:
+			return nil, pathError("open", name, os.ErrPermission)
+		}
+		if flag&os.O_TRUNC != 0 && e.size > 0 {
+			if err := fs.truncate(e, 0); err != nil {
+				return nil, pathError("open", name, err)
+			}
+		}
+	}
+
+	if !e.isRoot() {
+		fs.open[e.offset()] = e
+		e.refs++
+	}
+	return &File{
+		fs:    fs,
+		name:  name,
+		entry: e,
+		flag:  flag,
+	}, nil
+}
+
+// parent returns the directory entry a new entry at name goes into.
+func (fs *Fs) parent(name string) (*dirEntry, error) {
+	if fs.readOnly {
+		return nil, syscall.EROFS
+	}
+	if err := validName(path.Base(name)); err != nil {
+		return nil, err
+	}
+	dir, err := fs.lookup(path.Dir(name))
+	if err != nil {
+		return nil, err
+	}
+	if !dir.isDir() {
+		return nil, syscall.ENOTDIR
+	}
+	return dir, nil
+}
+
+func (fs *Fs) create(name string, perm os.FileMode) (*dirEntry, error) {
+	dir, err := fs.parent(name)
+	if err != nil {
+		return nil, err
+	}
+	e := &dirEntry{
+		name:  path.Base(name),
+		attr:  attrArchive,
+		mtime: fs.now(),
+	}
+	if perm&0200 == 0 {
+		e.attr |= attrReadOnly
+	}
+	if err := fs.addEntry(dir.cluster, e); err != nil {
+		fs.sync()
+		return nil, err
+	}
+	return e, fs.sync()
+}
+
+// Mkdir creates a directory in the filesystem, return an error if any
+// happens.
+func (fs *Fs) Mkdir(name string, perm os.FileMode) error {
+	name = clean(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, err := fs.lookup(name); err == nil {
+		return pathError("mkdir", name, os.ErrExist)
+	}
+	dir, err := fs.parent(name)
+	if err != nil {
+		return pathError("mkdir", name, err)
+	}
+	c, err := fs.allocZeroed(0)
+	if err != nil {
+		return pathError("mkdir", name, err)
+	}
+	e := &dirEntry{
+		name:    path.Base(name),
+		attr:    attrDirectory,
+		cluster: c,
+		mtime:   fs.now(),
+	}
+	err = fs.initDir(e, dir.cluster)
+	if err == nil {
+		err = fs.addEntry(dir.cluster, e)
+	}
+	if err != nil {
+		fs.freeChain(c)
+		fs.sync()
+		return pathError("mkdir", name, err)
+	}
+	return fs.sync()
+}
+
+// MkdirAll creates a directory path and all parents that does not exist
+// yet.
+func (fs *Fs) MkdirAll(name string, perm os.FileMode) error {
+	name = clean(name)
+	dir := "/"
+	for _, part := range strings.Split(name, "/") {
+		if part == "" {
+			continue
+		}
+		dir = path.Join(dir, part)
+		info, err := fs.Stat(dir)
+		switch {
+		case err == nil && !info.IsDir():
+			return pathError("mkdir", dir, syscall.ENOTDIR)
+		case err == nil:
+		case os.IsNotExist(err):
+			if err := fs.Mkdir(dir, perm); err != nil && !os.IsExist(err) {
+				return err
+			}
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove removes a file identified by name, returning an error, if any
+// happens.
+func (fs *Fs) Remove(name string) error {
+	name = clean(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	e, err := fs.lookup(name)
+	switch {
+	case err != nil:
+		return pathError("remove", name, err)
+	case e.isRoot():
+		return pathError("remove", name, syscall.EBUSY)
+	case fs.readOnly:
+		return pathError("remove", name, syscall.EROFS)
+	}
+	if e.isDir() {
+		entries, err := fs.readDir(e.cluster)
+		if err != nil {
+			return pathError("remove", name, err)
+		}
+		if len(entries) > 0 {
+			return pathError("remove", name, syscall.ENOTEMPTY)
+		}
+	}
+	if err := fs.remove(e); err != nil {
+		return pathError("remove", name, err)
+	}
+	return fs.sync()
+}
+
+// remove deletes the entry and the data of e. Handles still open on it
+// fail their writes and read nothing.
+func (fs *Fs) remove(e *dirEntry) error {
+	if err := fs.deleteEntry(e); err != nil {
+		return err
+	}
+	if fs.open[e.offset()] == e {
+		delete(fs.open, e.offset())
+	}
+	err := fs.freeChain(e.cluster)
+	e.removed = true
+	e.cluster = 0
+	e.size = 0
+	return err
+}
+
+// RemoveAll removes a directory path and any children it contains. It
+// does not fail if the path does not exist (return nil).
+func (fs *Fs) RemoveAll(name string) error {
+	info, err := fs.Stat(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		f, err := fs.Open(name)
+		if err != nil {
+			return err
+		}
+		names, err := f.Readdirnames(-1)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		for _, child := range names {
+			if err := fs.RemoveAll(path.Join(name, child)); err != nil {
+				return err
+			}
+		}
+	}
+	return fs.Remove(name)
+}
+
+// Rename renames a file.
+func (fs *Fs) Rename(oldname, newname string) error {
+	oldname, newname = clean(oldname), clean(newname)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	e, err := fs.lookup(oldname)
+	switch {
+	case err != nil:
+		return pathError("rename", oldname, err)
+	case e.isRoot():
+		return pathError("rename", oldname, syscall.EBUSY)
+	case oldname == newname:
+		return nil
+	case e.isDir() && strings.HasPrefix(newname, oldname+"/"):
+		return pathError("rename", newname, syscall.EINVAL)
+	}
+	dir, err := fs.parent(newname)
+	if err != nil {
+		return pathError("rename", newname, err)
+	}
+	// renaming to a name differing only in case finds e again
+	if target, err := fs.lookup(newname); err == nil && target.offset() != e.offset() {
+		switch {
+		case target.isDir():
+			return pathError("rename", newname, os.ErrExist)
+		case e.isDir():
+			return pathError("rename", newname, syscall.ENOTDIR)
+		}
+		if err := fs.remove(target); err != nil {
+			return pathError("rename", newname, err)
+		}
+	}
+
+	old := &dirEntry{slots: e.slots}
+	oldParent := e.parent
+	wasOpen := fs.open[e.offset()] == e
+	e.name = path.Base(newname)
+	if err := fs.addEntry(dir.cluster, e); err != nil {
+		fs.sync()
+		return pathError("rename", newname, err)
+	}
+	if err := fs.deleteEntry(old); err != nil {
+		return pathError("rename", oldname, err)
+	}
+	if wasOpen {
+		delete(fs.open, old.offset())
+		fs.open[e.offset()] = e
+	}
+	if e.isDir() && oldParent != dir.cluster {
+		if err := fs.reparent(e, dir.cluster); err != nil {
+			return pathError("rename", newname, err)
+		}
+	}
+	return fs.sync()
+}
+
+// Stat returns a FileInfo describing the named file, or an error, if any
+// happens.
+func (fs *Fs) Stat(name string) (os.FileInfo, error) {
+	name = clean(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	e, err := fs.lookup(name)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return newFileInfo(e), nil
+}
+
+// Chmod changes the mode of the named file to mode. FAT only knows
+// whether a file is read only.
+func (fs *Fs) Chmod(name string, mode os.FileMode) error {
+	return fs.update("chmod", name, func(e *dirEntry) {
+		if mode&0200 == 0 {
+			e.attr |= attrReadOnly
+		} else {
+			e.attr &^= attrReadOnly
+		}
+	})
+}
+
+// Chown changes the uid and gid of the named file.
+func (fs *Fs) Chown(name string, uid, gid int) error {
+	// FAT has no notion of file owners
+	return iofs.ErrInvalid
+}
+
+// Chtimes changes the access and modification times of the named file
+func (fs *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return fs.update("chtimes", name, func(e *dirEntry) {
+		e.mtime = mtime
+	})
+}
+
+func (fs *Fs) update(op, name string, fn func(e *dirEntry)) error {
+	name = clean(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	e, err := fs.lookup(name)
+	switch {
+	case err != nil:
+		return pathError(op, name, err)
+	case e.isRoot():
+		return nil
+	case fs.readOnly:
+		return pathError(op, name, syscall.EROFS)
+	}
+	fn(e)
+	if err := fs.updateEntry(e); err != nil {
+		return pathError(op, name, err)
+	}
+	return fs.sync()
+}
@@ -58,7 +58,12 @@ func New(opt *Options) stack.LinkEndpoint {
 	}
 	e.eth = ethernet.New(e)
 
-	e.device.SetReceiveCallback(e.onrx)
+	if o, ok := e.device.(ChecksumOffloader); ok {
+		e.cap = o.Capabilities()
+		o.SetChecksumReceiveCallback(e.deliver)
+	} else {
+		e.device.SetReceiveCallback(e.onrx)
+	}
 	return e.eth
 }
 
@@ -158,7 +163,12 @@ func (e *endpoint) Wait() {
 }
 
 func (e *endpoint) onrx(buf []byte) {
+	e.deliver(buf, false)
+}
+
+func (e *endpoint) deliver(buf []byte, csumValid bool) {
 	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{})
 	pkt.Data().AppendView(buffer.NewViewFromBytes(buf))
+	pkt.RXTransportChecksumValidated = csumValid
 	e.eth.DeliverNetworkPacket(tcpip.LinkAddress(""), tcpip.LinkAddress(""), 0, pkt)
 }
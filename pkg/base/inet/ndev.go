@@ -30,6 +30,21 @@ type Device interface {
 	SetReceiveCallback(func(b []byte))
 }
 
+// ChecksumOffloader is implemented by devices that can take checksum work
+// off the network stack.
+type ChecksumOffloader interface {
+	// Capabilities returns the offloads negotiated with the hardware.
+	Capabilities() stack.LinkEndpointCapabilities
+	// SetChecksumReceiveCallback is used instead of SetReceiveCallback and
+	// tells the callback whether the hardware validated the transport
+	// checksum of the frame.
+	SetChecksumReceiveCallback(func(b []byte, csumValid bool))
+}
+
+// RegisterDevice is called by drivers once they found their device. The
+// first registered device becomes the DefaultDevice.
 func RegisterDevice(d Device) {
-	DefaultDevice = d
+	if DefaultDevice == nil {
+		DefaultDevice = d
+	}
 }
@@ -39,6 +39,17 @@ TEXT ·rt0(SB), NOSPLIT, $0-0
 
 	// never return
 
+// apEntry is where application processors come from the trampoline, with
+// the stack set up and DI holding their cpu.
+TEXT ·apEntry(SB), NOSPLIT, $0
+	XORQ BP, BP
+	SUBQ $0x10, SP
+	MOVQ DI, 0(SP)
+	CALL ·apmain(SB)
+	INT  $3
+
+	// never return
+
 // go_entry invokes _rt0_amd64_linux of the Go runtime.
 TEXT ·go_entry(SB), NOSPLIT, $0
 	SUBQ  $256, SP
@@ -107,3 +118,12 @@ TEXT ·cpuid(SB), NOSPLIT, $0-24
 	MOVL CX, ecx+16(FP)
 	MOVL DX, edx+20(FP)
 	RET
+
+// rdtsc() uint64 - Read Time-Stamp Counter, after earlier instructions.
+TEXT ·rdtsc(SB), NOSPLIT, $0-8
+	LFENCE
+	RDTSC
+	SHLQ $32, DX
+	ORQ  DX, AX
+	MOVQ AX, ret+0(FP)
+	RET
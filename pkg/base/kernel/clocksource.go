@@ -0,0 +1,279 @@
+package kernel
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/bhojpur/kernel/pkg/base/drivers/hpet"
+	"github.com/bhojpur/kernel/pkg/base/kernel/mm"
+	"github.com/bhojpur/kernel/pkg/base/kernel/sys"
+	"github.com/bhojpur/kernel/pkg/base/log"
+)
+
+// clocksources, nanosecond reads the one picked by clocksourceInit
+const (
+	_CLOCK_PIT = iota
+	_CLOCK_HPET
+	_CLOCK_KVM
+	_CLOCK_TSC
+)
+
+const (
+	_CPUID_ECX_HYPERVISOR    = 1 << 31
+	_CPUID_FN_EXT_MAX        = 0x80000000
+	_CPUID_FN_POWER          = 0x80000007
+	_CPUID_EDX_INVARIANT_TSC = 1 << 8
+
+	_CPUID_FN_KVM_SIGNATURE = 0x40000000
+	_CPUID_FN_KVM_FEATURES  = 0x40000001
+	// "KVMKVMKVM\0\0\0" in ebx, ecx and edx
+	_KVM_SIGNATURE_EBX = 0x4b4d564b
+	_KVM_SIGNATURE_ECX = 0x564b4d56
+	_KVM_SIGNATURE_EDX = 0x0000004d
+
+	_KVM_FEATURE_CLOCKSOURCE2       = 1 << 3
+	_KVM_FEATURE_CLOCKSOURCE_STABLE = 1 << 24
+	_MSR_KVM_SYSTEM_TIME_NEW        = 0x4b564d01
+	_PVCLOCK_TSC_STABLE             = 1 << 0
+
+	// the TSC is calibrated over this long
+	_TSC_CALIBRATE_TIME = 10 * ms
+)
+
+var (
+	clocksourceNames = [...]string{
+		_CLOCK_PIT:  "pit",
+		_CLOCK_HPET: "hpet",
+		_CLOCK_KVM:  "kvmclock",
+		_CLOCK_TSC:  "tsc",
+	}
+
+	clocksource = _CLOCK_PIT
+	// converts the cycles of the TSC and the HPET to nanoseconds, see
+	// cyclesToNs
+	clockMult uint64
+	// the cycle count, or kvmclock time, nanosecond counts from
+	clockCycleBase uint64
+
+	// the address of the pvclockTime of the boot cpu
+	kvmclock uintptr
+)
+
+// pvclockTime is the time info the host keeps up to date for kvmclock,
+// the version is odd while an update is in progress.
+type pvclockTime struct {
+	version        uint32
+	_              uint32
+	tscTimestamp   uint64
+	systemTime     uint64
+	tscToSystemMul uint32
+	tscShift       int8
+	flags          uint8
+	_              [2]uint8
+}
+
+// rdtsc reads the time stamp counter, after every earlier instruction
+// has completed
+//
+//go:nosplit
+func rdtsc() uint64
+
+// cyclesToNs returns cycles*mult>>32, mult being the nanoseconds per cycle
+// shifted left 32
+//
+//go:nosplit
+func cyclesToNs(cycles, mult uint64) uint64 {
+	hi, lo := bits.Mul64(cycles, mult)
+	return hi<<32 | lo>>32
+}
+
+// nanosecond reads the clocksource, counting from about the time it was
+// picked
+//
+//go:nosplit
+func nanosecond() int64 {
+	switch clocksource {
+	case _CLOCK_TSC:
+		return int64(cyclesToNs(rdtsc()-clockCycleBase, clockMult))
+	case _CLOCK_HPET:
+		return int64(cyclesToNs(hpet.Counter()-clockCycleBase, clockMult))
+	case _CLOCK_KVM:
+		return int64(kvmclockRead() - clockCycleBase)
+	}
+	return pitNanosecond()
+}
+
+//go:nosplit
+func tscInvariant() bool {
+	max, _, _, _ := cpuid(_CPUID_FN_EXT_MAX, 0)
+	if max < _CPUID_FN_POWER {
+		return false
+	}
+	_, _, _, edx := cpuid(_CPUID_FN_POWER, 0)
+	return edx&_CPUID_EDX_INVARIANT_TSC != 0
+}
+
+// tscCalibrate returns the nanoseconds per TSC cycle shifted left 32,
+// measured against the HPET, or the PIT when there is no HPET
+//
+//go:nosplit
+func tscCalibrate() uint64 {
+	var cycles, elapsed uint64
+	if hpet.Enabled() {
+		mult := hpetMult()
+		h0 := hpet.Counter()
+		t0 := rdtsc()
+		for {
+			elapsed = cyclesToNs(hpet.Counter()-h0, mult)
+			if elapsed >= _TSC_CALIBRATE_TIME {
+				break
+			}
+			sys.Pause()
+		}
+		cycles = rdtsc() - t0
+	} else {
+		t0 := rdtsc()
+		udelay(_TSC_CALIBRATE_TIME / 1000)
+		cycles = rdtsc() - t0
+		elapsed = _TSC_CALIBRATE_TIME
+	}
+	if cycles == 0 {
+		return 0
+	}
+	return elapsed << 32 / cycles
+}
+
+//go:nosplit
+func tscInit() bool {
+	if !tscInvariant() {
+		return false
+	}
+	clockMult = tscCalibrate()
+	if clockMult == 0 {
+		return false
+	}
+	clockCycleBase = rdtsc()
+	return true
+}
+
+//go:nosplit
+func hpetMult() uint64 {
+	// femtoseconds to nanoseconds
+	return uint64(hpet.Period()) << 32 / 1000000
+}
+
+//go:nosplit
+func hpetInit() bool {
+	if !hpet.Enabled() {
+		return false
+	}
+	clockMult = hpetMult()
+	clockCycleBase = hpet.Counter()
+	return true
+}
+
+//go:nosplit
+func kvmclockRead() uint64 {
+	p := (*pvclockTime)(unsafe.Pointer(kvmclock))
+	for {
+		version := atomic.LoadUint32(&p.version)
+		if version&1 != 0 {
+			sys.Pause()
+			continue
+		}
+		delta := rdtsc() - p.tscTimestamp
+		if p.tscShift >= 0 {
+			delta <<= uint(p.tscShift)
+		} else {
+			delta >>= uint(-p.tscShift)
+		}
+		t := p.systemTime + cyclesToNs(delta, uint64(p.tscToSystemMul))
+		if atomic.LoadUint32(&p.version) == version {
+			return t
+		}
+	}
+}
+
+// kvmclockInit registers the time info of the boot cpu with the host. It
+// is only used when the host keeps the TSCs of all cpus in sync, so any
+// cpu can read it.
+//
+//go:nosplit
+func kvmclockInit() bool {
+	_, _, ecx, _ := cpuid(_CPUID_FN_STD, 0)
+	if ecx&_CPUID_ECX_HYPERVISOR == 0 {
+		return false
+	}
+	_, ebx, ecx, edx := cpuid(_CPUID_FN_KVM_SIGNATURE, 0)
+	if ebx != _KVM_SIGNATURE_EBX || ecx != _KVM_SIGNATURE_ECX || edx != _KVM_SIGNATURE_EDX {
+		return false
+	}
+	features, _, _, _ := cpuid(_CPUID_FN_KVM_FEATURES, 0)
+	if features&_KVM_FEATURE_CLOCKSOURCE2 == 0 || features&_KVM_FEATURE_CLOCKSOURCE_STABLE == 0 {
+		return false
+	}
+	page := mm.Alloc()
+	// bit 0 enables the updates
+	wrmsr(_MSR_KVM_SYSTEM_TIME_NEW, page|1)
+	p := (*pvclockTime)(unsafe.Pointer(page))
+	if p.flags&_PVCLOCK_TSC_STABLE == 0 {
+		wrmsr(_MSR_KVM_SYSTEM_TIME_NEW, 0)
+		return false
+	}
+	kvmclock = page
+	clockCycleBase = kvmclockRead()
+	return true
+}
+
+// clocksourceWanted reports whether cs may be used, the
+// BHOJPUR_KERNEL_CLOCKSOURCE command line argument names the only one
+// tried before falling back to the PIT
+//
+//go:nosplit
+func clocksourceWanted(want []byte, cs int) bool {
+	return len(want) == 0 || string(want) == clocksourceNames[cs]
+}
+
+// clocksourceInit picks the clocksource, in order of preference the
+// invariant TSC, kvmclock, the HPET and the PIT. It must run after
+// apicInit, which finds the ACPI tables.
+//
+//go:nosplit
+func clocksourceInit() {
+	want := kernelParam("BHOJPUR_KERNEL_CLOCKSOURCE")
+	hpet.Init()
+	switch {
+	case clocksourceWanted(want, _CLOCK_TSC) && tscInit():
+		clocksource = _CLOCK_TSC
+	case clocksourceWanted(want, _CLOCK_KVM) && kvmclockInit():
+		clocksource = _CLOCK_KVM
+	case clocksourceWanted(want, _CLOCK_HPET) && hpetInit():
+		clocksource = _CLOCK_HPET
+	default:
+		clocksource = _CLOCK_PIT
+	}
+	log.PrintStr("clocksource: ")
+	log.PrintStr(clocksourceNames[clocksource])
+	log.PrintStr("\n")
+}
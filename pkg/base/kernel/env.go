@@ -144,3 +144,51 @@ func strtok(pos *uintptr) uintptr {
 func bytedef(addr uintptr) byte {
 	return *(*byte)(unsafe.Pointer(addr))
 }
+
+// kernelParam returns the value of a name=value argument of the kernel
+// command line, nil if it is absent. Must be called before prepareArgs
+// splits the command line.
+//go:nosplit
+func kernelParam(name string) []byte {
+	info := multiboot.BootInfo
+	if info.Flags&multiboot.FlagInfoCmdline == 0 || info.Cmdline == 0 {
+		return nil
+	}
+	addr := uintptr(info.Cmdline)
+	for {
+		for bytedef(addr) == ' ' {
+			addr++
+		}
+		if bytedef(addr) == 0 {
+			return nil
+		}
+		start := addr
+		for ch := bytedef(addr); ch != ' ' && ch != 0; ch = bytedef(addr) {
+			addr++
+		}
+		arg := sys.UnsafeBuffer(start, int(addr-start))
+		if len(arg) > len(name) && arg[len(name)] == '=' && string(arg[:len(name)]) == name {
+			return arg[len(name)+1:]
+		}
+	}
+}
+
+// parseSize parses a decimal number with an optional K or M suffix, it
+// returns 0 if s is not one.
+//go:nosplit
+func parseSize(s []byte) uintptr {
+	var n uintptr
+	for i, ch := range s {
+		switch {
+		case ch >= '0' && ch <= '9':
+			n = n*10 + uintptr(ch-'0')
+		case i == len(s)-1 && i > 0 && (ch == 'k' || ch == 'K'):
+			return n << 10
+		case i == len(s)-1 && i > 0 && (ch == 'm' || ch == 'M'):
+			return n << 20
+		default:
+			return 0
+		}
+	}
+	return n
+}
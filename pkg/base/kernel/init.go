@@ -34,5 +34,6 @@ func Init() {
 func clockTimeInit() {
 	t := clock.ReadCmosTime()
 	baseUnixTime = t.Time().Unix()
-	clockBaseCounter = counter
+	clockBaseTime = nanosecond()
+	vdsoUpdate()
 }
@@ -109,6 +109,34 @@ func (k *kmmt) alloc() uintptr {
 	return uintptr(unsafe.Pointer(r))
 }
 
+// allocContig takes n physically contiguous pages off the free list.
+// freeRange pushes pages in ascending order, so contiguous runs show up
+// in descending order when walking the list.
+//
+//go:nosplit
+func (k *kmmt) allocContig(n int) uintptr {
+	var prev *page
+	for r := k.freelist; r != nil; prev, r = r, r.next {
+		last, cnt := r, 1
+		for cnt < n && last.next != nil && uintptr(unsafe.Pointer(last.next))+PGSIZE == uintptr(unsafe.Pointer(last)) {
+			last = last.next
+			cnt++
+		}
+		if cnt < n {
+			continue
+		}
+		if prev == nil {
+			k.freelist = last.next
+		} else {
+			prev.next = last.next
+		}
+		k.stat.alloc += n
+		return uintptr(unsafe.Pointer(last))
+	}
+	throw("kmemt.allocContig")
+	return 0
+}
+
 //go:nosplit
 func (k *kmmt) freeRange(start, end uintptr) {
 	p := pageRoundUp(start)
@@ -226,6 +254,30 @@ func Fixmap(va, pa, size uintptr) {
 	lcr3(vmm.topPage)
 }
 
+// Flush reloads the page table, dropping the TLB entries another cpu may
+// have left stale by unmapping pages.
+//
+//go:nosplit
+func Flush() {
+	lcr3(vmm.topPage)
+}
+
+// TopPage returns the physical address of the top level page table, shared
+// by all cpus.
+//
+//go:nosplit
+func TopPage() uintptr {
+	return uintptr(unsafe.Pointer(vmm.topPage))
+}
+
+// Mapped reports whether the page holding va is mapped.
+//
+//go:nosplit
+func Mapped(va uintptr) bool {
+	pte := vmm.walkpgdir(pageRoundDown(va), false)
+	return pte != nil && pte.present()
+}
+
 //go:nosplit
 func Alloc() uintptr {
 	ptr := kmm.alloc()
@@ -236,6 +288,19 @@ func Alloc() uintptr {
 	return ptr
 }
 
+// AllocContig allocates n physically contiguous zeroed pages, for devices
+// that need a DMA area larger than a page.
+//
+//go:nosplit
+func AllocContig(n int) uintptr {
+	ptr := kmm.allocContig(n)
+	buf := sys.UnsafeBuffer(ptr, n*PGSIZE)
+	for i := range buf {
+		buf[i] = 0
+	}
+	return ptr
+}
+
 //go:nosplit
 func (v *vmmt) fixmap(va, pa, size, perm uintptr) bool {
 	p := pageRoundDown(va)
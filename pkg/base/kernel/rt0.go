@@ -42,7 +42,7 @@ func rdmsr(reg uint32) (value uintptr)
 //go:nosplit
 func preinit(magic, mbiptr uintptr) {
 	simdInit()
-	gdtInit()
+	gdtInit(&cpus[0])
 	idtInit()
 	multiboot.Init(magic, mbiptr)
 	mm.Init()
@@ -51,6 +51,10 @@ func preinit(magic, mbiptr uintptr) {
 	trapInit()
 	threadInit()
 	pic.Init()
+	apicInit()
+	clocksourceInit()
 	timerInit()
-	schedule()
+	smpInit()
+	kernelLock(&cpus[0])
+	schedule(&cpus[0])
 }
@@ -39,14 +39,10 @@ const (
 	_TSS_IDX   = 5
 )
 
+// every cpu has its own gdt and tss, see cpu
 var (
-	gdt    [7]gdtSegDesc
-	gdtptr [10]byte
-
 	idt    [256]idtSetDesc
 	idtptr [10]byte
-
-	tss [26]uint32
 )
 
 type gdtSegDesc [8]byte
@@ -105,19 +101,22 @@ func setTssDesc(lo, hi *gdtSegDesc, addr, limit uintptr) {
 }
 
 //go:nosplit
-func gdtInit() {
+func gdtInit(c *cpu) {
+	gdt := &c.gdt
+	gdtptr := &c.gdtptr
+	tss := &c.tss
 	// leave gdt[0] untouched
 	setGdtCodeDesc(&gdt[_KCODE_IDX], segDplKernel)
 	setGdtDataDesc(&gdt[_KDATA_IDX], segDplKernel)
 	setGdtCodeDesc(&gdt[_UCODE_IDX], segDplUser)
 	setGdtDataDesc(&gdt[_UDATA_IDX], segDplUser)
 	tssAddr := uintptr(unsafe.Pointer(&tss[0]))
-	tssLimit := uintptr(unsafe.Sizeof(tss)) - 1
+	tssLimit := uintptr(unsafe.Sizeof(*tss)) - 1
 	setTssDesc(&gdt[_TSS_IDX], &gdt[_TSS_IDX+1], tssAddr, tssLimit)
 
 	limit := (*uint16)(unsafe.Pointer(&gdtptr[0]))
 	base := (*uint64)(unsafe.Pointer(&gdtptr[2]))
-	*limit = uint16(unsafe.Sizeof(gdt) - 1)
+	*limit = uint16(unsafe.Sizeof(*gdt) - 1)
 	*base = uint64(uintptr(unsafe.Pointer(&gdt[0])))
 	lgdt(uintptr(unsafe.Pointer(&gdtptr[0])))
 	ltr(_TSS_IDX << 3)
@@ -148,7 +147,7 @@ func idtInit() {
 }
 
 //go:nosplit
-func setTssSP0(addr uintptr) {
-	tss[1] = uint32(addr)
-	tss[2] = uint32(addr >> 32)
+func setTssSP0(c *cpu, addr uintptr) {
+	c.tss[1] = uint32(addr)
+	c.tss[2] = uint32(addr >> 32)
 }
@@ -0,0 +1,452 @@
+package kernel
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/bhojpur/kernel/pkg/base/drivers/apic"
+	"github.com/bhojpur/kernel/pkg/base/drivers/pic"
+	"github.com/bhojpur/kernel/pkg/base/kernel/mm"
+	"github.com/bhojpur/kernel/pkg/base/kernel/sys"
+	"github.com/bhojpur/kernel/pkg/base/kernel/trap"
+	"github.com/bhojpur/kernel/pkg/base/log"
+)
+
+const (
+	_MAXCPU = apic.MaxCPU
+
+	_IRQ_LAPIC_TIMER = 0xf0
+	_IPI_RESCHED     = 0xf1
+	_IPI_TLB         = 0xf2
+
+	// application processors start in real mode at _TRAMPOLINE, which must
+	// be page aligned, below 1MB and identity mapped
+	_TRAMPOLINE       = 0x7000
+	_TRAMPOLINE_CR3   = _TRAMPOLINE + 0xb0
+	_TRAMPOLINE_STACK = _TRAMPOLINE + 0xb8
+	_TRAMPOLINE_ENTRY = _TRAMPOLINE + 0xc0
+	_TRAMPOLINE_ARG   = _TRAMPOLINE + 0xc8
+)
+
+var (
+	cpus [_MAXCPU]cpu
+	ncpu = 1
+
+	klock bigLock
+
+	// tlbgen is bumped every time pages are unmapped, cpus flush their TLB
+	// when they see a new value
+	tlbgen uintptr
+
+	// local APIC timer ticks per scheduler tick
+	lapicTicks uint32
+
+	// trampoline brings an application processor from real mode to long
+	// mode with the kernel page table, then jumps to the entry slot with
+	// the stack and argument slots in SP and DI. It runs at _TRAMPOLINE.
+	trampoline = [...]byte{
+		// .code16
+		0xfa,       // cli
+		0x31, 0xc0, // xor %ax, %ax
+		0x8e, 0xd8, // mov %ax, %ds
+		0x66, 0x0f, 0x01, 0x16, 0xa0, 0x70, // lgdtl 0x70a0
+		0x0f, 0x20, 0xc0, // mov %cr0, %eax
+		0x0c, 0x01, // or $0x1, %al
+		0x0f, 0x22, 0xc0, // mov %eax, %cr0
+		0x66, 0xea, 0x20, 0x70, 0x00, 0x00, 0x08, 0x00, // ljmpl $0x8, $0x7020
+		0x00, 0x00, 0x00, 0x00, 0x00,
+
+		// .code32
+		0x66, 0xb8, 0x10, 0x00, // mov $0x10, %ax
+		0x8e, 0xd8, // mov %ax, %ds
+		0x8e, 0xc0, // mov %ax, %es
+		0x8e, 0xd0, // mov %ax, %ss
+		0x0f, 0x20, 0xe0, // mov %cr4, %eax
+		0x83, 0xc8, 0x20, // or $0x20, %eax (PAE)
+		0x0f, 0x22, 0xe0, // mov %eax, %cr4
+		0xa1, 0xb0, 0x70, 0x00, 0x00, // mov 0x70b0, %eax
+		0x0f, 0x22, 0xd8, // mov %eax, %cr3
+		0xb9, 0x80, 0x00, 0x00, 0xc0, // mov $0xc0000080, %ecx
+		0x0f, 0x32, // rdmsr
+		0x0d, 0x00, 0x01, 0x00, 0x00, // or $0x100, %eax (EFER.LME)
+		0x0f, 0x30, // wrmsr
+		0x0f, 0x20, 0xc0, // mov %cr0, %eax
+		0x25, 0xff, 0xff, 0xff, 0x9f, // and $0x9fffffff, %eax (caches on)
+		0x0d, 0x00, 0x00, 0x00, 0x80, // or $0x80000000, %eax (PG)
+		0x0f, 0x22, 0xc0, // mov %eax, %cr0
+		0xea, 0x60, 0x70, 0x00, 0x00, 0x18, 0x00, // ljmp $0x18, $0x7060
+
+		// .code64
+		0x48, 0x8b, 0x24, 0x25, 0xb8, 0x70, 0x00, 0x00, // mov 0x70b8, %rsp
+		0x48, 0x8b, 0x3c, 0x25, 0xc8, 0x70, 0x00, 0x00, // mov 0x70c8, %rdi
+		0x48, 0x8b, 0x04, 0x25, 0xc0, 0x70, 0x00, 0x00, // mov 0x70c0, %rax
+		0xff, 0xe0, // jmp *%rax
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+
+		// gdt: null, 32 bit code, data, 64 bit code
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0xff, 0xff, 0x00, 0x00, 0x00, 0x9a, 0xcf, 0x00,
+		0xff, 0xff, 0x00, 0x00, 0x00, 0x92, 0xcf, 0x00,
+		0xff, 0xff, 0x00, 0x00, 0x00, 0x9a, 0xaf, 0x00,
+		// gdtr at 0x70a0
+		0x1f, 0x00, 0x80, 0x70, 0x00, 0x00,
+	}
+)
+
+//go:notinheap
+type cpu struct {
+	id      int
+	apicid  uint8
+	started uint32
+
+	// the context of the scheduler loop, see schedule
+	scheduler *context
+	curr      threadptr
+	idle      threadptr
+
+	// RUNNABLE threads waiting for the cpu, linked by Thread.next
+	runqhead threadptr
+	runqtail threadptr
+	nrun     int
+
+	// the value of tlbgen at the last TLB flush
+	tlbgen uintptr
+
+	// nanoseconds spent running threads and the idle thread
+	busy     int64
+	idletime int64
+	switches int64
+
+	// when tickless, the end of the time slice of the running thread, 0
+	// when idle, and the time the one-shot timer is programmed for
+	sliceEnd  int64
+	timerNext int64
+
+	gdt    [7]gdtSegDesc
+	gdtptr [10]byte
+	tss    [26]uint32
+}
+
+type cpuptr uintptr
+
+//go:nosplit
+func (c cpuptr) ptr() *cpu {
+	return (*cpu)(unsafe.Pointer(c))
+}
+
+//go:nosplit
+func mycpu() *cpu {
+	return Mythread().cpu.ptr()
+}
+
+//go:nosplit
+func (c *cpu) idling() bool {
+	return c.idle != 0 && c.curr == c.idle
+}
+
+//go:nosplit
+func (c *cpu) enqueue(t *Thread) {
+	tp := threadptr(unsafe.Pointer(t))
+	t.next = 0
+	c.nrun++
+	if c.runqhead == 0 {
+		c.runqhead, c.runqtail = tp, tp
+		return
+	}
+	// the trap and syscall threads go first, like they always did
+	if t == traptask.ptr() || t == syscalltask.ptr() {
+		t.next = c.runqhead
+		c.runqhead = tp
+		return
+	}
+	c.runqtail.ptr().next = tp
+	c.runqtail = tp
+}
+
+//go:nosplit
+func (c *cpu) dequeue() *Thread {
+	t := c.runqhead.ptr()
+	if t == nil {
+		return nil
+	}
+	c.runqhead = t.next
+	if c.runqhead == 0 {
+		c.runqtail = 0
+	}
+	t.next = 0
+	c.nrun--
+	return t
+}
+
+// bigLock is the big kernel lock. The kernel code was written for one cpu,
+// so a cpu takes the lock on every entry into the kernel and gives it back
+// in trapret. The scheduler loop runs with the lock held, switching to a
+// thread hands it over to the thread.
+type bigLock struct {
+	v     uint32
+	owner cpuptr
+	depth int
+}
+
+//go:nosplit
+func kernelLock(c *cpu) {
+	l := &klock
+	// faults in the kernel nest
+	if l.owner == cpuptr(unsafe.Pointer(c)) {
+		l.depth++
+		return
+	}
+	for !atomic.CompareAndSwapUint32(&l.v, 0, 1) {
+		sys.Pause()
+	}
+	l.owner = cpuptr(unsafe.Pointer(c))
+	l.depth = 1
+}
+
+// kernelUnlock is called by trapret
+//
+//go:nosplit
+func kernelUnlock() {
+	l := &klock
+	l.depth--
+	if l.depth > 0 {
+		return
+	}
+	l.owner = 0
+	atomic.StoreUint32(&l.v, 0)
+}
+
+// ready makes t RUNNABLE and queues it on the cpu it last ran on, or on an
+// idle cpu when that one is busy.
+//
+//go:nosplit
+func ready(t *Thread) {
+	t.state = RUNNABLE
+	c := t.cpu.ptr()
+	if c == nil || !c.idling() {
+		for i := 0; i < ncpu; i++ {
+			if cpus[i].idling() {
+				c = &cpus[i]
+				break
+			}
+		}
+	}
+	if c == nil {
+		c = mycpu()
+	}
+	c.enqueue(t)
+	if c.idling() && c != mycpu() {
+		apic.SendIPI(c.apicid, _IPI_RESCHED)
+	}
+}
+
+// steal takes a thread from the cpu with the longest run queue
+//
+//go:nosplit
+func steal(c *cpu) *Thread {
+	var victim *cpu
+	for i := 0; i < ncpu; i++ {
+		v := &cpus[i]
+		if v == c || v.nrun == 0 {
+			continue
+		}
+		if victim == nil || v.nrun > victim.nrun {
+			victim = v
+		}
+	}
+	if victim == nil {
+		return nil
+	}
+	return victim.dequeue()
+}
+
+//go:nosplit
+func tlbSync(c *cpu) {
+	if c.tlbgen != tlbgen {
+		mm.Flush()
+		c.tlbgen = tlbgen
+	}
+}
+
+// tlbShootdown makes the other cpus drop the mappings removed by the caller
+//
+//go:nosplit
+func tlbShootdown() {
+	if ncpu == 1 {
+		return
+	}
+	tlbgen++
+	mycpu().tlbgen = tlbgen
+	apic.BroadcastIPI(_IPI_TLB)
+}
+
+//go:nosplit
+func lapicTimerIntr() {
+	apic.EOI()
+	if tickless {
+		tickIntr()
+		return
+	}
+	Yield()
+}
+
+//go:nosplit
+func reschedIntr() {
+	apic.EOI()
+	Yield()
+}
+
+// tlbIntr has nothing to do, the TLB is flushed on kernel entry
+//
+//go:nosplit
+func tlbIntr() {
+	apic.EOI()
+}
+
+//go:nosplit
+func schedTickWait() {
+	udelay(second / _HZ / 1000)
+}
+
+// apicInit switches interrupt delivery from the 8259 to the APICs when the
+// machine has them
+//
+//go:nosplit
+func apicInit() {
+	if !apic.Init() {
+		return
+	}
+	pic.Disable()
+	cpus[0].apicid = apic.CPUID(0)
+	lapicTicks = apic.CalibrateTimer(schedTickWait)
+
+	trap.Register(_IRQ_LAPIC_TIMER, lapicTimerIntr)
+	trap.Register(_IPI_RESCHED, reschedIntr)
+	trap.Register(_IPI_TLB, tlbIntr)
+	trap.Register(apic.SpuriousVector, ignoreHandler)
+}
+
+//go:nosplit
+func apEntry()
+
+// apmain is the first Go code run by an application processor
+//
+//go:nosplit
+func apmain(c *cpu) {
+	simdInit()
+	gdtInit(c)
+	lidt(uintptr(unsafe.Pointer(&idtptr)))
+	syscallInitCPU()
+	apic.InitCPU()
+	// the boot cpu is preempted by the PIT, tickless cpus arm their timer
+	// in switchto
+	if !tickless {
+		apic.StartTimer(_IRQ_LAPIC_TIMER, lapicTicks)
+	}
+	kernelLock(c)
+	atomic.StoreUint32(&c.started, 1)
+	schedule(c)
+}
+
+//go:nosplit
+func startCPU(c *cpu) bool {
+	*(*uintptr)(unsafe.Pointer(uintptr(_TRAMPOLINE_CR3))) = mm.TopPage()
+	*(*uintptr)(unsafe.Pointer(uintptr(_TRAMPOLINE_STACK))) = allocThreadStack()
+	*(*uintptr)(unsafe.Pointer(uintptr(_TRAMPOLINE_ENTRY))) = sys.FuncPC(apEntry)
+	*(*uintptr)(unsafe.Pointer(uintptr(_TRAMPOLINE_ARG))) = uintptr(unsafe.Pointer(c))
+
+	// INIT-SIPI-SIPI, the second SIPI is ignored by a cpu already running
+	apic.SendInit(c.apicid)
+	udelay(10000)
+	for i := 0; i < 2; i++ {
+		apic.SendStartup(c.apicid, _TRAMPOLINE)
+		udelay(200)
+	}
+	for i := 0; i < 1000; i++ {
+		if atomic.LoadUint32(&c.started) != 0 {
+			return true
+		}
+		udelay(100)
+	}
+	// park it again so it can't show up later
+	apic.SendInit(c.apicid)
+	return false
+}
+
+// smpInit starts the application processors one by one, each entering its
+// own scheduler loop.
+//
+//go:nosplit
+func smpInit() {
+	if !apic.Enabled() {
+		return
+	}
+	copy(sys.UnsafeBuffer(_TRAMPOLINE, len(trampoline)), trampoline[:])
+	n := apic.NumCPU()
+	if n > _MAXCPU {
+		n = _MAXCPU
+	}
+	for i := 1; i < n; i++ {
+		c := &cpus[ncpu]
+		c.id = ncpu
+		c.apicid = apic.CPUID(i)
+		if !startCPU(c) {
+			log.PrintStr("smp: cpu ")
+			log.PrintHex(uintptr(c.apicid))
+			log.PrintStr(" did not start\n")
+			continue
+		}
+		ncpu++
+	}
+}
+
+// CPUCounter holds the nanoseconds a cpu spent running threads and idling,
+// and the number of thread switches it made.
+type CPUCounter struct {
+	Busy     int64
+	Idle     int64
+	Switches int64
+}
+
+// NumCPU returns the number of cpus threads are scheduled on.
+func NumCPU() int {
+	return ncpu
+}
+
+// CPUStat fills stat with the counters of each cpu and returns the number
+// of cpus.
+func CPUStat(stat []CPUCounter) int {
+	n := ncpu
+	if n > len(stat) {
+		n = len(stat)
+	}
+	for i := 0; i < n; i++ {
+		c := &cpus[i]
+		stat[i] = CPUCounter{
+			Busy:     c.busy,
+			Idle:     c.idletime,
+			Switches: c.switches,
+		}
+	}
+	return ncpu
+}
@@ -0,0 +1,52 @@
+package sys
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import "sync/atomic"
+
+const flagsIF = 0x200
+
+// Spinlock is a busy waiting lock that keeps interrupts disabled while it is
+// held, so that kernel code and Go code running on other cpus can share a
+// device without one of them being preempted with the lock taken.
+type Spinlock struct {
+	v     uint32
+	flags uintptr
+}
+
+//go:nosplit
+func (l *Spinlock) Lock() {
+	flags := Flags()
+	Cli()
+	for !atomic.CompareAndSwapUint32(&l.v, 0, 1) {
+		Pause()
+	}
+	l.flags = flags
+}
+
+//go:nosplit
+func (l *Spinlock) Unlock() {
+	flags := l.flags
+	atomic.StoreUint32(&l.v, 0)
+	if flags&flagsIF != 0 {
+		Sti()
+	}
+}
@@ -32,6 +32,12 @@ func Outb(port uint16, data byte)
 //go:nosplit
 func Inb(port uint16) byte
 
+//go:nosplit
+func Outw(port uint16, data uint16)
+
+//go:nosplit
+func Inw(port uint16) uint16
+
 //go:nosplit
 func Outl(port uint16, data uint32)
 
@@ -47,6 +53,9 @@ func Sti()
 //go:nosplit
 func Hlt()
 
+//go:nosplit
+func Pause()
+
 //go:nosplit
 func Cr2() uintptr
 
@@ -34,3 +34,8 @@ TEXT ·Sti(SB), NOSPLIT, $0
 TEXT ·Hlt(SB), NOSPLIT, $0
 	HLT
 	RET
+
+// PAUSE - Spin Loop Hint
+TEXT ·Pause(SB), NOSPLIT, $0
+	PAUSE
+	RET
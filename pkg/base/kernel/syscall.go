@@ -79,6 +79,7 @@ var (
 		syscall.SYS_SCHED_YIELD,
 		syscall.SYS_MADVISE,
 		syscall.SYS_EXIT_GROUP,
+		syscall.SYS_EXIT,
 
 		// TODO: real random
 		unix.SYS_GETRANDOM,
@@ -207,7 +208,7 @@ func doSyscall(req *isyscall.Request) {
 	case syscall.SYS_ARCH_PRCTL:
 		sysArchPrctl(req)
 	case syscall.SYS_SCHED_GETAFFINITY:
-		req.SetRet(0)
+		sysSchedGetaffinity(req)
 	case syscall.SYS_OPENAT:
 		req.SetRet(isyscall.Errno(errno.ENOSYS))
 	case syscall.SYS_MMAP:
@@ -237,6 +238,8 @@ func doSyscall(req *isyscall.Request) {
 		Yield()
 	case syscall.SYS_EXIT_GROUP:
 		sysExitGroup(req)
+	case syscall.SYS_EXIT:
+		exit()
 
 	case unix.SYS_GETRANDOM:
 		req.SetRet(req.Arg(1))
@@ -302,6 +305,7 @@ func sysMunmap(req *isyscall.Request) {
 	addr := req.Arg(0)
 	n := req.Arg(1)
 	mm.Munmap(addr, n)
+	tlbShootdown()
 }
 
 //go:nosplit
@@ -347,9 +351,31 @@ func sysClone(req *isyscall.Request) {
 	stack := req.Arg(1)
 	tls := req.Arg(4)
 	tid := clone(pc, stack, flags, tls)
+	if tid < 0 {
+		req.SetRet(isyscall.Errno(errno.EAGAIN))
+		return
+	}
 	req.SetRet(uintptr(tid))
 }
 
+// sysSchedGetaffinity reports every cpu, the runtime sizes GOMAXPROCS
+// from it
+//go:nosplit
+func sysSchedGetaffinity(req *isyscall.Request) {
+	size := req.Arg(1)
+	mask := req.Arg(2)
+	if size < sys.PtrSize {
+		req.SetRet(isyscall.Errno(errno.EINVAL))
+		return
+	}
+	var bits uintptr
+	for i := 0; i < ncpu; i++ {
+		bits |= 1 << uint(i)
+	}
+	*(*uintptr)(unsafe.Pointer(mask)) = bits
+	req.SetRet(sys.PtrSize)
+}
+
 //go:nosplit
 func sysFutex(req *isyscall.Request) {
 	addr := (*uintptr)(unsafe.Pointer(req.Arg(0)))
@@ -418,11 +444,39 @@ func sysEpollNotify(req *isyscall.Request) {
 	epollNotify(req.Arg(0), req.Arg(1))
 }
 
-const vdsoGettimeofdaySym = 0xffffffffff600000
+const (
+	vdsoGettimeofdaySym = 0xffffffffff600000
+	// vdsoData lives in the same page, after the code
+	vdsoDataOffset = 0x800
+)
 
+// vdsoData lets vdsoGettimeofday read the time without a system call when
+// the clocksource is the TSC. The layout must be synced with syscall.s.
+type vdsoData struct {
+	tscBase uint64
+	mult    uint64
+	// the unix time in nanoseconds at tscBase, 0 until the TSC is usable
+	walltime int64
+}
+
+// vdsoGettimeofday is the gettimeofday of the vsyscall page, it fills a
+// timeval
 //go:nosplit
 func vdsoGettimeofday()
 
+// vdsoUpdate publishes the clocksource to vdsoGettimeofday, it is called
+// once the wall time is known
+//go:nosplit
+func vdsoUpdate() {
+	if clocksource != _CLOCK_TSC {
+		return
+	}
+	d := (*vdsoData)(unsafe.Pointer(uintptr(vdsoGettimeofdaySym + vdsoDataOffset)))
+	d.tscBase = clockCycleBase
+	d.mult = clockMult
+	d.walltime = baseUnixTime*second - clockBaseTime
+}
+
 //go:nosplit
 func vdsoInit() {
 	dst := sys.UnsafeBuffer(mm.Mmap(vdsoGettimeofdaySym, 0x100), 0x100)
@@ -430,8 +484,9 @@ func vdsoInit() {
 	copy(dst, src)
 }
 
+// syscallInitCPU sets up the SYSCALL instruction, on every cpu
 //go:nosplit
-func syscallInit() {
+func syscallInitCPU() {
 	// write syscall selector
 	wrmsr(_MSR_STAR, 8<<32)
 	// clear IF when enter syscall
@@ -442,7 +497,11 @@ func syscallInit() {
 	// Enable SYSCALL instruction.
 	efer := rdmsr(_MSR_IA32_EFER)
 	wrmsr(_MSR_IA32_EFER, efer|_EFER_SCE)
+}
 
+//go:nosplit
+func syscallInit() {
+	syscallInitCPU()
 	trap.Register(0x80, syscallIntr)
 	epollInit()
 	vdsoInit()
@@ -66,11 +66,58 @@ TEXT ·syscallEntry(SB), NOSPLIT, $0
 	// jmp INT 0x80
 	JMP ·trap128(SB)
 
+// the vdsoData page, see syscall.go
+#define vdso_data 0xffffffffff600800
+#define vdso_tscbase 0
+#define vdso_mult 8
+#define vdso_walltime 16
+
+// vdsoGettimeofday is copied to the vsyscall page, it must not refer to
+// anything by a relative address
 TEXT ·vdsoGettimeofday(SB), NOSPLIT, $0
-	MOVQ $SYS_clockgettime, AX
+	MOVQ $vdso_data, R8
+	MOVQ vdso_walltime(R8), R9
+	CMPQ R9, $0
+	JEQ  fallback
+
+	// nanoseconds since tscbase, (tsc - tscbase) * mult >> 32
+	LFENCE
+	RDTSC
+	SHLQ $32, DX
+	ORQ  DX, AX
+	SUBQ vdso_tscbase(R8), AX
+	MULQ vdso_mult(R8)
+	SHRQ $32, AX
+	SHLQ $32, DX
+	ORQ  DX, AX
+	ADDQ R9, AX
+
+	// DI store *Timeval
+	MOVQ $1000, CX
+	XORQ DX, DX
+	DIVQ CX
+	MOVQ $1000000, CX
+	XORQ DX, DX
+	DIVQ CX
+	MOVQ AX, 0(DI)
+	MOVQ DX, 8(DI)
+	XORQ AX, AX
+	RET
 
-	// DI store *TimeSpec, but clockgettime need SI
+fallback:
+	// DI store *Timeval, but clockgettime need SI
 	MOVQ DI, SI
 	MOVQ $0, DI
+	MOVQ $SYS_clockgettime, AX
+	PUSHQ SI
 	INT  $0x80
+	POPQ SI
+
+	// nanoseconds to microseconds
+	MOVQ 8(SI), AX
+	MOVQ $1000, CX
+	XORQ DX, DX
+	DIVQ CX
+	MOVQ AX, 8(SI)
+	XORQ AX, AX
 	RET
@@ -28,17 +28,25 @@ import (
 )
 
 const (
-	_NTHREDS = 20
+	// the thread table grows on demand up to the BHOJPUR_KERNEL_MAX_THREADS
+	// command line argument, which can't exceed _MAX_THREDS
+	_MAX_THREDS     = 4096
+	_DEFAULT_THREDS = 1024
 
 	_FLAGS_IF        = 0x200
 	_FLAGS_IOPL_USER = 0x3000
 
 	_RPL_USER = 3
 
+	// the default kernel stack size, BHOJPUR_KERNEL_STACK_SIZE=64K on the
+	// command line changes it
 	_THREAD_STACK_SIZE         = 32 << 10
+	_THREAD_STACK_MIN          = 16 << 10
 	_THREAD_STACK_GUARD_OFFSET = 1 << 10
 
-	_CLONE_IDLE = 0x8000000000000000
+	// the idle thread of the cpu in the low byte
+	_CLONE_IDLE     = 0x8000000000000000
+	_CLONE_IDLE_CPU = 0xff
 )
 
 const (
@@ -56,9 +64,13 @@ const (
 )
 
 var (
-	threads    [_NTHREDS]Thread
-	scheduler  *context
-	idleThread threadptr
+	// threads is indexed by thread id, exited threads are reused
+	threads    [_MAX_THREDS]threadptr
+	nthreads   int
+	maxThreads = _DEFAULT_THREDS
+	threadPool mm.Pool
+
+	threadStackSize uintptr = _THREAD_STACK_SIZE
 )
 
 //go:notinheap
@@ -93,42 +105,58 @@ type Thread struct {
 	// sysmon 会调用usleep，进而调用sleepon，如果sleepKey是个指针会触发gcWriteBarrier
 	// 而sysmon没有P，会导致空指针
 	sleepKey uintptr
-	// for sleep timeout
-	timerKey uintptr
+	// the nanosecond a sleep times out, 0 for none
+	deadline int64
 
 	// store goroutine tls
 	fsBase uintptr
 
 	// 用于保存需要转发的系统调用栈帧
 	systf trapFrame
+
+	// the cpu the thread runs or last ran on
+	cpu cpuptr
+	// next thread in the run queue of cpu
+	next threadptr
 }
 
+// allocThread returns nil when the thread table is full
 //go:nosplit
 func allocThread() *Thread {
 	var t *Thread
-	for i := 0; i < _NTHREDS; i++ {
-		tt := &threads[i]
-		if tt.state == UNUSED {
+	for i := 0; i < nthreads; i++ {
+		tt := threads[i].ptr()
+		if tt.state == EXIT {
 			t = tt
-			t.id = i
 			break
 		}
 	}
-	if t == nil {
-		throw("no thread slot available")
+	if t != nil {
+		// keep the stack and fpu area of the exited thread
+		id, kstack, fpstate := t.id, t.kstack, t.fpstate
+		sys.Memclr(uintptr(unsafe.Pointer(t)), int(unsafe.Sizeof(*t)))
+		t.id, t.kstack, t.fpstate = id, kstack, fpstate
+	} else {
+		if nthreads == maxThreads {
+			return nil
+		}
+		t = (*Thread)(unsafe.Pointer(threadPool.Alloc()))
+		t.id = nthreads
+		threads[nthreads] = threadptr(unsafe.Pointer(t))
+		nthreads++
+		t.kstack = allocThreadStack()
+		t.fpstate = mm.Alloc()
 	}
 
 	t.state = INITING
-	t.kstack = allocThreadStack()
-	t.fpstate = mm.Alloc()
 	t.threadTLS[0] = uintptr(unsafe.Pointer(t))
 	return t
 }
 
 //go:nosplit
 func allocThreadStack() uintptr {
-	stack := mm.Mmap(0, _THREAD_STACK_SIZE)
-	stack += _THREAD_STACK_SIZE - _THREAD_STACK_GUARD_OFFSET
+	stack := mm.Mmap(0, threadStackSize)
+	stack += threadStackSize - _THREAD_STACK_GUARD_OFFSET
 	return stack
 }
 
@@ -167,12 +195,15 @@ func switchThreadContext(t *Thread) {
 	setGS(uintptr(unsafe.Pointer(&t.threadTLS)))
 
 	// use current thread esp0 in tss
-	setTssSP0(t.kstack)
+	setTssSP0(t.cpu.ptr(), t.kstack)
 }
 
 //go:nosplit
 func thread0Init() {
 	t := allocThread()
+	if t == nil {
+		throw("no thread slot for thread0")
+	}
 	t.stack = allocThreadStack()
 
 	sp := t.kstack
@@ -200,7 +231,10 @@ func thread0Init() {
 	ctx.ip = sys.FuncPC(trapret)
 	t.context = ctx
 
+	// thread0 starts on the boot cpu
+	t.cpu = cpuptr(unsafe.Pointer(&cpus[0]))
 	t.state = RUNNABLE
+	cpus[0].enqueue(t)
 }
 
 //go:nosplit
@@ -219,12 +253,15 @@ func thread0() {
 
 // run when after main init
 func idleInit() {
-	// thread0 clone idle thread
-	stack := mm.SysMmap(0, _THREAD_STACK_SIZE) +
-		_THREAD_STACK_SIZE - _THREAD_STACK_GUARD_OFFSET
-
-	tid := ksysClone(sys.FuncPC(idle), stack, _CLONE_IDLE)
-	idleThread = (threadptr)(unsafe.Pointer(&threads[tid]))
+	// thread0 clone an idle thread for every cpu
+	for i := 0; i < ncpu; i++ {
+		stack := mm.SysMmap(0, threadStackSize) +
+			threadStackSize - _THREAD_STACK_GUARD_OFFSET
+		tid := ksysClone(sys.FuncPC(idle), stack, _CLONE_IDLE|uintptr(i))
+		if int(tid) < 0 {
+			throw("no thread slot for idle thread")
+		}
+	}
 }
 
 //go:nosplit
@@ -238,10 +275,14 @@ func idle() {
 	}
 }
 
+// clone returns -1 when the thread table is full
 //go:nosplit
 func clone(pc, usp, flags, tls uintptr) int {
 	my := Mythread()
 	chld := allocThread()
+	if chld == nil {
+		return -1
+	}
 
 	sp := chld.kstack
 	// for trap frame
@@ -273,102 +314,159 @@ func clone(pc, usp, flags, tls uintptr) int {
 	chld.tf = tf
 	chld.stack = usp
 	chld.fsBase = tls
-	chld.state = RUNNABLE
+	// idle threads are not queued, the scheduler runs them when it has
+	// nothing else to do
+	if flags&_CLONE_IDLE != 0 {
+		c := &cpus[flags&_CLONE_IDLE_CPU]
+		chld.cpu = cpuptr(unsafe.Pointer(c))
+		chld.state = RUNNABLE
+		c.idle = threadptr(unsafe.Pointer(chld))
+		return chld.id
+	}
+	ready(chld)
 	return chld.id
 }
 
+// exit never returns, the thread slot is reused by allocThread once the
+// scheduler has switched away from it
 //go:nosplit
 func exit() {
 	t := Mythread()
 	t.state = EXIT
-	Yield()
-	// TODO: handle thread exit in scheduler
+	Sched()
+	throw("exited thread scheduled")
 }
 
 //go:nosplit
 func threadInit() {
+	if n := int(parseSize(kernelParam("BHOJPUR_KERNEL_MAX_THREADS"))); n > 0 {
+		maxThreads = n
+		if maxThreads > _MAX_THREDS {
+			maxThreads = _MAX_THREDS
+		}
+	}
+	if size := parseSize(kernelParam("BHOJPUR_KERNEL_STACK_SIZE")); size != 0 {
+		size = (size + mm.PGSIZE - 1) &^ (mm.PGSIZE - 1)
+		if size < _THREAD_STACK_MIN {
+			size = _THREAD_STACK_MIN
+		}
+		threadStackSize = size
+	}
+	mm.PoolInit(&threadPool, unsafe.Sizeof(Thread{}))
 	thread0Init()
 }
 
 //go:nosplit
 func swtch(old **context, _new *context)
 
+// schedule is the scheduler loop of cpu c, entered with the big kernel
+// lock held
 //go:nosplit
-func schedule() {
-	var t *Thread
-	var idx int
+func schedule(c *cpu) {
 	for {
-		t = pickup(&idx)
-		switchto(t)
+		t := pickup(c)
+		if t == nil {
+			// there are no idle threads until the runtime is up, let the
+			// other cpus into the kernel meanwhile
+			kernelUnlock()
+			sys.Pause()
+			kernelLock(c)
+			continue
+		}
+		switchto(c, t)
+		if t.state == RUNNABLE && t != c.idle.ptr() {
+			c.enqueue(t)
+		}
 	}
 }
 
-// pickup selects the next runnable thread
+// pickup selects the next runnable thread of c, stealing one from another
+// cpu when its run queue is empty
 //go:nosplit
-func pickup(pidx *int) *Thread {
-	curr := *pidx
-	if traptask != 0 && traptask.ptr().state == RUNNABLE {
-		return traptask.ptr()
+func pickup(c *cpu) *Thread {
+	if t := c.dequeue(); t != nil {
+		return t
 	}
-	if syscalltask != 0 && syscalltask.ptr().state == RUNNABLE {
-		return syscalltask.ptr()
+	if t := steal(c); t != nil {
+		return t
 	}
-
-	var t *Thread
-	for i := 0; i < _NTHREDS; i++ {
-		idx := (curr + i + 1) % _NTHREDS
-		*pidx = idx
-		tt := &threads[idx]
-		if tt.state == RUNNABLE && tt != idleThread.ptr() {
-			t = tt
-			break
-		}
-	}
-	if t == nil {
-		t = idleThread.ptr()
-	}
-	if t == nil {
-		throw("no runnable thread")
-	}
-	return t
+	return c.idle.ptr()
 }
 
-// switchto switch thread context from scheduler to t
+// switchto switch thread context from the scheduler of c to t
 //go:nosplit
-func switchto(t *Thread) {
+func switchto(c *cpu, t *Thread) {
 	begin := nanosecond()
 	// assert that interrupt is enabled
 	// TODO: enable check
 	if t.tf != nil && t.tf.FLAGS&_FLAGS_IF == 0 {
 		throw("bad eflags")
 	}
+	t.cpu = cpuptr(unsafe.Pointer(c))
+	c.curr = threadptr(unsafe.Pointer(t))
 	setMythread(t)
 	t.state = RUNNING
 
-	if t == idleThread.ptr() && t.tf.CS != 8 {
+	idle := t == c.idle.ptr()
+	if idle && t.tf.CS != 8 {
 		throw("bad idle cs")
 
 	}
-	swtch(&scheduler, t.context)
+	startTimeslice(c, t, begin)
+	swtch(&c.scheduler, t.context)
 	used := nanosecond() - begin
 	t.counter += used
+	if idle {
+		c.idletime += used
+	} else {
+		c.busy += used
+	}
+	c.switches++
+	c.curr = 0
 }
 
-func ThreadStat(stat *[_NTHREDS]int64) {
-	for i := 0; i < _NTHREDS; i++ {
-		stat[i] = threads[i].counter
+// ThreadCounter holds the nanoseconds a thread has run and the cpu it last
+// ran on.
+type ThreadCounter struct {
+	ID      int
+	CPU     int
+	Counter int64
+}
+
+// NumThread returns the size of the thread table.
+func NumThread() int {
+	return nthreads
+}
+
+// ThreadStat fills stat with the counters of each thread and returns the
+// number of threads.
+func ThreadStat(stat []ThreadCounter) int {
+	n := nthreads
+	if n > len(stat) {
+		n = len(stat)
+	}
+	for i := 0; i < n; i++ {
+		t := threads[i].ptr()
+		stat[i] = ThreadCounter{
+			ID:      t.id,
+			Counter: t.counter,
+		}
+		if c := t.cpu.ptr(); c != nil {
+			stat[i].CPU = c.id
+		}
 	}
+	return nthreads
 }
 
 //go:nosplit
 func Sched() {
 	my := Mythread()
-	swtch(&my.context, scheduler)
+	swtch(&my.context, my.cpu.ptr().scheduler)
 }
 
 //go:nosplit
 func Yield() {
 	my := Mythread()
 	my.state = RUNNABLE
-	swtch(&my.context, scheduler)
+	swtch(&my.context, my.cpu.ptr().scheduler)
 }
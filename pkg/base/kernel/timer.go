@@ -21,6 +21,7 @@ package kernel
 // THE SOFTWARE.
 
 import (
+	"github.com/bhojpur/kernel/pkg/base/drivers/apic"
 	"github.com/bhojpur/kernel/pkg/base/drivers/pic"
 	"github.com/bhojpur/kernel/pkg/base/kernel/sys"
 	"github.com/bhojpur/kernel/pkg/base/kernel/trap"
@@ -31,6 +32,11 @@ const (
 	_PIT_HZ = 1193180
 	_HZ     = 100
 
+	// a thread runs this long before another one gets the cpu
+	_TIMESLICE = second / _HZ
+	// no timer deadline is pending
+	_NEVER = 1<<63 - 1
+
 	_IRQ_TIMER = pic.IRQ_BASE + pic.LINE_TIMER
 )
 
@@ -46,10 +52,15 @@ var (
 
 	// the unix time of cmos read time
 	baseUnixTime int64
-	// the counter of cmos read time
-	clockBaseCounter int64
+	// the nanosecond of cmos read time
+	clockBaseTime int64
 
 	sleeplock uintptr
+
+	// tickless is set when the clocksource doesn't need the PIT tick, every
+	// cpu then programs its local APIC timer for the next deadline or the
+	// end of the time slice instead of taking _HZ interrupts
+	tickless bool
 )
 
 // pitCounter return the current counter of 8259a
@@ -64,8 +75,9 @@ func pitCounter() int32 {
 	return div - ax
 }
 
+// pitNanosecond counts the PIT ticks, it is the clocksource of last resort
 //go:nosplit
-func nanosecond() int64 {
+func pitNanosecond() int64 {
 	var t int64 = counter * (second / _HZ)
 	elapse := int64(pitCounter()) * (second / _PIT_HZ)
 	t += elapse
@@ -75,10 +87,9 @@ func nanosecond() int64 {
 //go:nosplit
 func clocktime() linux.Timespec {
 	var ts linux.Timespec
-	n := counter - clockBaseCounter
-	ts.Sec = n/_HZ + baseUnixTime
-	ts.Nsec = n % _HZ * (second / _HZ)
-	ts.Nsec += int64(pitCounter()) * (second / _PIT_HZ)
+	n := nanosecond() - clockBaseTime
+	ts.Sec = n/second + baseUnixTime
+	ts.Nsec = n % second
 	return ts
 }
 
@@ -86,26 +97,149 @@ func clocktime() linux.Timespec {
 func nanosleep(tc *linux.Timespec) {
 	deadline := nanosecond() + int64(tc.Nsec+tc.Sec*second)
 	now := nanosecond()
+	t := Mythread()
 	for now < deadline {
+		t.deadline = deadline
+		armTimer(deadline)
 		sleepon(&sleeplock)
 		now = nanosecond()
 	}
+	t.deadline = 0
+}
+
+// expireTimers readies the sleeping threads whose deadline has passed and
+// returns the earliest deadline still pending
+//go:nosplit
+func expireTimers(now int64) int64 {
+	next := int64(_NEVER)
+	for i := 0; i < nthreads; i++ {
+		t := threads[i].ptr()
+		if t.state != SLEEPING || t.deadline == 0 {
+			continue
+		}
+		if t.deadline <= now {
+			ready(t)
+			continue
+		}
+		if t.deadline < next {
+			next = t.deadline
+		}
+	}
+	return next
+}
+
+// setTimer programs the one-shot timer of c, which must be the calling
+// cpu, to fire at when unless it already fires earlier
+//go:nosplit
+func setTimer(c *cpu, when, now int64) {
+	if when == _NEVER {
+		return
+	}
+	if c.timerNext > now && c.timerNext <= when {
+		return
+	}
+	d := when - now
+	if d < 0 {
+		d = 0
+	}
+	// the interrupt handler rearms the timer for far deadlines
+	if d > second {
+		d = second
+	}
+	c.timerNext = now + d
+	ticks := uint64(d) * uint64(lapicTicks) / _TIMESLICE
+	if ticks == 0 {
+		ticks = 1
+	}
+	apic.StartOneShot(_IRQ_LAPIC_TIMER, uint32(ticks))
+}
+
+// armTimer makes the calling cpu check the timers by deadline. The PIT tick
+// checks them every 1/_HZ second when not tickless.
+//go:nosplit
+func armTimer(deadline int64) {
+	if !tickless {
+		return
+	}
+	setTimer(mycpu(), deadline, nanosecond())
+}
+
+// startTimeslice is called by switchto before c runs t
+//go:nosplit
+func startTimeslice(c *cpu, t *Thread, now int64) {
+	if !tickless {
+		return
+	}
+	// an idle cpu sleeps until a deadline or an IPI
+	if t == c.idle.ptr() {
+		c.sliceEnd = 0
+		return
+	}
+	c.sliceEnd = now + _TIMESLICE
+	setTimer(c, c.sliceEnd, now)
+}
+
+// tickIntr handles the local APIC timer when tickless, preempting the
+// running thread at the end of its time slice
+//go:nosplit
+func tickIntr() {
+	c := mycpu()
+	now := nanosecond()
+	c.timerNext = 0
+	next := expireTimers(now)
+	preempt := c.sliceEnd != 0 && now >= c.sliceEnd
+	if c.sliceEnd != 0 && !preempt && c.sliceEnd < next {
+		next = c.sliceEnd
+	}
+	setTimer(c, next, now)
+	if preempt {
+		Yield()
+	}
 }
 
 //go:nosplit
 func timerIntr() {
 	counter++
-	wakeup(&sleeplock, -1)
+	expireTimers(nanosecond())
 	pic.EOI(_IRQ_TIMER)
 	Yield()
 }
 
+// udelay busy waits for us microseconds on PIT channel 2, the speaker
+// channel, leaving channel 0 to the scheduler clock
+//go:nosplit
+func udelay(us int) {
+	for us > 0 {
+		// the 16 bit counter lasts for 54ms
+		n := us
+		if n > 50000 {
+			n = 50000
+		}
+		us -= n
+		count := int64(n) * _PIT_HZ / 1000000
+		// gate on, speaker off
+		sys.Outb(0x61, sys.Inb(0x61)&^0x02|0x01)
+		// channel 2, lo/hi byte, interrupt on terminal count
+		sys.Outb(0x43, 0xb0)
+		sys.Outb(0x42, byte(count))
+		sys.Outb(0x42, byte(count>>8))
+		// OUT2 goes high when the count reaches zero
+		for sys.Inb(0x61)&0x20 == 0 {
+		}
+	}
+}
+
 //go:nosplit
 func timerInit() {
 	div := int(_PIT_HZ / _HZ)
 	sys.Outb(0x43, 0x36)
 	sys.Outb(0x40, byte(div&0xff))
 	sys.Outb(0x40, byte((div>>8)&0xff))
+	// the APIC timers can't be used without them
+	tickless = apic.Enabled() && clocksource != _CLOCK_PIT
+	if tickless {
+		return
+	}
 	trap.Register(_IRQ_TIMER, timerIntr)
 	pic.EnableIRQ(pic.LINE_TIMER)
 }
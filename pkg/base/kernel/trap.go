@@ -160,6 +160,9 @@ func dotrap(tf *trapFrame) {
 		throw("IF should clear")
 	}
 	my := Mythread()
+	c := my.cpu.ptr()
+	kernelLock(c)
+	tlbSync(c)
 	// ugly as it is, avoid writeBarrier
 	// my.tf = tf
 	*(*uintptr)(unsafe.Pointer(&my.tf)) = uintptr(unsafe.Pointer(tf))
@@ -169,13 +172,14 @@ func dotrap(tf *trapFrame) {
 		faultHandler()
 		return
 	}
-	// timer and syscall interrupts are processed synchronously
-	if tf.Trapno > 32 && tf.Trapno != 0x80 {
+	// timer, syscall and APIC interrupts are processed synchronously
+	if tf.Trapno > _IRQ_TIMER && tf.Trapno < pic.IRQ_BASE+pic.MAX_LINES {
 		// pci using level trigger irq, cause dead lock on trap handler
 		// FIXME: hard code network irq line
 		if tf.Trapno == 43 {
 			pic.DisableIRQ(43 - pic.IRQ_BASE)
 		}
+		pic.Defer(tf.Trapno)
 		wakeIRQ(tf.Trapno)
 		return
 	}
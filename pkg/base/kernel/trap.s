@@ -52,6 +52,9 @@ TEXT alltraps(SB), NOSPLIT, $0
 	JMP   ·trapret(SB)
 
 TEXT ·trapret(SB), NOSPLIT, $0
+	// leave the kernel
+	CALL ·kernelUnlock(SB)
+
 	// CX store mythread
 	MOVQ 0(GS), CX
 
@@ -0,0 +1,105 @@
+package client
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/bhojpur/kernel/pkg/types"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+)
+
+type builds struct {
+	kernelIP   string
+	httpClient *http.Client
+}
+
+func (b *builds) All() ([]*types.BuildJob, error) {
+	resp, body, err := get(b.httpClient, b.kernelIP, "/builds")
+	if err != nil {
+		return nil, errors.New("request failed", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("failed with status %v: %s", resp.StatusCode, string(body)), nil)
+	}
+	var jobs []*types.BuildJob
+	if err := json.Unmarshal(body, &jobs); err != nil {
+		return nil, errors.New(fmt.Sprintf("response body %s did not unmarshal to type []*types.BuildJob", string(body)), err)
+	}
+	return jobs, nil
+}
+
+func (b *builds) Get(id string) (*types.BuildJob, error) {
+	resp, body, err := get(b.httpClient, b.kernelIP, "/builds/"+id)
+	if err != nil {
+		return nil, errors.New("request failed", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("failed with status %v: %s", resp.StatusCode, string(body)), nil)
+	}
+	var job types.BuildJob
+	if err := json.Unmarshal(body, &job); err != nil {
+		return nil, errors.New(fmt.Sprintf("response body %s did not unmarshal to type *types.BuildJob", string(body)), err)
+	}
+	return &job, nil
+}
+
+func (b *builds) GetLogs(id string) (string, error) {
+	resp, body, err := get(b.httpClient, b.kernelIP, "/builds/"+id+"/logs")
+	if err != nil {
+		return "", errors.New("request failed", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New(fmt.Sprintf("failed with status %v: %s", resp.StatusCode, string(body)), nil)
+	}
+	return string(body), nil
+}
+
+// AttachLogs streams the build output until the build finishes.
+func (b *builds) AttachLogs(id string) (io.ReadCloser, error) {
+	resp, err := getAsync(b.httpClient, b.kernelIP, "/builds/"+id+"/logs?follow=true")
+	if err != nil {
+		return nil, errors.New("request failed", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.New(fmt.Sprintf("failed with status %v", resp.StatusCode), nil)
+	}
+	return resp.Body, nil
+}
+
+func (b *builds) Cancel(id string) (*types.BuildJob, error) {
+	resp, body, err := del(b.httpClient, b.kernelIP, "/builds/"+id)
+	if err != nil {
+		return nil, errors.New("request failed", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("failed with status %v: %s", resp.StatusCode, string(body)), nil)
+	}
+	var job types.BuildJob
+	if err := json.Unmarshal(body, &job); err != nil {
+		return nil, errors.New(fmt.Sprintf("response body %s did not unmarshal to type *types.BuildJob", string(body)), err)
+	}
+	return &job, nil
+}
@@ -27,32 +27,47 @@ import (
 	"net/url"
 	"strings"
 
+	"github.com/bhojpur/kernel/pkg/types"
 	"github.com/bhojpur/kernel/pkg/util/errors"
-	"github.com/layer-x/layerx-commons/lxhttpclient"
 )
 
 type client struct {
-	kernelIP string
+	kernelIP   string
+	httpClient *http.Client
 }
 
 func KernelClient(kernelIP string) *client {
-	return &client{kernelIP: kernelIP}
+	return KernelClientWith(kernelIP, daemonClient)
+}
+
+// KernelClientWith returns a client sending its requests with httpClient,
+// e.g. one made by NewHTTPClient.
+func KernelClientWith(kernelIP string, httpClient *http.Client) *client {
+	return &client{kernelIP: daemonURL(kernelIP, httpClient), httpClient: httpClient}
 }
 
 func (c *client) Images() *images {
-	return &images{kernelIP: c.kernelIP}
+	return &images{kernelIP: c.kernelIP, httpClient: c.httpClient}
 }
 
 func (c *client) Instances() *instances {
-	return &instances{kernelIP: c.kernelIP}
+	return &instances{kernelIP: c.kernelIP, httpClient: c.httpClient}
 }
 
 func (c *client) Volumes() *volumes {
-	return &volumes{kernelIP: c.kernelIP}
+	return &volumes{kernelIP: c.kernelIP, httpClient: c.httpClient}
+}
+
+func (c *client) Snapshots() *snapshots {
+	return &snapshots{kernelIP: c.kernelIP, httpClient: c.httpClient}
+}
+
+func (c *client) Builds() *builds {
+	return &builds{kernelIP: c.kernelIP, httpClient: c.httpClient}
 }
 
 func (c *client) AvailableCompilers() ([]string, error) {
-	resp, body, err := lxhttpclient.Get(c.kernelIP, "/available_compilers", nil)
+	resp, body, err := get(c.httpClient, c.kernelIP, "/available_compilers")
 	if err != nil {
 		return nil, errors.New("request failed", err)
 	}
@@ -67,7 +82,7 @@ func (c *client) AvailableCompilers() ([]string, error) {
 }
 
 func (c *client) AvailableProviders() ([]string, error) {
-	resp, body, err := lxhttpclient.Get(c.kernelIP, "/available_providers", nil)
+	resp, body, err := get(c.httpClient, c.kernelIP, "/available_providers")
 	if err != nil {
 		return nil, errors.New("request failed", err)
 	}
@@ -87,7 +102,7 @@ func (c *client) DescribeCompiler(base string, lang string, provider string) (st
 		"lang":     lang,
 		"provider": provider,
 	})
-	resp, body, err := lxhttpclient.Get(c.kernelIP, "/describe_compiler"+query, nil)
+	resp, body, err := get(c.httpClient, c.kernelIP, "/describe_compiler"+query)
 	if err != nil {
 		return "", errors.New("request failed", err)
 	}
@@ -105,3 +120,23 @@ func buildQuery(params map[string]interface{}) string {
 	queryString := "?" + strings.Join(queryArray, "&")
 	return queryString
 }
+
+// Drift returns the last reconciliation report of the daemon, or runs a new
+// reconciliation pass first when refresh is set.
+func (c *client) Drift(refresh bool) (*types.DriftReport, error) {
+	query := buildQuery(map[string]interface{}{
+		"refresh": refresh,
+	})
+	resp, body, err := get(c.httpClient, c.kernelIP, "/drift"+query)
+	if err != nil {
+		return nil, errors.New("request failed", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("failed with status %v: %s", resp.StatusCode, string(body)), nil)
+	}
+	var report types.DriftReport
+	if err := json.Unmarshal(body, &report); err != nil {
+		return nil, errors.New(fmt.Sprintf("response body %s did not unmarshal to type *types.DriftReport", string(body)), err)
+	}
+	return &report, nil
+}
@@ -0,0 +1,90 @@
+package client
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/bhojpur/kernel/pkg/types"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+)
+
+// EventStream reads lifecycle events sent by the daemon as server-sent
+// events.
+type EventStream struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+}
+
+// Events subscribes to lifecycle events. Empty kinds or providers match
+// all; providers may be account keys (aws/us-east-1-prod) or types (aws).
+func (c *client) Events(kinds, providers []string) (*EventStream, error) {
+	query := buildQuery(map[string]interface{}{
+		"kind":     strings.Join(kinds, ","),
+		"provider": strings.Join(providers, ","),
+	})
+	resp, err := getAsync(c.httpClient, c.kernelIP, "/events"+query)
+	if err != nil {
+		return nil, errors.New("request failed", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, errors.New(fmt.Sprintf("failed with status %v: %s", resp.StatusCode, string(body)), nil)
+	}
+	return &EventStream{body: resp.Body, reader: bufio.NewReader(resp.Body)}, nil
+}
+
+// Next blocks until the next event arrives. It returns io.EOF when the
+// daemon closes the stream.
+func (s *EventStream) Next() (*types.Event, error) {
+	var data []string
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			if len(data) == 0 {
+				continue
+			}
+			var event types.Event
+			if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &event); err != nil {
+				return nil, errors.New(fmt.Sprintf("event %s did not unmarshal to type *types.Event", strings.Join(data, "\n")), err)
+			}
+			return &event, nil
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+}
+
+func (s *EventStream) Close() error {
+	return s.body.Close()
+}
@@ -0,0 +1,148 @@
+package client
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/bhojpur/kernel/pkg/util/errors"
+)
+
+// requestRetries is how many times a request failing before the daemon
+// answers is retried, as the lxhttpclient helpers these replace did.
+const requestRetries = 5
+
+func get(c *http.Client, host, path string) (*http.Response, []byte, error) {
+	return do(c, http.MethodGet, host, path, func() (io.Reader, string, error) {
+		return nil, "", nil
+	})
+}
+
+// getAsync returns the response with its body unread, for streaming
+// endpoints.
+func getAsync(c *http.Client, host, path string) (*http.Response, error) {
+	var (
+		resp *http.Response
+		err  error
+	)
+	for try := 0; try <= requestRetries; try++ {
+		var req *http.Request
+		req, err = http.NewRequest(http.MethodGet, requestURL(host, path), nil)
+		if err != nil {
+			return nil, errors.New("error generating get request", err)
+		}
+		if resp, err = c.Do(req); err == nil {
+			return resp, nil
+		}
+	}
+	return nil, errors.New("error performing get request", err)
+}
+
+func del(c *http.Client, host, path string) (*http.Response, []byte, error) {
+	return do(c, http.MethodDelete, host, path, func() (io.Reader, string, error) {
+		return nil, "", nil
+	})
+}
+
+// post sends message as json.
+func post(c *http.Client, host, path string, message interface{}) (*http.Response, []byte, error) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return nil, nil, errors.New("message was not of expected type `json`", err)
+	}
+	return do(c, http.MethodPost, host, path, func() (io.Reader, string, error) {
+		return bytes.NewReader(data), "application/json", nil
+	})
+}
+
+// postFile sends the file at pathToFile as the multipart form field
+// fileKey.
+func postFile(c *http.Client, host, path, fileKey, pathToFile string) (*http.Response, []byte, error) {
+	return do(c, http.MethodPost, host, path, func() (io.Reader, string, error) {
+		body := &bytes.Buffer{}
+		form := multipart.NewWriter(body)
+		fileWriter, err := form.CreateFormFile(fileKey, pathToFile)
+		if err != nil {
+			return nil, "", errors.New("error writing to buffer", err)
+		}
+		f, err := os.Open(pathToFile)
+		if err != nil {
+			return nil, "", errors.New("error opening file", err)
+		}
+		defer f.Close()
+		if _, err := io.Copy(fileWriter, f); err != nil {
+			return nil, "", errors.New("error copying file to form", err)
+		}
+		form.Close()
+		return body, form.FormDataContentType(), nil
+	})
+}
+
+// do sends a request with the body made by newBody and reads the whole
+// response. newBody is called again for each retry.
+func do(c *http.Client, method, host, path string, newBody func() (io.Reader, string, error)) (*http.Response, []byte, error) {
+	var (
+		resp *http.Response
+		err  error
+	)
+	for try := 0; try <= requestRetries; try++ {
+		body, contentType, bodyErr := newBody()
+		if bodyErr != nil {
+			return nil, nil, bodyErr
+		}
+		var req *http.Request
+		req, err = http.NewRequest(method, requestURL(host, path), body)
+		if err != nil {
+			return nil, nil, errors.New("error generating "+strings.ToLower(method)+" request", err)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if resp, err = c.Do(req); err != nil {
+			err = errors.New("error performing "+strings.ToLower(method)+" request", err)
+			continue
+		}
+		var data []byte
+		data, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			err = errors.New("error reading "+strings.ToLower(method)+" response", err)
+			continue
+		}
+		return resp, data, nil
+	}
+	return resp, nil, err
+}
+
+// requestURL joins host, defaulting to http, and path.
+func requestURL(host, path string) string {
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		host = "http://" + host
+	}
+	return strings.TrimSuffix(host, "/") + "/" + strings.TrimPrefix(path, "/")
+}
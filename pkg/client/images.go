@@ -27,17 +27,18 @@ import (
 	"strings"
 
 	"github.com/bhojpur/kernel/pkg/config"
+	"github.com/bhojpur/kernel/pkg/daemon"
 	"github.com/bhojpur/kernel/pkg/types"
 	"github.com/bhojpur/kernel/pkg/util/errors"
-	"github.com/layer-x/layerx-commons/lxhttpclient"
 )
 
 type images struct {
-	kernelIP string
+	kernelIP   string
+	httpClient *http.Client
 }
 
 func (i *images) All() ([]*types.Image, error) {
-	resp, body, err := lxhttpclient.Get(i.kernelIP, "/images", nil)
+	resp, body, err := get(i.httpClient, i.kernelIP, "/images")
 	if err != nil {
 		return nil, errors.New("request failed", err)
 	}
@@ -52,7 +53,7 @@ func (i *images) All() ([]*types.Image, error) {
 }
 
 func (i *images) Get(id string) (*types.Image, error) {
-	resp, body, err := lxhttpclient.Get(i.kernelIP, "/images/"+id, nil)
+	resp, body, err := get(i.httpClient, i.kernelIP, "/images/"+id)
 	if err != nil {
 		return nil, errors.New("request failed", err)
 	}
@@ -76,7 +77,7 @@ func (i *images) Build(name, sourceTar, base, lang, provider, args string, mount
 		"force":      force,
 		"no_cleanup": noCleanup,
 	})
-	resp, body, err := lxhttpclient.PostFile(i.kernelIP, "/images/"+name+"/create"+query, "tarfile", sourceTar)
+	resp, body, err := postFile(i.httpClient, i.kernelIP, "/images/"+name+"/create"+query, "tarfile", sourceTar)
 	if err != nil {
 		return nil, errors.New("request failed", err)
 	}
@@ -90,22 +91,56 @@ func (i *images) Build(name, sourceTar, base, lang, provider, args string, mount
 	return &image, nil
 }
 
+// BuildDetached queues the build on the daemon and returns without waiting
+// for it. Follow it with Builds().
+func (i *images) BuildDetached(name, sourceTar, base, lang, provider, args string, mounts []string, force, noCleanup bool) (*types.BuildJob, error) {
+	query := buildQuery(map[string]interface{}{
+		"base":       base,
+		"lang":       lang,
+		"provider":   provider,
+		"args":       args,
+		"mounts":     strings.Join(mounts, ","),
+		"force":      force,
+		"no_cleanup": noCleanup,
+		"detach":     true,
+	})
+	resp, body, err := postFile(i.httpClient, i.kernelIP, "/images/"+name+"/create"+query, "tarfile", sourceTar)
+	if err != nil {
+		return nil, errors.New("request failed", err)
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, errors.New(fmt.Sprintf("failed with status %v: %s", resp.StatusCode, string(body)), err)
+	}
+	var job types.BuildJob
+	if err := json.Unmarshal(body, &job); err != nil {
+		return nil, errors.New(fmt.Sprintf("response body %s did not unmarshal to type *types.BuildJob", string(body)), err)
+	}
+	return &job, nil
+}
+
 func (i *images) Delete(id string, force bool) error {
 	query := buildQuery(map[string]interface{}{
 		"force": force,
 	})
-	resp, body, err := lxhttpclient.Delete(i.kernelIP, "/images/"+id+query, nil)
+	resp, body, err := del(i.httpClient, i.kernelIP, "/images/"+id+query)
 	if err != nil {
 		return errors.New("request failed", err)
 	}
 	if resp.StatusCode != http.StatusNoContent {
+		var errResp daemon.ErrorResponse
+		if err := json.Unmarshal(body, &errResp); err == nil && errResp.Message != "" {
+			if len(errResp.Instances) > 0 {
+				return errors.New(fmt.Sprintf("failed with status %v: %s (instances: %s)", resp.StatusCode, errResp.Message, strings.Join(errResp.Instances, ", ")), nil)
+			}
+			return errors.New(fmt.Sprintf("failed with status %v: %s", resp.StatusCode, errResp.Message), nil)
+		}
 		return errors.New(fmt.Sprintf("failed with status %v: %s", resp.StatusCode, string(body)), err)
 	}
 	return nil
 }
 
 func (i *images) Push(c config.HubConfig, imageName string) error {
-	resp, body, err := lxhttpclient.Post(i.kernelIP, "/images/push/"+imageName, nil, c)
+	resp, body, err := post(i.httpClient, i.kernelIP, "/images/push/"+imageName, c)
 	if err != nil {
 		return errors.New("request failed", err)
 	}
@@ -120,7 +155,7 @@ func (i *images) Pull(c config.HubConfig, imageName, provider string, force bool
 		"provider": provider,
 		"force":    force,
 	})
-	resp, body, err := lxhttpclient.Post(i.kernelIP, "/images/pull/"+imageName+query, nil, c)
+	resp, body, err := post(i.httpClient, i.kernelIP, "/images/pull/"+imageName+query, c)
 	if err != nil {
 		return errors.New("request failed", err)
 	}
@@ -131,7 +166,7 @@ func (i *images) Pull(c config.HubConfig, imageName, provider string, force bool
 }
 
 func (i *images) RemoteDelete(c config.HubConfig, imageName string) error {
-	resp, body, err := lxhttpclient.Post(i.kernelIP, "/images/remote-delete/"+imageName, nil, c)
+	resp, body, err := post(i.httpClient, i.kernelIP, "/images/remote-delete/"+imageName, c)
 	if err != nil {
 		return errors.New("request failed", err)
 	}
@@ -24,20 +24,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 
 	"github.com/bhojpur/kernel/pkg/daemon"
 	"github.com/bhojpur/kernel/pkg/types"
 	"github.com/bhojpur/kernel/pkg/util/errors"
-	"github.com/layer-x/layerx-commons/lxhttpclient"
 )
 
 type instances struct {
-	kernelIP string
+	kernelIP   string
+	httpClient *http.Client
 }
 
 func (i *instances) All() ([]*types.Instance, error) {
-	resp, body, err := lxhttpclient.Get(i.kernelIP, "/instances", nil)
+	resp, body, err := get(i.httpClient, i.kernelIP, "/instances")
 	if err != nil {
 		return nil, errors.New("request failed", err)
 	}
@@ -52,7 +53,7 @@ func (i *instances) All() ([]*types.Instance, error) {
 }
 
 func (i *instances) Get(id string) (*types.Instance, error) {
-	resp, body, err := lxhttpclient.Get(i.kernelIP, "/instances/"+id, nil)
+	resp, body, err := get(i.httpClient, i.kernelIP, "/instances/"+id)
 	if err != nil {
 		return nil, errors.New("request failed", err)
 	}
@@ -70,7 +71,7 @@ func (i *instances) Delete(id string, force bool) error {
 	query := buildQuery(map[string]interface{}{
 		"force": force,
 	})
-	resp, body, err := lxhttpclient.Delete(i.kernelIP, "/instances/"+id+query, nil)
+	resp, body, err := del(i.httpClient, i.kernelIP, "/instances/"+id+query)
 	if err != nil {
 		return errors.New("request failed", err)
 	}
@@ -81,7 +82,7 @@ func (i *instances) Delete(id string, force bool) error {
 }
 
 func (i *instances) GetLogs(id string) (string, error) {
-	resp, body, err := lxhttpclient.Get(i.kernelIP, "/instances/"+id+"/logs", nil)
+	resp, body, err := get(i.httpClient, i.kernelIP, "/instances/"+id+"/logs")
 	if err != nil {
 		return "", errors.New("request failed", err)
 	}
@@ -96,7 +97,7 @@ func (i *instances) AttachLogs(id string, deleteOnDisconnect bool) (io.ReadClose
 		"follow": true,
 		"delete": deleteOnDisconnect,
 	})
-	resp, err := lxhttpclient.GetAsync(i.kernelIP, "/instances/"+id+"/logs"+query, nil)
+	resp, err := getAsync(i.httpClient, i.kernelIP, "/instances/"+id+"/logs"+query)
 	if err != nil {
 		return nil, errors.New("request failed", err)
 	}
@@ -107,7 +108,7 @@ func (i *instances) AttachLogs(id string, deleteOnDisconnect bool) (io.ReadClose
 }
 
 func (i *instances) Run(instanceName, imageName string, mountPointsToVols, env map[string]string, memoryMb int, noCleanup, debugMode bool) (*types.Instance, error) {
-	runInstanceRequest := daemon.RunInstanceRequest{
+	return i.RunWithRequest(daemon.RunInstanceRequest{
 		InstanceName: instanceName,
 		ImageName:    imageName,
 		Mounts:       mountPointsToVols,
@@ -115,8 +116,13 @@ func (i *instances) Run(instanceName, imageName string, mountPointsToVols, env m
 		MemoryMb:     memoryMb,
 		NoCleanup:    noCleanup,
 		DebugMode:    debugMode,
-	}
-	resp, body, err := lxhttpclient.Post(i.kernelIP, "/instances/run", nil, runInstanceRequest)
+	})
+}
+
+// RunWithRequest is like Run but exposes the full request, including the
+// machine settings (vcpus, cpu template, kernel) some providers accept.
+func (i *instances) RunWithRequest(runInstanceRequest daemon.RunInstanceRequest) (*types.Instance, error) {
+	resp, body, err := post(i.httpClient, i.kernelIP, "/instances/run", runInstanceRequest)
 	if err != nil {
 		return nil, errors.New("request failed", err)
 	}
@@ -131,7 +137,7 @@ func (i *instances) Run(instanceName, imageName string, mountPointsToVols, env m
 }
 
 func (i *instances) Start(id string) error {
-	resp, body, err := lxhttpclient.Post(i.kernelIP, "/instances/"+id+"/start", nil, nil)
+	resp, body, err := post(i.httpClient, i.kernelIP, "/instances/"+id+"/start", nil)
 	if err != nil {
 		return errors.New("request failed", err)
 	}
@@ -142,7 +148,7 @@ func (i *instances) Start(id string) error {
 }
 
 func (i *instances) Stop(id string) error {
-	resp, body, err := lxhttpclient.Post(i.kernelIP, "/instances/"+id+"/stop", nil, nil)
+	resp, body, err := post(i.httpClient, i.kernelIP, "/instances/"+id+"/stop", nil)
 	if err != nil {
 		return errors.New("request failed", err)
 	}
@@ -151,3 +157,67 @@ func (i *instances) Stop(id string) error {
 	}
 	return nil
 }
+
+func (i *instances) GetMetrics(id string) (map[string]interface{}, error) {
+	resp, body, err := get(i.httpClient, i.kernelIP, "/instances/"+id+"/metrics")
+	if err != nil {
+		return nil, errors.New("request failed", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("failed with status %v: %s", resp.StatusCode, string(body)), nil)
+	}
+	var metrics map[string]interface{}
+	if err := json.Unmarshal(body, &metrics); err != nil {
+		return nil, errors.New(fmt.Sprintf("response body %s did not unmarshal to metrics", string(body)), err)
+	}
+	return metrics, nil
+}
+
+func (i *instances) Pause(id string) error {
+	resp, body, err := post(i.httpClient, i.kernelIP, "/instances/"+id+"/pause", nil)
+	if err != nil {
+		return errors.New("request failed", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(fmt.Sprintf("failed with status %v: %s", resp.StatusCode, string(body)), err)
+	}
+	return nil
+}
+
+func (i *instances) Resume(id string) error {
+	resp, body, err := post(i.httpClient, i.kernelIP, "/instances/"+id+"/resume", nil)
+	if err != nil {
+		return errors.New("request failed", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(fmt.Sprintf("failed with status %v: %s", resp.StatusCode, string(body)), err)
+	}
+	return nil
+}
+
+// AttachConsole connects to the serial console of an instance. Reads
+// return the guest output, writes are typed into the guest, and closing
+// the stream detaches.
+func (i *instances) AttachConsole(id string) (io.ReadWriteCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, requestURL(i.kernelIP, "/instances/"+id+"/console"), nil)
+	if err != nil {
+		return nil, errors.New("building request", err)
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+	resp, err := i.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.New("request failed", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, errors.New(fmt.Sprintf("failed with status %v: %s", resp.StatusCode, string(body)), nil)
+	}
+	console, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, errors.New("daemon connection cannot be used for a console", nil)
+	}
+	return console, nil
+}
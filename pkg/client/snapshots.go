@@ -0,0 +1,102 @@
+package client
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/bhojpur/kernel/pkg/types"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+)
+
+type snapshots struct {
+	kernelIP   string
+	httpClient *http.Client
+}
+
+func (s *snapshots) All() ([]*types.Snapshot, error) {
+	resp, body, err := get(s.httpClient, s.kernelIP, "/snapshots")
+	if err != nil {
+		return nil, errors.New("request failed", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("failed with status %v: %s", resp.StatusCode, string(body)), nil)
+	}
+	var snapshots []*types.Snapshot
+	if err := json.Unmarshal(body, &snapshots); err != nil {
+		return nil, errors.New(fmt.Sprintf("response body %s did not unmarshal to type []*types.Snapshot", string(body)), err)
+	}
+	return snapshots, nil
+}
+
+// Create snapshots the instance with the given name or id. An empty name
+// lets the provider choose one; stop stops the instance afterwards.
+func (s *snapshots) Create(instanceId, name string, stop bool) (*types.Snapshot, error) {
+	query := buildQuery(map[string]interface{}{
+		"name": name,
+		"stop": stop,
+	})
+	resp, body, err := post(s.httpClient, s.kernelIP, "/instances/"+instanceId+"/snapshot"+query, nil)
+	if err != nil {
+		return nil, errors.New("request failed", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return nil, errors.New(fmt.Sprintf("failed with status %v: %s", resp.StatusCode, string(body)), nil)
+	}
+	var snapshot types.Snapshot
+	if err := json.Unmarshal(body, &snapshot); err != nil {
+		return nil, errors.New(fmt.Sprintf("response body %s did not unmarshal to type *types.Snapshot", string(body)), err)
+	}
+	return &snapshot, nil
+}
+
+// Restore starts a new instance from a snapshot. An empty instanceName
+// reuses the name of the snapshotted instance.
+func (s *snapshots) Restore(id, instanceName string) (*types.Instance, error) {
+	query := buildQuery(map[string]interface{}{
+		"name": instanceName,
+	})
+	resp, body, err := post(s.httpClient, s.kernelIP, "/snapshots/"+id+"/restore"+query, nil)
+	if err != nil {
+		return nil, errors.New("request failed", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return nil, errors.New(fmt.Sprintf("failed with status %v: %s", resp.StatusCode, string(body)), nil)
+	}
+	var instance types.Instance
+	if err := json.Unmarshal(body, &instance); err != nil {
+		return nil, errors.New(fmt.Sprintf("response body %s did not unmarshal to type *types.Instance", string(body)), err)
+	}
+	return &instance, nil
+}
+
+func (s *snapshots) Delete(id string) error {
+	resp, body, err := del(s.httpClient, s.kernelIP, "/snapshots/"+id)
+	if err != nil {
+		return errors.New("request failed", err)
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		return errors.New(fmt.Sprintf("failed with status %v: %s", resp.StatusCode, string(body)), nil)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package client
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/bhojpur/kernel/pkg/config"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+)
+
+// daemonTransport adds the daemon credentials to requests for the daemon
+// host only, so tokens and client certs are never sent to other servers
+// (e.g. the image hub).
+type daemonTransport struct {
+	host   string
+	token  string
+	tls    bool
+	daemon http.RoundTripper
+	other  http.RoundTripper
+}
+
+func (t *daemonTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.host {
+		return t.other.RoundTrip(req)
+	}
+	if t.token != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	return t.daemon.RoundTrip(req)
+}
+
+// daemonClient is used by the clients returned from KernelClient
+var daemonClient = &http.Client{}
+
+// UseConfig sets up TLS and token auth for requests to c.Host. It must be
+// called before using a client for a secured daemon.
+func UseConfig(c config.ClientConfig) error {
+	httpClient, err := NewHTTPClient(c)
+	if err != nil {
+		return err
+	}
+	daemonClient = httpClient
+	return nil
+}
+
+// NewHTTPClient returns an http client sending requests to c.Host with
+// its TLS and token auth.
+func NewHTTPClient(c config.ClientConfig) (*http.Client, error) {
+	host := stripScheme(c.Host)
+	useTLS := strings.HasPrefix(c.Host, "https://") || c.CAFile != "" || c.CertFile != ""
+	if !useTLS && c.Token == "" {
+		return &http.Client{}, nil
+	}
+	if c.CertFile != "" && c.KeyFile == "" || c.CertFile == "" && c.KeyFile != "" {
+		return nil, errors.New("client cert_file and key_file must be set together", nil)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.CAFile != "" {
+		data, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, errors.New("reading ca file "+c.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New("no certificates found in "+c.CAFile, nil)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, errors.New("loading client certificate "+c.CertFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	daemonRoundTripper := http.DefaultTransport.(*http.Transport).Clone()
+	daemonRoundTripper.TLSClientConfig = tlsConfig
+	return &http.Client{
+		Transport: &daemonTransport{
+			host:   host,
+			token:  c.Token,
+			tls:    useTLS,
+			daemon: daemonRoundTripper,
+			other:  http.DefaultTransport,
+		},
+	}, nil
+}
+
+// daemonURL adds the https scheme to the daemon host of httpClient when
+// it uses TLS.
+func daemonURL(kernelIP string, httpClient *http.Client) string {
+	if t, ok := httpClient.Transport.(*daemonTransport); ok && t.tls && stripScheme(kernelIP) == t.host {
+		return "https://" + t.host
+	}
+	return kernelIP
+}
+
+func stripScheme(host string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+}
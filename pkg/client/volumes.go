@@ -27,15 +27,15 @@ import (
 
 	"github.com/bhojpur/kernel/pkg/types"
 	"github.com/bhojpur/kernel/pkg/util/errors"
-	"github.com/layer-x/layerx-commons/lxhttpclient"
 )
 
 type volumes struct {
-	kernelIP string
+	kernelIP   string
+	httpClient *http.Client
 }
 
 func (v *volumes) All() ([]*types.Volume, error) {
-	resp, body, err := lxhttpclient.Get(v.kernelIP, "/volumes", nil)
+	resp, body, err := get(v.httpClient, v.kernelIP, "/volumes")
 	if err != nil {
 		return nil, errors.New("request failed", err)
 	}
@@ -50,7 +50,7 @@ func (v *volumes) All() ([]*types.Volume, error) {
 }
 
 func (v *volumes) Get(id string) (*types.Volume, error) {
-	resp, body, err := lxhttpclient.Get(v.kernelIP, "/volumes/"+id, nil)
+	resp, body, err := get(v.httpClient, v.kernelIP, "/volumes/"+id)
 	if err != nil {
 		return nil, errors.New("request failed", err)
 	}
@@ -68,7 +68,7 @@ func (v *volumes) Delete(id string, force bool) error {
 	query := buildQuery(map[string]interface{}{
 		"force": force,
 	})
-	resp, body, err := lxhttpclient.Delete(v.kernelIP, "/volumes/"+id+query, nil)
+	resp, body, err := del(v.httpClient, v.kernelIP, "/volumes/"+id+query)
 	if err != nil {
 		return errors.New("request failed", err)
 	}
@@ -93,7 +93,7 @@ func (v *volumes) Create(name, dataTar, provider string, raw bool, size int, vol
 		err  error
 	)
 	if dataTar == "" {
-		resp, body, err = lxhttpclient.Post(v.kernelIP, "/volumes/"+name+query, nil, nil)
+		resp, body, err = post(v.httpClient, v.kernelIP, "/volumes/"+name+query, nil)
 		if err != nil {
 			return nil, errors.New("request failed", err)
 		}
@@ -101,7 +101,7 @@ func (v *volumes) Create(name, dataTar, provider string, raw bool, size int, vol
 			return nil, errors.New(fmt.Sprintf("failed with status %v: %s", resp.StatusCode, string(body)), err)
 		}
 	} else {
-		resp, body, err = lxhttpclient.PostFile(v.kernelIP, "/volumes/"+name+query, "tarfile", dataTar)
+		resp, body, err = postFile(v.httpClient, v.kernelIP, "/volumes/"+name+query, "tarfile", dataTar)
 		if err != nil {
 			return nil, errors.New("request failed", err)
 		}
@@ -120,7 +120,7 @@ func (v *volumes) Attach(id, instanceId, mountPoint string) error {
 	query := buildQuery(map[string]interface{}{
 		"mount": mountPoint,
 	})
-	resp, body, err := lxhttpclient.Post(v.kernelIP, "/volumes/"+id+"/attach/"+instanceId+query, nil, nil)
+	resp, body, err := post(v.httpClient, v.kernelIP, "/volumes/"+id+"/attach/"+instanceId+query, nil)
 	if err != nil {
 		return errors.New("request failed", err)
 	}
@@ -131,7 +131,7 @@ func (v *volumes) Attach(id, instanceId, mountPoint string) error {
 }
 
 func (v *volumes) Detach(id string) error {
-	resp, body, err := lxhttpclient.Post(v.kernelIP, "/volumes/"+id+"/detach", nil, nil)
+	resp, body, err := post(v.httpClient, v.kernelIP, "/volumes/"+id+"/detach", nil)
 	if err != nil {
 		return errors.New("request failed", err)
 	}
@@ -0,0 +1,104 @@
+package bhojpur
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/bhojpur/kernel/cmd/server/assets"
+	"github.com/bhojpur/kernel/pkg/compilers"
+	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+)
+
+const (
+	// KernelFile and LoaderFile are written next to each other; providers
+	// boot the loader and hand it the kernel as its first module
+	KernelFile = "kernel.elf"
+	LoaderFile = "loader.elf"
+)
+
+// BhojpurGoCompiler builds a Go program against the Bhojpur Go kernel,
+// the same way 'kernel build' does, inside the compilers-bhojpur-go container.
+type BhojpurGoCompiler struct {
+	Compiler compilers.CompilerType
+}
+
+func (c *BhojpurGoCompiler) CompileRawImage(params types.CompileImageParams) (*types.RawImage, error) {
+	logger := kutil.LogEntry(params.Logger)
+	sourcesDir := params.SourcesDir
+
+	if params.Args != "" {
+		logger.Warnf("%s does not take arguments, ignoring %q", c.Compiler, params.Args)
+	}
+	if len(params.MntPoints) > 0 {
+		return nil, errors.New(c.Compiler.String()+" does not support mount points", nil)
+	}
+
+	if err := kutil.NewContainer("compilers-bhojpur-go").WithVolume(sourcesDir, "/opt/code").InGroup(params.Containers).Run(); err != nil {
+		return nil, errors.New("building bhojpur kernel", err)
+	}
+
+	if err := writeLoader(c.Compiler, filepath.Join(sourcesDir, LoaderFile)); err != nil {
+		return nil, err
+	}
+
+	res := &types.RawImage{}
+	res.LocalImagePath = filepath.Join(sourcesDir, KernelFile)
+	res.StageSpec.ImageFormat = types.ImageFormat_RAW
+	res.RunSpec.DefaultInstanceMemory = 256
+	res.RunSpec.Compiler = c.Compiler.String()
+	if c.Compiler != compilers.BHOJPUR_GO_FIRECRACKER {
+		// the kernel has both e1000 and virtio-net (pci) drivers
+		res.RunSpec.NicModel = "virtio"
+	}
+	return res, nil
+}
+
+// writeLoader extracts the multiboot loader that is embedded for
+// 'kernel run' and 'kernel pack'. Firecracker gets the ELF64 build
+// of the same loader, which it enters through the PVH note.
+func writeLoader(compiler compilers.CompilerType, path string) error {
+	asset := "boot/multiboot.elf"
+	if compiler == compilers.BHOJPUR_GO_FIRECRACKER {
+		asset = "boot/multiboot64.elf"
+	}
+	loader, err := assets.Boot.ReadFile(asset)
+	if err != nil {
+		return errors.New("multiboot loader is not embedded in this build", err)
+	}
+	if err := os.WriteFile(path, loader, 0644); err != nil {
+		return errors.New("writing multiboot loader", err)
+	}
+	return nil
+}
+
+func (c *BhojpurGoCompiler) Usage() *compilers.CompilerUsage {
+	return &compilers.CompilerUsage{
+		PrepareApplication: `
+Sources must be a Go module whose main package is built into the kernel,
+exactly as with 'kernel build'. If the module does not require
+github.com/bhojpur/kernel yet, it is added with 'go get' before building.
+`,
+	}
+}
@@ -27,22 +27,22 @@ import (
 	"github.com/bhojpur/kernel/pkg/compilers"
 	"github.com/bhojpur/kernel/pkg/types"
 	kutil "github.com/bhojpur/kernel/pkg/util"
-	"github.com/sirupsen/logrus"
 )
 
 type FirecrackerCompiler struct{}
 
 func (f *FirecrackerCompiler) CompileRawImage(params types.CompileImageParams) (*types.RawImage, error) {
+	logger := kutil.LogEntry(params.Logger)
 	sourcesDir := params.SourcesDir
 
 	// run dep ensure and go build
-	if err := kutil.NewContainer("compilers-firecracker").Privileged(true).WithVolume(sourcesDir, "/opt/code").Run(); err != nil {
+	if err := kutil.NewContainer("compilers-firecracker").Privileged(true).WithVolume(sourcesDir, "/opt/code").InGroup(params.Containers).Run(); err != nil {
 		return nil, err
 	}
 	res := &types.RawImage{}
 	localImageFile, err := f.getImagefile(sourcesDir)
 	if err != nil {
-		logrus.Errorf("error getting local image file name")
+		logger.Errorf("error getting local image file name")
 	}
 	res.LocalImagePath = localImageFile
 	res.StageSpec.ImageFormat = types.ImageFormat_RAW
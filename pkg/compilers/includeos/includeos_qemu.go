@@ -30,21 +30,21 @@ import (
 	"github.com/bhojpur/kernel/pkg/types"
 	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
-	"github.com/sirupsen/logrus"
 )
 
 type IncludeosQemuCompiler struct{}
 
 func (i *IncludeosQemuCompiler) CompileRawImage(params types.CompileImageParams) (*types.RawImage, error) {
+	logger := kutil.LogEntry(params.Logger)
 	sourcesDir := params.SourcesDir
 	env := make(map[string]string)
-	if err := kutil.NewContainer("compilers-includeos-cpp-hw").WithVolume(sourcesDir, "/opt/code").WithEnvs(env).Run(); err != nil {
+	if err := kutil.NewContainer("compilers-includeos-cpp-hw").WithVolume(sourcesDir, "/opt/code").WithEnvs(env).InGroup(params.Containers).Run(); err != nil {
 		return nil, err
 	
 	res := &types.RawImage{}
 	localImageFile, err := i.findFirstImageFile(sourcesDir)
 	if err != nil {
-		logrus.Errorf("error getting local image file name")
+		logger.Errorf("error getting local image file name")
 	}
 	res.LocalImagePath = path.Join(sourcesDir, localImageFile)
 	res.StageSpec.ImageFormat = types.ImageFormat_RAW
@@ -38,7 +38,7 @@ type IncludeosVirtualboxCompiler struct{}
 func (i *IncludeosVirtualboxCompiler) CompileRawImage(params types.CompileImageParams) (*types.RawImage, error) {
 	sourcesDir := params.SourcesDir
 	env := make(map[string]string)
-	if err := kutil.NewContainer("compilers-includeos-cpp-hw").WithVolume(sourcesDir, "/opt/code").WithEnvs(env).Run(); err != nil {
+	if err := kutil.NewContainer("compilers-includeos-cpp-hw").WithVolume(sourcesDir, "/opt/code").WithEnvs(env).InGroup(params.Containers).Run(); err != nil {
 		return nil, err
 	}
 
@@ -56,7 +56,7 @@ func (c *MirageCompiler) CompileRawImage(params types.CompileImageParams) (*type
 
 	sourcesDir := params.SourcesDir
 
-	if err := grantOpamPermissions(sourcesDir); err != nil {
+	if err := grantOpamPermissions(sourcesDir, params.Containers); err != nil {
 		return nil, err
 	}
 	var containerToUse string
@@ -66,7 +66,7 @@ func (c *MirageCompiler) CompileRawImage(params types.CompileImageParams) (*type
 		var err error
 		args, err = parseMirageManifest(sourcesDir)
 		if err != nil {
-			args, err = introspectArguments(sourcesDir)
+			args, err = introspectArguments(sourcesDir, params.Containers)
 			if err != nil {
 				return nil, err
 			}
@@ -85,11 +85,11 @@ func (c *MirageCompiler) CompileRawImage(params types.CompileImageParams) (*type
 		return nil, errors.New("unknown type", nil)
 	}
 
-	if err := kutil.NewContainer(containerToUse).WithEntrypoint("mirage").WithVolume(sourcesDir, "/opt/code").Run(args...); err != nil {
+	if err := kutil.NewContainer(containerToUse).WithEntrypoint("mirage").WithVolume(sourcesDir, "/opt/code").InGroup(params.Containers).Run(args...); err != nil {
 		return nil, err
 	}
 
-	if err := kutil.NewContainer(containerToUse).WithEntrypoint("/usr/bin/make").WithVolume(sourcesDir, "/opt/code").Run(); err != nil {
+	if err := kutil.NewContainer(containerToUse).WithEntrypoint("/usr/bin/make").WithVolume(sourcesDir, "/opt/code").InGroup(params.Containers).Run(); err != nil {
 		return nil, err
 	}
 
@@ -113,7 +113,7 @@ func (c *MirageCompiler) CompileRawImage(params types.CompileImageParams) (*type
 	}
 	switch c.Type {
 	case XenType:
-		return c.packageForXen(sourcesDir, disks, params.NoCleanup)
+		return c.packageForXen(sourcesDir, disks, params.NoCleanup, params.Containers)
 	case UKVMType:
 		return c.packageForUkvm(sourcesDir, disks, params.NoCleanup)
 	case VirtioType:
@@ -123,7 +123,7 @@ func (c *MirageCompiler) CompileRawImage(params types.CompileImageParams) (*type
 	}
 }
 
-func (c *MirageCompiler) packageForXen(sourcesDir string, disks []string, cleanup bool) (*types.RawImage, error) {
+func (c *MirageCompiler) packageForXen(sourcesDir string, disks []string, cleanup bool, group *kutil.ContainerGroup) (*types.RawImage, error) {
 	// TODO: ukvm package zipfile for ukvm
 	var res types.RawImage
 	res.RunSpec.Compiler = compilers.MIRAGE_OCAML_XEN.String()
@@ -139,7 +139,7 @@ func (c *MirageCompiler) packageForXen(sourcesDir string, disks []string, cleanu
 	}
 
 	// TODO: ukvm package zipfile for ukvm
-	imgFile, err := compilers.BuildBootableImage(unikernelfile, "", false, cleanup)
+	imgFile, err := compilers.BuildBootableImage(unikernelfile, "", false, cleanup, group)
 
 	if err != nil {
 		return nil, err
@@ -318,9 +318,9 @@ func getDisksFromReader(sourcesDir string, xlFile io.Reader) ([]string, error) {
 	return disks, nil
 }
 
-func introspectArguments(sourcesDir string) ([]string, error) {
+func introspectArguments(sourcesDir string, group *kutil.ContainerGroup) ([]string, error) {
 
-	output, err := kutil.NewContainer("compilers-mirage-ocaml-xen").WithVolume(sourcesDir, "/opt/code").WithEntrypoint("/home/opam/.opam/system/bin/mirage").CombinedOutput("describe", "--color=never")
+	output, err := kutil.NewContainer("compilers-mirage-ocaml-xen").WithVolume(sourcesDir, "/opt/code").WithEntrypoint("/home/opam/.opam/system/bin/mirage").InGroup(group).CombinedOutput("describe", "--color=never")
 	if err != nil {
 		log.WithError(err).WithFields(log.Fields{"output": string(output)}).Error("Error getting data on mirage code")
 		return nil, err
@@ -383,8 +383,8 @@ func parseMirageManifest(sourcesDir string) ([]string, error) {
 	return strings.Split(config.Args, " "), nil
 }
 
-func grantOpamPermissions(sourcesDir string) error {
-	err := kutil.NewContainer("compilers-mirage-ocaml-xen").WithVolume(sourcesDir, "/opt/code").WithEntrypoint("sudo").Run("chown", "-R", "opam", ".")
+func grantOpamPermissions(sourcesDir string, group *kutil.ContainerGroup) error {
+	err := kutil.NewContainer("compilers-mirage-ocaml-xen").WithVolume(sourcesDir, "/opt/code").WithEntrypoint("sudo").InGroup(group).Run("chown", "-R", "opam", ".")
 	if err != nil {
 		log.WithError(err).Error("Error granting permissions to opam")
 		return err
@@ -28,7 +28,8 @@ import (
 )
 
 const (
-	Rump = "rump"
+	Rump    = "rump"
+	Bhojpur = "bhojpur"
 )
 
 type CompilerType string
@@ -111,6 +112,9 @@ var (
 	MIRAGE_OCAML_QEMU = compilerName("mirage", "ocaml", "qemu")
 
 	FIRECRACKER_GO = compilerName("firecracker", "go", "firecracker")
+
+	BHOJPUR_GO_QEMU        = compilerName("bhojpur", "go", "qemu")
+	BHOJPUR_GO_FIRECRACKER = compilerName("bhojpur", "go", "firecracker")
 )
 
 var compilers = []CompilerType{
@@ -177,6 +181,9 @@ var compilers = []CompilerType{
 	MIRAGE_OCAML_QEMU,
 
 	FIRECRACKER_GO,
+
+	BHOJPUR_GO_QEMU,
+	BHOJPUR_GO_FIRECRACKER,
 }
 
 func ValidateCompiler(base, language, provider string) (CompilerType, error) {
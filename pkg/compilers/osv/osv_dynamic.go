@@ -45,7 +45,8 @@ type dynamicProjectConfig struct {
 func CreateImageDynamic(params types.CompileImageParams, useEc2Bootstrap bool) (string, error) {
 	container := kutil.NewContainer("compilers-osv-dynamic").
 		WithVolume(params.SourcesDir+"/", "/project_directory").
-		WithEnv("MAX_IMAGE_SIZE", fmt.Sprintf("%dMB", params.SizeMB))
+		WithEnv("MAX_IMAGE_SIZE", fmt.Sprintf("%dMB", params.SizeMB)).
+		InGroup(params.Containers)
 
 	logrus.WithFields(logrus.Fields{
 		"params": params,
@@ -44,6 +44,7 @@ type javaProjectConfig struct {
 }
 
 func (r *OSvJavaCompiler) CompileRawImage(params types.CompileImageParams) (*types.RawImage, error) {
+	logger := kutil.LogEntry(params.Logger)
 	sourcesDir := params.SourcesDir
 
 	var config javaProjectConfig
@@ -55,7 +56,7 @@ func (r *OSvJavaCompiler) CompileRawImage(params types.CompileImageParams) (*typ
 		return nil, errors.New("failed to parse yaml manifest.yaml file", err)
 	}
 
-	container := kutil.NewContainer("compilers-osv-java").WithVolume("/dev", "/dev").WithVolume(sourcesDir+"/", "/project_directory")
+	container := kutil.NewContainer("compilers-osv-java").WithVolume("/dev", "/dev").WithVolume(sourcesDir+"/", "/project_directory").InGroup(params.Containers)
 	var args []string
 	if r.ImageFinisher.UseEc2() {
 		args = append(args, "-ec2")
@@ -70,7 +71,7 @@ func (r *OSvJavaCompiler) CompileRawImage(params types.CompileImageParams) (*typ
 		args = append(args, "-runtime", config.RuntimeArgs)
 	}
 
-	logrus.WithFields(logrus.Fields{
+	logger.WithFields(logrus.Fields{
 		"args": args,
 	}).Debugf("running compilers-osv-java container")
 
@@ -32,8 +32,8 @@ import (
 	kutil "github.com/bhojpur/kernel/pkg/util"
 )
 
-func execContainer(imageName string, cmds []string, binds map[string]string, privileged bool, env map[string]string) error {
-	container := kutil.NewContainer(imageName).Privileged(privileged).WithVolumes(binds).WithEnvs(env)
+func execContainer(imageName string, cmds []string, binds map[string]string, privileged bool, env map[string]string, group *kutil.ContainerGroup) error {
+	container := kutil.NewContainer(imageName).Privileged(privileged).WithVolumes(binds).WithEnvs(env).InGroup(group)
 	if err := container.Run(cmds...); err != nil {
 		return errors.New("running container "+imageName, err)
 	}
@@ -42,10 +42,10 @@ func execContainer(imageName string, cmds []string, binds map[string]string, pri
 
 type RumCompilerBase struct {
 	DockerImage string
-	CreateImage func(kernel, args string, mntPoints, bakedEnv []string, noCleanup bool) (*types.RawImage, error)
+	CreateImage func(kernel, args string, mntPoints, bakedEnv []string, noCleanup bool, group *kutil.ContainerGroup) (*types.RawImage, error)
 }
 
-func (r *RumCompilerBase) runContainer(localFolder string, envPairs []string) error {
+func (r *RumCompilerBase) runContainer(localFolder string, envPairs []string, group *kutil.ContainerGroup) error {
 	env := make(map[string]string)
 	for _, pair := range envPairs {
 		split := strings.Split(pair, "=")
@@ -58,7 +58,7 @@ func (r *RumCompilerBase) runContainer(localFolder string, envPairs []string) er
 	if kutil.IsDockerToolbox() {
 		localFolder = kutil.GetToolboxMountPath(localFolder)
 	}
-	return kutil.NewContainer(r.DockerImage).WithVolume(localFolder, "/opt/code").WithEnvs(env).Run()
+	return kutil.NewContainer(r.DockerImage).WithVolume(localFolder, "/opt/code").WithEnvs(env).InGroup(group).Run()
 
 }
 
@@ -28,6 +28,7 @@ import (
 
 	"github.com/bhojpur/kernel/pkg/compilers"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
 	"gopkg.in/yaml.v2"
 )
@@ -56,20 +57,20 @@ func (r *RumpCCompiler) CompileRawImage(params types.CompileImageParams) (*types
 		fmt.Sprintf("BINARY_NAME=%s", config.BinaryName),
 	}
 
-	if err := r.runContainer(sourcesDir, containerEnv); err != nil {
+	if err := r.runContainer(sourcesDir, containerEnv, params.Containers); err != nil {
 		return nil, err
 	}
 
 	resultFile := path.Join(sourcesDir, "program.bin")
 
-	return r.CreateImage(resultFile, params.Args, params.MntPoints, nil, params.NoCleanup)
+	return r.CreateImage(resultFile, params.Args, params.MntPoints, nil, params.NoCleanup, params.Containers)
 }
 
 func (r *RumpCCompiler) Usage() *compilers.CompilerUsage {
 	return nil
 }
 
-func NewRumpCCompiler(dockerImage string, createImage func(kernel, args string, mntPoints, bakedEnv []string, noCleanup bool) (*types.RawImage, error)) *RumpCCompiler {
+func NewRumpCCompiler(dockerImage string, createImage func(kernel, args string, mntPoints, bakedEnv []string, noCleanup bool, group *kutil.ContainerGroup) (*types.RawImage, error)) *RumpCCompiler {
 	return &RumpCCompiler{
 		RumCompilerBase: RumCompilerBase{
 			DockerImage: dockerImage,
@@ -26,18 +26,19 @@ import (
 
 	"github.com/bhojpur/kernel/pkg/compilers"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/sirupsen/logrus"
 )
 
-func CreateImageGCloud(kernel string, args string, mntPoints, bakedEnv []string, noCleanup bool) (*types.RawImage, error) {
-	return createImageGCloud(kernel, args, mntPoints, bakedEnv, noCleanup, false)
+func CreateImageGCloud(kernel string, args string, mntPoints, bakedEnv []string, noCleanup bool, group *kutil.ContainerGroup) (*types.RawImage, error) {
+	return createImageGCloud(kernel, args, mntPoints, bakedEnv, noCleanup, false, group)
 }
 
-func CreateImageGCloudAddStub(kernel string, args string, mntPoints, bakedEnv []string, noCleanup bool) (*types.RawImage, error) {
-	return createImageGCloud(kernel, args, mntPoints, bakedEnv, noCleanup, true)
+func CreateImageGCloudAddStub(kernel string, args string, mntPoints, bakedEnv []string, noCleanup bool, group *kutil.ContainerGroup) (*types.RawImage, error) {
+	return createImageGCloud(kernel, args, mntPoints, bakedEnv, noCleanup, true, group)
 }
 
-func createImageGCloud(kernel string, args string, mntPoints, bakedEnv []string, noCleanup, addStub bool) (*types.RawImage, error) {
+func createImageGCloud(kernel string, args string, mntPoints, bakedEnv []string, noCleanup, addStub bool, group *kutil.ContainerGroup) (*types.RawImage, error) {
 	// create rump config
 	var c rumpConfig
 	if bakedEnv != nil {
@@ -96,7 +97,7 @@ func createImageGCloud(kernel string, args string, mntPoints, bakedEnv []string,
 
 	logrus.Debugf("writing rump json config: %s", cmdline)
 
-	imgFile, err := compilers.BuildBootableImage(kernel, cmdline, true, noCleanup)
+	imgFile, err := compilers.BuildBootableImage(kernel, cmdline, true, noCleanup, group)
 	if err != nil {
 		return nil, err
 	}
@@ -27,11 +27,12 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 
 	"github.com/bhojpur/kernel/pkg/compilers"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
-	"github.com/sirupsen/logrus"
 )
 
 // uses rump docker conter container
@@ -44,33 +45,25 @@ type RumpGoCompiler struct {
 }
 
 func (r *RumpGoCompiler) CompileRawImage(params types.CompileImageParams) (*types.RawImage, error) {
+	logger := kutil.LogEntry(params.Logger)
 	sourcesDir := params.SourcesDir
-	godepsFile := filepath.Join(sourcesDir, "Godeps", "Godeps.json")
-	_, err := os.Stat(godepsFile)
-	if err != nil {
-		return nil, errors.New("the Go compiler requires Godeps file in the root of your project. see https://github.com/tools/godep", nil)
-	}
-	data, err := ioutil.ReadFile(godepsFile)
+	rootPath, err := goRootPath(sourcesDir)
 	if err != nil {
-		return nil, errors.New("could not read godeps file", err)
-	}
-	var g godeps
-	if err := json.Unmarshal(data, &g); err != nil {
-		return nil, errors.New("invalid json in godeps file", err)
+		return nil, err
 	}
 	containerEnv := []string{
-		fmt.Sprintf("ROOT_PATH=%s", g.ImportPath),
+		fmt.Sprintf("ROOT_PATH=%s", rootPath),
 		fmt.Sprintf("BOOTSTRAP_TYPE=%s", r.BootstrapType),
 	}
 
-	if err := r.runContainer(sourcesDir, containerEnv); err != nil {
+	if err := r.runContainer(sourcesDir, containerEnv, params.Containers); err != nil {
 		return nil, err
 	}
 
 	// now we should program.bin
 	resultFile := path.Join(sourcesDir, "program.bin")
-	logrus.Debugf("finished kernel binary at %s", resultFile)
-	img, err := r.CreateImage(resultFile, params.Args, params.MntPoints, nil, params.NoCleanup)
+	logger.Debugf("finished kernel binary at %s", resultFile)
+	img, err := r.CreateImage(resultFile, params.Args, params.MntPoints, nil, params.NoCleanup, params.Containers)
 	if err != nil {
 		return nil, errors.New("creating boot volume from kernel binary", err)
 	}
@@ -81,6 +74,50 @@ func (r *RumpGoCompiler) Usage() *compilers.CompilerUsage {
 	return nil
 }
 
+// goRootPath returns the import path the project is built under: the
+// module path from go.mod, or the ImportPath of a legacy Godeps file.
+// Module dependencies are vendored by the container before building.
+func goRootPath(sourcesDir string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(sourcesDir, "go.mod"))
+	if err == nil {
+		modulePath := goModulePath(data)
+		if modulePath == "" {
+			return "", errors.New("go.mod has no module directive", nil)
+		}
+		return modulePath, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", errors.New("could not read go.mod", err)
+	}
+
+	godepsFile := filepath.Join(sourcesDir, "Godeps", "Godeps.json")
+	if _, err := os.Stat(godepsFile); err != nil {
+		return "", errors.New("the Go compiler requires a go.mod file (or a legacy Godeps file) in the root of your project", nil)
+	}
+	data, err = ioutil.ReadFile(godepsFile)
+	if err != nil {
+		return "", errors.New("could not read godeps file", err)
+	}
+	var g godeps
+	if err := json.Unmarshal(data, &g); err != nil {
+		return "", errors.New("invalid json in godeps file", err)
+	}
+	return g.ImportPath, nil
+}
+
+func goModulePath(goMod []byte) string {
+	for _, line := range strings.Split(string(goMod), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], "\"`")
+		}
+	}
+	return ""
+}
+
 type godeps struct {
 	ImportPath   string   `json:"ImportPath"`
 	GoVersion    string   `json:"GoVersion"`
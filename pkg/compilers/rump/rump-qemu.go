@@ -30,10 +30,11 @@ import (
 	"github.com/bhojpur/kernel/pkg/compilers"
 	kos "github.com/bhojpur/kernel/pkg/os"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/sirupsen/logrus"
 )
 
-func CreateImageQemu(kernel string, args string, mntPoints, bakedEnv []string, noCleanup bool) (*types.RawImage, error) {
+func CreateImageQemu(kernel string, args string, mntPoints, bakedEnv []string, noCleanup bool, group *kutil.ContainerGroup) (*types.RawImage, error) {
 	// create rump config
 	var c rumpConfig
 	if bakedEnv != nil {
@@ -89,7 +90,7 @@ func CreateImageQemu(kernel string, args string, mntPoints, bakedEnv []string, n
 
 	logrus.Debugf("writing rump json config: %s", cmdline)
 
-	imgFile, err := compilers.BuildBootableImage(kernel, cmdline, true, noCleanup)
+	imgFile, err := compilers.BuildBootableImage(kernel, cmdline, true, noCleanup, group)
 	if err != nil {
 		return nil, err
 	}
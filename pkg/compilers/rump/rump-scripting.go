@@ -29,8 +29,8 @@ import (
 
 	"github.com/bhojpur/kernel/pkg/compilers"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
-	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 )
 
@@ -60,6 +60,7 @@ type scriptProjectConfig struct {
 }
 
 func (r *RumpScriptCompiler) CompileRawImage(params types.CompileImageParams) (*types.RawImage, error) {
+	logger := kutil.LogEntry(params.Logger)
 	sourcesDir := params.SourcesDir
 	var config scriptProjectConfig
 	data, err := ioutil.ReadFile(filepath.Join(sourcesDir, "manifest.yaml"))
@@ -74,14 +75,14 @@ func (r *RumpScriptCompiler) CompileRawImage(params types.CompileImageParams) (*
 		return nil, errors.New("invalid main file specified", err)
 	}
 
-	logrus.Debugf("using main file %s", config.MainFile)
+	logger.Debugf("using main file %s", config.MainFile)
 
 	containerEnv := []string{
 		fmt.Sprintf("MAIN_FILE=%s", config.MainFile),
 		fmt.Sprintf("BOOTSTRAP_TYPE=%s", r.BootstrapType),
 	}
 
-	if err := r.runContainer(sourcesDir, containerEnv); err != nil {
+	if err := r.runContainer(sourcesDir, containerEnv, params.Containers); err != nil {
 		return nil, err
 	}
 
@@ -96,14 +97,14 @@ func (r *RumpScriptCompiler) CompileRawImage(params types.CompileImageParams) (*
 		args = args + " " + params.Args
 	}
 
-	return r.CreateImage(resultFile, args, params.MntPoints, append(r.ScriptEnv, fmt.Sprintf("MAIN_FILE=%s", config.MainFile), fmt.Sprintf("BOOTSTRAP_TYPE=%s", r.BootstrapType)), params.NoCleanup)
+	return r.CreateImage(resultFile, args, params.MntPoints, append(r.ScriptEnv, fmt.Sprintf("MAIN_FILE=%s", config.MainFile), fmt.Sprintf("BOOTSTRAP_TYPE=%s", r.BootstrapType)), params.NoCleanup, params.Containers)
 }
 
 func (r *RumpScriptCompiler) Usage() *compilers.CompilerUsage {
 	return nil
 }
 
-func NewRumpPythonCompiler(dockerImage string, createImage func(kernel, args string, mntPoints, bakedEnv []string, noCleanup bool) (*types.RawImage, error), bootStrapType string) *RumpScriptCompiler {
+func NewRumpPythonCompiler(dockerImage string, createImage func(kernel, args string, mntPoints, bakedEnv []string, noCleanup bool, group *kutil.ContainerGroup) (*types.RawImage, error), bootStrapType string) *RumpScriptCompiler {
 	return &RumpScriptCompiler{
 		RumCompilerBase: RumCompilerBase{
 			DockerImage: dockerImage,
@@ -118,7 +119,7 @@ func NewRumpPythonCompiler(dockerImage string, createImage func(kernel, args str
 	}
 }
 
-func NewRumpJavaCompiler(dockerImage string, createImage func(kernel, args string, mntPoints, bakedEnv []string, noCleanup bool) (*types.RawImage, error), bootStrapType string) *RumpScriptCompiler {
+func NewRumpJavaCompiler(dockerImage string, createImage func(kernel, args string, mntPoints, bakedEnv []string, noCleanup bool, group *kutil.ContainerGroup) (*types.RawImage, error), bootStrapType string) *RumpScriptCompiler {
 	return &RumpScriptCompiler{
 		RumCompilerBase: RumCompilerBase{
 			DockerImage: dockerImage,
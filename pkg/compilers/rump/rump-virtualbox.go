@@ -26,18 +26,19 @@ import (
 
 	"github.com/bhojpur/kernel/pkg/compilers"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/sirupsen/logrus"
 )
 
-func CreateImageVirtualBox(kernel string, args string, mntPoints, bakedEnv []string, noCleanup bool) (*types.RawImage, error) {
-	return createImageVirtualBox(kernel, args, mntPoints, bakedEnv, noCleanup, false)
+func CreateImageVirtualBox(kernel string, args string, mntPoints, bakedEnv []string, noCleanup bool, group *kutil.ContainerGroup) (*types.RawImage, error) {
+	return createImageVirtualBox(kernel, args, mntPoints, bakedEnv, noCleanup, false, group)
 }
 
-func CreateImageVirtualBoxAddStub(kernel string, args string, mntPoints, bakedEnv []string, noCleanup bool) (*types.RawImage, error) {
-	return createImageVirtualBox(kernel, args, mntPoints, bakedEnv, noCleanup, true)
+func CreateImageVirtualBoxAddStub(kernel string, args string, mntPoints, bakedEnv []string, noCleanup bool, group *kutil.ContainerGroup) (*types.RawImage, error) {
+	return createImageVirtualBox(kernel, args, mntPoints, bakedEnv, noCleanup, true, group)
 }
 
-func createImageVirtualBox(kernel string, args string, mntPoints, bakedEnv []string, noCleanup, addStub bool) (*types.RawImage, error) {
+func createImageVirtualBox(kernel string, args string, mntPoints, bakedEnv []string, noCleanup, addStub bool, group *kutil.ContainerGroup) (*types.RawImage, error) {
 	// create rump config
 	var c rumpConfig
 	if bakedEnv != nil {
@@ -101,7 +102,7 @@ func createImageVirtualBox(kernel string, args string, mntPoints, bakedEnv []str
 
 	logrus.Debugf("writing rump json config: %s", cmdline)
 
-	imgFile, err := compilers.BuildBootableImage(kernel, cmdline, true, noCleanup)
+	imgFile, err := compilers.BuildBootableImage(kernel, cmdline, true, noCleanup, group)
 	if err != nil {
 		return nil, err
 	}
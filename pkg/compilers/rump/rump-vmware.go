@@ -26,18 +26,19 @@ import (
 
 	"github.com/bhojpur/kernel/pkg/compilers"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/sirupsen/logrus"
 )
 
-func CreateImageVmware(kernel string, args string, mntPoints, bakedEnv []string, noCleanup bool) (*types.RawImage, error) {
-	return createImageVmware(kernel, args, mntPoints, bakedEnv, noCleanup, false)
+func CreateImageVmware(kernel string, args string, mntPoints, bakedEnv []string, noCleanup bool, group *kutil.ContainerGroup) (*types.RawImage, error) {
+	return createImageVmware(kernel, args, mntPoints, bakedEnv, noCleanup, false, group)
 }
 
-func CreateImageVmwareAddStub(kernel string, args string, mntPoints, bakedEnv []string, noCleanup bool) (*types.RawImage, error) {
-	return createImageVmware(kernel, args, mntPoints, bakedEnv, noCleanup, true)
+func CreateImageVmwareAddStub(kernel string, args string, mntPoints, bakedEnv []string, noCleanup bool, group *kutil.ContainerGroup) (*types.RawImage, error) {
+	return createImageVmware(kernel, args, mntPoints, bakedEnv, noCleanup, true, group)
 }
 
-func createImageVmware(kernel string, args string, mntPoints, bakedEnv []string, noCleanup, addStub bool) (*types.RawImage, error) {
+func createImageVmware(kernel string, args string, mntPoints, bakedEnv []string, noCleanup, addStub bool, group *kutil.ContainerGroup) (*types.RawImage, error) {
 	// create rump config
 	var c rumpConfig
 	if bakedEnv != nil {
@@ -90,7 +91,7 @@ func createImageVmware(kernel string, args string, mntPoints, bakedEnv []string,
 		return nil, err
 	}
 
-	imgFile, err := compilers.BuildBootableImage(kernel, cmdline, true, noCleanup)
+	imgFile, err := compilers.BuildBootableImage(kernel, cmdline, true, noCleanup, group)
 	if err != nil {
 		return nil, err
 	}
@@ -26,17 +26,18 @@ import (
 
 	"github.com/bhojpur/kernel/pkg/compilers"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 )
 
-func CreateImageXen(kernel, args string, mntPoints, bakedEnv []string, noCleanup bool) (*types.RawImage, error) {
-	return createImageXen(kernel, args, mntPoints, bakedEnv, noCleanup, false)
+func CreateImageXen(kernel, args string, mntPoints, bakedEnv []string, noCleanup bool, group *kutil.ContainerGroup) (*types.RawImage, error) {
+	return createImageXen(kernel, args, mntPoints, bakedEnv, noCleanup, false, group)
 }
 
-func CreateImageXenAddStub(kernel, args string, mntPoints, bakedEnv []string, noCleanup bool) (*types.RawImage, error) {
-	return createImageXen(kernel, args, mntPoints, bakedEnv, noCleanup, true)
+func CreateImageXenAddStub(kernel, args string, mntPoints, bakedEnv []string, noCleanup bool, group *kutil.ContainerGroup) (*types.RawImage, error) {
+	return createImageXen(kernel, args, mntPoints, bakedEnv, noCleanup, true, group)
 }
 
-func createImageXen(kernel, args string, mntPoints, bakedEnv []string, noCleanup, addStub bool) (*types.RawImage, error) {
+func createImageXen(kernel, args string, mntPoints, bakedEnv []string, noCleanup, addStub bool, group *kutil.ContainerGroup) (*types.RawImage, error) {
 	// create rump config
 	var c rumpConfig
 	if bakedEnv != nil {
@@ -92,7 +93,7 @@ func createImageXen(kernel, args string, mntPoints, bakedEnv []string, noCleanup
 	if err != nil {
 		return nil, err
 	}
-	imgFile, err := compilers.BuildBootableImage(kernel, cmdline, false, noCleanup)
+	imgFile, err := compilers.BuildBootableImage(kernel, cmdline, false, noCleanup, group)
 
 	if err != nil {
 		return nil, err
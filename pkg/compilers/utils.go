@@ -33,7 +33,7 @@ import (
 	kutil "github.com/bhojpur/kernel/pkg/util"
 )
 
-func BuildBootableImage(kernel, cmdline string, usePartitionTables, noCleanup bool) (string, error) {
+func BuildBootableImage(kernel, cmdline string, usePartitionTables, noCleanup bool, group *kutil.ContainerGroup) (string, error) {
 	directory, err := ioutil.TempDir("", "bootable-image-directory.")
 	if err != nil {
 		return "", errors.New("creating tmpdir", err)
@@ -67,7 +67,7 @@ func BuildBootableImage(kernel, cmdline string, usePartitionTables, noCleanup bo
 	}
 	binds := map[string]string{directory: contextDir, "/dev/": "/dev/"}
 
-	if err := kutil.NewContainer("boot-creator").Privileged(true).WithVolumes(binds).Run(cmds...); err != nil {
+	if err := kutil.NewContainer("boot-creator").Privileged(true).WithVolumes(binds).InGroup(group).Run(cmds...); err != nil {
 		return "", err
 	}
 
@@ -20,9 +20,63 @@ package config
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
+import "time"
+
 type DaemonConfig struct {
 	Providers Providers `yaml:"providers"`
 	Version   string    `yaml:"version"`
+	// Address the daemon listens on; empty means all interfaces
+	Address    string     `yaml:"address"`
+	TLS        DaemonTLS  `yaml:"tls"`
+	Auth       DaemonAuth `yaml:"auth"`
+	State      State      `yaml:"state"`
+	Reconcile  Reconcile  `yaml:"reconcile"`
+	Supervisor Supervisor `yaml:"supervisor"`
+	AccessLog  AccessLog  `yaml:"access_log"`
+}
+
+// AccessLog configures the JSON access log of the daemon api, one line per
+// request. It goes to stdout unless a Path is given.
+type AccessLog struct {
+	Path     string `yaml:"path"`
+	Disabled bool   `yaml:"disabled"`
+}
+
+// Reconcile configures the loop that compares provider state with the
+// real infrastructure. Interval defaults to 30s.
+type Reconcile struct {
+	Interval time.Duration `yaml:"interval"`
+	Disabled bool          `yaml:"disabled"`
+}
+
+// Supervisor configures how often instances with a restart policy or
+// health check are checked. Interval defaults to 5s.
+type Supervisor struct {
+	Interval time.Duration `yaml:"interval"`
+}
+
+// State selects where providers keep their state. Backend is "json"
+// (the default, one state.json per provider) or "bolt" (one transactional
+// database for all providers, importing existing state.json files).
+type State struct {
+	Backend string `yaml:"backend"`
+	// Path of the bolt database, default {KernelHome}/state.db
+	Path string `yaml:"path"`
+}
+
+// DaemonTLS enables https when CertFile and KeyFile are set. Setting
+// ClientCAFile additionally requires clients to present a certificate
+// signed by that CA.
+type DaemonTLS struct {
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file"`
+}
+
+// DaemonAuth requires requests to carry one of Tokens as a bearer token.
+// No tokens means no token auth.
+type DaemonAuth struct {
+	Tokens []string `yaml:"tokens"`
 }
 
 type Providers struct {
@@ -73,9 +127,10 @@ type Virtualbox struct {
 }
 
 type Qemu struct {
-	Name         string `yaml:"name"`
-	NoGraphic    bool   `yaml:"no_graphic"`
-	DebuggerPort int    `yaml:"debugger_port"`
+	Name           string `yaml:"name"`
+	NoGraphic      bool   `yaml:"no_graphic"`
+	DebuggerPort   int    `yaml:"debugger_port"`
+	SerialLogMaxMb int    `yaml:"serial_log_max_mb"`
 }
 type Firecracker struct {
 	Name string `yaml:"name"`
@@ -84,6 +139,25 @@ type Firecracker struct {
 	Kernel string `yaml:"kernel"`
 	// either empty, stdio, or xterm
 	Console string `yaml:"console"`
+
+	// instances get a tap device on Bridge and a static address from
+	// IpPool (CIDR notation); leave IpPool empty to disable networking
+	Bridge      string   `yaml:"bridge"`
+	IpPool      string   `yaml:"ip_pool"`
+	Gateway     string   `yaml:"gateway"`
+	Nameservers []string `yaml:"nameservers"`
+
+	// machine defaults, overridable per instance at run time
+	VcpuCount   int    `yaml:"vcpu_count"`
+	CpuTemplate string `yaml:"cpu_template"`
+	HtEnabled   bool   `yaml:"ht_enabled"`
+	KernelArgs  string `yaml:"kernel_args"`
+	// kernels instances may boot instead of Kernel must be in KernelsDir;
+	// leave it empty to only ever boot the configured kernel
+	KernelsDir string `yaml:"kernels_dir"`
+
+	// size in MB the instance log and metrics files rotate at
+	LogMaxMb int `yaml:"log_max_mb"`
 }
 
 type Ukvm struct {
@@ -125,6 +199,12 @@ const (
 
 type ClientConfig struct {
 	Host string `yaml:"host"`
+	// CAFile verifies the daemon certificate; setting it (or CertFile)
+	// switches the client to https
+	CAFile   string `yaml:"ca_file,omitempty"`
+	CertFile string `yaml:"cert_file,omitempty"`
+	KeyFile  string `yaml:"key_file,omitempty"`
+	Token    string `yaml:"token,omitempty"`
 }
 
 type HubConfig struct {
@@ -0,0 +1,109 @@
+package daemon
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/bhojpur/kernel/pkg/config"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/go-martini/martini"
+	"github.com/pborman/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const requestIdHeader = "X-Request-Id"
+
+var routeType = reflect.TypeOf((*martini.Route)(nil)).Elem()
+
+func newAccessLogger(c config.AccessLog) (*logrus.Logger, error) {
+	logger := logrus.New()
+	logger.Formatter = &logrus.JSONFormatter{}
+	logger.Out = os.Stdout
+	switch {
+	case c.Disabled:
+		logger.Out = ioutil.Discard
+	case c.Path != "":
+		f, err := os.OpenFile(c.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+		if err != nil {
+			return nil, errors.New("opening access log "+c.Path, err)
+		}
+		logger.Out = f
+	}
+	return logger, nil
+}
+
+// instrument is the outermost daemon middleware. It gives every request an
+// id, reusing the client's X-Request-Id if it sent one, then records the
+// request in the metrics and writes a JSON access log line for it.
+func (d *KernelDaemon) instrument(res http.ResponseWriter, req *http.Request, c martini.Context) {
+	start := time.Now()
+	id := req.Header.Get(requestIdHeader)
+	if id == "" || len(id) > 128 {
+		id = uuid.New()
+	}
+	res.Header().Set(requestIdHeader, id)
+	rw := res.(martini.ResponseWriter)
+
+	defer func() {
+		elapsed := time.Since(start)
+		route := "unmatched"
+		if v := c.Get(routeType); v.IsValid() {
+			route = v.Interface().(martini.Route).Pattern()
+		}
+		status := rw.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		d.metrics.observeRequest(req.Method, route, status, elapsed)
+		d.accessLog.WithFields(logrus.Fields{
+			"request_id":  id,
+			"method":      req.Method,
+			"path":        req.URL.Path,
+			"route":       route,
+			"status":      status,
+			"bytes":       rw.Size(),
+			"duration_ms": float64(elapsed) / float64(time.Millisecond),
+			"remote":      req.RemoteAddr,
+			"user_agent":  req.UserAgent(),
+		}).Info("request")
+	}()
+
+	// handlers take the request with the id from the injector
+	c.Map(req.WithContext(context.WithValue(req.Context(), requestIdKey{}, id)))
+	c.Next()
+}
+
+type requestIdKey struct{}
+
+// requestLog is the logger for lines about req, tagged with its request id.
+func requestLog(req *http.Request) *logrus.Entry {
+	entry := logrus.NewEntry(logrus.StandardLogger())
+	if id, ok := req.Context().Value(requestIdKey{}).(string); ok {
+		return entry.WithField("request_id", id)
+	}
+	return entry
+}
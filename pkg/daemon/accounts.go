@@ -0,0 +1,146 @@
+package daemon
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bhojpur/kernel/pkg/config"
+	"github.com/bhojpur/kernel/pkg/providers"
+	"github.com/bhojpur/kernel/pkg/state"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// providerStateFile is where the account registered under key keeps its
+// state. Unnamed accounts use the provider's default state file, named
+// accounts get their own next to it, e.g. ~/.bhojpur/aws/us-east-1-prod/state.json
+func providerStateFile(key, defaultFile string) string {
+	if key == providers.ProviderType(key) {
+		return defaultFile
+	}
+	_, name := filepath.Split(key)
+	return filepath.Join(filepath.Dir(defaultFile), name, filepath.Base(defaultFile))
+}
+
+// openStateDB opens the shared state database when the bolt backend is
+// configured; it returns nil for the default json backend.
+func openStateDB(c config.State) (*bolt.DB, error) {
+	switch c.Backend {
+	case "", "json":
+		return nil, nil
+	case "bolt":
+		path := c.Path
+		if path == "" {
+			path = filepath.Join(config.Internal.KernelHome, "state.db")
+		}
+		logrus.Infof("keeping provider state in %s", path)
+		return state.OpenBoltDB(path)
+	default:
+		return nil, errors.New("unknown state backend "+c.Backend+". Available: json|bolt", nil)
+	}
+}
+
+// providerState loads the state of an account, starting blank if there is
+// none. Before accounts were named, only the first account of each type was
+// used and it kept its state in the default file; that file is moved to the
+// first named account so upgrading keeps existing images and instances.
+// With a database, the account's state.json is imported the first time.
+func providerState(db *bolt.DB, key, defaultFile string, first bool) (state.State, error) {
+	stateFile := providerStateFile(key, defaultFile)
+	if stateFile != defaultFile && first {
+		if _, err := os.Stat(stateFile); os.IsNotExist(err) {
+			if _, err := os.Stat(defaultFile); err == nil {
+				logrus.Infof("moving state of %s from %s to %s", key, defaultFile, stateFile)
+				os.MkdirAll(filepath.Dir(stateFile), 0755)
+				if err := os.Rename(defaultFile, stateFile); err != nil {
+					logrus.WithError(err).Warnf("failed to move state file %s", defaultFile)
+				}
+			}
+		}
+	}
+	if db != nil {
+		s, err := state.NewBoltState(db, key)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(stateFile); err == nil && s.Empty() {
+			logrus.Infof("importing state of %s from %s", key, stateFile)
+			if err := s.Import(stateFile); err != nil {
+				return nil, errors.New("importing state of "+key, err)
+			}
+		}
+		return s, nil
+	}
+	s, err := state.BasicStateFromFile(stateFile)
+	if err != nil {
+		logrus.WithError(err).Warnf("failed to read %s state file at %s, creating blank state", key, stateFile)
+		os.MkdirAll(filepath.Dir(stateFile), 0755)
+		return state.NewBasicState(stateFile), nil
+	}
+	return s, nil
+}
+
+// providerDataDirs are the directories local hypervisor providers keep the
+// files of their images, instances, volumes and snapshots in.
+var providerDataDirs = []string{"images", "instances", "volumes", "snapshots"}
+
+// moveProviderDirs moves the data directories the first account of a local
+// hypervisor kept in defaultDir before accounts were named to dir, the same
+// way providerState moves its state file. Saved launch arguments and
+// snapshots hold absolute paths, so the old locations are left as links.
+func moveProviderDirs(key, defaultDir, dir string, first bool) {
+	if dir == defaultDir || !first {
+		return
+	}
+	for _, name := range providerDataDirs {
+		from, to := filepath.Join(defaultDir, name), filepath.Join(dir, name)
+		if _, err := os.Stat(to); !os.IsNotExist(err) {
+			continue
+		}
+		if _, err := os.Stat(from); err != nil {
+			continue
+		}
+		logrus.Infof("moving %s of %s from %s to %s", name, key, from, to)
+		os.MkdirAll(dir, 0755)
+		if err := os.Rename(from, to); err != nil {
+			logrus.WithError(err).Warnf("failed to move %s", from)
+			continue
+		}
+		if err := os.Symlink(to, from); err != nil {
+			logrus.WithError(err).Warnf("failed to link %s to %s", from, to)
+		}
+	}
+}
+
+func addProvider(registered providers.Providers, key string, p providers.Provider) error {
+	if strings.Count(key, "/") > 1 {
+		return errors.New("provider account name in "+key+" must not contain '/'", nil)
+	}
+	if _, ok := registered[key]; ok {
+		return errors.New("provider "+key+" is configured more than once; give each account a unique name", nil)
+	}
+	registered[key] = p
+	return nil
+}
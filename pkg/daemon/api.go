@@ -20,6 +20,10 @@ package daemon
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
+import (
+	"github.com/bhojpur/kernel/pkg/types"
+)
+
 type RunInstanceRequest struct {
 	InstanceName string            `json:"InstanceName"`
 	ImageName    string            `json:"ImageName"`
@@ -28,4 +32,25 @@ type RunInstanceRequest struct {
 	MemoryMb     int               `json:"MemoryMb"`
 	NoCleanup    bool              `json:"NoCleanup"`
 	DebugMode    bool              `json:"DebugMode"`
+	VcpuCount    int               `json:"VcpuCount,omitempty"`
+	CpuTemplate  string            `json:"CpuTemplate,omitempty"`
+	KernelArgs   string            `json:"KernelArgs,omitempty"`
+	KernelPath   string            `json:"KernelPath,omitempty"`
+	// Provider picks the account to run on when the image exists in
+	// several; by default the account holding the image is used
+	Provider string `json:"Provider,omitempty"`
+	// RestartPolicy and HealthCheck make the daemon supervise the instance
+	RestartPolicy types.RestartPolicy `json:"RestartPolicy,omitempty"`
+	HealthCheck   *types.HealthCheck  `json:"HealthCheck,omitempty"`
+}
+
+// ErrorResponse is the json body of a failed request that carries more
+// than a message, e.g. the instances that block deleting an image.
+type ErrorResponse struct {
+	Message   string   `json:"Message"`
+	Instances []string `json:"Instances,omitempty"`
+}
+
+func (e *ErrorResponse) Error() string {
+	return e.Message
 }
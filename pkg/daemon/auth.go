@@ -0,0 +1,90 @@
+package daemon
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/bhojpur/kernel/pkg/config"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/go-martini/martini"
+	"github.com/sirupsen/logrus"
+)
+
+// tokenAuth rejects requests that do not carry one of tokens as a bearer
+// token.
+func tokenAuth(tokens []string) martini.Handler {
+	return func(res http.ResponseWriter, req *http.Request, c martini.Context) {
+		header := req.Header.Get("Authorization")
+		if strings.HasPrefix(header, "Bearer ") {
+			presented := []byte(strings.TrimPrefix(header, "Bearer "))
+			for _, token := range tokens {
+				if subtle.ConstantTimeCompare(presented, []byte(token)) == 1 {
+					c.Next()
+					return
+				}
+			}
+		}
+		logrus.WithFields(logrus.Fields{
+			"remote": req.RemoteAddr,
+			"path":   req.URL.Path,
+		}).Warnf("rejecting unauthenticated request")
+		res.Header().Set("WWW-Authenticate", `Bearer realm="bhojpur-kernel"`)
+		res.WriteHeader(http.StatusUnauthorized)
+		respond(res, errors.New("missing or invalid bearer token", nil))
+	}
+}
+
+// newTLSConfig returns nil when the daemon should serve plain http.
+func newTLSConfig(c config.DaemonTLS) (*tls.Config, error) {
+	if c.CertFile == "" && c.KeyFile == "" {
+		if c.ClientCAFile != "" {
+			return nil, errors.New("tls client_ca_file requires cert_file and key_file", nil)
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, errors.New("loading tls certificate "+c.CertFile, err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if c.ClientCAFile != "" {
+		data, err := ioutil.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, errors.New("reading client ca file "+c.ClientCAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New("no certificates found in "+c.ClientCAFile, nil)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
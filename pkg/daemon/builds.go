@@ -0,0 +1,296 @@
+package daemon
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bhojpur/kernel/pkg/compilers"
+	"github.com/bhojpur/kernel/pkg/providers"
+	"github.com/bhojpur/kernel/pkg/types"
+	"github.com/bhojpur/kernel/pkg/util"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/pborman/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// builds beyond this many wait in the queue
+	maxConcurrentBuilds = 2
+	// finished builds are forgotten, oldest first, beyond this many
+	maxFinishedBuilds = 50
+	// builds keep the last this many bytes of their output; older output
+	// is dropped once twice as much has piled up
+	maxBuildLogBytes = 1 << 20
+)
+
+// buildJob compiles sources and stages the result on a provider in the
+// background. Its sources dir is removed when it finishes.
+type buildJob struct {
+	job        types.BuildJob
+	compiler   compilers.Compiler
+	provider   providers.Provider
+	params     types.CompileImageParams
+	force      bool
+	log        *buildLog
+	logger     *logrus.Entry // tagged with the id of the queuing request
+	containers *util.ContainerGroup
+	cancelled  chan struct{}
+	cancelOnce sync.Once
+	done       chan struct{}
+	lock       sync.Mutex
+}
+
+func newBuildJob(imageName string, compilerName compilers.CompilerType, compiler compilers.Compiler, providerName string, provider providers.Provider, params types.CompileImageParams, force bool, logger *logrus.Entry) *buildJob {
+	log := &buildLog{}
+	containers := util.NewContainerGroup(log)
+	params.Containers = containers
+	id := uuid.New()
+	logger = logger.WithField("build_id", id)
+	params.Logger = logger
+	return &buildJob{
+		job: types.BuildJob{
+			Id:        id,
+			ImageName: imageName,
+			Compiler:  compilerName.String(),
+			Provider:  providerName,
+			State:     types.BuildState_Queued,
+			Created:   time.Now(),
+		},
+		compiler:   compiler,
+		provider:   provider,
+		params:     params,
+		force:      force,
+		log:        log,
+		logger:     logger,
+		containers: containers,
+		cancelled:  make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+func (j *buildJob) snapshot() types.BuildJob {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.job
+}
+
+func (j *buildJob) setState(state types.BuildState) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.job.State = state
+}
+
+func (j *buildJob) finish(state types.BuildState, image *types.Image, err error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.job.State = state
+	j.job.Image = image
+	j.job.Finished = time.Now()
+	if err != nil {
+		j.job.Error = err.Error()
+		fmt.Fprintf(j.log, "build %s: %v\n", state, err)
+		j.logger.WithError(err).Warnf("build %s", state)
+	} else {
+		fmt.Fprintf(j.log, "build %s\n", state)
+		j.logger.Infof("build %s", state)
+	}
+}
+
+func (j *buildJob) cancel() {
+	j.cancelOnce.Do(func() {
+		close(j.cancelled)
+		j.containers.Cancel()
+	})
+}
+
+func (j *buildJob) run(slots chan struct{}, metrics *daemonMetrics) {
+	defer close(j.done)
+	if !j.params.NoCleanup {
+		defer os.RemoveAll(j.params.SourcesDir)
+	}
+
+	select {
+	case slots <- struct{}{}:
+		defer func() { <-slots }()
+	case <-j.cancelled:
+		j.finish(types.BuildState_Cancelled, nil, nil)
+		return
+	}
+
+	j.setState(types.BuildState_Running)
+	fmt.Fprintf(j.log, "compiling %s with %s\n", j.job.ImageName, j.job.Compiler)
+	compileStart := time.Now()
+	rawImage, err := j.compiler.CompileRawImage(j.params)
+	if j.containers.Cancelled() {
+		metrics.compileDuration.WithLabelValues(j.job.Compiler, string(types.BuildState_Cancelled)).Observe(time.Since(compileStart).Seconds())
+		j.finish(types.BuildState_Cancelled, nil, nil)
+		return
+	}
+	metrics.compileDuration.WithLabelValues(j.job.Compiler, result(err)).Observe(time.Since(compileStart).Seconds())
+	if err != nil {
+		j.finish(types.BuildState_Failed, nil, errors.New("failed to compile raw image", err))
+		return
+	}
+	j.logger.Debugf("raw image compiled and saved to " + rawImage.LocalImagePath)
+	if !j.params.NoCleanup {
+		defer os.Remove(rawImage.LocalImagePath)
+	}
+
+	if j.containers.Cancelled() {
+		j.finish(types.BuildState_Cancelled, nil, nil)
+		return
+	}
+	fmt.Fprintf(j.log, "staging %s on %s\n", j.job.ImageName, j.job.Provider)
+	stageStart := time.Now()
+	image, err := j.provider.Stage(types.StageImageParams{
+		Name:       j.job.ImageName,
+		RawImage:   rawImage,
+		Force:      j.force,
+		NoCleanup:  j.params.NoCleanup,
+		Containers: j.containers,
+		Logger:     j.logger,
+	})
+	if err != nil && j.containers.Cancelled() {
+		metrics.stageDuration.WithLabelValues(j.job.Provider, string(types.BuildState_Cancelled)).Observe(time.Since(stageStart).Seconds())
+		j.finish(types.BuildState_Cancelled, nil, nil)
+		return
+	}
+	metrics.stageDuration.WithLabelValues(j.job.Provider, result(err)).Observe(time.Since(stageStart).Seconds())
+	metrics.providerError(j.job.Provider, "stage", err)
+	if err != nil {
+		j.finish(types.BuildState_Failed, nil, errors.New("failed staging image", err))
+		return
+	}
+	j.finish(types.BuildState_Succeeded, image, nil)
+}
+
+// buildLog is the combined output of a build, readable while it is written.
+// Only the tail of long outputs is kept, so finished builds held in the
+// queue stay small.
+type buildLog struct {
+	buf []byte
+	// start is the offset in the whole output of buf[0]
+	start int
+	lock  sync.Mutex
+}
+
+func (l *buildLog) Write(p []byte) (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.buf = append(l.buf, p...)
+	// trim in batches so every write does not move the whole buffer
+	if len(l.buf) > 2*maxBuildLogBytes {
+		drop := len(l.buf) - maxBuildLogBytes
+		l.buf = append([]byte{}, l.buf[drop:]...)
+		l.start += drop
+	}
+	return len(p), nil
+}
+
+// from returns a copy of everything written after offset and the offset
+// to continue from. Readers asking for output that was already dropped
+// get a note saying how much of it is missing.
+func (l *buildLog) from(offset int) ([]byte, int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	end := l.start + len(l.buf)
+	if offset >= end {
+		return nil, offset
+	}
+	var data []byte
+	if offset < l.start {
+		data = []byte(fmt.Sprintf("[%d bytes of build output dropped]\n", l.start-offset))
+		offset = l.start
+	}
+	return append(data, l.buf[offset-l.start:]...), end
+}
+
+type buildQueue struct {
+	jobs    map[string]*buildJob
+	slots   chan struct{}
+	metrics *daemonMetrics
+	lock    sync.Mutex
+}
+
+func newBuildQueue(metrics *daemonMetrics) *buildQueue {
+	return &buildQueue{
+		jobs:    map[string]*buildJob{},
+		slots:   make(chan struct{}, maxConcurrentBuilds),
+		metrics: metrics,
+	}
+}
+
+func (q *buildQueue) submit(j *buildJob) {
+	q.lock.Lock()
+	q.jobs[j.job.Id] = j
+	q.prune()
+	q.lock.Unlock()
+
+	j.logger.WithField("build", j.job).Infof("queued build %s", j.job.Id)
+	go j.run(q.slots, q.metrics)
+}
+
+// prune forgets the oldest finished jobs. Must be called with lock held.
+func (q *buildQueue) prune() {
+	var finished []types.BuildJob
+	for _, j := range q.jobs {
+		if job := j.snapshot(); job.Done() {
+			finished = append(finished, job)
+		}
+	}
+	if len(finished) <= maxFinishedBuilds {
+		return
+	}
+	sort.Slice(finished, func(i, k int) bool {
+		return finished[i].Finished.Before(finished[k].Finished)
+	})
+	for _, job := range finished[:len(finished)-maxFinishedBuilds] {
+		delete(q.jobs, job.Id)
+	}
+}
+
+func (q *buildQueue) get(id string) (*buildJob, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return nil, errors.New("build "+id+" not found", nil)
+	}
+	return j, nil
+}
+
+func (q *buildQueue) list() []types.BuildJob {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	jobs := []types.BuildJob{}
+	for _, j := range q.jobs {
+		jobs = append(jobs, j.snapshot())
+	}
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].Created.Before(jobs[k].Created)
+	})
+	return jobs
+}
@@ -0,0 +1,68 @@
+package daemon
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bhojpur/kernel/pkg/util/errors"
+)
+
+// consoleUpgradeResponse switches a console request to a raw, bidirectional
+// byte stream, the way docker attaches to containers. Go's http client
+// hands the connection back as the body of the response.
+const consoleUpgradeResponse = "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n"
+
+func isConsoleUpgrade(req *http.Request) bool {
+	return strings.ToLower(req.Header.Get("Upgrade")) == "tcp"
+}
+
+// serveConsole hijacks the connection of a console request and copies
+// between it and the console until either the client disconnects or the
+// console closes because the instance exited.
+func serveConsole(res http.ResponseWriter, console io.ReadWriteCloser) error {
+	hijacker, ok := res.(http.Hijacker)
+	if !ok {
+		return errors.New("connection does not support hijacking", nil)
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		return errors.New("hijacking connection", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(consoleUpgradeResponse)); err != nil {
+		return errors.New("switching protocols", err)
+	}
+
+	outputDone := make(chan struct{})
+	go func() {
+		io.Copy(conn, console)
+		// unblocks the copy of client input below
+		conn.Close()
+		close(outputDone)
+	}()
+	io.Copy(console, buf)
+	console.Close()
+	<-outputDone
+	return nil
+}
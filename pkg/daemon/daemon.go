@@ -21,6 +21,7 @@ package daemon
 // THE SOFTWARE.
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -35,6 +36,7 @@ import (
 	"path/filepath"
 
 	"github.com/bhojpur/kernel/pkg/compilers"
+	"github.com/bhojpur/kernel/pkg/compilers/bhojpur"
 	firecrackercompiler "github.com/bhojpur/kernel/pkg/compilers/firecracker"
 	"github.com/bhojpur/kernel/pkg/compilers/includeos"
 	"github.com/bhojpur/kernel/pkg/compilers/mirage"
@@ -44,12 +46,14 @@ import (
 	"github.com/docker/docker/pkg/ioutils"
 	"github.com/go-martini/martini"
 	"github.com/layer-x/layerx-commons/lxmartini"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 
 	"github.com/bhojpur/kernel/pkg/config"
 	kos "github.com/bhojpur/kernel/pkg/os"
 	"github.com/bhojpur/kernel/pkg/providers"
 	"github.com/bhojpur/kernel/pkg/providers/aws"
+	"github.com/bhojpur/kernel/pkg/providers/common"
 	firecrackerprovider "github.com/bhojpur/kernel/pkg/providers/firecracker"
 	"github.com/bhojpur/kernel/pkg/providers/gcloud"
 	"github.com/bhojpur/kernel/pkg/providers/openstack"
@@ -59,16 +63,24 @@ import (
 	"github.com/bhojpur/kernel/pkg/providers/virtualbox"
 	"github.com/bhojpur/kernel/pkg/providers/vsphere"
 	"github.com/bhojpur/kernel/pkg/providers/xen"
-
 	"github.com/bhojpur/kernel/pkg/state"
+
 	"github.com/bhojpur/kernel/pkg/types"
 	"github.com/bhojpur/kernel/pkg/util"
 )
 
 type KernelDaemon struct {
-	server    *martini.ClassicMartini
-	providers providers.Providers `json:"providers"`
-	compilers map[compilers.CompilerType]compilers.Compiler
+	server     *martini.ClassicMartini
+	providers  providers.Providers `json:"providers"`
+	compilers  map[compilers.CompilerType]compilers.Compiler
+	builds     *buildQueue
+	events     *eventBus
+	reconciler *reconciler
+	supervisor *supervisor
+	metrics    *daemonMetrics
+	accessLog  *logrus.Logger
+	address    string
+	tls        *tls.Config
 }
 
 const (
@@ -95,169 +107,207 @@ func NewKernelDaemon(config config.DaemonConfig) (*KernelDaemon, error) {
 	os.Setenv("TMPDIR", tmpDir)
 	os.MkdirAll(tmpDir, 0755)
 
+	stateDB, err := openStateDB(config.State)
+	if err != nil {
+		return nil, err
+	}
+	events := newEventBus()
+	states := map[string]state.State{}
 	_providers := make(providers.Providers)
 	_compilers := make(map[compilers.CompilerType]compilers.Compiler)
 
-	for _, awsConfig := range config.Providers.Aws {
-		logrus.Infof("Bootstrapping provider %s with config %v", aws_provider, awsConfig)
+	for i, awsConfig := range config.Providers.Aws {
+		key := providers.ProviderKey(aws_provider, awsConfig.Name)
+		logrus.Infof("Bootstrapping provider %s with config %v", key, awsConfig)
 		p := aws.NewAwsProvier(awsConfig)
-		s, err := state.BasicStateFromFile(aws.AwsStateFile())
+		s, err := providerState(stateDB, key, aws.AwsStateFile(), i == 0)
 		if err != nil {
-			logrus.WithError(err).Warnf("failed to read aws state file at %s, creating blank aws state", aws.AwsStateFile())
-			s = state.NewBasicState(aws.AwsStateFile())
+			return nil, err
 		}
+		s = events.observe(key, s)
+		states[key] = s
 		p = p.WithState(s)
-		_providers[aws_provider] = p
-		break
+		if err := addProvider(_providers, key, p); err != nil {
+			return nil, err
+		}
 	}
-	for _, vsphereConfig := range config.Providers.Vsphere {
-		logrus.Infof("Bootstrapping provider %s with config %v", vsphere_provider, vsphereConfig)
+	for i, vsphereConfig := range config.Providers.Vsphere {
+		key := providers.ProviderKey(vsphere_provider, vsphereConfig.Name)
+		logrus.Infof("Bootstrapping provider %s with config %v", key, vsphereConfig)
 		p, err := vsphere.NewVsphereProvier(vsphereConfig)
 		if err != nil {
 			return nil, errors.New("initializing vsphere provider", err)
 		}
-		s, err := state.BasicStateFromFile(vsphere.VsphereStateFile())
+		s, err := providerState(stateDB, key, vsphere.VsphereStateFile(), i == 0)
 		if err != nil {
-			logrus.WithError(err).Warnf("failed to read vsphere state file at %s, creating blank vsphere state", vsphere.VsphereStateFile())
-			s = state.NewBasicState(vsphere.VsphereStateFile())
+			return nil, err
 		}
+		s = events.observe(key, s)
+		states[key] = s
 		p = p.WithState(s)
-		_providers[vsphere_provider] = p
-		break
+		if err := addProvider(_providers, key, p); err != nil {
+			return nil, err
+		}
 	}
-	for _, virtualboxConfig := range config.Providers.Virtualbox {
-		logrus.Infof("Bootstrapping provider %s with config %v", virtualbox_provider, virtualboxConfig)
+	for i, virtualboxConfig := range config.Providers.Virtualbox {
+		key := providers.ProviderKey(virtualbox_provider, virtualboxConfig.Name)
+		logrus.Infof("Bootstrapping provider %s with config %v", key, virtualboxConfig)
 		p, err := virtualbox.NewVirtualboxProvider(virtualboxConfig)
 		if err != nil {
 			return nil, errors.New("initializing virtualbox provider", err)
 		}
-		s, err := state.BasicStateFromFile(virtualbox.VirtualboxStateFile())
+		s, err := providerState(stateDB, key, virtualbox.VirtualboxStateFile(), i == 0)
 		if err != nil {
-			logrus.WithError(err).Warnf("failed to read virtualbox state file at %s, creating blank virtualbox state", virtualbox.VirtualboxStateFile())
-			s = state.NewBasicState(virtualbox.VirtualboxStateFile())
+			return nil, err
 		}
+		s = events.observe(key, s)
+		states[key] = s
 		p = p.WithState(s)
-		_providers[virtualbox_provider] = p
-		break
+		if err := addProvider(_providers, key, p); err != nil {
+			return nil, err
+		}
 	}
 
-	for _, qemuConfig := range config.Providers.Qemu {
-		logrus.Infof("Bootstrapping provider %s with config %v", qemu_provider, qemuConfig)
+	for i, qemuConfig := range config.Providers.Qemu {
+		key := providers.ProviderKey(qemu_provider, qemuConfig.Name)
+		logrus.Infof("Bootstrapping provider %s with config %v", key, qemuConfig)
+		moveProviderDirs(key, qemu.QemuDirectory(""), qemu.QemuDirectory(qemuConfig.Name), i == 0)
 		p, err := qemu.NewQemuProvider(qemuConfig)
 		if err != nil {
 			return nil, errors.New("initializing qemu provider", err)
 		}
-		s, err := state.BasicStateFromFile(qemu.QemuStateFile())
+		s, err := providerState(stateDB, key, qemu.QemuStateFile(), i == 0)
 		if err != nil {
-			logrus.WithError(err).Warnf("failed to read qemu state file at %s, creating blank qemu state", qemu.QemuStateFile())
-			s = state.NewBasicState(qemu.QemuStateFile())
+			return nil, err
 		}
+		s = events.observe(key, s)
+		states[key] = s
 		p = p.WithState(s)
-		_providers[qemu_provider] = p
-		break
+		if err := addProvider(_providers, key, p); err != nil {
+			return nil, err
+		}
 	}
 
-	for _, photonConfig := range config.Providers.Photon {
-		logrus.Infof("Bootstrapping provider %s with config %v", photon_provider, photonConfig)
+	for i, photonConfig := range config.Providers.Photon {
+		key := providers.ProviderKey(photon_provider, photonConfig.Name)
+		logrus.Infof("Bootstrapping provider %s with config %v", key, photonConfig)
 		p, err := photon.NewPhotonProvider(photonConfig)
 		if err != nil {
 			return nil, errors.New("initializing photon provider", err)
 		}
-		s, err := state.BasicStateFromFile(photon.PhotonStateFile())
+		s, err := providerState(stateDB, key, photon.PhotonStateFile(), i == 0)
 		if err != nil {
-			logrus.WithError(err).Warnf("failed to read photon state file at %s, creating blank photon state", photon.PhotonStateFile())
-			s = state.NewBasicState(photon.PhotonStateFile())
+			return nil, err
 		}
+		s = events.observe(key, s)
+		states[key] = s
 		p = p.WithState(s)
-		_providers[photon_provider] = p
-		break
+		if err := addProvider(_providers, key, p); err != nil {
+			return nil, err
+		}
 	}
 
-	for _, openstackConfig := range config.Providers.Openstack {
+	for i, openstackConfig := range config.Providers.Openstack {
+		key := providers.ProviderKey(openstack_provider, openstackConfig.Name)
 		openstack.MergeConfWithEnv(&openstackConfig)
 
 		// Mask password prior logging to console.
 		orig_pass := openstackConfig.Password
 		openstackConfig.Password = "<password>"
-		logrus.Infof("Bootstrapping provider %s with config %v", openstack_provider, openstackConfig)
+		logrus.Infof("Bootstrapping provider %s with config %v", key, openstackConfig)
 		openstackConfig.Password = orig_pass
 
 		p, err := openstack.NewOpenstackProvider(openstackConfig)
 		if err != nil {
 			return nil, errors.New("initializing openstack provider", err)
 		}
-		s, err := state.BasicStateFromFile(openstack.OpenstackStateFile())
+		s, err := providerState(stateDB, key, openstack.OpenstackStateFile(), i == 0)
 		if err != nil {
-			logrus.WithError(err).Warnf("failed to read openstack state file at %s, creating blank openstack state", openstack.OpenstackStateFile())
-			s = state.NewBasicState(openstack.OpenstackStateFile())
+			return nil, err
 		}
+		s = events.observe(key, s)
+		states[key] = s
 		p = p.WithState(s)
-		_providers[openstack_provider] = p
-		break
+		if err := addProvider(_providers, key, p); err != nil {
+			return nil, err
+		}
 	}
 
-	for _, xenConfig := range config.Providers.Xen {
-		logrus.Infof("Bootstrapping provider %s with config %v", xen_provider, xenConfig)
+	for i, xenConfig := range config.Providers.Xen {
+		key := providers.ProviderKey(xen_provider, xenConfig.Name)
+		logrus.Infof("Bootstrapping provider %s with config %v", key, xenConfig)
 		p, err := xen.NewXenProvider(xenConfig)
 		if err != nil {
 			return nil, errors.New("initializing xen provider", err)
 		}
-		s, err := state.BasicStateFromFile(xen.XenStateFile())
+		s, err := providerState(stateDB, key, xen.XenStateFile(), i == 0)
 		if err != nil {
-			logrus.WithError(err).Warnf("failed to read xen state file at %s, creating blank state", xen.XenStateFile())
-			s = state.NewBasicState(xen.XenStateFile())
+			return nil, err
 		}
+		s = events.observe(key, s)
+		states[key] = s
 		p = p.WithState(s)
-		_providers[xen_provider] = p
-		break
+		if err := addProvider(_providers, key, p); err != nil {
+			return nil, err
+		}
 	}
 
-	for _, ukvmConfig := range config.Providers.Ukvm {
-		logrus.Infof("Bootstrapping provider %s with config %v", ukvm_provider, ukvmConfig)
+	for i, ukvmConfig := range config.Providers.Ukvm {
+		key := providers.ProviderKey(ukvm_provider, ukvmConfig.Name)
+		logrus.Infof("Bootstrapping provider %s with config %v", key, ukvmConfig)
 		p, err := ukvm.NewUkvmProvider(ukvmConfig)
 		if err != nil {
 			return nil, errors.New("initializing ukvm provider", err)
 		}
-		s, err := state.BasicStateFromFile(ukvm.UkvmStateFile())
+		s, err := providerState(stateDB, key, ukvm.UkvmStateFile(), i == 0)
 		if err != nil {
-			logrus.WithError(err).Warnf("failed to read ukvm state file at %s, creating blank state", ukvm.UkvmStateFile())
-			s = state.NewBasicState(ukvm.UkvmStateFile())
+			return nil, err
 		}
+		s = events.observe(key, s)
+		states[key] = s
 		p = p.WithState(s)
-		_providers[ukvm_provider] = p
-		break
+		if err := addProvider(_providers, key, p); err != nil {
+			return nil, err
+		}
 	}
 
-	for _, gcloudConfig := range config.Providers.Gcloud {
-		logrus.Infof("Bootstrapping provider %s with config %v", gcloud_provider, gcloudConfig)
+	for i, gcloudConfig := range config.Providers.Gcloud {
+		key := providers.ProviderKey(gcloud_provider, gcloudConfig.Name)
+		logrus.Infof("Bootstrapping provider %s with config %v", key, gcloudConfig)
 		p, err := gcloud.NewGcloudProvier(gcloudConfig)
 		if err != nil {
 			return nil, errors.New("initializing gcloud provider", err)
 		}
-		s, err := state.BasicStateFromFile(gcloud.GcloudStateFile())
+		s, err := providerState(stateDB, key, gcloud.GcloudStateFile(), i == 0)
 		if err != nil {
-			logrus.WithError(err).Warnf("failed to read gcloud state file at %s, creating blank state", gcloud.GcloudStateFile())
-			s = state.NewBasicState(gcloud.GcloudStateFile())
+			return nil, err
 		}
+		s = events.observe(key, s)
+		states[key] = s
 		p = p.WithState(s)
-		_providers[gcloud_provider] = p
-		break
+		if err := addProvider(_providers, key, p); err != nil {
+			return nil, err
+		}
 	}
 
-	for _, firecrackerConfig := range config.Providers.Firecracker {
-		logrus.Infof("Bootstrapping provider %s with config %v", firecracker_provider, firecrackerConfig)
+	for i, firecrackerConfig := range config.Providers.Firecracker {
+		key := providers.ProviderKey(firecracker_provider, firecrackerConfig.Name)
+		logrus.Infof("Bootstrapping provider %s with config %v", key, firecrackerConfig)
+		moveProviderDirs(key, firecrackerprovider.FirecrackerDirectory(""), firecrackerprovider.FirecrackerDirectory(firecrackerConfig.Name), i == 0)
 		p, err := firecrackerprovider.NewProvider(firecrackerConfig)
 		if err != nil {
 			return nil, errors.New("initializing firecracker provider", err)
 		}
-		s, err := state.BasicStateFromFile(firecrackerprovider.FirecrackerStateFile())
+		s, err := providerState(stateDB, key, firecrackerprovider.FirecrackerStateFile(), i == 0)
 		if err != nil {
-			logrus.WithError(err).Warnf("failed to read firecracker state file at %s, creating blank state", firecrackerprovider.FirecrackerStateFile())
-			s = state.NewBasicState(firecrackerprovider.FirecrackerStateFile())
+			return nil, err
 		}
+		s = events.observe(key, s)
+		states[key] = s
 		p = p.WithState(s)
-		_providers[firecracker_provider] = p
-		break
+		if err := addProvider(_providers, key, p); err != nil {
+			return nil, err
+		}
 	}
 
 	//rump-go
@@ -433,11 +483,46 @@ func NewKernelDaemon(config config.DaemonConfig) (*KernelDaemon, error) {
 	}
 	_compilers[compilers.FIRECRACKER_GO] = &firecrackercompiler.FirecrackerCompiler{}
 
+	// Bhojpur Go kernel
+	_compilers[compilers.BHOJPUR_GO_QEMU] = &bhojpur.BhojpurGoCompiler{
+		Compiler: compilers.BHOJPUR_GO_QEMU,
+	}
+	_compilers[compilers.BHOJPUR_GO_FIRECRACKER] = &bhojpur.BhojpurGoCompiler{
+		Compiler: compilers.BHOJPUR_GO_FIRECRACKER,
+	}
+
+	tlsConfig, err := newTLSConfig(config.TLS)
+	if err != nil {
+		return nil, errors.New("configuring tls", err)
+	}
+	if tlsConfig == nil && len(config.Auth.Tokens) > 0 {
+		logrus.Warnf("bearer tokens are enabled without tls; tokens will be sent in clear text")
+	}
+
+	accessLog, err := newAccessLogger(config.AccessLog)
+	if err != nil {
+		return nil, err
+	}
+	metrics := newDaemonMetrics(states)
 	d := &KernelDaemon{
 		server:    lxmartini.QuietMartini(),
 		providers: _providers,
 		compilers: _compilers,
+		builds:    newBuildQueue(metrics),
+		events:    events,
+		metrics:   metrics,
+		accessLog: accessLog,
+		address:   config.Address,
+		tls:       tlsConfig,
 	}
+	d.server.Use(d.instrument)
+	if len(config.Auth.Tokens) > 0 {
+		d.server.Use(tokenAuth(config.Auth.Tokens))
+	}
+	if !config.Reconcile.Disabled {
+		d.reconciler = newReconciler(config.Reconcile, _providers, states)
+	}
+	d.supervisor = newSupervisor(config.Supervisor, _providers, states, supervisorFile())
 
 	d.initialize()
 
@@ -445,7 +530,22 @@ func NewKernelDaemon(config config.DaemonConfig) (*KernelDaemon, error) {
 }
 
 func (d *KernelDaemon) Run(port int) {
-	d.server.RunOnAddr(fmt.Sprintf(":%v", port))
+	if d.reconciler != nil {
+		go d.reconciler.loop()
+	}
+	go d.supervisor.loop()
+	addr := fmt.Sprintf("%s:%v", d.address, port)
+	if d.tls == nil {
+		d.server.RunOnAddr(addr)
+		return
+	}
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   d.server,
+		TLSConfig: d.tls,
+	}
+	logrus.Infof("listening on %s (tls)", addr)
+	logrus.Fatal(server.ListenAndServeTLS("", ""))
 }
 
 func (d *KernelDaemon) Stop() error {
@@ -454,43 +554,49 @@ func (d *KernelDaemon) Stop() error {
 }
 
 func (d *KernelDaemon) initialize() {
-	handle := func(res http.ResponseWriter, action func() (interface{}, int, error)) {
+	providerError := func(provider providers.Provider, operation string, err error) error {
+		return d.metrics.providerError(d.providers.KeyOf(provider), operation, err)
+	}
+	d.server.Get("/metrics", promhttp.HandlerFor(d.metrics.registry, promhttp.HandlerOpts{}).ServeHTTP)
+
+	handle := func(res http.ResponseWriter, req *http.Request, action func() (interface{}, int, error)) {
 		jsonObject, statusCode, err := action()
 		res.WriteHeader(statusCode)
 		if err != nil {
 			if err := respond(res, err); err != nil {
-				logrus.WithError(err).Errorf("failed to reply to http request")
+				requestLog(req).WithError(err).Errorf("failed to reply to http request")
 			}
-			logrus.WithError(err).Errorf("error handling request")
+			requestLog(req).WithError(err).Errorf("error handling request")
 			return
 		}
 		if jsonObject != nil {
 			if err := respond(res, jsonObject); err != nil {
-				logrus.WithError(err).Errorf("failed to reply to http request")
+				requestLog(req).WithError(err).Errorf("failed to reply to http request")
 			}
-			logrus.WithField("result", jsonObject).Debugf("request finished")
+			requestLog(req).WithField("result", jsonObject).Debugf("request finished")
 		}
 	}
 
 	//images
 	d.server.Get("/images", func(res http.ResponseWriter, req *http.Request) {
-		handle(res, func() (interface{}, int, error) {
+		handle(res, req, func() (interface{}, int, error) {
 			allImages := []*types.Image{}
 			for _, provider := range d.providers {
 				images, err := provider.ListImages()
+				providerError(provider, "list_images", err)
 				if err != nil {
 					return nil, http.StatusInternalServerError, errors.New("could not get image list", err)
 				}
 				allImages = append(allImages, images...)
 			}
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"images": allImages,
 			}).Debugf("Listing all images")
 			return allImages, http.StatusOK, nil
 		})
 	})
 	d.server.Get("/images/:image_name", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
-		handle(res, func() (interface{}, int, error) {
+		handle(res, req, func() (interface{}, int, error) {
 			imageName := params["image_name"]
 			provider, err := d.providers.ProviderForImage(imageName)
 			if err != nil {
@@ -504,7 +610,7 @@ func (d *KernelDaemon) initialize() {
 		})
 	})
 	d.server.Post("/images/:name/create", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
-		handle(res, func() (interface{}, int, error) {
+		handle(res, req, func() (interface{}, int, error) {
 			name := params["name"]
 			if name == "" {
 				return nil, http.StatusBadRequest, errors.New("image must be named", nil)
@@ -513,10 +619,10 @@ func (d *KernelDaemon) initialize() {
 			if err != nil {
 				return nil, http.StatusInternalServerError, err
 			}
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"req": req,
 			}).Debugf("parsing multipart form")
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"form": req.Form,
 			}).Debugf("parsing form file marked 'tarfile'")
 			sourceTar, _, err := req.FormFile("tarfile")
@@ -531,19 +637,6 @@ func (d *KernelDaemon) initialize() {
 				noCleanup = true
 			}
 
-			sourcesDir, err := ioutil.TempDir("", "unpacked.sources.dir.")
-			if err != nil {
-				return nil, http.StatusInternalServerError, errors.New("creating tmp dir for src files", err)
-			}
-
-			if !noCleanup {
-				defer os.RemoveAll(sourcesDir)
-			}
-
-			logrus.Debugf("extracting uploaded files to " + sourcesDir)
-			if err := kos.ExtractTar(sourceTar, sourcesDir); err != nil {
-				return nil, http.StatusInternalServerError, errors.New("extracting sources", err)
-			}
 			forceStr := req.FormValue("force")
 			var force bool
 			if strings.ToLower(forceStr) == "true" {
@@ -551,8 +644,9 @@ func (d *KernelDaemon) initialize() {
 			}
 			args := req.FormValue("args")
 			providerName := req.FormValue("provider")
-			if _, ok := d.providers[providerName]; !ok {
-				return nil, http.StatusBadRequest, errors.New(providerName+" is not a known provider. Available: "+strings.Join(d.providers.Keys(), "|"), nil)
+			provider, err := d.providers.Lookup(providerName)
+			if err != nil {
+				return nil, http.StatusBadRequest, err
 			}
 
 			base := req.FormValue("base")
@@ -563,7 +657,7 @@ func (d *KernelDaemon) initialize() {
 			if lang == "" {
 				return nil, http.StatusBadRequest, errors.New("must provide 'lang' parameter", nil)
 			}
-			compilerName, err := compilers.ValidateCompiler(base, lang, providerName)
+			compilerName, err := compilers.ValidateCompiler(base, lang, providers.ProviderType(providerName))
 			if err != nil {
 				return nil, http.StatusBadRequest, errors.New("invalid base - lang - provider match", err)
 			}
@@ -578,8 +672,20 @@ func (d *KernelDaemon) initialize() {
 			if len(mntStr) > 0 {
 				mountPoints = strings.Split(mntStr, ",")
 			}
+			detach := strings.ToLower(req.FormValue("detach")) == "true"
+
+			sourcesDir, err := ioutil.TempDir("", "unpacked.sources.dir.")
+			if err != nil {
+				return nil, http.StatusInternalServerError, errors.New("creating tmp dir for src files", err)
+			}
+
+			requestLog(req).Debugf("extracting uploaded files to " + sourcesDir)
+			if err := kos.ExtractTar(sourceTar, sourcesDir); err != nil {
+				os.RemoveAll(sourcesDir)
+				return nil, http.StatusInternalServerError, errors.New("extracting sources", err)
+			}
 
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"force":        force,
 				"mount-points": mountPoints,
 				"name":         name,
@@ -587,6 +693,7 @@ func (d *KernelDaemon) initialize() {
 				"compiler":     compilerName,
 				"provider":     providerName,
 				"noCleanup":    noCleanup,
+				"detach":       detach,
 			}).Debugf("compiling raw image")
 
 			compileParams := types.CompileImageParams{
@@ -594,42 +701,130 @@ func (d *KernelDaemon) initialize() {
 				Args:       args,
 				MntPoints:  mountPoints,
 				NoCleanup:  noCleanup,
+				Logger:     requestLog(req),
 			}
 
-			rawImage, err := compiler.CompileRawImage(compileParams)
-			if err != nil {
-				return nil, http.StatusInternalServerError, errors.New("failed to compile raw image", err)
+			// jobs and metrics carry the full key, e.g. qemu/dev, even when
+			// the request named the provider by type only
+			job := newBuildJob(name, compilerName, compiler, d.providers.KeyOf(provider), provider, compileParams, force, requestLog(req))
+			d.builds.submit(job)
+			if detach {
+				return job.snapshot(), http.StatusAccepted, nil
 			}
-			logrus.Debugf("raw image compiled and saved to " + rawImage.LocalImagePath)
 
-			if !noCleanup {
-				defer os.Remove(rawImage.LocalImagePath)
+			<-job.done
+			result := job.snapshot()
+			if result.State != types.BuildState_Succeeded {
+				return nil, http.StatusInternalServerError, errors.New("build "+result.Id+" "+string(result.State)+": "+result.Error, nil)
 			}
-
-			stageParams := types.StageImageParams{
-				Name:      name,
-				RawImage:  rawImage,
-				Force:     force,
-				NoCleanup: noCleanup,
+			return result.Image, http.StatusCreated, nil
+		})
+	})
+	d.server.Get("/builds", func(res http.ResponseWriter, req *http.Request) {
+		handle(res, req, func() (interface{}, int, error) {
+			return d.builds.list(), http.StatusOK, nil
+		})
+	})
+	d.server.Get("/builds/:build_id", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
+		handle(res, req, func() (interface{}, int, error) {
+			job, err := d.builds.get(params["build_id"])
+			if err != nil {
+				return nil, http.StatusNotFound, err
 			}
-
-			image, err := d.providers[providerName].Stage(stageParams)
+			return job.snapshot(), http.StatusOK, nil
+		})
+	})
+	d.server.Get("/builds/:build_id/logs", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
+		job, err := d.builds.get(params["build_id"])
+		if err != nil {
+			res.WriteHeader(http.StatusNotFound)
+			respond(res, err)
+			return
+		}
+		if strings.ToLower(req.URL.Query().Get("follow")) != "true" {
+			res.WriteHeader(http.StatusOK)
+			data, _ := job.log.from(0)
+			res.Write(data)
+			return
+		}
+		res.WriteHeader(http.StatusOK)
+		flusher, _ := res.(http.Flusher)
+		offset := 0
+		for {
+			finished := false
+			select {
+			case <-job.done:
+				finished = true
+			case <-time.After(200 * time.Millisecond):
+			}
+			var data []byte
+			if data, offset = job.log.from(offset); len(data) > 0 {
+				if _, err := res.Write(data); err != nil {
+					requestLog(req).WithError(err).Debugf("build log client went away")
+					return
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+			if finished {
+				return
+			}
+		}
+	})
+	d.server.Get("/drift", func(res http.ResponseWriter, req *http.Request) {
+		handle(res, req, func() (interface{}, int, error) {
+			if d.reconciler == nil {
+				return nil, http.StatusBadRequest, errors.New("reconciliation is disabled in the daemon config", nil)
+			}
+			if strings.ToLower(req.URL.Query().Get("refresh")) == "true" {
+				return d.reconciler.reconcile(), http.StatusOK, nil
+			}
+			return d.reconciler.lastReport(), http.StatusOK, nil
+		})
+	})
+	d.server.Get("/events", func(res http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		filter := newEventFilter(query.Get("kind"), query.Get("provider"))
+		for _, kind := range filter.kinds {
+			switch types.EventKind(kind) {
+			case types.EventKind_Image, types.EventKind_Instance, types.EventKind_Volume:
+			default:
+				res.WriteHeader(http.StatusBadRequest)
+				respond(res, errors.New("unknown event kind "+kind+". Available: image|instance|volume", nil))
+				return
+			}
+		}
+		sub := d.events.subscribe(filter)
+		defer d.events.unsubscribe(sub)
+		if err := streamEvents(res, req, sub); err != nil {
+			requestLog(req).WithError(err).Errorf("streaming events")
+		}
+	})
+	d.server.Delete("/builds/:build_id", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
+		handle(res, req, func() (interface{}, int, error) {
+			job, err := d.builds.get(params["build_id"])
 			if err != nil {
-				return nil, http.StatusInternalServerError, errors.New("failed staging image", err)
+				return nil, http.StatusNotFound, err
 			}
-			return image, http.StatusCreated, nil
+			if job.snapshot().Done() {
+				return nil, http.StatusConflict, errors.New("build "+params["build_id"]+" already finished", nil)
+			}
+			job.cancel()
+			<-job.done
+			return job.snapshot(), http.StatusOK, nil
 		})
 	})
 	d.server.Delete("/images/:image_name", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
-		handle(res, func() (interface{}, int, error) {
+		handle(res, req, func() (interface{}, int, error) {
 			imageName := params["image_name"]
 			if imageName == "" {
-				logrus.WithFields(logrus.Fields{
+				requestLog(req).WithFields(logrus.Fields{
 					"request": fmt.Sprintf("%v", req),
 				}).Errorf("image must be named")
 				return nil, http.StatusBadRequest, errors.New("image must be named", nil)
 			}
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"request": req,
 			}).Infof("deleting image " + imageName)
 			forceStr := req.URL.Query().Get("force")
@@ -639,20 +834,40 @@ func (d *KernelDaemon) initialize() {
 			}
 			provider, err := d.providers.ProviderForImage(imageName)
 			if err != nil {
-				return nil, http.StatusInternalServerError, err
+				return nil, http.StatusNotFound, &ErrorResponse{Message: err.Error()}
+			}
+			image, err := provider.GetImage(imageName)
+			if err != nil {
+				return nil, http.StatusNotFound, &ErrorResponse{Message: err.Error()}
 			}
-			err = provider.DeleteImage(imageName, force)
+			instances, err := provider.ListInstances()
+			providerError(provider, "list_instances", err)
 			if err != nil {
-				return nil, http.StatusInternalServerError, err
+				return nil, http.StatusInternalServerError, &ErrorResponse{Message: errors.New("listing instances", err).Error()}
+			}
+			var inUseBy []string
+			for _, instance := range instances {
+				if instance.ImageId == image.Id {
+					inUseBy = append(inUseBy, instance.Name)
+				}
+			}
+			if len(inUseBy) > 0 && !force {
+				return nil, http.StatusConflict, &ErrorResponse{
+					Message:   "image " + imageName + " is used by " + strconv.Itoa(len(inUseBy)) + " instance(s); try again with force=true",
+					Instances: inUseBy,
+				}
+			}
+			if err := providerError(provider, "delete_image", provider.DeleteImage(image.Id, force)); err != nil {
+				return nil, http.StatusInternalServerError, &ErrorResponse{Message: errors.New("deleting image "+imageName, err).Error()}
 			}
 			return nil, http.StatusNoContent, nil
 		})
 	})
 	d.server.Post("/images/push/:image_name", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
-		handle(res, func() (interface{}, int, error) {
+		handle(res, req, func() (interface{}, int, error) {
 			imageName := params["image_name"]
 			if imageName == "" {
-				logrus.WithFields(logrus.Fields{
+				requestLog(req).WithFields(logrus.Fields{
 					"request": fmt.Sprintf("%v", req),
 				}).Errorf("image must be named")
 				return nil, http.StatusBadRequest, errors.New("image must be named", nil)
@@ -665,17 +880,21 @@ func (d *KernelDaemon) initialize() {
 			if err := json.Unmarshal(body, &c); err != nil {
 				return nil, http.StatusBadRequest, errors.New("failed to parse request json", err)
 			}
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"request": req,
 			}).Infof("pushing image " + imageName + " to " + c.URL)
 			provider, err := d.providers.ProviderForImage(imageName)
 			if err != nil {
 				return nil, http.StatusInternalServerError, err
 			}
+			uploadStart := time.Now()
 			err = provider.PushImage(types.PushImagePararms{
 				ImageName: imageName,
 				Config:    c,
+				Logger:    requestLog(req),
 			})
+			d.metrics.uploadDuration.WithLabelValues(d.providers.KeyOf(provider), result(err)).Observe(time.Since(uploadStart).Seconds())
+			providerError(provider, "push_image", err)
 			if err != nil {
 				return nil, http.StatusInternalServerError, err
 			}
@@ -683,10 +902,10 @@ func (d *KernelDaemon) initialize() {
 		})
 	})
 	d.server.Post("/images/pull/:image_name", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
-		handle(res, func() (interface{}, int, error) {
+		handle(res, req, func() (interface{}, int, error) {
 			imageName := params["image_name"]
 			if imageName == "" {
-				logrus.WithFields(logrus.Fields{
+				requestLog(req).WithFields(logrus.Fields{
 					"request": fmt.Sprintf("%v", req),
 				}).Errorf("image must be named")
 				return nil, http.StatusBadRequest, errors.New("image must be named", nil)
@@ -699,13 +918,13 @@ func (d *KernelDaemon) initialize() {
 			if err := json.Unmarshal(body, &c); err != nil {
 				return nil, http.StatusBadRequest, errors.New("failed to parse request json", err)
 			}
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"request": req,
 			}).Infof("pushing image " + imageName + " to " + c.URL)
 			providerName := req.URL.Query().Get("provider")
-			provider, ok := d.providers[providerName]
-			if !ok {
-				return nil, http.StatusBadRequest, errors.New(providerName+" is not a known provider. Available: "+strings.Join(d.providers.Keys(), "|"), nil)
+			provider, err := d.providers.Lookup(providerName)
+			if err != nil {
+				return nil, http.StatusBadRequest, err
 			}
 			forceStr := req.URL.Query().Get("force")
 			force := false
@@ -716,7 +935,9 @@ func (d *KernelDaemon) initialize() {
 				ImageName: imageName,
 				Config:    c,
 				Force:     force,
+				Logger:    requestLog(req),
 			})
+			providerError(provider, "pull_image", err)
 			if err != nil {
 				return nil, http.StatusInternalServerError, err
 			}
@@ -724,10 +945,10 @@ func (d *KernelDaemon) initialize() {
 		})
 	})
 	d.server.Post("/images/remote-delete/:image_name", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
-		handle(res, func() (interface{}, int, error) {
+		handle(res, req, func() (interface{}, int, error) {
 			imageName := params["image_name"]
 			if imageName == "" {
-				logrus.WithFields(logrus.Fields{
+				requestLog(req).WithFields(logrus.Fields{
 					"request": fmt.Sprintf("%v", req),
 				}).Errorf("image must be named")
 				return nil, http.StatusBadRequest, errors.New("image must be named", nil)
@@ -740,7 +961,7 @@ func (d *KernelDaemon) initialize() {
 			if err := json.Unmarshal(body, &c); err != nil {
 				return nil, http.StatusBadRequest, errors.New("failed to parse request json", err)
 			}
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"request": req,
 			}).Infof("deleting image " + imageName + " to " + c.URL)
 			provider, err := d.providers.ProviderForImage(imageName)
@@ -750,7 +971,9 @@ func (d *KernelDaemon) initialize() {
 			err = provider.PushImage(types.PushImagePararms{
 				ImageName: imageName,
 				Config:    c,
+				Logger:    requestLog(req),
 			})
+			providerError(provider, "push_image", err)
 			if err != nil {
 				return nil, http.StatusInternalServerError, err
 			}
@@ -760,23 +983,24 @@ func (d *KernelDaemon) initialize() {
 
 	//Instances
 	d.server.Get("/instances", func(res http.ResponseWriter, req *http.Request) {
-		handle(res, func() (interface{}, int, error) {
+		handle(res, req, func() (interface{}, int, error) {
 			allInstances := []*types.Instance{}
 			for _, provider := range d.providers {
 				instances, err := provider.ListInstances()
+				providerError(provider, "list_instances", err)
 				if err != nil {
 					return nil, http.StatusInternalServerError, errors.New("could not get instance list", err)
 				}
 				allInstances = append(allInstances, instances...)
 			}
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"instances": allInstances,
 			}).Debugf("Listing all instances")
 			return allInstances, http.StatusOK, nil
 		})
 	})
 	d.server.Get("/instances/:instance_id", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
-		handle(res, func() (interface{}, int, error) {
+		handle(res, req, func() (interface{}, int, error) {
 			instanceId := params["instance_id"]
 			provider, err := d.providers.ProviderForInstance(instanceId)
 			if err != nil {
@@ -790,9 +1014,9 @@ func (d *KernelDaemon) initialize() {
 		})
 	})
 	d.server.Delete("/instances/:instance_id", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
-		handle(res, func() (interface{}, int, error) {
+		handle(res, req, func() (interface{}, int, error) {
 			instanceId := params["instance_id"]
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"request": req,
 			}).Infof("deleting instance " + instanceId)
 			provider, err := d.providers.ProviderForInstance(instanceId)
@@ -804,7 +1028,9 @@ func (d *KernelDaemon) initialize() {
 			if strings.ToLower(forceStr) == "true" {
 				force = true
 			}
+			d.supervisor.forget(provider, instanceId)
 			err = provider.DeleteInstance(instanceId, force)
+			providerError(provider, "delete_instance", err)
 			if err != nil {
 				return nil, http.StatusInternalServerError, err
 			}
@@ -812,7 +1038,7 @@ func (d *KernelDaemon) initialize() {
 		})
 	})
 	d.server.Get("/instances/:instance_id/logs", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
-		handle(res, func() (interface{}, int, error) {
+		handle(res, req, func() (interface{}, int, error) {
 			instanceId := params["instance_id"]
 			follow := req.URL.Query().Get("follow")
 			res.Write([]byte("getting logs for " + instanceId + "...\n"))
@@ -829,7 +1055,7 @@ func (d *KernelDaemon) initialize() {
 
 				deleteOnDisconnect := req.URL.Query().Get("delete")
 				if strings.ToLower(deleteOnDisconnect) == "true" {
-					logrus.Warnf("INSTANCE %v WILL BE TERMINTED ON CLIENT DISCONNECT!", instanceId)
+					requestLog(req).Warnf("INSTANCE %v WILL BE TERMINTED ON CLIENT DISCONNECT!", instanceId)
 					defer provider.DeleteInstance(instanceId, true)
 				}
 
@@ -838,7 +1064,7 @@ func (d *KernelDaemon) initialize() {
 					return provider.GetInstanceLogs(instanceId)
 				}
 				if err := streamOutput(logFn, output); err != nil {
-					logrus.WithError(err).WithFields(logrus.Fields{
+					requestLog(req).WithError(err).WithFields(logrus.Fields{
 						"instanceId": instanceId,
 					}).Warnf("streaming logs stopped")
 					return nil, http.StatusInternalServerError, err
@@ -846,14 +1072,50 @@ func (d *KernelDaemon) initialize() {
 				return nil, 0, nil
 			}
 			logs, err := provider.GetInstanceLogs(instanceId)
+			providerError(provider, "get_instance_logs", err)
 			if err != nil {
 				return nil, http.StatusInternalServerError, errors.New("failed to perform get logs request", err)
 			}
 			return logs, http.StatusOK, nil
 		})
 	})
+	d.server.Get("/instances/:instance_id/console", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
+		instanceId := params["instance_id"]
+		console, statusCode, err := func() (io.ReadWriteCloser, int, error) {
+			if !isConsoleUpgrade(req) {
+				return nil, http.StatusBadRequest, errors.New("attaching to a console requires the Upgrade: tcp header", nil)
+			}
+			provider, err := d.providers.ProviderForInstance(instanceId)
+			if err != nil {
+				return nil, http.StatusInternalServerError, err
+			}
+			attacher, ok := provider.(providers.ConsoleAttacher)
+			if !ok {
+				return nil, http.StatusBadRequest, errors.New("provider for instance "+instanceId+" does not support attaching to consoles", nil)
+			}
+			console, err := attacher.AttachConsole(instanceId)
+			providerError(provider, "attach_console", err)
+			if err != nil {
+				return nil, http.StatusInternalServerError, errors.New("could not attach to console of instance "+instanceId, err)
+			}
+			return console, http.StatusSwitchingProtocols, nil
+		}()
+		if err != nil {
+			handle(res, req, func() (interface{}, int, error) {
+				return nil, statusCode, err
+			})
+			return
+		}
+		defer console.Close()
+		requestLog(req).WithField("request", req).Infof("attached to console of instance " + instanceId)
+		if err := serveConsole(res, console); err != nil {
+			requestLog(req).WithError(err).Warnf("serving console of instance %s", instanceId)
+			return
+		}
+		requestLog(req).Infof("detached from console of instance " + instanceId)
+	})
 	d.server.Post("/instances/run", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
-		handle(res, func() (interface{}, int, error) {
+		handle(res, req, func() (interface{}, int, error) {
 			body, err := ioutil.ReadAll(req.Body)
 			if err != nil {
 				return nil, http.StatusBadRequest, errors.New("could not read request body", err)
@@ -864,18 +1126,37 @@ func (d *KernelDaemon) initialize() {
 				return nil, http.StatusBadRequest, errors.New("failed to parse request json", err)
 			}
 
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"request": runInstanceRequest,
 			}).Debugf("Received run request")
 
 			if runInstanceRequest.ImageName == "" {
 				return nil, http.StatusBadRequest, errors.New("image must be named", nil)
 			}
-
-			provider, err := d.providers.ProviderForImage(runInstanceRequest.ImageName)
-			if err != nil {
+			if err := runInstanceRequest.RestartPolicy.Validate(); err != nil {
 				return nil, http.StatusBadRequest, err
 			}
+			if runInstanceRequest.HealthCheck != nil {
+				if err := runInstanceRequest.HealthCheck.Validate(); err != nil {
+					return nil, http.StatusBadRequest, err
+				}
+			}
+
+			var provider providers.Provider
+			if runInstanceRequest.Provider != "" {
+				provider, err = d.providers.Lookup(runInstanceRequest.Provider)
+				if err != nil {
+					return nil, http.StatusBadRequest, err
+				}
+				if _, err := provider.GetImage(runInstanceRequest.ImageName); err != nil {
+					return nil, http.StatusBadRequest, errors.New("image "+runInstanceRequest.ImageName+" not found on "+runInstanceRequest.Provider, err)
+				}
+			} else {
+				provider, err = d.providers.ProviderForImage(runInstanceRequest.ImageName)
+				if err != nil {
+					return nil, http.StatusBadRequest, err
+				}
+			}
 
 			params := types.RunInstanceParams{
 				Name:                 runInstanceRequest.InstanceName,
@@ -885,26 +1166,37 @@ func (d *KernelDaemon) initialize() {
 				InstanceMemory:       runInstanceRequest.MemoryMb,
 				NoCleanup:            runInstanceRequest.NoCleanup,
 				DebugMode:            runInstanceRequest.DebugMode,
+				VcpuCount:            runInstanceRequest.VcpuCount,
+				CpuTemplate:          runInstanceRequest.CpuTemplate,
+				KernelArgs:           runInstanceRequest.KernelArgs,
+				KernelPath:           runInstanceRequest.KernelPath,
+				RestartPolicy:        runInstanceRequest.RestartPolicy,
+				HealthCheck:          runInstanceRequest.HealthCheck,
+				Logger:               requestLog(req),
 			}
 
 			instance, err := provider.RunInstance(params)
+			providerError(provider, "run_instance", err)
 			if err != nil {
 				return nil, http.StatusInternalServerError, err
 			}
+			d.supervisor.watch(provider, instance, params)
 			return instance, http.StatusCreated, nil
 		})
 	})
 	d.server.Post("/instances/:instance_id/start", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
-		handle(res, func() (interface{}, int, error) {
+		handle(res, req, func() (interface{}, int, error) {
 			instanceId := params["instance_id"]
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"request": req,
 			}).Infof("starting instance " + instanceId)
 			provider, err := d.providers.ProviderForInstance(instanceId)
 			if err != nil {
 				return nil, http.StatusInternalServerError, err
 			}
+			d.supervisor.setStopped(provider, instanceId, false)
 			err = provider.StartInstance(instanceId)
+			providerError(provider, "start_instance", err)
 			if err != nil {
 				return nil, http.StatusInternalServerError, errors.New("could not start instance "+instanceId, err)
 			}
@@ -912,43 +1204,206 @@ func (d *KernelDaemon) initialize() {
 		})
 	})
 	d.server.Post("/instances/:instance_id/stop", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
-		handle(res, func() (interface{}, int, error) {
+		handle(res, req, func() (interface{}, int, error) {
 			instanceId := params["instance_id"]
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"request": req,
 			}).Infof("stopping instance " + instanceId)
 			provider, err := d.providers.ProviderForInstance(instanceId)
 			if err != nil {
 				return nil, http.StatusInternalServerError, err
 			}
+			d.supervisor.setStopped(provider, instanceId, true)
 			err = provider.StopInstance(instanceId)
+			providerError(provider, "stop_instance", err)
 			if err != nil {
 				return nil, http.StatusInternalServerError, errors.New("could not stop instance "+instanceId, err)
 			}
 			return nil, http.StatusOK, nil
 		})
 	})
+	d.server.Get("/instances/:instance_id/metrics", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
+		handle(res, req, func() (interface{}, int, error) {
+			instanceId := params["instance_id"]
+			provider, err := d.providers.ProviderForInstance(instanceId)
+			if err != nil {
+				return nil, http.StatusInternalServerError, err
+			}
+			metricsGetter, ok := provider.(providers.InstanceMetricsGetter)
+			if !ok {
+				return nil, http.StatusBadRequest, errors.New("provider for instance "+instanceId+" does not support instance metrics", nil)
+			}
+			metrics, err := metricsGetter.GetInstanceMetrics(instanceId)
+			providerError(provider, "get_instance_metrics", err)
+			if err != nil {
+				return nil, http.StatusInternalServerError, errors.New("could not get metrics for instance "+instanceId, err)
+			}
+			return metrics, http.StatusOK, nil
+		})
+	})
+	d.server.Post("/instances/:instance_id/pause", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
+		handle(res, req, func() (interface{}, int, error) {
+			instanceId := params["instance_id"]
+			requestLog(req).WithFields(logrus.Fields{
+				"request": req,
+			}).Infof("pausing instance " + instanceId)
+			provider, err := d.providers.ProviderForInstance(instanceId)
+			if err != nil {
+				return nil, http.StatusInternalServerError, err
+			}
+			pauser, ok := provider.(providers.InstancePauser)
+			if !ok {
+				return nil, http.StatusBadRequest, errors.New("provider for instance "+instanceId+" does not support pausing instances", nil)
+			}
+			err = pauser.PauseInstance(instanceId)
+			providerError(provider, "pause_instance", err)
+			if err != nil {
+				return nil, http.StatusInternalServerError, errors.New("could not pause instance "+instanceId, err)
+			}
+			return nil, http.StatusOK, nil
+		})
+	})
+	d.server.Post("/instances/:instance_id/resume", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
+		handle(res, req, func() (interface{}, int, error) {
+			instanceId := params["instance_id"]
+			requestLog(req).WithFields(logrus.Fields{
+				"request": req,
+			}).Infof("resuming instance " + instanceId)
+			provider, err := d.providers.ProviderForInstance(instanceId)
+			if err != nil {
+				return nil, http.StatusInternalServerError, err
+			}
+			pauser, ok := provider.(providers.InstancePauser)
+			if !ok {
+				return nil, http.StatusBadRequest, errors.New("provider for instance "+instanceId+" does not support pausing instances", nil)
+			}
+			err = pauser.ResumeInstance(instanceId)
+			providerError(provider, "resume_instance", err)
+			if err != nil {
+				return nil, http.StatusInternalServerError, errors.New("could not resume instance "+instanceId, err)
+			}
+			return nil, http.StatusOK, nil
+		})
+	})
+
+	d.server.Post("/instances/:instance_id/snapshot", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
+		handle(res, req, func() (interface{}, int, error) {
+			instanceId := params["instance_id"]
+			name := req.URL.Query().Get("name")
+			if name != "" && !common.ValidName(name) {
+				return nil, http.StatusBadRequest, errors.New("invalid snapshot name "+name, nil)
+			}
+			stop := strings.ToLower(req.URL.Query().Get("stop")) == "true"
+			requestLog(req).WithFields(logrus.Fields{
+				"request": req, "name": name, "stop": stop,
+			}).Infof("snapshotting instance " + instanceId)
+			provider, err := d.providers.ProviderForInstance(instanceId)
+			if err != nil {
+				return nil, http.StatusInternalServerError, err
+			}
+			snapshotter, ok := provider.(providers.InstanceSnapshotter)
+			if !ok {
+				return nil, http.StatusBadRequest, errors.New("provider for instance "+instanceId+" does not support snapshots", nil)
+			}
+			snapshot, err := snapshotter.SnapshotInstance(types.SnapshotInstanceParams{
+				InstanceId: instanceId,
+				Name:       name,
+				Stop:       stop,
+				Logger:     requestLog(req),
+			})
+			providerError(provider, "snapshot_instance", err)
+			if err != nil {
+				return nil, http.StatusInternalServerError, errors.New("could not snapshot instance "+instanceId, err)
+			}
+			return snapshot, http.StatusCreated, nil
+		})
+	})
+
+	//Snapshots
+	d.server.Get("/snapshots", func(res http.ResponseWriter, req *http.Request) {
+		handle(res, req, func() (interface{}, int, error) {
+			allSnapshots := []*types.Snapshot{}
+			for _, provider := range d.providers {
+				snapshotter, ok := provider.(providers.InstanceSnapshotter)
+				if !ok {
+					continue
+				}
+				snapshots, err := snapshotter.ListSnapshots()
+				providerError(provider, "list_snapshots", err)
+				if err != nil {
+					return nil, http.StatusInternalServerError, errors.New("could not retrieve snapshots", err)
+				}
+				allSnapshots = append(allSnapshots, snapshots...)
+			}
+			return allSnapshots, http.StatusOK, nil
+		})
+	})
+	d.server.Post("/snapshots/:snapshot_id/restore", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
+		handle(res, req, func() (interface{}, int, error) {
+			snapshotId := params["snapshot_id"]
+			name := req.URL.Query().Get("name")
+			if name != "" && !common.ValidName(name) {
+				return nil, http.StatusBadRequest, errors.New("invalid instance name "+name, nil)
+			}
+			requestLog(req).WithFields(logrus.Fields{
+				"request": req, "name": name,
+			}).Infof("restoring snapshot " + snapshotId)
+			provider, err := d.providers.ProviderForSnapshot(snapshotId)
+			if err != nil {
+				return nil, http.StatusNotFound, err
+			}
+			snapshotter := provider.(providers.InstanceSnapshotter)
+			instance, err := snapshotter.RestoreSnapshot(types.RestoreSnapshotParams{
+				SnapshotId:   snapshotId,
+				InstanceName: name,
+				Logger:       requestLog(req),
+			})
+			providerError(provider, "restore_snapshot", err)
+			if err != nil {
+				return nil, http.StatusInternalServerError, errors.New("could not restore snapshot "+snapshotId, err)
+			}
+			return instance, http.StatusCreated, nil
+		})
+	})
+	d.server.Delete("/snapshots/:snapshot_id", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
+		handle(res, req, func() (interface{}, int, error) {
+			snapshotId := params["snapshot_id"]
+			provider, err := d.providers.ProviderForSnapshot(snapshotId)
+			if err != nil {
+				return nil, http.StatusNotFound, err
+			}
+			snapshotter := provider.(providers.InstanceSnapshotter)
+			err = snapshotter.DeleteSnapshot(snapshotId)
+			providerError(provider, "delete_snapshot", err)
+			if err != nil {
+				return nil, http.StatusInternalServerError, errors.New("could not delete snapshot "+snapshotId, err)
+			}
+			requestLog(req).WithField("snapshot", snapshotId).Infof("snapshot deleted")
+			return nil, http.StatusNoContent, nil
+		})
+	})
 
 	//Volumes
 	d.server.Get("/volumes", func(res http.ResponseWriter, req *http.Request) {
-		handle(res, func() (interface{}, int, error) {
-			logrus.Debugf("listing volumes started")
+		handle(res, req, func() (interface{}, int, error) {
+			requestLog(req).Debugf("listing volumes started")
 			allVolumes := []*types.Volume{}
 			for _, provider := range d.providers {
 				volumes, err := provider.ListVolumes()
+				providerError(provider, "list_volumes", err)
 				if err != nil {
 					return nil, http.StatusInternalServerError, errors.New("could not retrieve volumes", err)
 				}
 				allVolumes = append(allVolumes, volumes...)
 			}
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"volumes": allVolumes,
 			}).Infof("volumes")
 			return allVolumes, http.StatusOK, nil
 		})
 	})
 	d.server.Get("/volumes/:volume_name", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
-		handle(res, func() (interface{}, int, error) {
+		handle(res, req, func() (interface{}, int, error) {
 			volumeName := params["volume_name"]
 			provider, err := d.providers.ProviderForVolume(volumeName)
 			if err != nil {
@@ -958,21 +1413,21 @@ func (d *KernelDaemon) initialize() {
 			if err != nil {
 				return nil, http.StatusInternalServerError, errors.New("could not get volume", err)
 			}
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"volume": volume,
 			}).Infof("volume retrieved")
 			return volume, http.StatusOK, nil
 		})
 	})
 	d.server.Post("/volumes/:volume_name", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
-		handle(res, func() (interface{}, int, error) {
+		handle(res, req, func() (interface{}, int, error) {
 			volumeName := params["volume_name"]
 			var imagePath string
 			var provider providers.Provider
 			var noCleanup bool
 			var raw bool
 
-			logrus.WithField("req", req).Info("received request to create volume")
+			requestLog(req).WithField("req", req).Info("received request to create volume")
 
 			typeStr := req.FormValue("type")
 			typeStr = strings.ToLower(typeStr)
@@ -986,20 +1441,20 @@ func (d *KernelDaemon) initialize() {
 					noCleanup = true
 				}
 
-				logrus.Info("received request with form-data")
+				requestLog(req).Info("received request with form-data")
 				err := req.ParseMultipartForm(0)
 				if err != nil {
 					return nil, http.StatusInternalServerError, err
 				}
-				logrus.WithFields(logrus.Fields{
+				requestLog(req).WithFields(logrus.Fields{
 					"req": req,
 				}).Debugf("parsing multipart form")
 
 				providerName := req.FormValue("provider")
-				if _, ok := d.providers[providerName]; !ok {
-					return nil, http.StatusBadRequest, errors.New(providerName+" is not a known provider. Available: "+strings.Join(d.providers.Keys(), "|"), nil)
+				provider, err = d.providers.Lookup(providerName)
+				if err != nil {
+					return nil, http.StatusBadRequest, err
 				}
-				provider = d.providers[providerName]
 				dataTar, header, err := req.FormFile("tarfile")
 				if err != nil {
 					return nil, http.StatusInternalServerError, errors.New("failed to retrieve form-data for tarfe", err)
@@ -1007,10 +1462,10 @@ func (d *KernelDaemon) initialize() {
 				defer dataTar.Close()
 
 				if !raw {
-					logrus.WithFields(logrus.Fields{
+					requestLog(req).WithFields(logrus.Fields{
 						"form": req.Form,
 					}).Debugf("seeking form file marked 'tarfile'")
-					logrus.WithFields(logrus.Fields{
+					requestLog(req).WithFields(logrus.Fields{
 						"tarred-data": header.Filename,
 						"name":        volumeName,
 						"provider":    providerName,
@@ -1024,7 +1479,7 @@ func (d *KernelDaemon) initialize() {
 					if err != nil {
 						return nil, http.StatusBadRequest, errors.New("could not parse given size", err)
 					}
-					imagePath, err = util.BuildRawDataImageWithType(dataTar, kos.MegaBytes(size), typeStr, provider.GetConfig().UsePartitionTables)
+					imagePath, err = util.BuildRawDataImageWithType(dataTar, kos.MegaBytes(size), typeStr, provider.GetConfig().UsePartitionTables, nil)
 					if err != nil {
 						return nil, http.StatusInternalServerError, errors.New("creating raw volume image", err)
 					}
@@ -1052,26 +1507,26 @@ func (d *KernelDaemon) initialize() {
 				if raw == true {
 					return nil, http.StatusBadRequest, errors.New("Raw volume was requested but no data provided", nil)
 				}
-				logrus.Info("received request for empty volume")
+				requestLog(req).Info("received request for empty volume")
 				sizeStr := req.URL.Query().Get("size")
 				size, err := strconv.Atoi(sizeStr)
 				if err != nil {
 					return nil, http.StatusBadRequest, errors.New("could not parse given size", err)
 				}
-				logrus.WithFields(logrus.Fields{
+				requestLog(req).WithFields(logrus.Fields{
 					"size": size,
 					"name": volumeName,
 				}).Debugf("creating empty volume started")
-				imagePath, err = util.BuildEmptyDataVolumeWithType(kos.MegaBytes(size), typeStr)
+				imagePath, err = util.BuildEmptyDataVolumeWithType(kos.MegaBytes(size), typeStr, nil)
 				if err != nil {
 					return nil, http.StatusInternalServerError, errors.New("failed building raw image", err)
 				}
 				providerName := req.URL.Query().Get("provider")
-				if _, ok := d.providers[providerName]; !ok {
-					return nil, http.StatusBadRequest, errors.New(providerName+" is not a known provider. Available: "+strings.Join(d.providers.Keys(), "|"), nil)
+				provider, err = d.providers.Lookup(providerName)
+				if err != nil {
+					return nil, http.StatusBadRequest, err
 				}
-				provider = d.providers[providerName]
-				logrus.WithFields(logrus.Fields{
+				requestLog(req).WithFields(logrus.Fields{
 					"image": imagePath,
 				}).Infof("raw image created")
 
@@ -1085,20 +1540,22 @@ func (d *KernelDaemon) initialize() {
 				Name:      volumeName,
 				ImagePath: imagePath,
 				NoCleanup: noCleanup,
+				Logger:    requestLog(req),
 			}
 
 			volume, err := provider.CreateVolume(params)
+			providerError(provider, "create_volume", err)
 			if err != nil {
 				return nil, http.StatusInternalServerError, errors.New("could not create volume", err)
 			}
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"volume": volume,
 			}).Infof("volume created")
 			return volume, http.StatusCreated, nil
 		})
 	})
 	d.server.Delete("/volumes/:volume_name", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
-		handle(res, func() (interface{}, int, error) {
+		handle(res, req, func() (interface{}, int, error) {
 			volumeName := params["volume_name"]
 			provider, err := d.providers.ProviderForVolume(volumeName)
 			if err != nil {
@@ -1110,21 +1567,22 @@ func (d *KernelDaemon) initialize() {
 				force = true
 			}
 
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"force": force, "name": volumeName,
 			}).Debugf("deleting volume started")
 			err = provider.DeleteVolume(volumeName, force)
+			providerError(provider, "delete_volume", err)
 			if err != nil {
 				return nil, http.StatusInternalServerError, errors.New("could not delete volume", err)
 			}
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"volume": volumeName,
 			}).Infof("volume deleted")
 			return nil, http.StatusNoContent, nil
 		})
 	})
 	d.server.Post("/volumes/:volume_name/attach/:instance_id", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
-		handle(res, func() (interface{}, int, error) {
+		handle(res, req, func() (interface{}, int, error) {
 			volumeName := params["volume_name"]
 			provider, err := d.providers.ProviderForVolume(volumeName)
 			if err != nil {
@@ -1135,16 +1593,17 @@ func (d *KernelDaemon) initialize() {
 			if mount == "" {
 				return nil, http.StatusBadRequest, errors.New("must provide a mount point in URL query", nil)
 			}
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"instance": instanceId,
 				"volume":   volumeName,
 				"mount":    mount,
 			}).Debugf("attaching volume to instance")
 			err = provider.AttachVolume(volumeName, instanceId, mount)
+			providerError(provider, "attach_volume", err)
 			if err != nil {
 				return nil, http.StatusInternalServerError, errors.New("could not attach volume to instance", err)
 			}
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"instance": instanceId,
 				"volume":   volumeName,
 				"mount":    mount,
@@ -1153,20 +1612,21 @@ func (d *KernelDaemon) initialize() {
 		})
 	})
 	d.server.Post("/volumes/:volume_name/detach", func(res http.ResponseWriter, req *http.Request, params martini.Params) {
-		handle(res, func() (interface{}, int, error) {
+		handle(res, req, func() (interface{}, int, error) {
 			volumeName := params["volume_name"]
 			provider, err := d.providers.ProviderForVolume(volumeName)
 			if err != nil {
 				return nil, http.StatusInternalServerError, err
 			}
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"volume": volumeName,
 			}).Debugf("detaching volume from any instance")
 			err = provider.DetachVolume(volumeName)
+			providerError(provider, "detach_volume", err)
 			if err != nil {
 				return nil, http.StatusInternalServerError, errors.New("could not detach volume from instance", err)
 			}
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"volume": volumeName,
 			}).Infof("volume detached")
 			return volumeName, http.StatusAccepted, nil
@@ -1175,43 +1635,43 @@ func (d *KernelDaemon) initialize() {
 
 	//info
 	d.server.Get("/available_compilers", func(res http.ResponseWriter, req *http.Request) {
-		handle(res, func() (interface{}, int, error) {
-			logrus.Debugf("listing available compilers")
+		handle(res, req, func() (interface{}, int, error) {
+			requestLog(req).Debugf("listing available compilers")
 			availableCompilers := sort.StringSlice{}
 			for compilerName := range d.compilers {
 				availableCompilers = append(availableCompilers, compilerName.String())
 			}
 			availableCompilers.Sort()
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"compilers": availableCompilers,
 			}).Infof("compilers")
 			return []string(availableCompilers), http.StatusOK, nil
 		})
 	})
 	d.server.Get("/available_providers", func(res http.ResponseWriter, req *http.Request) {
-		handle(res, func() (interface{}, int, error) {
-			logrus.Debugf("listing available providers")
+		handle(res, req, func() (interface{}, int, error) {
+			requestLog(req).Debugf("listing available providers")
 			availableProviders := sort.StringSlice{}
 			for compilerName := range d.providers {
 				availableProviders = append(availableProviders, compilerName)
 			}
 			availableProviders.Sort()
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"providers": availableProviders,
 			}).Infof("providers")
 			return []string(availableProviders), http.StatusOK, nil
 		})
 	})
 	d.server.Get("/describe_compiler", func(res http.ResponseWriter, req *http.Request) {
-		handle(res, func() (interface{}, int, error) {
-			logrus.Debugf("describing compiler")
+		handle(res, req, func() (interface{}, int, error) {
+			requestLog(req).Debugf("describing compiler")
 
 			// Find compiler.
 			provider := req.FormValue("provider")
-			if _, ok := d.providers[provider]; !ok {
-				return nil, http.StatusBadRequest, errors.New(provider+" is not a known provider. Available: "+
-					strings.Join(d.providers.Keys(), "|"), nil)
+			if _, err := d.providers.Lookup(provider); err != nil {
+				return nil, http.StatusBadRequest, err
 			}
+			provider = providers.ProviderType(provider)
 			base := req.FormValue("base")
 			if base == "" {
 				return nil, http.StatusBadRequest, errors.New("must provide 'base' parameter", nil)
@@ -1229,7 +1689,7 @@ func (d *KernelDaemon) initialize() {
 				return nil, http.StatusBadRequest, errors.New("failed to access compiler", nil)
 			}
 
-			logrus.WithFields(logrus.Fields{
+			requestLog(req).WithFields(logrus.Fields{
 				"compiler": compiler,
 			}).Infof("describe compiler")
 
@@ -1296,6 +1756,8 @@ func streamOutput(outputFunc func() (string, error), w io.Writer) (err error) {
 
 func respond(res http.ResponseWriter, message interface{}) error {
 	switch message.(type) {
+	case *ErrorResponse:
+		// structured errors are sent as json like any other object
 	case string:
 		messageString := message.(string)
 		data := []byte(messageString)
@@ -0,0 +1,382 @@
+package daemon
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhojpur/kernel/pkg/providers"
+	"github.com/bhojpur/kernel/pkg/state"
+	"github.com/bhojpur/kernel/pkg/types"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// events buffered per subscriber before newer ones are dropped
+const eventBufferSize = 256
+
+// eventFilter selects events by kind and provider; empty fields match all.
+// Providers match either the full account key or the provider type.
+type eventFilter struct {
+	kinds     []string
+	providers []string
+}
+
+func newEventFilter(kinds, providerNames string) eventFilter {
+	return eventFilter{kinds: splitList(kinds), providers: splitList(providerNames)}
+}
+
+func (f eventFilter) matches(event types.Event) bool {
+	if len(f.kinds) > 0 && !contains(f.kinds, string(event.Kind)) {
+		return false
+	}
+	if len(f.providers) > 0 && !contains(f.providers, event.Provider) && !contains(f.providers, providers.ProviderType(event.Provider)) {
+		return false
+	}
+	return true
+}
+
+type subscription struct {
+	filter  eventFilter
+	events  chan types.Event
+	dropped int
+}
+
+type eventBus struct {
+	subscribers map[*subscription]bool
+	lock        sync.Mutex
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subscribers: map[*subscription]bool{}}
+}
+
+func (b *eventBus) subscribe(filter eventFilter) *subscription {
+	sub := &subscription{filter: filter, events: make(chan types.Event, eventBufferSize)}
+	b.lock.Lock()
+	b.subscribers[sub] = true
+	b.lock.Unlock()
+	return sub
+}
+
+func (b *eventBus) unsubscribe(sub *subscription) {
+	b.lock.Lock()
+	delete(b.subscribers, sub)
+	b.lock.Unlock()
+}
+
+// publish never blocks; subscribers that fall behind lose events.
+func (b *eventBus) publish(events ...types.Event) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, event := range events {
+		logrus.WithFields(logrus.Fields{
+			"kind":     event.Kind,
+			"action":   event.Action,
+			"provider": event.Provider,
+			"id":       event.Id,
+		}).Debugf("event")
+		for sub := range b.subscribers {
+			if !sub.filter.matches(event) {
+				continue
+			}
+			select {
+			case sub.events <- event:
+			default:
+				sub.dropped++
+				if sub.dropped == 1 {
+					logrus.Warnf("event subscriber is not keeping up, dropping events")
+				}
+			}
+		}
+	}
+}
+
+// observe wraps the state of the account registered under provider so
+// that every change to it is published.
+func (b *eventBus) observe(provider string, s state.State) state.State {
+	return &observedState{State: s, provider: provider, bus: b}
+}
+
+type observedState struct {
+	state.State
+	provider string
+	bus      *eventBus
+}
+
+func (s *observedState) ModifyImages(modify func(images map[string]*types.Image) error) error {
+	var events []types.Event
+	if err := s.State.ModifyImages(func(images map[string]*types.Image) error {
+		before := copyImages(images)
+		if err := modify(images); err != nil {
+			return err
+		}
+		events = s.diffImages(before, images)
+		return nil
+	}); err != nil {
+		return err
+	}
+	s.bus.publish(events...)
+	return nil
+}
+
+func (s *observedState) ModifyInstances(modify func(instances map[string]*types.Instance) error) error {
+	var events []types.Event
+	if err := s.State.ModifyInstances(func(instances map[string]*types.Instance) error {
+		before := copyInstances(instances)
+		if err := modify(instances); err != nil {
+			return err
+		}
+		events = s.diffInstances(before, instances)
+		return nil
+	}); err != nil {
+		return err
+	}
+	s.bus.publish(events...)
+	return nil
+}
+
+func (s *observedState) ModifyVolumes(modify func(volumes map[string]*types.Volume) error) error {
+	var events []types.Event
+	if err := s.State.ModifyVolumes(func(volumes map[string]*types.Volume) error {
+		before := copyVolumes(volumes)
+		if err := modify(volumes); err != nil {
+			return err
+		}
+		events = s.diffVolumes(before, volumes)
+		return nil
+	}); err != nil {
+		return err
+	}
+	s.bus.publish(events...)
+	return nil
+}
+
+// The wrapped state removes through its own Modify* methods, bypassing
+// ours, so removals compare the state before and after.
+
+func (s *observedState) RemoveImage(image *types.Image) error {
+	before := s.State.GetImages()
+	if err := s.State.RemoveImage(image); err != nil {
+		return err
+	}
+	s.bus.publish(s.diffImages(before, s.State.GetImages())...)
+	return nil
+}
+
+func (s *observedState) RemoveInstance(instance *types.Instance) error {
+	instancesBefore := s.State.GetInstances()
+	volumesBefore := s.State.GetVolumes()
+	if err := s.State.RemoveInstance(instance); err != nil {
+		return err
+	}
+	s.bus.publish(s.diffInstances(instancesBefore, s.State.GetInstances())...)
+	s.bus.publish(s.diffVolumes(volumesBefore, s.State.GetVolumes())...)
+	return nil
+}
+
+func (s *observedState) RemoveVolume(volume *types.Volume) error {
+	before := s.State.GetVolumes()
+	if err := s.State.RemoveVolume(volume); err != nil {
+		return err
+	}
+	s.bus.publish(s.diffVolumes(before, s.State.GetVolumes())...)
+	return nil
+}
+
+func (s *observedState) event(kind types.EventKind, action types.EventAction, id, name string) types.Event {
+	return types.Event{
+		Time:     time.Now(),
+		Kind:     kind,
+		Action:   action,
+		Provider: s.provider,
+		Id:       id,
+		Name:     name,
+	}
+}
+
+func (s *observedState) diffImages(before, after map[string]*types.Image) []types.Event {
+	var events []types.Event
+	for id, image := range after {
+		old, existed := before[id]
+		if existed && reflect.DeepEqual(*old, *image) {
+			continue
+		}
+		action := types.EventAction_Created
+		if existed {
+			action = types.EventAction_Updated
+		}
+		imageCopy := *image
+		event := s.event(types.EventKind_Image, action, id, image.Name)
+		event.Image = &imageCopy
+		events = append(events, event)
+	}
+	for id, image := range before {
+		if _, ok := after[id]; !ok {
+			event := s.event(types.EventKind_Image, types.EventAction_Removed, id, image.Name)
+			event.Image = image
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func (s *observedState) diffInstances(before, after map[string]*types.Instance) []types.Event {
+	var events []types.Event
+	for id, instance := range after {
+		old, existed := before[id]
+		if existed && reflect.DeepEqual(*old, *instance) {
+			continue
+		}
+		action := types.EventAction_Created
+		if existed {
+			action = types.EventAction_Updated
+		}
+		instanceCopy := *instance
+		event := s.event(types.EventKind_Instance, action, id, instance.Name)
+		event.Instance = &instanceCopy
+		events = append(events, event)
+	}
+	for id, instance := range before {
+		if _, ok := after[id]; !ok {
+			event := s.event(types.EventKind_Instance, types.EventAction_Removed, id, instance.Name)
+			event.Instance = instance
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func (s *observedState) diffVolumes(before, after map[string]*types.Volume) []types.Event {
+	var events []types.Event
+	for id, volume := range after {
+		old, existed := before[id]
+		if existed && reflect.DeepEqual(*old, *volume) {
+			continue
+		}
+		action := types.EventAction_Created
+		if existed {
+			action = types.EventAction_Updated
+		}
+		volumeCopy := *volume
+		event := s.event(types.EventKind_Volume, action, id, volume.Name)
+		event.Volume = &volumeCopy
+		events = append(events, event)
+	}
+	for id, volume := range before {
+		if _, ok := after[id]; !ok {
+			event := s.event(types.EventKind_Volume, types.EventAction_Removed, id, volume.Name)
+			event.Volume = volume
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func copyImages(images map[string]*types.Image) map[string]*types.Image {
+	imagesCopy := make(map[string]*types.Image, len(images))
+	for id, image := range images {
+		imageCopy := *image
+		imagesCopy[id] = &imageCopy
+	}
+	return imagesCopy
+}
+
+func copyInstances(instances map[string]*types.Instance) map[string]*types.Instance {
+	instancesCopy := make(map[string]*types.Instance, len(instances))
+	for id, instance := range instances {
+		instanceCopy := *instance
+		instancesCopy[id] = &instanceCopy
+	}
+	return instancesCopy
+}
+
+func copyVolumes(volumes map[string]*types.Volume) map[string]*types.Volume {
+	volumesCopy := make(map[string]*types.Volume, len(volumes))
+	for id, volume := range volumes {
+		volumeCopy := *volume
+		volumesCopy[id] = &volumeCopy
+	}
+	return volumesCopy
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func contains(list []string, item string) bool {
+	for _, candidate := range list {
+		if candidate == item {
+			return true
+		}
+	}
+	return false
+}
+
+// streamEvents writes events to w as server-sent events until the client
+// disconnects. A comment line is sent periodically so idle connections
+// are not closed by proxies.
+func streamEvents(w http.ResponseWriter, req *http.Request, sub *subscription) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.New("w is not a flusher", nil)
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return nil
+		case <-keepalive.C:
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return nil
+			}
+		case event := <-sub.events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				return errors.New("marshalling event to json", err)
+			}
+			if _, err := fmt.Fprintf(w, "event: %s.%s\ndata: %s\n\n", event.Kind, event.Action, data); err != nil {
+				return nil
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,158 @@
+package daemon
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/bhojpur/kernel/pkg/state"
+	"github.com/bhojpur/kernel/pkg/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "bhojpur_kernel"
+
+// instanceStates are reported for every provider, with a count of zero
+// when no instance is in them, so series do not come and go
+var instanceStates = []types.InstanceState{
+	types.InstanceState_Running,
+	types.InstanceState_Stopped,
+	types.InstanceState_Pending,
+	types.InstanceState_Unknown,
+	types.InstanceState_Terminated,
+	types.InstanceState_Error,
+	types.InstanceState_Paused,
+	types.InstanceState_Suspended,
+}
+
+// daemonMetrics are served from /metrics.
+type daemonMetrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	compileDuration *prometheus.HistogramVec
+	stageDuration   *prometheus.HistogramVec
+	uploadDuration  *prometheus.HistogramVec
+	providerErrors  *prometheus.CounterVec
+}
+
+func newDaemonMetrics(states map[string]state.State) *daemonMetrics {
+	// builds take from seconds to the better part of an hour
+	buildBuckets := prometheus.ExponentialBuckets(1, 2, 12)
+	m := &daemonMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "Requests handled by the daemon api, by route and status code.",
+		}, []string{"method", "route", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to handle daemon api requests, by route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		compileDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "compile_duration_seconds",
+			Help:      "Time taken to compile raw images, by compiler and result.",
+			Buckets:   buildBuckets,
+		}, []string{"compiler", "result"}),
+		stageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "stage_duration_seconds",
+			Help:      "Time taken to stage compiled images on a provider, by result.",
+			Buckets:   buildBuckets,
+		}, []string{"provider", "result"}),
+		uploadDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "upload_duration_seconds",
+			Help:      "Time taken to push images from a provider to the hub, by result.",
+			Buckets:   buildBuckets,
+		}, []string{"provider", "result"}),
+		providerErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "provider_errors_total",
+			Help:      "Failed provider operations.",
+		}, []string{"provider", "operation"}),
+	}
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.compileDuration,
+		m.stageDuration,
+		m.uploadDuration,
+		m.providerErrors,
+		&instanceCollector{
+			states: states,
+			desc: prometheus.NewDesc(metricsNamespace+"_instances", "Instances in provider state, by state.",
+				[]string{"provider", "state"}, nil),
+		},
+	)
+	return m
+}
+
+func (m *daemonMetrics) observeRequest(method, route string, code int, elapsed time.Duration) {
+	m.requests.WithLabelValues(method, route, strconv.Itoa(code)).Inc()
+	m.requestDuration.WithLabelValues(method, route).Observe(elapsed.Seconds())
+}
+
+// providerError counts err against the provider if it is not nil, and
+// returns it.
+func (m *daemonMetrics) providerError(provider, operation string, err error) error {
+	if err != nil {
+		m.providerErrors.WithLabelValues(provider, operation).Inc()
+	}
+	return err
+}
+
+func result(err error) string {
+	if err != nil {
+		return "failed"
+	}
+	return "succeeded"
+}
+
+// instanceCollector counts instances when scraped rather than tracking
+// every state change.
+type instanceCollector struct {
+	states map[string]state.State
+	desc   *prometheus.Desc
+}
+
+func (c *instanceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *instanceCollector) Collect(ch chan<- prometheus.Metric) {
+	for key, s := range c.states {
+		counts := map[types.InstanceState]int{}
+		for _, instance := range s.GetInstances() {
+			counts[instance.State]++
+		}
+		for _, instanceState := range instanceStates {
+			ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(counts[instanceState]), key, string(instanceState))
+		}
+	}
+}
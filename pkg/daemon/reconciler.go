@@ -0,0 +1,274 @@
+package daemon
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bhojpur/kernel/pkg/config"
+	"github.com/bhojpur/kernel/pkg/providers"
+	"github.com/bhojpur/kernel/pkg/state"
+	"github.com/bhojpur/kernel/pkg/types"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultReconcileInterval = 30 * time.Second
+	// instances younger than this may still be starting up, and are left
+	// alone so the reconciler does not race RunInstance
+	reconcileGracePeriod = time.Minute
+)
+
+// reconciler periodically compares each provider's state with what the
+// provider observes on its infrastructure. It fixes instance states, adopts
+// running VMs missing from the state and reports everything else as drift.
+type reconciler struct {
+	providers providers.Providers
+	states    map[string]state.State
+	interval  time.Duration
+
+	passLock   sync.Mutex
+	report     types.DriftReport
+	reportLock sync.RWMutex
+}
+
+func newReconciler(c config.Reconcile, _providers providers.Providers, states map[string]state.State) *reconciler {
+	interval := c.Interval
+	if interval <= 0 {
+		interval = defaultReconcileInterval
+	}
+	return &reconciler{
+		providers: _providers,
+		states:    states,
+		interval:  interval,
+	}
+}
+
+func (r *reconciler) loop() {
+	logrus.Infof("reconciling provider state every %v", r.interval)
+	for {
+		r.reconcile()
+		time.Sleep(r.interval)
+	}
+}
+
+func (r *reconciler) lastReport() types.DriftReport {
+	r.reportLock.RLock()
+	defer r.reportLock.RUnlock()
+	return r.report
+}
+
+// reconcile runs one pass over all providers and returns its report.
+func (r *reconciler) reconcile() types.DriftReport {
+	r.passLock.Lock()
+	defer r.passLock.Unlock()
+
+	report := types.DriftReport{Time: time.Now(), Drift: []types.Drift{}}
+	keys := r.providers.Keys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		drift, err := r.reconcileProvider(key, r.providers[key], r.states[key])
+		if err != nil {
+			logrus.WithError(err).Warnf("reconciling provider %s", key)
+			if report.Errors == nil {
+				report.Errors = map[string]string{}
+			}
+			report.Errors[key] = err.Error()
+		}
+		for _, d := range drift {
+			entry := logrus.WithFields(logrus.Fields{"provider": d.Provider, "kind": d.Kind, "name": d.Name})
+			if d.Action != "" {
+				entry.Warnf("%s: %s", d.Problem, d.Action)
+			} else {
+				entry.Debugf("%s", d.Problem)
+			}
+		}
+		report.Drift = append(report.Drift, drift...)
+	}
+
+	r.reportLock.Lock()
+	r.report = report
+	r.reportLock.Unlock()
+	return report
+}
+
+func (r *reconciler) reconcileProvider(key string, p providers.Provider, s state.State) ([]types.Drift, error) {
+	observer, ok := p.(providers.ResourceObserver)
+	if !ok || s == nil {
+		// providers that cannot be observed refresh their state when
+		// listing, e.g. by probing instances
+		if _, err := p.ListInstances(); err != nil {
+			return nil, errors.New("listing instances", err)
+		}
+		if s == nil {
+			return nil, nil
+		}
+		return danglingAttachments(key, s), nil
+	}
+
+	observed, err := observer.ObserveResources()
+	if err != nil {
+		return nil, errors.New("observing resources", err)
+	}
+
+	drift, err := reconcileInstances(key, s, observed)
+	if err != nil {
+		return drift, err
+	}
+
+	imageNames := map[string]bool{}
+	for _, image := range s.GetImages() {
+		imageNames[image.Name] = true
+	}
+	volumeNames := map[string]bool{}
+	for _, volume := range s.GetVolumes() {
+		volumeNames[volume.Name] = true
+	}
+	drift = append(drift, compareNames(key, types.EventKind_Image, imageNames, observed.Images)...)
+	drift = append(drift, compareNames(key, types.EventKind_Volume, volumeNames, observed.Volumes)...)
+	drift = append(drift, danglingAttachments(key, s)...)
+	return drift, nil
+}
+
+func reconcileInstances(key string, s state.State, observed *providers.ObservedResources) ([]types.Drift, error) {
+	var drift []types.Drift
+	recent := time.Now().Add(-reconcileGracePeriod)
+	err := s.ModifyInstances(func(instances map[string]*types.Instance) error {
+		tracked := map[string]bool{}
+		for id, instance := range instances {
+			tracked[instance.Name] = true
+			if instance.Created.After(recent) || instance.State == types.InstanceState_Pending {
+				continue
+			}
+			actual, found := observed.Instances[instance.Name]
+			if !found {
+				if instance.State == types.InstanceState_Terminated {
+					continue
+				}
+				drift = append(drift, types.Drift{
+					Provider: key,
+					Kind:     types.EventKind_Instance,
+					Id:       id,
+					Name:     instance.Name,
+					Problem:  fmt.Sprintf("instance is %s in state but does not exist", instance.State),
+					Action:   "marked terminated",
+				})
+				instance.State = types.InstanceState_Terminated
+				instance.IpAddress = ""
+				continue
+			}
+			if actual.State == instance.State && (actual.Id == "" || actual.Id == id) {
+				continue
+			}
+			drift = append(drift, types.Drift{
+				Provider: key,
+				Kind:     types.EventKind_Instance,
+				Id:       id,
+				Name:     instance.Name,
+				Problem:  fmt.Sprintf("instance is %s in state but %s", instance.State, actual.State),
+				Action:   "marked " + string(actual.State),
+			})
+			instance.State = actual.State
+			if actual.State != types.InstanceState_Running && actual.State != types.InstanceState_Paused {
+				instance.IpAddress = ""
+			}
+			if actual.Id != "" && actual.Id != id {
+				delete(instances, id)
+				instance.Id = actual.Id
+				instances[actual.Id] = instance
+			}
+		}
+
+		for name, actual := range observed.Instances {
+			if tracked[name] || actual.Created.After(recent) {
+				continue
+			}
+			d := types.Drift{
+				Provider: key,
+				Kind:     types.EventKind_Instance,
+				Id:       actual.Id,
+				Name:     name,
+				Problem:  fmt.Sprintf("%s instance is not in state", actual.State),
+			}
+			if actual.Id != "" && (actual.State == types.InstanceState_Running || actual.State == types.InstanceState_Paused) {
+				adopted := *actual
+				instances[adopted.Id] = &adopted
+				d.Action = "adopted"
+			}
+			drift = append(drift, d)
+		}
+		return nil
+	})
+	return drift, err
+}
+
+// compareNames reports images or volumes that are in the state but not on
+// the infrastructure, and the other way round.
+func compareNames(key string, kind types.EventKind, inState map[string]bool, found []string) []types.Drift {
+	var drift []types.Drift
+	onInfrastructure := map[string]bool{}
+	for _, name := range found {
+		onInfrastructure[name] = true
+		if !inState[name] {
+			drift = append(drift, types.Drift{
+				Provider: key,
+				Kind:     kind,
+				Name:     name,
+				Problem:  fmt.Sprintf("leaked %s: exists but is not in state", kind),
+			})
+		}
+	}
+	for name := range inState {
+		if !onInfrastructure[name] {
+			drift = append(drift, types.Drift{
+				Provider: key,
+				Kind:     kind,
+				Name:     name,
+				Problem:  fmt.Sprintf("%s is in state but does not exist", kind),
+			})
+		}
+	}
+	return drift
+}
+
+func danglingAttachments(key string, s state.State) []types.Drift {
+	var drift []types.Drift
+	instances := s.GetInstances()
+	for _, volume := range s.GetVolumes() {
+		if volume.Attachment == "" {
+			continue
+		}
+		if _, ok := instances[volume.Attachment]; !ok {
+			drift = append(drift, types.Drift{
+				Provider: key,
+				Kind:     types.EventKind_Volume,
+				Id:       volume.Id,
+				Name:     volume.Name,
+				Problem:  "attached to unknown instance " + volume.Attachment,
+			})
+		}
+	}
+	return drift
+}
@@ -0,0 +1,499 @@
+package daemon
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bhojpur/kernel/pkg/config"
+	"github.com/bhojpur/kernel/pkg/providers"
+	"github.com/bhojpur/kernel/pkg/providers/common"
+	"github.com/bhojpur/kernel/pkg/state"
+	"github.com/bhojpur/kernel/pkg/types"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSupervisorInterval = 5 * time.Second
+	defaultProbeInterval      = 10 * time.Second
+	defaultProbeTimeout       = 2 * time.Second
+	defaultFailureThreshold   = 3
+	maxRestartBackoff         = time.Minute
+)
+
+// supervised is an instance run with a restart policy or health check. It
+// is tracked by provider and name, since restarting may change its id, and
+// keeps the run parameters so it can be run again when the provider
+// cannot start it.
+type supervised struct {
+	Provider string                  `json:"Provider"`
+	Params   types.RunInstanceParams `json:"Params"`
+	// Stopped is set while the instance is stopped through the api
+	Stopped bool `json:"Stopped,omitempty"`
+	// GaveUp is set when an on-failure policy ran out of retries
+	GaveUp      bool      `json:"GaveUp,omitempty"`
+	Restarts    int       `json:"Restarts"`
+	LastRestart time.Time `json:"LastRestart,omitempty"`
+
+	health    types.HealthStatus
+	failures  int
+	nextProbe time.Time
+}
+
+// supervisor enforces restart policies and health checks. Its records are
+// kept in a file so supervision survives daemon restarts.
+type supervisor struct {
+	providers providers.Providers
+	states    map[string]state.State
+	interval  time.Duration
+	file      string
+
+	lock      sync.Mutex
+	instances map[string]*supervised
+}
+
+// supervisorFile is where the supervisor keeps its records,
+// {KernelHome}/supervisor.json
+func supervisorFile() string {
+	return filepath.Join(config.Internal.KernelHome, "supervisor.json")
+}
+
+func supervisedKey(provider, name string) string {
+	return provider + ":" + name
+}
+
+func newSupervisor(c config.Supervisor, _providers providers.Providers, states map[string]state.State, file string) *supervisor {
+	interval := c.Interval
+	if interval <= 0 {
+		interval = defaultSupervisorInterval
+	}
+	s := &supervisor{
+		providers: _providers,
+		states:    states,
+		interval:  interval,
+		file:      file,
+		instances: map[string]*supervised{},
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.WithError(err).Warnf("failed to read supervised instances from %s", file)
+		}
+		return s
+	}
+	var records []*supervised
+	if err := json.Unmarshal(data, &records); err != nil {
+		logrus.WithError(err).Warnf("failed to parse supervised instances from %s", file)
+		return s
+	}
+	for _, record := range records {
+		if _, ok := _providers[record.Provider]; !ok {
+			logrus.Warnf("not supervising instance %s: provider %s is not configured", record.Params.Name, record.Provider)
+			continue
+		}
+		s.instances[supervisedKey(record.Provider, record.Params.Name)] = record
+	}
+	return s
+}
+
+// save writes the records to a temporary file first so a crash cannot
+// leave a truncated file behind. The caller must hold the lock.
+func (s *supervisor) save() {
+	records := make([]*supervised, 0, len(s.instances))
+	for _, record := range s.instances {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return supervisedKey(records[i].Provider, records[i].Params.Name) < supervisedKey(records[j].Provider, records[j].Params.Name)
+	})
+	data, err := json.Marshal(records)
+	if err == nil {
+		tmp := s.file + ".tmp"
+		os.MkdirAll(filepath.Dir(s.file), 0755)
+		if err = ioutil.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, s.file)
+		}
+	}
+	if err != nil {
+		logrus.WithError(err).Errorf("failed to save supervised instances to %s", s.file)
+	}
+}
+
+// watch starts supervising an instance that was just run, if it has a
+// restart policy or health check.
+func (s *supervisor) watch(p providers.Provider, instance *types.Instance, params types.RunInstanceParams) {
+	if (params.RestartPolicy.Name == "" || params.RestartPolicy.Name == types.RestartPolicy_Never) && params.HealthCheck == nil {
+		return
+	}
+	key := s.providers.KeyOf(p)
+	if key == "" {
+		return
+	}
+	params.Name = instance.Name
+	// restarts are not part of the request that ran the instance
+	params.Logger = nil
+	record := &supervised{Provider: key, Params: params}
+	if params.HealthCheck != nil {
+		record.health = types.HealthStatus_Starting
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.instances[supervisedKey(key, instance.Name)] = record
+	s.save()
+	s.annotate(record, "")
+}
+
+// lookup returns the record of an instance given by id or name. The caller
+// must hold the lock.
+func (s *supervisor) lookup(p providers.Provider, instanceId string) (string, *supervised) {
+	instance, err := p.GetInstance(instanceId)
+	if err != nil {
+		return "", nil
+	}
+	key := supervisedKey(s.providers.KeyOf(p), instance.Name)
+	return key, s.instances[key]
+}
+
+// setStopped records that an instance is stopped, or started again,
+// through the api. Stopped instances are not restarted.
+func (s *supervisor) setStopped(p providers.Provider, instanceId string, stopped bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, record := s.lookup(p, instanceId)
+	if record == nil {
+		return
+	}
+	record.Stopped = stopped
+	if !stopped {
+		record.GaveUp = false
+		record.failures = 0
+	}
+	s.save()
+}
+
+// forget stops supervising an instance that is about to be deleted.
+func (s *supervisor) forget(p providers.Provider, instanceId string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key, record := s.lookup(p, instanceId)
+	if record == nil {
+		return
+	}
+	delete(s.instances, key)
+	s.save()
+}
+
+func (s *supervisor) loop() {
+	logrus.Infof("supervising instances every %v", s.interval)
+	for {
+		s.supervise()
+		time.Sleep(s.interval)
+	}
+}
+
+// supervise runs one pass over all supervised instances, probing the
+// running ones and restarting those that exited or became unhealthy.
+// Probes and restarts can take long, so the lock is only held to read and
+// update records, never while talking to providers or guests.
+func (s *supervisor) supervise() {
+	s.lock.Lock()
+	records := make([]*supervised, 0, len(s.instances))
+	for _, record := range s.instances {
+		if s.providers[record.Provider] == nil || s.states[record.Provider] == nil || record.Stopped || record.GaveUp {
+			continue
+		}
+		records = append(records, record)
+	}
+	s.lock.Unlock()
+
+	refreshed := map[string]bool{}
+	for _, record := range records {
+		p, st := s.providers[record.Provider], s.states[record.Provider]
+		if !refreshed[record.Provider] {
+			// lets providers notice instances that exited
+			if _, err := p.ListInstances(); err != nil {
+				logrus.WithError(err).Warnf("supervisor: listing instances of %s", record.Provider)
+			}
+			refreshed[record.Provider] = true
+		}
+		instance := instanceByName(st, record.Params.Name)
+		reason := s.check(record, instance)
+		if reason == "" {
+			continue
+		}
+		if !shouldRestart(record.Params.RestartPolicy, reason) {
+			continue
+		}
+		if !s.beginRestart(record, reason) {
+			continue
+		}
+		if err := s.restart(record, p, instance, reason); err != nil {
+			logrus.WithError(err).Errorf("supervisor: restarting instance %s", record.Params.Name)
+		}
+	}
+}
+
+// active tells whether record is still supervised and may be restarted,
+// it can be stopped or forgotten while the supervisor works without the
+// lock. The caller must hold the lock.
+func (s *supervisor) active(record *supervised) bool {
+	return s.instances[supervisedKey(record.Provider, record.Params.Name)] == record && !record.Stopped && !record.GaveUp
+}
+
+// beginRestart records a restart of the instance, unless its policy has
+// run out of retries or it was restarted too recently.
+func (s *supervisor) beginRestart(record *supervised, reason string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.active(record) {
+		return false
+	}
+	policy := record.Params.RestartPolicy
+	if policy.Name == types.RestartPolicy_OnFailure && policy.MaxRetries > 0 && record.Restarts >= policy.MaxRetries {
+		logrus.Warnf("instance %s failed (%s) and has been restarted %d times; giving up", record.Params.Name, reason, record.Restarts)
+		record.GaveUp = true
+		s.save()
+		s.annotate(record, reason)
+		return false
+	}
+	if time.Since(record.LastRestart) < restartBackoff(record.Restarts) {
+		return false
+	}
+	logrus.Warnf("restarting instance %s: %s", record.Params.Name, reason)
+	record.Restarts++
+	record.LastRestart = time.Now()
+	record.failures = 0
+	record.nextProbe = time.Time{}
+	if record.Params.HealthCheck != nil {
+		record.health = types.HealthStatus_Starting
+	}
+	s.save()
+	return true
+}
+
+// check returns why the instance needs a restart, or "" if it does not.
+func (s *supervisor) check(record *supervised, instance *types.Instance) string {
+	if instance == nil {
+		return "instance disappeared"
+	}
+	switch instance.State {
+	case types.InstanceState_Stopped, types.InstanceState_Terminated, types.InstanceState_Error:
+		if instance.LastExitReason != "" {
+			return instance.LastExitReason
+		}
+		return "instance is " + string(instance.State)
+	case types.InstanceState_Running:
+		if record.Params.HealthCheck != nil {
+			return s.probe(record, instance)
+		}
+	}
+	return ""
+}
+
+func (s *supervisor) probe(record *supervised, instance *types.Instance) string {
+	check := record.Params.HealthCheck
+	s.lock.Lock()
+	if time.Now().Before(record.nextProbe) {
+		s.lock.Unlock()
+		return ""
+	}
+	record.nextProbe = time.Now().Add(secondsOr(check.IntervalSeconds, defaultProbeInterval))
+	started := instance.Created
+	if record.LastRestart.After(started) {
+		started = record.LastRestart
+	}
+	inGracePeriod := time.Since(started) < time.Duration(check.GracePeriodSeconds)*time.Second
+	if instance.IpAddress == "" {
+		// some providers (e.g. qemu) never record an address; say so once
+		// instead of reporting the instance as starting forever
+		if !inGracePeriod && record.health != types.HealthStatus_Unprobeable {
+			logrus.Warnf("supervisor: cannot run the health check of instance %s: provider %s reports no address for it", instance.Name, record.Provider)
+			record.health = types.HealthStatus_Unprobeable
+			s.annotate(record, "")
+		}
+		s.lock.Unlock()
+		return ""
+	}
+	s.lock.Unlock()
+
+	err := probeInstance(check, instance.IpAddress, secondsOr(check.TimeoutSeconds, defaultProbeTimeout))
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.active(record) {
+		return ""
+	}
+	health := record.health
+	switch {
+	case err == nil:
+		record.failures = 0
+		health = types.HealthStatus_Healthy
+	case inGracePeriod:
+		logrus.WithError(err).Debugf("health check of instance %s failed during grace period", instance.Name)
+	default:
+		record.failures++
+		threshold := check.FailureThreshold
+		if threshold <= 0 {
+			threshold = defaultFailureThreshold
+		}
+		if record.failures >= threshold {
+			health = types.HealthStatus_Unhealthy
+		}
+	}
+	if health != record.health {
+		logrus.Infof("instance %s is %s", instance.Name, health)
+		record.health = health
+		s.annotate(record, "")
+	}
+	if health == types.HealthStatus_Unhealthy {
+		return "health check failed: " + err.Error()
+	}
+	return ""
+}
+
+func probeInstance(check *types.HealthCheck, ip string, timeout time.Duration) error {
+	addr := net.JoinHostPort(ip, strconv.Itoa(check.Port))
+	if check.Type == "tcp" {
+		conn, err := net.DialTimeout("tcp", addr, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	httpClient := &http.Client{Timeout: timeout}
+	resp, err := httpClient.Get("http://" + addr + check.Path)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return errors.New("http status "+resp.Status, nil)
+	}
+	return nil
+}
+
+// restart starts the instance again if the provider can, and otherwise
+// deletes it and runs it again from the saved parameters. It is called
+// without the lock, after beginRestart recorded the restart.
+func (s *supervisor) restart(record *supervised, p providers.Provider, instance *types.Instance, reason string) error {
+	var err error
+	if instance != nil {
+		if instance.State == types.InstanceState_Running {
+			err = p.StopInstance(instance.Id)
+		}
+		if err == nil {
+			err = p.StartInstance(instance.Id)
+		}
+		if err != nil {
+			logrus.WithError(err).Debugf("could not start instance %s, running it again", instance.Name)
+			if err := p.DeleteInstance(instance.Id, true); err != nil {
+				return errors.New("deleting instance "+instance.Name, err)
+			}
+			instance = nil
+		}
+	}
+	if instance == nil {
+		if _, err := p.RunInstance(record.Params); err != nil {
+			return errors.New("running instance "+record.Params.Name, err)
+		}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.annotate(record, reason)
+	return nil
+}
+
+// annotate copies the supervision status onto the instance in state. The
+// caller must hold the lock.
+func (s *supervisor) annotate(record *supervised, reason string) {
+	st := s.states[record.Provider]
+	if st == nil {
+		return
+	}
+	if err := st.ModifyInstances(func(instances map[string]*types.Instance) error {
+		for _, instance := range instances {
+			if instance.Name != record.Params.Name {
+				continue
+			}
+			instance.RestartPolicy = record.Params.RestartPolicy.Name
+			if instance.RestartPolicy == "" {
+				instance.RestartPolicy = types.RestartPolicy_Never
+			}
+			instance.Restarts = record.Restarts
+			instance.Health = record.health
+			if reason != "" {
+				instance.LastExitReason = reason
+			}
+		}
+		return nil
+	}); err != nil {
+		logrus.WithError(err).Warnf("supervisor: updating instance %s in state", record.Params.Name)
+	}
+}
+
+func shouldRestart(policy types.RestartPolicy, reason string) bool {
+	switch policy.Name {
+	case types.RestartPolicy_Always:
+		return true
+	case types.RestartPolicy_OnFailure:
+		return reason != common.CleanExit
+	}
+	return false
+}
+
+// restartBackoff doubles the delay between restarts, up to a minute.
+func restartBackoff(restarts int) time.Duration {
+	if restarts > 6 {
+		return maxRestartBackoff
+	}
+	backoff := time.Second << uint(restarts)
+	if backoff > maxRestartBackoff {
+		return maxRestartBackoff
+	}
+	return backoff
+}
+
+func secondsOr(seconds int, fallback time.Duration) time.Duration {
+	if seconds <= 0 {
+		return fallback
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func instanceByName(s state.State, name string) *types.Instance {
+	for _, instance := range s.GetInstances() {
+		if instance.Name == name {
+			return instance
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package manifest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/bhojpur/kernel/pkg/client"
+	"github.com/bhojpur/kernel/pkg/daemon"
+	kos "github.com/bhojpur/kernel/pkg/os"
+	"github.com/bhojpur/kernel/pkg/types"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Current fetches the images, volumes and instances the daemon at host has.
+func Current(host string) (Resources, error) {
+	c := client.KernelClient(host)
+	images, err := c.Images().All()
+	if err != nil {
+		return Resources{}, errors.New("listing images", err)
+	}
+	volumes, err := c.Volumes().All()
+	if err != nil {
+		return Resources{}, errors.New("listing volumes", err)
+	}
+	instances, err := c.Instances().All()
+	if err != nil {
+		return Resources{}, errors.New("listing instances", err)
+	}
+	return Resources{Images: images, Volumes: volumes, Instances: instances}, nil
+}
+
+// Execute runs the plan against the daemon at host and stops at the first
+// step that fails. Steps that already ran are not rolled back; running
+// apply again picks up where it stopped.
+func (plan *Plan) Execute(host string) error {
+	for _, step := range plan.Steps {
+		if step.Kind != Kind_Instance || step.Action != Action_Replace {
+			continue
+		}
+		logrus.Infof("deleting instance %s to replace it", step.Name)
+		if err := client.KernelClient(host).Instances().Delete(step.Id, true); err != nil {
+			return errors.New("deleting instance "+step.Name, err)
+		}
+	}
+	for _, step := range plan.Steps {
+		logrus.Infof("%s", step)
+		if err := executeStep(host, step); err != nil {
+			return errors.New(fmt.Sprintf("%s failed", step), err)
+		}
+	}
+	return nil
+}
+
+func executeStep(host string, step Step) error {
+	c := client.KernelClient(host)
+	switch step.Kind {
+	case Kind_Image:
+		if step.Action == Action_Delete {
+			return c.Images().Delete(step.Id, true)
+		}
+		return buildImage(host, step.image, step.Action == Action_Replace)
+	case Kind_Volume:
+		if step.Action == Action_Delete {
+			return c.Volumes().Delete(step.Id, true)
+		}
+		return createVolume(host, step.volume)
+	case Kind_Instance:
+		switch step.Action {
+		case Action_Delete:
+			return c.Instances().Delete(step.Id, true)
+		case Action_Start:
+			return c.Instances().Start(step.Id)
+		case Action_Resume:
+			return c.Instances().Resume(step.Id)
+		}
+		return runInstance(host, step.Name, step.instance)
+	}
+	return errors.New("unknown resource kind "+string(step.Kind), nil)
+}
+
+func buildImage(host string, spec *ImageSpec, force bool) error {
+	sourceTar, err := ioutil.TempFile("", "sources.tar.gz.")
+	if err != nil {
+		return errors.New("failed to create tmp tar file", err)
+	}
+	sourceTar.Close()
+	defer os.Remove(sourceTar.Name())
+	if err := kos.Compress(spec.Path, sourceTar.Name()); err != nil {
+		return errors.New("failed to tar sources", err)
+	}
+	_, err = client.KernelClient(host).Images().Build(spec.Name, sourceTar.Name(), spec.Base, spec.Language, spec.Provider, spec.Args, spec.MountPoints, force, false)
+	return err
+}
+
+func createVolume(host string, spec *VolumeSpec) error {
+	volumeType := spec.Type
+	if volumeType == "" {
+		volumeType = "ext2"
+	}
+	data := spec.Data
+	if data != "" && !spec.Raw {
+		dataTar, err := ioutil.TempFile("", "data.tar.gz.")
+		if err != nil {
+			return errors.New("failed to create tmp tar file", err)
+		}
+		dataTar.Close()
+		defer os.Remove(dataTar.Name())
+		if err := kos.Compress(data, dataTar.Name()); err != nil {
+			return errors.New("failed to tar data", err)
+		}
+		data = dataTar.Name()
+	}
+	_, err := client.KernelClient(host).Volumes().Create(spec.Name, data, spec.Provider, spec.Raw, spec.Size, volumeType, false)
+	return err
+}
+
+func runInstance(host, name string, spec *InstanceSpec) error {
+	c := client.KernelClient(host)
+	mounts := map[string]string{}
+	for mountPoint, volumeName := range spec.Mounts {
+		volume, err := c.Volumes().Get(volumeName)
+		if err != nil {
+			return errors.New("looking up volume "+volumeName, err)
+		}
+		mounts[mountPoint] = volume.Id
+	}
+	// validated when the manifest was loaded
+	policy, _ := types.ParseRestartPolicy(spec.Restart)
+	_, err := c.Instances().RunWithRequest(daemon.RunInstanceRequest{
+		InstanceName:  name,
+		ImageName:     spec.Image,
+		Mounts:        mounts,
+		Env:           spec.Env,
+		MemoryMb:      spec.Memory,
+		Provider:      spec.Provider,
+		RestartPolicy: policy,
+		HealthCheck:   spec.HealthCheck.healthCheck(),
+	})
+	return err
+}
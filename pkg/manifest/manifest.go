@@ -0,0 +1,298 @@
+package manifest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package manifest describes a set of images, volumes and instances in
+// YAML and plans the calls needed to bring a daemon in line with it.
+//
+// Example manifest:
+//
+//	images:
+//	  - name: web
+//	    base: rump
+//	    language: go
+//	    provider: qemu
+//	    path: ./web
+//	    args: "-port 8080"
+//	    mountpoints: [/data]
+//	volumes:
+//	  - name: web-data
+//	    provider: qemu
+//	    size: 100
+//	instances:
+//	  - name: web
+//	    image: web
+//	    memory: 256
+//	    env:
+//	      LOG_LEVEL: debug
+//	    mounts:
+//	      /data: web-data
+//	    restart: on-failure:5
+//	    healthCheck:
+//	      type: http
+//	      port: 8080
+//	      path: /healthz
+//
+// Relative paths are resolved against the directory of the manifest file.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bhojpur/kernel/pkg/types"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	"gopkg.in/yaml.v2"
+)
+
+type Manifest struct {
+	Images    []ImageSpec    `yaml:"images"`
+	Volumes   []VolumeSpec   `yaml:"volumes"`
+	Instances []InstanceSpec `yaml:"instances"`
+}
+
+type ImageSpec struct {
+	Name        string   `yaml:"name"`
+	Base        string   `yaml:"base"`
+	Language    string   `yaml:"language"`
+	Provider    string   `yaml:"provider"`
+	Path        string   `yaml:"path"`
+	Args        string   `yaml:"args"`
+	MountPoints []string `yaml:"mountpoints"`
+}
+
+type VolumeSpec struct {
+	Name     string `yaml:"name"`
+	Provider string `yaml:"provider"`
+	// Size is in MB; optional when Data is set
+	Size int    `yaml:"size"`
+	Data string `yaml:"data"`
+	Type string `yaml:"type"`
+	Raw  bool   `yaml:"raw"`
+}
+
+type InstanceSpec struct {
+	Name     string            `yaml:"name"`
+	Image    string            `yaml:"image"`
+	Provider string            `yaml:"provider"`
+	Env      map[string]string `yaml:"env"`
+	// Memory is in MB; the image default is used when zero
+	Memory int `yaml:"memory"`
+	// Mounts maps mount points to volume names
+	Mounts   map[string]string `yaml:"mounts"`
+	Replicas int               `yaml:"replicas"`
+	// Restart is never, on-failure[:N] or always
+	Restart     string           `yaml:"restart"`
+	HealthCheck *HealthCheckSpec `yaml:"healthCheck"`
+}
+
+// HealthCheckSpec mirrors types.HealthCheck; durations are in seconds.
+type HealthCheckSpec struct {
+	Type             string `yaml:"type"`
+	Port             int    `yaml:"port"`
+	Path             string `yaml:"path"`
+	Interval         int    `yaml:"interval"`
+	Timeout          int    `yaml:"timeout"`
+	FailureThreshold int    `yaml:"failureThreshold"`
+	GracePeriod      int    `yaml:"gracePeriod"`
+}
+
+func (spec *HealthCheckSpec) healthCheck() *types.HealthCheck {
+	if spec == nil {
+		return nil
+	}
+	return &types.HealthCheck{
+		Type:               spec.Type,
+		Port:               spec.Port,
+		Path:               spec.Path,
+		IntervalSeconds:    spec.Interval,
+		TimeoutSeconds:     spec.Timeout,
+		FailureThreshold:   spec.FailureThreshold,
+		GracePeriodSeconds: spec.GracePeriod,
+	}
+}
+
+// InstanceNames returns the names the replicas of the instance run under:
+// the instance name itself for a single replica, name-0, name-1, ...
+// otherwise.
+func (spec InstanceSpec) InstanceNames() []string {
+	if spec.Replicas <= 1 {
+		return []string{spec.Name}
+	}
+	names := make([]string, spec.Replicas)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s-%d", spec.Name, i)
+	}
+	return names
+}
+
+// Load reads and validates the manifest at path.
+func Load(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.New("reading manifest "+path, err)
+	}
+	m, err := Parse(data)
+	if err != nil {
+		return nil, errors.New("parsing manifest "+path, err)
+	}
+	m.resolvePaths(filepath.Dir(path))
+	return m, nil
+}
+
+// Parse decodes and validates a manifest. Unknown fields are rejected so
+// that typos do not silently fall back to defaults.
+func Parse(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := yaml.UnmarshalStrict(data, &m); err != nil {
+		return nil, errors.New("invalid yaml", err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (m *Manifest) resolvePaths(dir string) {
+	resolve := func(path string) string {
+		if path == "" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+	for i := range m.Images {
+		m.Images[i].Path = resolve(m.Images[i].Path)
+	}
+	for i := range m.Volumes {
+		m.Volumes[i].Data = resolve(m.Volumes[i].Data)
+	}
+}
+
+// Validate checks the manifest for missing fields, duplicate names and
+// references to images or volumes it does not declare.
+func (m *Manifest) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	images := map[string]ImageSpec{}
+	for i, image := range m.Images {
+		if image.Name == "" {
+			add("images[%d]: name must be set", i)
+			continue
+		}
+		if _, ok := images[image.Name]; ok {
+			add("image %s: declared more than once", image.Name)
+		}
+		images[image.Name] = image
+		for field, value := range map[string]string{"base": image.Base, "language": image.Language, "provider": image.Provider, "path": image.Path} {
+			if value == "" {
+				add("image %s: %s must be set", image.Name, field)
+			}
+		}
+	}
+
+	volumes := map[string]VolumeSpec{}
+	for i, volume := range m.Volumes {
+		if volume.Name == "" {
+			add("volumes[%d]: name must be set", i)
+			continue
+		}
+		if _, ok := volumes[volume.Name]; ok {
+			add("volume %s: declared more than once", volume.Name)
+		}
+		volumes[volume.Name] = volume
+		if volume.Provider == "" {
+			add("volume %s: provider must be set", volume.Name)
+		}
+		if volume.Data == "" && volume.Size <= 0 {
+			add("volume %s: either data or size must be set", volume.Name)
+		}
+	}
+
+	instanceNames := map[string]bool{}
+	mountedBy := map[string]string{}
+	for i, instance := range m.Instances {
+		if instance.Name == "" {
+			add("instances[%d]: name must be set", i)
+			continue
+		}
+		if instance.Replicas < 0 {
+			add("instance %s: replicas must not be negative", instance.Name)
+		}
+		for _, name := range instance.InstanceNames() {
+			if instanceNames[name] {
+				add("instance %s: name is used more than once", name)
+			}
+			instanceNames[name] = true
+		}
+		image, ok := images[instance.Image]
+		if !ok {
+			add("instance %s: image %q is not declared in the manifest", instance.Name, instance.Image)
+		}
+		for mountPoint, volumeName := range instance.Mounts {
+			if _, ok := volumes[volumeName]; !ok {
+				add("instance %s: volume %q is not declared in the manifest", instance.Name, volumeName)
+			}
+			if other, ok := mountedBy[volumeName]; ok {
+				add("instance %s: volume %s is already mounted by %s", instance.Name, volumeName, other)
+			}
+			mountedBy[volumeName] = instance.Name
+			if ok && !containsString(image.MountPoints, mountPoint) {
+				add("instance %s: image %s has no mount point %s", instance.Name, image.Name, mountPoint)
+			}
+		}
+		for _, mountPoint := range image.MountPoints {
+			if _, ok := instance.Mounts[mountPoint]; !ok {
+				add("instance %s: mount point %s of image %s needs a volume", instance.Name, mountPoint, image.Name)
+			}
+		}
+		if _, err := types.ParseRestartPolicy(instance.Restart); err != nil {
+			add("instance %s: %v", instance.Name, err)
+		}
+		if check := instance.HealthCheck.healthCheck(); check != nil {
+			if err := check.Validate(); err != nil {
+				add("instance %s: %v", instance.Name, err)
+			}
+		}
+		if len(instance.Mounts) > 0 && instance.Replicas > 1 {
+			add("instance %s: a volume can only be attached to one replica", instance.Name)
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.New("invalid manifest:\n\t"+strings.Join(problems, "\n\t"), nil)
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,278 @@
+package manifest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bhojpur/kernel/pkg/providers"
+	"github.com/bhojpur/kernel/pkg/types"
+)
+
+type Action string
+
+const (
+	Action_Create  Action = "create"
+	Action_Replace Action = "replace"
+	Action_Start   Action = "start"
+	Action_Resume  Action = "resume"
+	Action_Delete  Action = "delete"
+)
+
+type Kind string
+
+const (
+	Kind_Image    Kind = "image"
+	Kind_Volume   Kind = "volume"
+	Kind_Instance Kind = "instance"
+)
+
+// Step is a single change to one resource.
+type Step struct {
+	Action Action
+	Kind   Kind
+	Name   string
+	Reason string
+
+	// Id of the existing resource, for delete, replace, start and resume
+	Id       string
+	image    *ImageSpec
+	volume   *VolumeSpec
+	instance *InstanceSpec
+}
+
+func (step Step) String() string {
+	s := fmt.Sprintf("%s %s %s", step.Action, step.Kind, step.Name)
+	if step.Reason != "" {
+		s += " (" + step.Reason + ")"
+	}
+	return s
+}
+
+// Plan lists surplus instances to delete, then volumes and images to
+// create, then instances to run. Replaced instances are deleted before
+// any image is built, since building an image over an existing one
+// removes its instances.
+type Plan struct {
+	Steps []Step
+}
+
+func (plan *Plan) Empty() bool {
+	return len(plan.Steps) == 0
+}
+
+// Resources is what the daemon currently has.
+type Resources struct {
+	Images    []*types.Image
+	Volumes   []*types.Volume
+	Instances []*types.Instance
+}
+
+type PlanOptions struct {
+	// Rebuild rebuilds every image, e.g. because its sources changed.
+	// The daemon does not record the sources an image was built from,
+	// so source changes are not detected otherwise.
+	Rebuild bool
+}
+
+// NewPlan computes the steps that bring current in line with m. Only
+// resources named in the manifest are touched, plus surplus replicas
+// left behind when an instance is scaled down.
+func NewPlan(m *Manifest, current Resources, opts PlanOptions) *Plan {
+	images := map[string]*types.Image{}
+	for _, image := range current.Images {
+		images[image.Name] = image
+	}
+	volumes := map[string]*types.Volume{}
+	for _, volume := range current.Volumes {
+		volumes[volume.Name] = volume
+	}
+	instances := map[string]*types.Instance{}
+	for _, instance := range current.Instances {
+		instances[instance.Name] = instance
+	}
+
+	var removals, volumeSteps, imageSteps, runs []Step
+
+	rebuilt := map[string]bool{}
+	for i := range m.Images {
+		spec := &m.Images[i]
+		image, ok := images[spec.Name]
+		switch {
+		case !ok:
+			imageSteps = append(imageSteps, Step{Action: Action_Create, Kind: Kind_Image, Name: spec.Name, image: spec})
+		case opts.Rebuild:
+			imageSteps = append(imageSteps, Step{Action: Action_Replace, Kind: Kind_Image, Name: spec.Name, Id: image.Id, Reason: "rebuild requested", image: spec})
+		default:
+			if reason := imageDiff(spec, image); reason != "" {
+				imageSteps = append(imageSteps, Step{Action: Action_Replace, Kind: Kind_Image, Name: spec.Name, Id: image.Id, Reason: reason, image: spec})
+			} else {
+				continue
+			}
+		}
+		rebuilt[spec.Name] = true
+	}
+
+	for i := range m.Volumes {
+		spec := &m.Volumes[i]
+		if _, ok := volumes[spec.Name]; !ok {
+			volumeSteps = append(volumeSteps, Step{Action: Action_Create, Kind: Kind_Volume, Name: spec.Name, volume: spec})
+		}
+	}
+
+	for i := range m.Instances {
+		spec := &m.Instances[i]
+		image := images[spec.Image]
+		declared := map[string]bool{}
+		for _, name := range spec.InstanceNames() {
+			declared[name] = true
+			instance, ok := instances[name]
+			if !ok {
+				runs = append(runs, Step{Action: Action_Create, Kind: Kind_Instance, Name: name, instance: spec})
+				continue
+			}
+			reason := ""
+			switch {
+			case rebuilt[spec.Image]:
+				reason = "image " + spec.Image + " is rebuilt"
+			case image == nil || instance.ImageId != image.Id:
+				reason = "instance runs a different image"
+			case instance.State == types.InstanceState_Terminated || instance.State == types.InstanceState_Error:
+				reason = "instance is " + string(instance.State)
+			}
+			switch {
+			case reason != "":
+				runs = append(runs, Step{Action: Action_Replace, Kind: Kind_Instance, Name: name, Id: instance.Id, Reason: reason, instance: spec})
+			case instance.State == types.InstanceState_Stopped:
+				runs = append(runs, Step{Action: Action_Start, Kind: Kind_Instance, Name: name, Id: instance.Id, Reason: "instance is stopped"})
+			case instance.State == types.InstanceState_Paused || instance.State == types.InstanceState_Suspended:
+				runs = append(runs, Step{Action: Action_Resume, Kind: Kind_Instance, Name: name, Id: instance.Id, Reason: "instance is " + string(instance.State)})
+			}
+		}
+		if image == nil {
+			continue
+		}
+		for _, instance := range surplusReplicas(spec, declared, image, current.Instances) {
+			removals = append(removals, Step{Action: Action_Delete, Kind: Kind_Instance, Name: instance.Name, Id: instance.Id, Reason: "scaled down"})
+		}
+	}
+
+	sortSteps(removals)
+	sortSteps(runs)
+	steps := append(removals, volumeSteps...)
+	steps = append(steps, imageSteps...)
+	return &Plan{Steps: append(steps, runs...)}
+}
+
+// NewDestroyPlan removes every instance, image and, unless keepVolumes is
+// set, volume the manifest declares.
+func NewDestroyPlan(m *Manifest, current Resources, keepVolumes bool) *Plan {
+	var steps []Step
+	declared := map[string]bool{}
+	for _, spec := range m.Instances {
+		for _, name := range spec.InstanceNames() {
+			declared[name] = true
+		}
+	}
+	images := map[string]*types.Image{}
+	for _, image := range current.Images {
+		images[image.Name] = image
+	}
+	var instanceSteps []Step
+	for _, instance := range current.Instances {
+		if declared[instance.Name] {
+			instanceSteps = append(instanceSteps, Step{Action: Action_Delete, Kind: Kind_Instance, Name: instance.Name, Id: instance.Id})
+		}
+	}
+	for _, spec := range m.Instances {
+		if image := images[spec.Image]; image != nil {
+			for _, instance := range surplusReplicas(&spec, declared, image, current.Instances) {
+				instanceSteps = append(instanceSteps, Step{Action: Action_Delete, Kind: Kind_Instance, Name: instance.Name, Id: instance.Id, Reason: "surplus replica"})
+			}
+		}
+	}
+	sortSteps(instanceSteps)
+	steps = append(steps, instanceSteps...)
+	for _, spec := range m.Images {
+		if image := images[spec.Name]; image != nil {
+			steps = append(steps, Step{Action: Action_Delete, Kind: Kind_Image, Name: image.Name, Id: image.Id})
+		}
+	}
+	if !keepVolumes {
+		volumes := map[string]*types.Volume{}
+		for _, volume := range current.Volumes {
+			volumes[volume.Name] = volume
+		}
+		for _, spec := range m.Volumes {
+			if volume := volumes[spec.Name]; volume != nil {
+				steps = append(steps, Step{Action: Action_Delete, Kind: Kind_Volume, Name: volume.Name, Id: volume.Id})
+			}
+		}
+	}
+	return &Plan{Steps: steps}
+}
+
+// imageDiff returns why image no longer matches spec, or "" if it does.
+func imageDiff(spec *ImageSpec, image *types.Image) string {
+	providerType := providers.ProviderType(spec.Provider)
+	if !strings.EqualFold(string(image.Infrastructure), providerType) {
+		return fmt.Sprintf("provider changed from %s to %s", strings.ToLower(string(image.Infrastructure)), providerType)
+	}
+	compiler := fmt.Sprintf("%s-%s-%s", spec.Base, spec.Language, providerType)
+	if image.RunSpec.Compiler != "" && image.RunSpec.Compiler != compiler {
+		return fmt.Sprintf("compiler changed from %s to %s", image.RunSpec.Compiler, compiler)
+	}
+	var have []string
+	for _, deviceMapping := range image.RunSpec.DeviceMappings {
+		if strings.HasPrefix(deviceMapping.MountPoint, "/") && deviceMapping.MountPoint != "/" {
+			have = append(have, deviceMapping.MountPoint)
+		}
+	}
+	want := append([]string{}, spec.MountPoints...)
+	sort.Strings(have)
+	sort.Strings(want)
+	if strings.Join(have, ",") != strings.Join(want, ",") {
+		return fmt.Sprintf("mount points changed from [%s] to [%s]", strings.Join(have, " "), strings.Join(want, " "))
+	}
+	return ""
+}
+
+// surplusReplicas returns the instances of image named like a replica of
+// spec that the manifest no longer declares.
+func surplusReplicas(spec *InstanceSpec, declared map[string]bool, image *types.Image, instances []*types.Instance) []*types.Instance {
+	replicaName := regexp.MustCompile("^" + regexp.QuoteMeta(spec.Name) + `(-[0-9]+)?$`)
+	var surplus []*types.Instance
+	for _, instance := range instances {
+		if !declared[instance.Name] && instance.ImageId == image.Id && replicaName.MatchString(instance.Name) {
+			surplus = append(surplus, instance)
+		}
+	}
+	return surplus
+}
+
+func sortSteps(steps []Step) {
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].Name < steps[j].Name
+	})
+}
@@ -0,0 +1,130 @@
+package manifest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bhojpur/kernel/pkg/types"
+)
+
+const testManifest = `
+images:
+  - name: web
+    base: rump
+    language: go
+    provider: qemu
+    path: ./web
+    mountpoints: [/data]
+  - name: worker
+    base: rump
+    language: go
+    provider: qemu
+    path: ./worker
+volumes:
+  - name: web-data
+    provider: qemu
+    size: 100
+instances:
+  - name: web
+    image: web
+    mounts:
+      /data: web-data
+  - name: worker
+    image: worker
+    replicas: 2
+`
+
+func TestParseRejectsInvalidManifest(t *testing.T) {
+	_, err := Parse([]byte(`
+images:
+  - name: web
+    base: rump
+instances:
+  - name: web
+    image: missing
+    replicas: 2
+    mounts:
+      /data: nope
+`))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, problem := range []string{"path must be set", `image "missing" is not declared`, `volume "nope" is not declared`, "only be attached to one replica"} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("error %q does not mention %q", err.Error(), problem)
+		}
+	}
+	if _, err := Parse([]byte("images:\n  - name: web\n    typo: x\n")); err == nil {
+		t.Error("expected unknown fields to be rejected")
+	}
+}
+
+func TestNewPlan(t *testing.T) {
+	m, err := Parse([]byte(testManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := Resources{
+		Images: []*types.Image{
+			{Id: "img-web", Name: "web", Infrastructure: types.Infrastructure_QEMU, RunSpec: types.RunSpec{
+				Compiler:       "rump-go-qemu",
+				DeviceMappings: []types.DeviceMapping{{MountPoint: "/"}, {MountPoint: "/data"}},
+			}},
+			{Id: "img-worker", Name: "worker", Infrastructure: types.Infrastructure_QEMU, RunSpec: types.RunSpec{
+				Compiler:       "rump-go-qemu",
+				DeviceMappings: []types.DeviceMapping{{MountPoint: "/data"}},
+			}},
+		},
+		Volumes: []*types.Volume{{Id: "vol-1", Name: "web-data"}},
+		Instances: []*types.Instance{
+			{Id: "i-web", Name: "web", ImageId: "img-web", State: types.InstanceState_Stopped},
+			{Id: "i-w0", Name: "worker-0", ImageId: "img-worker", State: types.InstanceState_Running},
+			{Id: "i-w2", Name: "worker-2", ImageId: "img-worker", State: types.InstanceState_Running},
+			{Id: "i-other", Name: "worker-tool", ImageId: "img-worker", State: types.InstanceState_Running},
+		},
+	}
+	var got []string
+	for _, step := range NewPlan(m, current, PlanOptions{}).Steps {
+		got = append(got, string(step.Action)+" "+string(step.Kind)+" "+step.Name)
+	}
+	want := []string{
+		"delete instance worker-2",
+		"replace image worker",
+		"start instance web",
+		"replace instance worker-0",
+		"create instance worker-1",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got plan\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	destroy := NewDestroyPlan(m, current, true)
+	for _, step := range destroy.Steps {
+		if step.Kind == Kind_Volume || step.Name == "worker-tool" {
+			t.Errorf("destroy plan should not contain %s", step)
+		}
+	}
+	if len(destroy.Steps) != 5 {
+		t.Errorf("expected 5 destroy steps, got %v", destroy.Steps)
+	}
+}
@@ -22,17 +22,53 @@ package os
 
 import (
 	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"io"
 	"os"
 	"os/exec"
-	"path"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/klauspost/compress/zstd"
 	log "github.com/sirupsen/logrus"
 )
 
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ExtractTar unpacks a tar archive, which may be gzip or zstd compressed,
+// into localFolder. File modes and modification times are preserved.
+// Entries, symlinks and hard links that would resolve outside localFolder
+// are rejected.
 func ExtractTar(tarArchive io.ReadCloser, localFolder string) error {
-	tr := tar.NewReader(tarArchive)
+	r, closeFn, err := decompress(tarArchive)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	root, err := filepath.Abs(localFolder)
+	if err != nil {
+		return errors.New("resolving extraction root", err)
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return errors.New("making extraction root", err)
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return errors.New("resolving extraction root", err)
+	}
+
+	// directory modes and mtimes are applied last, so that read-only
+	// directories can still be filled and their mtimes aren't bumped
+	var dirs []*tar.Header
+
+	tr := tar.NewReader(r)
 	for {
 		hdr, err := tr.Next()
 		if err == io.EOF {
@@ -40,44 +76,226 @@ func ExtractTar(tarArchive io.ReadCloser, localFolder string) error {
 			break
 		}
 		if err != nil {
-			return err
+			return errors.New("reading tar archive", err)
 		}
 		log.WithField("file", hdr.Name).Debug("Extracting file")
+
+		target, err := extractPath(root, hdr.Name)
+		if err != nil {
+			return err
+		}
+		if target == root {
+			continue
+		}
+		if err := mkdirInside(root, filepath.Dir(target)); err != nil {
+			return err
+		}
+
 		switch hdr.Typeflag {
 		case tar.TypeDir:
-			err = os.MkdirAll(path.Join(localFolder, hdr.Name), 0755)
+			if err := mkdirInside(root, target); err != nil {
+				return err
+			}
+			dirs = append(dirs, hdr)
 
-			if err != nil {
+		case tar.TypeReg, tar.TypeRegA:
+			if err := removeExisting(target); err != nil {
 				return err
 			}
+			outputFile, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, hdr.FileInfo().Mode().Perm())
+			if err != nil {
+				return errors.New("creating output file", err)
+			}
+			if _, err := io.Copy(outputFile, tr); err != nil {
+				outputFile.Close()
+				return errors.New("writing output file", err)
+			}
+			outputFile.Close()
+			// the umask applies on create, set the exact mode afterwards
+			if err := os.Chmod(target, hdr.FileInfo().Mode().Perm()); err != nil {
+				return errors.New("setting mode of "+hdr.Name, err)
+			}
+			if err := os.Chtimes(target, hdr.ModTime, hdr.ModTime); err != nil {
+				return errors.New("setting mtime of "+hdr.Name, err)
+			}
 
-		case tar.TypeReg:
-			fallthrough
-		case tar.TypeRegA:
-			dir, _ := path.Split(hdr.Name)
-			if err := os.MkdirAll(path.Join(localFolder, dir), 0755); err != nil {
+		case tar.TypeSymlink:
+			if filepath.IsAbs(hdr.Linkname) {
+				return errors.New("symlink "+hdr.Name+" points to absolute path "+hdr.Linkname, nil)
+			}
+			if err := checkLinkInside(root, filepath.Dir(target), hdr.Linkname); err != nil {
+				return errors.New("symlink "+hdr.Name+" points outside of the archive root", err)
+			}
+			if err := removeExisting(target); err != nil {
 				return err
 			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return errors.New("creating symlink "+hdr.Name, err)
+			}
 
-			outputFile, err := os.Create(path.Join(localFolder, hdr.Name))
+		case tar.TypeLink:
+			source, err := extractPath(root, hdr.Linkname)
 			if err != nil {
 				return err
 			}
-
-			if _, err := io.Copy(outputFile, tr); err != nil {
-				outputFile.Close()
+			if err := checkResolvesInside(root, filepath.Dir(source)); err != nil {
 				return err
 			}
-			outputFile.Close()
+			if err := removeExisting(target); err != nil {
+				return err
+			}
+			if err := os.Link(source, target); err != nil {
+				return errors.New("creating hard link "+hdr.Name, err)
+			}
 
 		default:
-			continue
+			log.WithField("file", hdr.Name).Debugf("skipping unsupported tar entry type %v", hdr.Typeflag)
+		}
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		target, _ := extractPath(root, dirs[i].Name)
+		if err := os.Chmod(target, dirs[i].FileInfo().Mode().Perm()); err != nil {
+			return errors.New("setting mode of "+dirs[i].Name, err)
 		}
+		if err := os.Chtimes(target, time.Now(), dirs[i].ModTime); err != nil {
+			return errors.New("setting mtime of "+dirs[i].Name, err)
+		}
+	}
+
+	return nil
+}
+
+// decompress detects gzip and zstd compressed archives by their magic
+// bytes.
+func decompress(archive io.Reader) (io.Reader, func() error, error) {
+	br := bufio.NewReader(archive)
+	magic, _ := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, errors.New("reading gzip stream", err)
+		}
+		return gz, gz.Close, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, nil, errors.New("reading zstd stream", err)
+		}
+		return zr, func() error {
+			zr.Close()
+			return nil
+		}, nil
+	}
+	return br, func() error { return nil }, nil
+}
+
+// extractPath returns where the entry name lands below root, failing if
+// it would land outside of it.
+func extractPath(root, name string) (string, error) {
+	target := filepath.Join(root, filepath.FromSlash(name))
+	if !isInside(root, target) {
+		return "", errors.New("tar entry "+name+" points outside of the archive root", nil)
+	}
+	return target, nil
+}
+
+func isInside(root, path string) bool {
+	rel, err := filepath.Rel(root, filepath.Clean(path))
+	if err != nil {
+		return false
 	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// checkResolvesInside guards against entries reaching outside of root
+// through symlinks extracted earlier.
+func checkResolvesInside(root, dir string) error {
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return errors.New("resolving "+dir, err)
+	}
+	if !isInside(root, resolved) {
+		return errors.New(dir+" resolves outside of the archive root", nil)
+	}
+	return nil
+}
 
+// checkLinkInside follows the symlink target linkname from dir one
+// component at a time, the way the kernel would. Links already on disk
+// are resolved before a ".." is applied, and ".." is only allowed on an
+// existing directory, which later entries can't turn into a symlink.
+func checkLinkInside(root, dir, linkname string) error {
+	cur, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return errors.New("resolving "+dir, err)
+	}
+	exists := true
+	for _, part := range strings.Split(filepath.ToSlash(linkname), "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if !exists {
+				return errors.New(".. follows "+cur+", which does not exist yet", nil)
+			}
+			cur = filepath.Dir(cur)
+		default:
+			cur = filepath.Join(cur, part)
+			if !exists {
+				continue
+			}
+			resolved, err := filepath.EvalSymlinks(cur)
+			switch {
+			case err == nil:
+				cur = resolved
+			case os.IsNotExist(err):
+				exists = false
+			default:
+				return errors.New("resolving "+cur, err)
+			}
+		}
+		if !isInside(root, cur) {
+			return errors.New(linkname+" leaves the archive root at "+cur, nil)
+		}
+	}
 	return nil
 }
 
+func mkdirInside(root, dir string) error {
+	existing := dir
+	for {
+		if _, err := os.Lstat(existing); err == nil || existing == root {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	if err := checkResolvesInside(root, existing); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.New("making folder", err)
+	}
+	return checkResolvesInside(root, dir)
+}
+
+// removeExisting removes whatever is at path so it is replaced rather
+// than written through, e.g. when it is a symlink.
+func removeExisting(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.New("statting "+path, err)
+	}
+	if info.IsDir() {
+		return errors.New(path+" already exists as a directory", nil)
+	}
+	return os.Remove(path)
+}
+
 func Compress(source, destination string) error {
 	tarCmd := exec.Command("tar", "cf", destination, "-C", source, ".")
 	if out, err := tarCmd.Output(); err != nil {
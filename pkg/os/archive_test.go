@@ -0,0 +1,159 @@
+package os
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type tarEntry struct {
+	hdr  tar.Header
+	body string
+}
+
+func makeTar(t *testing.T, entries []tarEntry) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := e.hdr
+		hdr.Size = int64(len(e.body))
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func extract(t *testing.T, data []byte) (string, error) {
+	dir, err := ioutil.TempDir("", "extract-tar-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(dir, "root")
+	return root, ExtractTar(ioutil.NopCloser(bytes.NewReader(data)), root)
+}
+
+func TestExtractTar(t *testing.T) {
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	data := makeTar(t, []tarEntry{
+		{hdr: tar.Header{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: mtime}},
+		{hdr: tar.Header{Name: "bin/build.sh", Typeflag: tar.TypeReg, Mode: 0755, ModTime: mtime}, body: "#!/bin/sh\n"},
+		{hdr: tar.Header{Name: "bin/run.sh", Typeflag: tar.TypeSymlink, Linkname: "build.sh"}},
+		{hdr: tar.Header{Name: "bin/copy.sh", Typeflag: tar.TypeLink, Linkname: "bin/build.sh"}},
+	})
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(data)
+	w.Close()
+
+	root, err := extract(t, gz.Bytes())
+	defer os.RemoveAll(filepath.Dir(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(root, "bin", "build.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("expected mode 0755, got %v", info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("expected mtime %v, got %v", mtime, info.ModTime())
+	}
+	if link, err := os.Readlink(filepath.Join(root, "bin", "run.sh")); err != nil || link != "build.sh" {
+		t.Errorf("expected symlink to build.sh, got %q (%v)", link, err)
+	}
+	if body, err := ioutil.ReadFile(filepath.Join(root, "bin", "copy.sh")); err != nil || string(body) != "#!/bin/sh\n" {
+		t.Errorf("expected hard link contents, got %q (%v)", body, err)
+	}
+}
+
+func TestExtractTarZstd(t *testing.T) {
+	data := makeTar(t, []tarEntry{
+		{hdr: tar.Header{Name: "main.go", Typeflag: tar.TypeReg, Mode: 0644}, body: "package main\n"},
+	})
+
+	var zs bytes.Buffer
+	w, err := zstd.NewWriter(&zs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	w.Close()
+
+	root, err := extract(t, zs.Bytes())
+	defer os.RemoveAll(filepath.Dir(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, err := ioutil.ReadFile(filepath.Join(root, "main.go")); err != nil || string(body) != "package main\n" {
+		t.Errorf("expected main.go contents, got %q (%v)", body, err)
+	}
+}
+
+func TestExtractTarRejectsEscapes(t *testing.T) {
+	for name, entries := range map[string][]tarEntry{
+		"parent path": {
+			{hdr: tar.Header{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0644}, body: "x"},
+		},
+		"absolute symlink": {
+			{hdr: tar.Header{Name: "etc", Typeflag: tar.TypeSymlink, Linkname: "/etc"}},
+		},
+		"relative symlink": {
+			{hdr: tar.Header{Name: "up", Typeflag: tar.TypeSymlink, Linkname: "../.."}},
+		},
+		"chained symlink": {
+			{hdr: tar.Header{Name: "d/", Typeflag: tar.TypeDir, Mode: 0755}},
+			{hdr: tar.Header{Name: "d/l", Typeflag: tar.TypeSymlink, Linkname: ".."}},
+			{hdr: tar.Header{Name: "s", Typeflag: tar.TypeSymlink, Linkname: "d/l/.."}},
+		},
+		"symlink through a later symlink": {
+			{hdr: tar.Header{Name: "s", Typeflag: tar.TypeSymlink, Linkname: "x/.."}},
+			{hdr: tar.Header{Name: "x", Typeflag: tar.TypeSymlink, Linkname: "."}},
+		},
+		"hard link": {
+			{hdr: tar.Header{Name: "passwd", Typeflag: tar.TypeLink, Linkname: "../../etc/passwd"}},
+		},
+	} {
+		root, err := extract(t, makeTar(t, entries))
+		os.RemoveAll(filepath.Dir(root))
+		if err == nil {
+			t.Errorf("%s: expected extraction to fail", name)
+		}
+	}
+}
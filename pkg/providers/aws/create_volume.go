@@ -27,12 +27,13 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
-	"github.com/sirupsen/logrus"
 )
 
 func (p *AwsProvider) CreateVolume(params types.CreateVolumeParams) (*types.Volume, error) {
-	logrus.WithField("raw-image", params.ImagePath).WithField("az", p.config.Zone).Infof("creating data volume from raw image")
+	logger := kutil.LogEntry(params.Logger)
+	logger.WithField("raw-image", params.ImagePath).WithField("az", p.config.Zone).Infof("creating data volume from raw image")
 	s3svc := p.newS3()
 	ec2svc := p.newEC2()
 	imageFile, err := os.Stat(params.ImagePath)
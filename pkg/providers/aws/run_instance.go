@@ -29,12 +29,14 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/bhojpur/kernel/pkg/providers/common"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
 	"github.com/sirupsen/logrus"
 )
 
 func (p *AwsProvider) RunInstance(params types.RunInstanceParams) (_ *types.Instance, err error) {
-	logrus.WithFields(logrus.Fields{
+	logger := kutil.LogEntry(params.Logger)
+	logger.WithFields(logrus.Fields{
 		"image-id": params.ImageId,
 		"mounts":   params.MntPointsToVolumeIds,
 		"env":      params.Env,
@@ -45,13 +47,13 @@ func (p *AwsProvider) RunInstance(params types.RunInstanceParams) (_ *types.Inst
 
 	defer func() {
 		if err != nil {
-			logrus.WithError(err).Errorf("aws running instance encountered an error")
+			logger.WithError(err).Errorf("aws running instance encountered an error")
 			if instanceId != "" {
 				if params.NoCleanup {
-					logrus.Warnf("because --no-cleanup flag was provided, not cleaning up failed instance %s0", instanceId)
+					logger.Warnf("because --no-cleanup flag was provided, not cleaning up failed instance %s0", instanceId)
 					return
 				}
-				logrus.Warnf("cleaning up instance %s", instanceId)
+				logger.Warnf("cleaning up instance %s", instanceId)
 				terminateInstanceInput := &ec2.TerminateInstancesInput{
 					InstanceIds: []*string{aws.String(instanceId)},
 				}
@@ -60,7 +62,7 @@ func (p *AwsProvider) RunInstance(params types.RunInstanceParams) (_ *types.Inst
 					delete(instances, instanceId)
 					return nil
 				}); cleanupErr != nil {
-					logrus.Error(errors.New("modifying instance map in state", cleanupErr))
+					logger.Error(errors.New("modifying instance map in state", cleanupErr))
 				}
 			}
 		}
@@ -91,7 +93,7 @@ func (p *AwsProvider) RunInstance(params types.RunInstanceParams) (_ *types.Inst
 		return nil, errors.New("could not find instance type for specified memory", err)
 	}
 
-	logrus.Debugf("determined intstance type %s for memory requirement %v", instanceType, params.InstanceMemory)
+	logger.Debugf("determined intstance type %s for memory requirement %v", instanceType, params.InstanceMemory)
 
 	runInstanceInput := &ec2.RunInstancesInput{
 		ImageId:  aws.String(image.Id),
@@ -109,13 +111,13 @@ func (p *AwsProvider) RunInstance(params types.RunInstanceParams) (_ *types.Inst
 		return nil, errors.New("failed to run instance", err)
 	}
 	if len(runInstanceOutput.Instances) < 1 {
-		logrus.WithFields(logrus.Fields{"output": runInstanceOutput}).Errorf("run instance %s failed, produced %v instances, expected 1", params.Name, len(runInstanceOutput.Instances))
+		logger.WithFields(logrus.Fields{"output": runInstanceOutput}).Errorf("run instance %s failed, produced %v instances, expected 1", params.Name, len(runInstanceOutput.Instances))
 		return nil, errors.New("expected 1 instance to be created", nil)
 	}
 	instanceId = *runInstanceOutput.Instances[0].InstanceId
 
 	if len(runInstanceOutput.Instances) > 1 {
-		logrus.WithFields(logrus.Fields{"output": runInstanceOutput}).Errorf("run instance %s failed, produced %v instances, expected 1", params.Name, len(runInstanceOutput.Instances))
+		logger.WithFields(logrus.Fields{"output": runInstanceOutput}).Errorf("run instance %s failed, produced %v instances, expected 1", params.Name, len(runInstanceOutput.Instances))
 		return nil, errors.New("expected 1 instance to be created", nil)
 	}
 
@@ -137,11 +139,11 @@ func (p *AwsProvider) RunInstance(params types.RunInstanceParams) (_ *types.Inst
 	}
 
 	if len(params.MntPointsToVolumeIds) > 0 {
-		logrus.Debugf("stopping instance for volume attach")
+		logger.Debugf("stopping instance for volume attach")
 		waitParam := &ec2.DescribeInstancesInput{
 			InstanceIds: []*string{aws.String(instanceId)},
 		}
-		logrus.Debugf("waiting for instance to reach running state")
+		logger.Debugf("waiting for instance to reach running state")
 		if err := ec2svc.WaitUntilInstanceRunning(waitParam); err != nil {
 			return nil, errors.New("waiting for instance to reach running state", err)
 		}
@@ -149,7 +151,7 @@ func (p *AwsProvider) RunInstance(params types.RunInstanceParams) (_ *types.Inst
 			return nil, errors.New("failed to stop instance for attaching volumes", err)
 		}
 		for mountPoint, volumeId := range params.MntPointsToVolumeIds {
-			logrus.WithFields(logrus.Fields{"volume-id": volumeId}).Debugf("attaching volume %s to intance %s", volumeId, instanceId)
+			logger.WithFields(logrus.Fields{"volume-id": volumeId}).Debugf("attaching volume %s to intance %s", volumeId, instanceId)
 			if err := p.AttachVolume(volumeId, instanceId, mountPoint); err != nil {
 				return nil, errors.New("attaching volume to instance", err)
 			}
@@ -175,7 +177,7 @@ func (p *AwsProvider) RunInstance(params types.RunInstanceParams) (_ *types.Inst
 		return nil, errors.New("tagging snapshot, image, and volume", err)
 	}
 
-	logrus.WithFields(logrus.Fields{"instance": instance}).Infof("instance created succesfully")
+	logger.WithFields(logrus.Fields{"instance": instance}).Infof("instance created succesfully")
 
 	return instance, nil
 }
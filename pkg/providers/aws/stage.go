@@ -29,6 +29,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/bhojpur/kernel/pkg/providers/common"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -47,6 +48,7 @@ var kernelIdMap = map[string]string{
 }
 
 func (p *AwsProvider) Stage(params types.StageImageParams) (_ *types.Image, err error) {
+	logger := kutil.LogEntry(params.Logger)
 	images, err := p.ListImages()
 	if err != nil {
 		return nil, errors.New("retrieving image list for existing image", err)
@@ -57,7 +59,7 @@ func (p *AwsProvider) Stage(params types.StageImageParams) (_ *types.Image, err
 			if !params.Force {
 				return nil, errors.New("an image already exists with name '"+params.Name+"', try again with --force", nil)
 			} else {
-				logrus.WithField("image", image).Warnf("force: deleting previous image with name " + params.Name)
+				logger.WithField("image", image).Warnf("force: deleting previous image with name " + params.Name)
 				err = p.DeleteImage(image.Id, true)
 				if err != nil {
 					return nil, errors.New("removing previously existing image", err)
@@ -71,19 +73,19 @@ func (p *AwsProvider) Stage(params types.StageImageParams) (_ *types.Image, err
 	ec2svc := p.newEC2()
 	defer func() {
 		if err != nil {
-			logrus.WithError(err).Errorf("aws staging encountered an error")
+			logger.WithError(err).Errorf("aws staging encountered an error")
 			if snapshotId != "" {
-				logrus.Warnf("cleaning up snapshot %s", snapshotId)
+				logger.Warnf("cleaning up snapshot %s", snapshotId)
 				deleteSnapshot(ec2svc, snapshotId)
 			}
 			if volumeId != "" {
-				logrus.Warnf("cleaning up volume %s", volumeId)
+				logger.Warnf("cleaning up volume %s", volumeId)
 				deleteVolume(ec2svc, volumeId)
 			}
 		}
 	}()
 
-	logrus.WithField("raw-image", params.RawImage).WithField("az", p.config.Zone).Infof("creating boot volume from raw image")
+	logger.WithField("raw-image", params.RawImage).WithField("az", p.config.Zone).Infof("creating boot volume from raw image")
 
 	rawImageFile, err := os.Stat(params.RawImage.LocalImagePath)
 	if err != nil {
@@ -100,14 +102,14 @@ func (p *AwsProvider) Stage(params types.StageImageParams) (_ *types.Image, err
 		}
 		defer os.Remove(rawImage.Name())
 		//vpc indicates VHD image type to qemu-img
-		if err := common.ConvertRawImage(types.ImageFormat_QCOW2, types.ImageFormat_VHD, params.RawImage.LocalImagePath, rawImage.Name()); err != nil {
+		if err := common.ConvertRawImage(types.ImageFormat_QCOW2, types.ImageFormat_VHD, params.RawImage.LocalImagePath, rawImage.Name(), params.Containers); err != nil {
 			return nil, errors.New("converting qcow2 to vhd image", err)
 		}
 		os.Remove(params.RawImage.LocalImagePath)
 		//point at the new image
 		params.RawImage.LocalImagePath = rawImage.Name()
 		params.RawImage.StageSpec.ImageFormat = types.ImageFormat_VHD
-		imageSize, err = common.GetVirtualImageSize(params.RawImage.LocalImagePath, params.RawImage.StageSpec.ImageFormat)
+		imageSize, err = common.GetVirtualImageSize(params.RawImage.LocalImagePath, params.RawImage.StageSpec.ImageFormat, params.Containers)
 		if err != nil {
 			return nil, errors.New("getting virtual image size", err)
 		}
@@ -118,7 +120,7 @@ func (p *AwsProvider) Stage(params types.StageImageParams) (_ *types.Image, err
 		return nil, errors.New("creating aws boot volume", err)
 	}
 
-	logrus.WithField("volume-id", volumeId).Infof("creating snapshot from boot volume")
+	logger.WithField("volume-id", volumeId).Infof("creating snapshot from boot volume")
 	createSnasphotInput := &ec2.CreateSnapshotInput{
 		Description: aws.String("snapshot for unikernel image " + params.Name),
 		VolumeId:    aws.String(volumeId),
@@ -162,7 +164,7 @@ func (p *AwsProvider) Stage(params types.StageImageParams) (_ *types.Image, err
 		kernelId = nil //no kernel id for HVM
 	}
 
-	logrus.WithFields(logrus.Fields{
+	logger.WithFields(logrus.Fields{
 		"name":                  params.Name,
 		"architecture":          architecture,
 		"virtualization-type":   params.RawImage.StageSpec.XenVirtualizationType,
@@ -187,7 +189,7 @@ func (p *AwsProvider) Stage(params types.StageImageParams) (_ *types.Image, err
 
 	imageId := *registerImageOutput.ImageId
 
-	logrus.WithField("volume-id", volumeId).Infof("tagging image, snapshot, and volume with unikernel id")
+	logger.WithField("volume-id", volumeId).Infof("tagging image, snapshot, and volume with unikernel id")
 	tagObjects := &ec2.CreateTagsInput{
 		Resources: []*string{
 			aws.String(imageId),
@@ -228,6 +230,6 @@ func (p *AwsProvider) Stage(params types.StageImageParams) (_ *types.Image, err
 		return nil, errors.New("modifying image map in state", err)
 	}
 
-	logrus.WithFields(logrus.Fields{"image": image}).Infof("image created succesfully")
+	logger.WithFields(logrus.Fields{"image": image}).Infof("image created succesfully")
 	return image, nil
 }
@@ -28,10 +28,11 @@ import (
 	"github.com/bhojpur/kernel/cmd/listener/bindata"
 	"github.com/bhojpur/kernel/pkg/compilers/rump"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
 )
 
-func CompileInstanceListener(sourceDir, instanceListenerPrefix, dockerImage string, createImageFunc func(kernel, args string, mntPoints, bakedEnv []string, noCleanup bool) (*types.RawImage, error), enablePersistence bool) (*types.RawImage, error) {
+func CompileInstanceListener(sourceDir, instanceListenerPrefix, dockerImage string, createImageFunc func(kernel, args string, mntPoints, bakedEnv []string, noCleanup bool, group *kutil.ContainerGroup) (*types.RawImage, error), enablePersistence bool) (*types.RawImage, error) {
 	mainData, err := bindata.Asset("instance-listener/main.go")
 	if err != nil {
 		return nil, errors.New("reading binary data of instance listener main", err)
@@ -0,0 +1,183 @@
+package common
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/bhojpur/kernel/pkg/util/errors"
+)
+
+// consoleBacklog is how many chunks of output an attached client may fall
+// behind before further output to it is dropped. A slow client must not
+// hold up the guest or the instance log.
+const consoleBacklog = 256
+
+// Console fans the serial output of an instance out to any attached
+// clients and forwards their input to the serial port. Providers write
+// the guest output to it next to the instance log.
+type Console struct {
+	input     io.Writer
+	inputLock sync.Mutex
+
+	lock     sync.Mutex
+	sessions map[*consoleSession]bool
+	closed   bool
+}
+
+// NewConsole returns a console that forwards client input to input.
+func NewConsole(input io.Writer) *Console {
+	return &Console{
+		input:    input,
+		sessions: map[*consoleSession]bool{},
+	}
+}
+
+// Write passes guest output to every attached client. It never fails and
+// never blocks on a client.
+func (c *Console) Write(p []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for session := range c.sessions {
+		chunk := make([]byte, len(p))
+		copy(chunk, p)
+		select {
+		case session.output <- chunk:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// Attach connects a client to the console. Reads return guest output from
+// the time of attaching on, writes are typed into the guest. Closing the
+// session detaches the client; reads return io.EOF once the console is
+// closed.
+func (c *Console) Attach() (io.ReadWriteCloser, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return nil, errors.New("console is closed", nil)
+	}
+	session := &consoleSession{
+		console: c,
+		output:  make(chan []byte, consoleBacklog),
+		done:    make(chan struct{}),
+	}
+	c.sessions[session] = true
+	return session, nil
+}
+
+// Close detaches all clients, for when the instance has exited.
+func (c *Console) Close() {
+	c.lock.Lock()
+	sessions := c.sessions
+	c.sessions = map[*consoleSession]bool{}
+	c.closed = true
+	c.lock.Unlock()
+	for session := range sessions {
+		session.close()
+	}
+}
+
+type consoleSession struct {
+	console   *Console
+	output    chan []byte
+	pending   []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (s *consoleSession) Read(p []byte) (int, error) {
+	if len(s.pending) == 0 {
+		select {
+		case s.pending = <-s.output:
+		case <-s.done:
+			// hand out what was written before the console closed
+			select {
+			case s.pending = <-s.output:
+			default:
+				return 0, io.EOF
+			}
+		}
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+func (s *consoleSession) Write(p []byte) (int, error) {
+	select {
+	case <-s.done:
+		return 0, io.ErrClosedPipe
+	default:
+	}
+	s.console.inputLock.Lock()
+	defer s.console.inputLock.Unlock()
+	return s.console.input.Write(p)
+}
+
+func (s *consoleSession) Close() error {
+	s.console.lock.Lock()
+	delete(s.console.sessions, s)
+	s.console.lock.Unlock()
+	s.close()
+	return nil
+}
+
+func (s *consoleSession) close() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+// ProcessConsole is the console of a hypervisor process that connects the
+// guest's serial port to its stdin and stdout. Stdin is handed to the
+// process; the guest output written to the console must be its stdout.
+type ProcessConsole struct {
+	*Console
+	Stdin *os.File
+	input *os.File
+}
+
+func NewProcessConsole() (*ProcessConsole, error) {
+	stdin, input, err := os.Pipe()
+	if err != nil {
+		return nil, errors.New("creating console pipe", err)
+	}
+	return &ProcessConsole{
+		Console: NewConsole(input),
+		Stdin:   stdin,
+		input:   input,
+	}, nil
+}
+
+// Started releases the daemon's copy of Stdin once the process holds its
+// own.
+func (c *ProcessConsole) Started() {
+	c.Stdin.Close()
+}
+
+func (c *ProcessConsole) Close() {
+	c.Console.Close()
+	c.Stdin.Close()
+	c.input.Close()
+}
@@ -40,3 +40,18 @@ func GetInstance(p providers.Provider, nameOrIdPrefix string) (*types.Instance,
 	}
 	return nil, errors.New("instance with name or id containing '"+nameOrIdPrefix+"' not found", nil)
 }
+
+// FindInstanceByName returns the instance named exactly name, or nil if
+// the provider has none.
+func FindInstanceByName(p providers.Provider, name string) (*types.Instance, error) {
+	instances, err := p.ListInstances()
+	if err != nil {
+		return nil, errors.New("retrieving instance list", err)
+	}
+	for _, instance := range instances {
+		if instance.Name == name {
+			return instance, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,62 @@
+package common
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strings"
+
+	"github.com/bhojpur/kernel/pkg/providers"
+	"github.com/bhojpur/kernel/pkg/types"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+)
+
+// GetSnapshot finds the snapshot with the given id or name, or else the
+// only one whose id or name starts with nameOrIdPrefix. Snapshots are
+// deleted and restored through it, so a prefix shared by several of them
+// is an error rather than a guess.
+func GetSnapshot(p providers.InstanceSnapshotter, nameOrIdPrefix string) (*types.Snapshot, error) {
+	snapshots, err := p.ListSnapshots()
+	if err != nil {
+		return nil, errors.New("retrieving snapshot list", err)
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.Id == nameOrIdPrefix || snapshot.Name == nameOrIdPrefix {
+			return snapshot, nil
+		}
+	}
+	var matches []*types.Snapshot
+	for _, snapshot := range snapshots {
+		if strings.HasPrefix(snapshot.Id, nameOrIdPrefix) || strings.HasPrefix(snapshot.Name, nameOrIdPrefix) {
+			matches = append(matches, snapshot)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, errors.New("snapshot with name or id starting with '"+nameOrIdPrefix+"' not found", nil)
+	case 1:
+		return matches[0], nil
+	}
+	var names []string
+	for _, snapshot := range matches {
+		names = append(names, snapshot.Name)
+	}
+	return nil, errors.New("snapshot '"+nameOrIdPrefix+"' is ambiguous, it matches "+strings.Join(names, ", "), nil)
+}
@@ -0,0 +1,76 @@
+package common
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+
+	"github.com/bhojpur/kernel/pkg/types"
+)
+
+type fakeSnapshotter struct {
+	snapshots []*types.Snapshot
+}
+
+func (f *fakeSnapshotter) SnapshotInstance(types.SnapshotInstanceParams) (*types.Snapshot, error) {
+	return nil, nil
+}
+
+func (f *fakeSnapshotter) RestoreSnapshot(types.RestoreSnapshotParams) (*types.Instance, error) {
+	return nil, nil
+}
+
+func (f *fakeSnapshotter) ListSnapshots() ([]*types.Snapshot, error) {
+	return f.snapshots, nil
+}
+
+func (f *fakeSnapshotter) DeleteSnapshot(string) error {
+	return nil
+}
+
+func TestGetSnapshot(t *testing.T) {
+	p := &fakeSnapshotter{snapshots: []*types.Snapshot{
+		{Id: "a1", Name: "web-1700000000"},
+		{Id: "b2", Name: "web"},
+		{Id: "c3", Name: "myweb-1700000000"},
+		{Id: "d4", Name: "db-1700000000"},
+	}}
+	for query, want := range map[string]string{
+		"web": "b2",
+		"a1":  "a1",
+		"db":  "d4",
+		"myw": "c3",
+	} {
+		snapshot, err := GetSnapshot(p, query)
+		if err != nil {
+			t.Errorf("%s: %v", query, err)
+			continue
+		}
+		if snapshot.Id != want {
+			t.Errorf("%s found %s, want %s", query, snapshot.Id, want)
+		}
+	}
+	for _, query := range []string{"we", "eb", "nope"} {
+		if snapshot, err := GetSnapshot(p, query); err == nil {
+			t.Errorf("%s should not resolve, found %s", query, snapshot.Id)
+		}
+	}
+}
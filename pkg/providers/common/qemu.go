@@ -35,7 +35,7 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func ConvertRawImage(sourceFormat, targetFormat types.ImageFormat, inputFile, outputFile string) error {
+func ConvertRawImage(sourceFormat, targetFormat types.ImageFormat, inputFile, outputFile string, containers *kutil.ContainerGroup) error {
 	targetFormatName := string(targetFormat)
 	if targetFormat == types.ImageFormat_VHD {
 		targetFormatName = "vpc" //for some reason qemu calls VHD disks vpc
@@ -44,7 +44,7 @@ func ConvertRawImage(sourceFormat, targetFormat types.ImageFormat, inputFile, ou
 	outDir := filepath.Dir(outputFile)
 
 	container := kutil.NewContainer("qemu-util").WithVolume(dir, "/bhojpur/input").
-		WithVolume(outDir, "/bhojpur/output")
+		WithVolume(outDir, "/bhojpur/output").InGroup(containers)
 
 	args := []string{"qemu-img", "convert", "-f", string(sourceFormat), "-O", targetFormatName}
 	if targetFormat == types.ImageFormat_VMDK {
@@ -105,13 +105,13 @@ func fixVmdk(vmdkFile string) error {
 	return nil
 }
 
-func ConvertRawToNewVmdk(inputFile, outputFile string) error {
+func ConvertRawToNewVmdk(inputFile, outputFile string, containers *kutil.ContainerGroup) error {
 
 	dir := filepath.Dir(inputFile)
 	outDir := filepath.Dir(outputFile)
 
 	container := kutil.NewContainer("euranova/ubuntu-vbox").WithVolume(dir, dir).
-		WithVolume(outDir, outDir)
+		WithVolume(outDir, outDir).InGroup(containers)
 
 	args := []string{
 		"VBoxManage", "convertfromraw", inputFile, outputFile, "--format", "vmdk", "--variant", "Stream"}
@@ -129,14 +129,14 @@ func ConvertRawToNewVmdk(inputFile, outputFile string) error {
 	return nil
 }
 
-func GetVirtualImageSize(imageFile string, imageFormat types.ImageFormat) (int64, error) {
+func GetVirtualImageSize(imageFile string, imageFormat types.ImageFormat, containers *kutil.ContainerGroup) (int64, error) {
 	formatName := string(imageFormat)
 	if imageFormat == types.ImageFormat_VHD {
 		formatName = "vpc" //for some reason qemu calls VHD disks vpc
 	}
 	dir := filepath.Dir(imageFile)
 
-	container := kutil.NewContainer("qemu-util").WithVolume(dir, dir)
+	container := kutil.NewContainer("qemu-util").WithVolume(dir, dir).InGroup(containers)
 	args := []string{"qemu-img", "info", "--output", "json", "-f", formatName, imageFile}
 
 	logrus.WithField("command", args).Debugf("running command")
@@ -26,29 +26,30 @@ import (
 	"time"
 
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
-	"github.com/sirupsen/logrus"
 )
 
 func (p *FirecrackerProvider) CreateVolume(params types.CreateVolumeParams) (_ *types.Volume, err error) {
+	logger := kutil.LogEntry(params.Logger)
 	if _, volumeErr := p.GetImage(params.Name); volumeErr == nil {
 		return nil, errors.New("volume already exists", nil)
 	}
 
-	volumePath := getVolumePath(params.Name)
+	volumePath := p.getVolumePath(params.Name)
 	if err := os.MkdirAll(filepath.Dir(volumePath), 0755); err != nil {
 		return nil, errors.New("creating directory for volume file", err)
 	}
 	defer func() {
 		if err != nil {
 			if params.NoCleanup {
-				logrus.Warnf("because --no-cleanup flag was provided, not cleaning up failed volume %s at %s", params.Name, volumePath)
+				logger.Warnf("because --no-cleanup flag was provided, not cleaning up failed volume %s at %s", params.Name, volumePath)
 			} else {
 				os.RemoveAll(filepath.Dir(volumePath))
 			}
 		}
 	}()
-	logrus.WithField("raw-image", params.ImagePath).Infof("creating volume from raw image")
+	logger.WithField("raw-image", params.ImagePath).Infof("creating volume from raw image")
 
 	rawImageFile, err := os.Stat(params.ImagePath)
 	if err != nil {
@@ -20,8 +20,19 @@ package firecracker
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
-import "github.com/bhojpur/kernel/pkg/util/errors"
+import (
+	"github.com/bhojpur/kernel/pkg/util"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+)
 
 func (p *FirecrackerProvider) GetInstanceLogs(id string) (string, error) {
-	return "", errors.New("not supported", nil)
+	instance, err := p.GetInstance(id)
+	if err != nil {
+		return "", errors.New("retrieving instance "+id, err)
+	}
+	logs, err := util.ReadRotatingFile(p.getInstanceLogPath(instance.Id))
+	if err != nil {
+		return "", errors.New("reading logs for instance "+instance.Id, err)
+	}
+	return string(logs), nil
 }
@@ -0,0 +1,52 @@
+package firecracker
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/bhojpur/kernel/pkg/util"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+)
+
+// GetInstanceMetrics returns the most recent metrics firecracker flushed
+// for the instance. Firecracker writes one JSON object per line.
+func (p *FirecrackerProvider) GetInstanceMetrics(id string) (map[string]interface{}, error) {
+	instance, err := p.GetInstance(id)
+	if err != nil {
+		return nil, errors.New("retrieving instance "+id, err)
+	}
+	data, err := util.ReadRotatingFile(p.getInstanceMetricsPath(instance.Id))
+	if err != nil {
+		return nil, errors.New("reading metrics for instance "+instance.Id, err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	last := lines[len(lines)-1]
+	if len(last) == 0 {
+		return nil, errors.New("no metrics have been flushed for instance "+instance.Id+" yet", nil)
+	}
+	var metrics map[string]interface{}
+	if err := json.Unmarshal(last, &metrics); err != nil {
+		return nil, errors.New("parsing metrics for instance "+instance.Id, err)
+	}
+	return metrics, nil
+}
@@ -0,0 +1,139 @@
+package firecracker
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	firecrackersdk "github.com/firecracker-microvm/firecracker-go-sdk"
+
+	"github.com/bhojpur/kernel/pkg/util"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// lines written by firecracker itself are prefixed so they can be told
+// apart from the guest console in the instance log
+const vmmLogPrefix = "[firecracker] "
+
+func (p *FirecrackerProvider) getInstanceLogPath(instanceId string) string {
+	return filepath.Join(p.getInstanceDir(instanceId), "instance.log")
+}
+
+func (p *FirecrackerProvider) getInstanceMetricsPath(instanceId string) string {
+	return filepath.Join(p.getInstanceDir(instanceId), "metrics.log")
+}
+
+// instanceLogs are the files the guest console, the firecracker log and
+// the firecracker metrics of a running instance are drained into.
+type instanceLogs struct {
+	log         *util.RotatingFile
+	metrics     *util.RotatingFile
+	metricsFifo *os.File
+	lock        sync.Mutex
+}
+
+func (p *FirecrackerProvider) openInstanceLogs(instanceId string) (*instanceLogs, error) {
+	maxSize := int64(p.config.LogMaxMb) << 20
+	log, err := util.NewRotatingFile(p.getInstanceLogPath(instanceId), maxSize)
+	if err != nil {
+		return nil, errors.New("creating instance log", err)
+	}
+	metrics, err := util.NewRotatingFile(p.getInstanceMetricsPath(instanceId), maxSize)
+	if err != nil {
+		log.Close()
+		return nil, errors.New("creating metrics log", err)
+	}
+	return &instanceLogs{log: log, metrics: metrics}, nil
+}
+
+func (l *instanceLogs) console() io.Writer {
+	return &lineWriter{w: l.log}
+}
+
+func (l *instanceLogs) vmm() io.Writer {
+	return &lineWriter{w: l.log, prefix: vmmLogPrefix}
+}
+
+// captureMetrics returns a handler that starts draining the metrics fifo
+// once the sdk has created it. It must run before firecracker is pointed
+// at the fifo: firecracker opens it non-blocking and fails without a reader.
+func (l *instanceLogs) captureMetrics(path string) firecrackersdk.Handler {
+	return firecrackersdk.Handler{
+		Name: "kernel.CaptureMetrics",
+		Fn: func(ctx context.Context, m *firecrackersdk.Machine) error {
+			// opening read-write keeps the fifo from reporting EOF until
+			// firecracker opens its end; Close stops the copy
+			fifo, err := os.OpenFile(path, os.O_RDWR, 0)
+			if err != nil {
+				return errors.New("opening metrics fifo", err)
+			}
+			l.lock.Lock()
+			l.metricsFifo = fifo
+			l.lock.Unlock()
+			go func() {
+				if _, err := io.Copy(&lineWriter{w: l.metrics}, fifo); err != nil {
+					logrus.WithError(err).Debugf("metrics fifo %s closed", path)
+				}
+			}()
+			return nil
+		},
+	}
+}
+
+func (l *instanceLogs) Close() {
+	l.lock.Lock()
+	if l.metricsFifo != nil {
+		l.metricsFifo.Close()
+	}
+	l.lock.Unlock()
+	l.metrics.Close()
+	l.log.Close()
+}
+
+// lineWriter forwards only complete lines to w, each preceded by prefix,
+// so several writers can share a file without interleaving mid-line.
+type lineWriter struct {
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := append([]byte(l.prefix), l.buf[:i+1]...)
+		if _, err := l.w.Write(line); err != nil {
+			return 0, err
+		}
+		l.buf = l.buf[i+1:]
+	}
+	return len(p), nil
+}
@@ -0,0 +1,247 @@
+package firecracker
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"net"
+
+	firecrackersdk "github.com/firecracker-microvm/firecracker-go-sdk"
+
+	kos "github.com/bhojpur/kernel/pkg/os"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultBridge = "fcbr0"
+
+type ipPool struct {
+	network *net.IPNet
+	gateway net.IP
+	first   uint32
+	last    uint32
+}
+
+func parseIpPool(cidr, gateway string) (*ipPool, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, errors.New("parsing firecracker ip pool "+cidr, err)
+	}
+	if network.IP.To4() == nil {
+		return nil, errors.New("firecracker ip pool "+cidr+" is not an IPv4 network", nil)
+	}
+	ones, bits := network.Mask.Size()
+	if bits-ones < 2 {
+		return nil, errors.New("firecracker ip pool "+cidr+" is too small", nil)
+	}
+	base := ipToUint32(network.IP)
+	pool := &ipPool{
+		network: network,
+		first:   base + 1,
+		last:    base + (1 << uint(bits-ones)) - 2,
+	}
+	if gateway == "" {
+		pool.gateway = uint32ToIp(pool.first)
+	} else {
+		pool.gateway = net.ParseIP(gateway).To4()
+		if pool.gateway == nil || !network.Contains(pool.gateway) {
+			return nil, errors.New("firecracker gateway "+gateway+" is not an address in "+cidr, nil)
+		}
+	}
+	return pool, nil
+}
+
+// next returns the lowest address in the pool that is neither the gateway
+// nor marked as used, along with its offset from the start of the pool.
+func (pool *ipPool) next(used map[string]bool) (net.IP, uint32, error) {
+	for addr := pool.first; addr <= pool.last; addr++ {
+		ip := uint32ToIp(addr)
+		if ip.Equal(pool.gateway) || used[ip.String()] {
+			continue
+		}
+		return ip, addr - pool.first, nil
+	}
+	return nil, 0, errors.New("no free address left in firecracker ip pool "+pool.network.String(), nil)
+}
+
+func ipToUint32(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+func uint32ToIp(addr uint32) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, addr)
+	return ip
+}
+
+func (p *FirecrackerProvider) bridgeName() string {
+	if p.config.Bridge == "" {
+		return defaultBridge
+	}
+	return p.config.Bridge
+}
+
+// allocateNetwork reserves an address from the configured pool and creates
+// a tap device for it on the bridge. The returned release func undoes both.
+func (p *FirecrackerProvider) allocateNetwork() (*firecrackersdk.NetworkInterface, string, func(), error) {
+	pool, err := parseIpPool(p.config.IpPool, p.config.Gateway)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	p.netLock.Lock()
+	defer p.netLock.Unlock()
+
+	ip, offset, err := pool.next(p.usedIps())
+	if err != nil {
+		return nil, "", nil, err
+	}
+	tap, release, err := p.setupTap(pool, ip, offset)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	iface := &firecrackersdk.NetworkInterface{
+		StaticConfiguration: &firecrackersdk.StaticNetworkConfiguration{
+			MacAddress:  fmt.Sprintf("02:FC:%02X:%02X:%02X:%02X", ip[0], ip[1], ip[2], ip[3]),
+			HostDevName: tap,
+			IPConfiguration: &firecrackersdk.IPConfiguration{
+				IPAddr:      net.IPNet{IP: ip, Mask: pool.network.Mask},
+				Gateway:     pool.gateway,
+				Nameservers: p.config.Nameservers,
+				IfName:      "eth0",
+			},
+		},
+	}
+	return iface, ip.String(), release, nil
+}
+
+// reserveNetwork claims a given address of the pool, and recreates the tap
+// device that goes with it, for an instance restored from a snapshot: the
+// guest resumes with the address and tap of the snapshotted instance.
+func (p *FirecrackerProvider) reserveNetwork(address string) (string, func(), error) {
+	pool, err := parseIpPool(p.config.IpPool, p.config.Gateway)
+	if err != nil {
+		return "", nil, err
+	}
+	ip := net.ParseIP(address).To4()
+	if ip == nil || !pool.network.Contains(ip) {
+		return "", nil, errors.New("address "+address+" is not in firecracker ip pool "+pool.network.String(), nil)
+	}
+
+	p.netLock.Lock()
+	defer p.netLock.Unlock()
+
+	if p.usedIps()[ip.String()] {
+		return "", nil, errors.New("address "+address+" is in use by another instance", nil)
+	}
+	return p.setupTap(pool, ip, ipToUint32(ip)-pool.first)
+}
+
+// usedIps must be called with netLock held.
+func (p *FirecrackerProvider) usedIps() map[string]bool {
+	used := map[string]bool{}
+	for ip := range p.reservedIps {
+		used[ip] = true
+	}
+	for _, instance := range p.state.GetInstances() {
+		used[instance.IpAddress] = true
+	}
+	return used
+}
+
+// setupTap must be called with netLock held.
+func (p *FirecrackerProvider) setupTap(pool *ipPool, ip net.IP, offset uint32) (string, func(), error) {
+	if err := p.ensureBridge(pool); err != nil {
+		return "", nil, err
+	}
+
+	tap := p.tapName(offset)
+	if err := createTap(tap, p.bridgeName()); err != nil {
+		return "", nil, err
+	}
+	p.reservedIps[ip.String()] = true
+
+	release := func() {
+		deleteTap(tap)
+		p.netLock.Lock()
+		delete(p.reservedIps, ip.String())
+		p.netLock.Unlock()
+	}
+	return tap, release, nil
+}
+
+// tapName names the tap device of the address at offset in the pool. Pools
+// of different accounts may overlap in offsets, so named accounts add a
+// hash of their name; the name stays within the 15 characters of IFNAMSIZ.
+func (p *FirecrackerProvider) tapName(offset uint32) string {
+	if p.config.Name == "" {
+		return fmt.Sprintf("fc-tap%d", offset)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(p.config.Name))
+	return fmt.Sprintf("fc%04x-%d", h.Sum32()&0xffff, offset)
+}
+
+func (p *FirecrackerProvider) ensureBridge(pool *ipPool) error {
+	bridge := p.bridgeName()
+	if _, err := net.InterfaceByName(bridge); err == nil {
+		return nil
+	}
+	logrus.Infof("creating firecracker bridge %s", bridge)
+	ones, _ := pool.network.Mask.Size()
+	if err := kos.RunLogCommand("ip", "link", "add", "name", bridge, "type", "bridge"); err != nil {
+		return errors.New("creating bridge "+bridge, err)
+	}
+	if err := kos.RunLogCommand("ip", "addr", "add", fmt.Sprintf("%s/%d", pool.gateway, ones), "dev", bridge); err != nil {
+		return errors.New("assigning gateway address to bridge "+bridge, err)
+	}
+	if err := kos.RunLogCommand("ip", "link", "set", bridge, "up"); err != nil {
+		return errors.New("bringing up bridge "+bridge, err)
+	}
+	return nil
+}
+
+func createTap(tap, bridge string) (err error) {
+	if err := kos.RunLogCommand("ip", "tuntap", "add", "dev", tap, "mode", "tap"); err != nil {
+		return errors.New("creating tap device "+tap, err)
+	}
+	defer func() {
+		if err != nil {
+			deleteTap(tap)
+		}
+	}()
+	if err := kos.RunLogCommand("ip", "link", "set", tap, "master", bridge); err != nil {
+		return errors.New("attaching tap device "+tap+" to bridge "+bridge, err)
+	}
+	if err := kos.RunLogCommand("ip", "link", "set", tap, "up"); err != nil {
+		return errors.New("bringing up tap device "+tap, err)
+	}
+	return nil
+}
+
+func deleteTap(tap string) {
+	if err := kos.RunLogCommand("ip", "link", "del", tap); err != nil {
+		logrus.WithError(err).Warnf("failed to delete tap device %s", tap)
+	}
+}
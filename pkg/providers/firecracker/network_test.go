@@ -0,0 +1,44 @@
+package firecracker
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+
+	"github.com/bhojpur/kernel/pkg/config"
+)
+
+func TestTapName(t *testing.T) {
+	def := &FirecrackerProvider{}
+	if tap := def.tapName(3); tap != "fc-tap3" {
+		t.Errorf("default account tap is %s, want fc-tap3", tap)
+	}
+
+	a := &FirecrackerProvider{config: config.Firecracker{Name: "dev"}}
+	b := &FirecrackerProvider{config: config.Firecracker{Name: "prod"}}
+	if a.tapName(3) == b.tapName(3) || a.tapName(3) == def.tapName(3) {
+		t.Errorf("accounts share tap %s", a.tapName(3))
+	}
+	// the largest offset of a /8 pool
+	if tap := a.tapName(1<<24 - 2); len(tap) > 15 {
+		t.Errorf("tap %s is longer than IFNAMSIZ allows", tap)
+	}
+}
@@ -0,0 +1,77 @@
+package firecracker
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/bhojpur/kernel/pkg/providers"
+	"github.com/bhojpur/kernel/pkg/providers/common"
+	"github.com/bhojpur/kernel/pkg/types"
+)
+
+// ObserveResources reports every instance directory as a running or
+// stopped instance, depending on whether its firecracker process is alive,
+// and the image and volume directories on disk.
+func (p *FirecrackerProvider) ObserveResources() (*providers.ObservedResources, error) {
+	observed := &providers.ObservedResources{Instances: map[string]*types.Instance{}}
+
+	instanceNames, err := common.ListDirs(p.instancesDirectory())
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range instanceNames {
+		instance := &types.Instance{
+			Id:             name,
+			Name:           name,
+			State:          types.InstanceState_Stopped,
+			Infrastructure: types.Infrastructure_FIRECRACKER,
+		}
+		if pid, ok := p.readPid(name); ok && syscall.Kill(pid, 0) == nil {
+			instance.State = types.InstanceState_Running
+		}
+		if info, err := os.Stat(p.getInstanceDir(name)); err == nil {
+			instance.Created = info.ModTime()
+		}
+		observed.Instances[name] = instance
+	}
+
+	if observed.Images, err = common.ListDirs(p.imagesDirectory()); err != nil {
+		return nil, err
+	}
+	if observed.Volumes, err = common.ListDirs(p.volumesDirectory()); err != nil {
+		return nil, err
+	}
+	return observed, nil
+}
+
+func (p *FirecrackerProvider) readPid(instanceName string) (int, bool) {
+	data, err := ioutil.ReadFile(p.getPidPath(instanceName))
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid, err == nil && pid > 0
+}
@@ -26,8 +26,10 @@ import (
 	"sync"
 
 	firecrackersdk "github.com/firecracker-microvm/firecracker-go-sdk"
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
 
 	"github.com/bhojpur/kernel/pkg/config"
+	"github.com/bhojpur/kernel/pkg/providers/common"
 	"github.com/bhojpur/kernel/pkg/state"
 )
 
@@ -36,37 +38,75 @@ type FirecrackerProvider struct {
 	state  state.State
 
 	runningMachines map[string]*firecrackersdk.Machine
+	consoles        map[string]*common.ProcessConsole
 	mapLock         sync.RWMutex
+
+	reservedIps map[string]bool
+	netLock     sync.Mutex
+
+	// dir holds the images, instances, volumes and snapshots of this account
+	dir string
 }
 
 func FirecrackerStateFile() string {
 	return filepath.Join(config.Internal.KernelHome, "firecracker/state.json")
 
 }
-func firecrackerImagesDirectory() string {
-	return filepath.Join(config.Internal.KernelHome, "firecracker/images/")
+
+// FirecrackerDirectory is where the account called name keeps its files.
+// Named accounts get their own directory next to their state file, so
+// several accounts never share images or instances.
+func FirecrackerDirectory(name string) string {
+	return filepath.Join(config.Internal.KernelHome, "firecracker", name)
 }
 
-func firecrackerInstancesDirectory() string {
-	return filepath.Join(config.Internal.KernelHome, "firecracker/instances/")
+func (p *FirecrackerProvider) imagesDirectory() string {
+	return filepath.Join(p.dir, "images")
 }
 
-func firecrackerVolumesDirectory() string {
-	return filepath.Join(config.Internal.KernelHome, "firecracker/volumes/")
+func (p *FirecrackerProvider) instancesDirectory() string {
+	return filepath.Join(p.dir, "instances")
 }
 
-func NewProvider(config config.Firecracker) (*FirecrackerProvider, error) {
+func (p *FirecrackerProvider) volumesDirectory() string {
+	return filepath.Join(p.dir, "volumes")
+}
 
-	os.MkdirAll(firecrackerImagesDirectory(), 0777)
-	os.MkdirAll(firecrackerInstancesDirectory(), 0777)
-	os.MkdirAll(firecrackerVolumesDirectory(), 0777)
+func (p *FirecrackerProvider) snapshotsDirectory() string {
+	return filepath.Join(p.dir, "snapshots")
+}
+
+const defaultKernelArgs = "console=ttyS0 reboot=k panic=1 pci=off"
+
+func NewProvider(config config.Firecracker) (*FirecrackerProvider, error) {
+	if config.VcpuCount == 0 {
+		config.VcpuCount = 1
+	}
+	if config.CpuTemplate == "" {
+		config.CpuTemplate = string(models.CPUTemplateC3)
+	}
+	if config.LogMaxMb == 0 {
+		config.LogMaxMb = 10
+	}
+	if config.KernelArgs == "" {
+		config.KernelArgs = defaultKernelArgs
+	}
 
+	dir := FirecrackerDirectory(config.Name)
 	p := &FirecrackerProvider{
 		config:          config,
-		state:           state.NewBasicState(FirecrackerStateFile()),
+		state:           state.NewBasicState(filepath.Join(dir, "state.json")),
 		runningMachines: map[string]*firecrackersdk.Machine{},
+		consoles:        map[string]*common.ProcessConsole{},
+		reservedIps:     map[string]bool{},
+		dir:             dir,
 	}
 
+	os.MkdirAll(p.imagesDirectory(), 0777)
+	os.MkdirAll(p.instancesDirectory(), 0777)
+	os.MkdirAll(p.volumesDirectory(), 0777)
+	os.MkdirAll(p.snapshotsDirectory(), 0777)
+
 	return p, nil
 }
 
@@ -75,18 +115,30 @@ func (p *FirecrackerProvider) WithState(state state.State) *FirecrackerProvider
 	return p
 }
 
-func getImagePath(imageName string) string {
-	return filepath.Join(firecrackerImagesDirectory(), imageName, "boot.img")
+func (p *FirecrackerProvider) getImagePath(imageName string) string {
+	return filepath.Join(p.imagesDirectory(), imageName, "boot.img")
+}
+
+func (p *FirecrackerProvider) getLoaderPath(imageName string) string {
+	return filepath.Join(p.imagesDirectory(), imageName, "loader.elf")
+}
+
+func (p *FirecrackerProvider) getVolumePath(volumeName string) string {
+	return filepath.Join(p.volumesDirectory(), volumeName, "data.img")
+}
+
+func (p *FirecrackerProvider) getInstanceDir(instanceName string) string {
+	return filepath.Join(p.instancesDirectory(), instanceName)
 }
 
-func getVolumePath(volumeName string) string {
-	return filepath.Join(firecrackerVolumesDirectory(), volumeName, "data.img")
+func (p *FirecrackerProvider) getSnapshotDir(snapshotName string) string {
+	return filepath.Join(p.snapshotsDirectory(), snapshotName)
 }
 
-func getInstanceDir(instanceName string) string {
-	return filepath.Join(firecrackerInstancesDirectory(), instanceName)
+func (p *FirecrackerProvider) getPidPath(instanceName string) string {
+	return filepath.Join(p.instancesDirectory(), instanceName, "firecracker.pid")
 }
 
-func getImageDir(imageName string) string {
-	return filepath.Join(firecrackerImagesDirectory(), imageName)
+func (p *FirecrackerProvider) getImageDir(imageName string) string {
+	return filepath.Join(p.imagesDirectory(), imageName)
 }
@@ -23,18 +23,19 @@ package firecracker
 import (
 	"github.com/bhojpur/kernel/pkg/providers/common"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
-	"github.com/sirupsen/logrus"
 )
 
 func (p *FirecrackerProvider) PushImage(params types.PushImagePararms) error {
+	logger := kutil.LogEntry(params.Logger)
 	image, err := p.GetImage(params.ImageName)
 	if err != nil {
 		return errors.New("finding image for "+params.ImageName, err)
 	}
-	if err := common.PushImage(params.Config, image, getImagePath(image.Name)); err != nil {
+	if err := common.PushImage(params.Config, image, p.getImagePath(image.Name)); err != nil {
 		return errors.New("pushing image "+image.Name, err)
 	}
-	logrus.Infof("pushed image %v to %v", image.Name, params.Config.URL)
+	logger.Infof("pushed image %v to %v", image.Name, params.Config.URL)
 	return nil
 }
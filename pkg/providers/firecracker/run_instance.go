@@ -23,32 +23,34 @@ package firecracker
 import (
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	firecrackersdk "github.com/firecracker-microvm/firecracker-go-sdk"
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
 
+	"github.com/bhojpur/kernel/pkg/compilers"
 	"github.com/bhojpur/kernel/pkg/providers/common"
 	"github.com/bhojpur/kernel/pkg/types"
 	"github.com/bhojpur/kernel/pkg/util/errors"
 	"github.com/sirupsen/logrus"
 )
 
-func toblk(s string) firecrackersdk.BlockDevice {
-	return firecrackersdk.BlockDevice{
-		HostPath: s,
-		Mode:     "rw",
-	}
-}
-
 func (p *FirecrackerProvider) RunInstance(params types.RunInstanceParams) (_ *types.Instance, err error) {
+	logger := kutil.LogEntry(params.Logger)
 
-	logrus.WithFields(logrus.Fields{
+	logger.WithFields(logrus.Fields{
 		"image-id": params.ImageId,
 		"mounts":   params.MntPointsToVolumeIds,
 		"env":      params.Env,
+		"vcpus":    params.VcpuCount,
 	}).Infof("running instance %s", params.Name)
 
 	if _, err := p.GetInstance(params.Name); err == nil {
@@ -65,7 +67,7 @@ func (p *FirecrackerProvider) RunInstance(params types.RunInstanceParams) (_ *ty
 	}
 
 	instanceId := params.Name
-	instanceDir := getInstanceDir(instanceId)
+	instanceDir := p.getInstanceDir(instanceId)
 
 	if _, err := os.Stat(instanceDir); os.IsNotExist(err) {
 		err = os.Mkdir(instanceDir, 0755)
@@ -74,15 +76,52 @@ func (p *FirecrackerProvider) RunInstance(params types.RunInstanceParams) (_ *ty
 		}
 	}
 
-	logs := filepath.Join(instanceDir, "logs.fifo")
-	metrics := filepath.Join(instanceDir, "metrics.fifo")
+	logFifo := filepath.Join(instanceDir, "logs.fifo")
+	metricsFifo := filepath.Join(instanceDir, "metrics.fifo")
 	sock := filepath.Join(instanceDir, "firecracker.sock")
 
 	if params.InstanceMemory == 0 {
 		params.InstanceMemory = image.RunSpec.DefaultInstanceMemory
 	}
 
-	rootDrive := getImagePath(image.Name)
+	if params.VcpuCount == 0 {
+		params.VcpuCount = p.config.VcpuCount
+	}
+	if params.VcpuCount < 1 {
+		return nil, errors.New(fmt.Sprintf("invalid vcpu count %v", params.VcpuCount), nil)
+	}
+	if params.CpuTemplate == "" {
+		params.CpuTemplate = p.config.CpuTemplate
+	}
+	cpuTemplate := models.CPUTemplate(params.CpuTemplate)
+	if err := cpuTemplate.Validate(nil); err != nil {
+		return nil, errors.New("invalid cpu template "+params.CpuTemplate, err)
+	}
+	kernelPath := p.config.Kernel
+	isBhojpur := compilers.CompilerType(image.RunSpec.Compiler).Base() == compilers.Bhojpur
+	var initrdPath string
+	if isBhojpur {
+		// the kernel's block and network drivers are virtio-pci only, and
+		// firecracker exposes its devices over virtio-mmio
+		if len(params.MntPointsToVolumeIds) > 0 {
+			return nil, errors.New("bhojpur go kernels cannot use volumes on firecracker: they have no virtio-mmio driver", nil)
+		}
+		if p.config.IpPool != "" {
+			return nil, errors.New("bhojpur go kernels cannot be networked on firecracker: they have no virtio-mmio driver; use an account without ip_pool", nil)
+		}
+		// the loader boots and finds the kernel as its initrd module
+		kernelPath = p.getLoaderPath(image.Name)
+		initrdPath = p.getImagePath(image.Name)
+	}
+	if params.KernelPath != "" {
+		if kernelPath, err = p.allowedKernel(params.KernelPath); err != nil {
+			return nil, err
+		}
+	}
+	kernelArgs := p.config.KernelArgs
+	if params.KernelArgs != "" {
+		kernelArgs += " " + params.KernelArgs
+	}
 
 	volumeIdInOrder := make([]string, len(params.MntPointsToVolumeIds))
 
@@ -100,53 +139,102 @@ func (p *FirecrackerProvider) RunInstance(params types.RunInstanceParams) (_ *ty
 		return nil, errors.New("can't get volumes", err)
 	}
 
-	fcCfg := firecrackersdk.Config{
-		BinPath:          p.config.Binary,
-		SocketPath:       sock,
-		LogFifo:          logs,
-		LogLevel:         "Debug",
-		MetricsFifo:      metrics,
-		KernelImagePath:  p.config.Kernel,
-		KernelArgs:       "console=ttyS0 reboot=k panic=1 pci=off",
-		RootDrive:        toblk(rootDrive),
-		AdditionalDrives: volPathToBlockDevices(volImagesInOrder),
-		// TODO: add these later. NetworkInterfaces: NICs,
-		CPUCount:    1,
-		CPUTemplate: firecrackersdk.CPUTemplate("C3"),
-		HtEnabled:   false,
-		MemInMiB:    int64(params.InstanceMemory),
-		Debug:       true,
-		Console:     p.config.Console,
-	}
-
-	logrus.Debugf("creating firecracker vm")
-
-	m, err := firecrackersdk.NewMachine(fcCfg, firecrackersdk.WithLogger(logrus.NewEntry(logrus.New())))
+	var drives []models.Drive
+	if !isBhojpur {
+		drives = volPathToDrives(p.getImagePath(image.Name), volImagesInOrder)
+	}
+
+	var networkInterfaces firecrackersdk.NetworkInterfaces
+	var instanceIp string
+	if p.config.IpPool != "" {
+		var iface *firecrackersdk.NetworkInterface
+		var release func()
+		iface, instanceIp, release, err = p.allocateNetwork()
+		if err != nil {
+			return nil, errors.New("allocating network for instance", err)
+		}
+		defer func() {
+			if err != nil {
+				release()
+			}
+		}()
+		networkInterfaces = append(networkInterfaces, *iface)
+	}
+
+	logs, err := p.openInstanceLogs(instanceId)
 	if err != nil {
-		logrus.Errorf("Failed creating machine: %s", err)
 		return nil, err
 	}
+	defer func() {
+		if err != nil {
+			logs.Close()
+		}
+	}()
+
+	fcCfg := firecrackersdk.Config{
+		SocketPath:        sock,
+		LogFifo:           logFifo,
+		LogLevel:          "Debug",
+		MetricsFifo:       metricsFifo,
+		FifoLogWriter:     logs.vmm(),
+		KernelImagePath:   kernelPath,
+		KernelArgs:        kernelArgs,
+		InitrdPath:        initrdPath,
+		Drives:            drives,
+		NetworkInterfaces: networkInterfaces,
+		MachineCfg: models.MachineConfiguration{
+			VcpuCount:   firecrackersdk.Int64(int64(params.VcpuCount)),
+			CPUTemplate: cpuTemplate,
+			HtEnabled:   firecrackersdk.Bool(p.config.HtEnabled),
+			MemSizeMib:  firecrackersdk.Int64(int64(params.InstanceMemory)),
+		},
+	}
+
+	logger.Debugf("creating firecracker vm")
 
 	ctx := context.Background()
 	vmmCtx, vmmCancel := context.WithCancel(ctx)
-	exitchan, err := m.Init(ctx)
+
+	cmd, console, err := p.buildCommand(vmmCtx, sock, logs)
 	if err != nil {
-		logrus.Errorf("Firecracker Init returned error %s", err)
+		vmmCancel()
 		return nil, err
 	}
+	defer func() {
+		if err != nil && console != nil {
+			console.Close()
+		}
+	}()
 
-	go func() {
-		<-exitchan
+	m, err := firecrackersdk.NewMachine(vmmCtx, fcCfg,
+		firecrackersdk.WithProcessRunner(cmd),
+		firecrackersdk.WithLogger(logrus.NewEntry(logrus.New())))
+	if err != nil {
 		vmmCancel()
-	}()
+		logger.Errorf("Failed creating machine: %s", err)
+		return nil, err
+	}
+	m.Handlers.FcInit = m.Handlers.FcInit.AppendAfter(firecrackersdk.CreateLogFilesHandlerName, logs.captureMetrics(metricsFifo))
 
-	err = m.StartInstance(vmmCtx)
+	err = m.Start(vmmCtx)
 	if err != nil {
-		return nil, errors.New("can't start firecracker - make sure it's in your path.", nil)
+		vmmCancel()
+		return nil, errors.New("can't start firecracker - make sure it's in your path.", err)
 	}
+	p.registerConsole(instanceId, console)
 
-	// todo: once we have network support we can set this up.
-	var instanceIp string
+	// lets the vm be found, and stopped, after a daemon restart
+	if pid, err := m.PID(); err == nil {
+		if err := ioutil.WriteFile(p.getPidPath(instanceId), []byte(strconv.Itoa(pid)), 0644); err != nil {
+			logger.WithError(err).Warnf("writing pid file of instance %s", instanceId)
+		}
+	}
+
+	exitReason := make(chan string, 1)
+	go func() {
+		exitReason <- common.ExitReason(m.Wait(ctx))
+		vmmCancel()
+	}()
 
 	instance := &types.Instance{
 		Id:             instanceId,
@@ -158,10 +246,20 @@ func (p *FirecrackerProvider) RunInstance(params types.RunInstanceParams) (_ *ty
 		Created:        time.Now(),
 	}
 
+	// the instance dir, and the logs in it, are kept until the instance
+	// is deleted so it can be inspected after the microVM exits
 	go func() {
 		<-vmmCtx.Done()
-		p.state.RemoveInstance(instance)
-		os.RemoveAll(instanceDir)
+		var taps []string
+		for _, iface := range networkInterfaces {
+			taps = append(taps, iface.StaticConfiguration.HostDevName)
+		}
+		var reason string
+		select {
+		case reason = <-exitReason:
+		default:
+		}
+		p.instanceExited(instanceId, instanceIp, taps, logs, reason)
 	}()
 
 	if err := p.state.ModifyInstances(func(instances map[string]*types.Instance) error {
@@ -171,7 +269,7 @@ func (p *FirecrackerProvider) RunInstance(params types.RunInstanceParams) (_ *ty
 		return nil, errors.New("modifying instance map in state", err)
 	}
 
-	logrus.WithField("instance", instance).Infof("instance created successfully")
+	logger.WithField("instance", instance).Infof("instance created successfully")
 
 	p.mapLock.Lock()
 	p.runningMachines[instanceId] = m
@@ -180,6 +278,36 @@ func (p *FirecrackerProvider) RunInstance(params types.RunInstanceParams) (_ *ty
 	return instance, nil
 }
 
+// instanceExited releases what a microVM held while it ran and marks its
+// instance stopped.
+func (p *FirecrackerProvider) instanceExited(instanceId, instanceIp string, taps []string, logs *instanceLogs, exitReason string) {
+	logs.Close()
+	os.Remove(p.getPidPath(instanceId))
+	for _, tap := range taps {
+		deleteTap(tap)
+	}
+	p.netLock.Lock()
+	delete(p.reservedIps, instanceIp)
+	p.netLock.Unlock()
+	p.mapLock.Lock()
+	delete(p.runningMachines, instanceId)
+	if console := p.consoles[instanceId]; console != nil {
+		console.Close()
+		delete(p.consoles, instanceId)
+	}
+	p.mapLock.Unlock()
+	p.state.ModifyInstances(func(instances map[string]*types.Instance) error {
+		if i, ok := instances[instanceId]; ok {
+			i.State = types.InstanceState_Stopped
+			i.IpAddress = ""
+			if exitReason != "" {
+				i.LastExitReason = exitReason
+			}
+		}
+		return nil
+	})
+}
+
 func (p *FirecrackerProvider) getVolumeImages(volumeIdInOrder []string) ([]string, error) {
 
 	var volPath []string
@@ -188,17 +316,57 @@ func (p *FirecrackerProvider) getVolumeImages(volumeIdInOrder []string) ([]strin
 		if err != nil {
 			return nil, err
 		}
-		volPath = append(volPath, getVolumePath(v.Name))
+		volPath = append(volPath, p.getVolumePath(v.Name))
 	}
 	return volPath, nil
 }
 
-func volPathToBlockDevices(volPaths []string) []firecrackersdk.BlockDevice {
-	var res []firecrackersdk.BlockDevice
+func volPathToDrives(rootDrive string, volPaths []string) []models.Drive {
+	drives := firecrackersdk.NewDrivesBuilder(rootDrive)
 	for _, v := range volPaths {
-		res = append(res, toblk(v))
+		drives = drives.AddDrive(v, false)
 	}
-	return res
+	return drives.Build()
+}
+
+// buildCommand returns the firecracker process for an instance and its
+// console, whose input is the process's stdin. Its output goes to the
+// instance log and the console, or is also copied to the daemon's stdio,
+// without a console, when the provider is configured with console: stdio.
+func (p *FirecrackerProvider) buildCommand(ctx context.Context, sock string, logs *instanceLogs) (*exec.Cmd, *common.ProcessConsole, error) {
+	builder := firecrackersdk.VMCommandBuilder{}.
+		WithBin(p.config.Binary).
+		WithSocketPath(sock).
+		WithStdout(logs.console()).
+		WithStderr(logs.vmm())
+	var console *common.ProcessConsole
+	switch p.config.Console {
+	case "":
+		var err error
+		if console, err = common.NewProcessConsole(); err != nil {
+			return nil, nil, err
+		}
+		builder = builder.WithStdin(console.Stdin).
+			WithStdout(io.MultiWriter(logs.console(), console))
+	case "stdio":
+		builder = builder.WithStdin(os.Stdin).
+			WithStdout(io.MultiWriter(os.Stdout, logs.console())).
+			WithStderr(io.MultiWriter(os.Stderr, logs.vmm()))
+	default:
+		logrus.Warnf("firecracker console %q is not supported, running without a console", p.config.Console)
+	}
+	return builder.Build(ctx), console, nil
+}
+
+// registerConsole makes the console of a started instance attachable.
+func (p *FirecrackerProvider) registerConsole(instanceId string, console *common.ProcessConsole) {
+	if console == nil {
+		return
+	}
+	console.Started()
+	p.mapLock.Lock()
+	p.consoles[instanceId] = console
+	p.mapLock.Unlock()
 }
 
 func injectEnv(cmdline string, env map[string]string) string {
@@ -211,3 +379,29 @@ func injectEnv(cmdline string, env map[string]string) string {
 	cmdline = cmdline[:len(cmdline)-2] + "," + strings.Join(envRumpJson, ",") + "}}"
 	return cmdline
 }
+
+// allowedKernel resolves a kernel requested for an instance, which must be
+// a file in the configured kernels dir. Names are relative to that dir.
+func (p *FirecrackerProvider) allowedKernel(path string) (string, error) {
+	if p.config.KernelsDir == "" {
+		return "", errors.New("booting a custom kernel requires kernels_dir in the firecracker config", nil)
+	}
+	dir, err := filepath.EvalSymlinks(p.config.KernelsDir)
+	if err != nil {
+		return "", errors.New("resolving kernels dir", err)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", errors.New("resolving kernel "+path, err)
+	}
+	if rel, err := filepath.Rel(dir, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.New("kernel "+path+" is not in the kernels dir "+p.config.KernelsDir, nil)
+	}
+	if info, err := os.Stat(resolved); err != nil || !info.Mode().IsRegular() {
+		return "", errors.New("kernel "+path+" is not a regular file", err)
+	}
+	return resolved, nil
+}
@@ -0,0 +1,388 @@
+package firecracker
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/bhojpur/kernel/pkg/providers/common"
+	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	fcApiTimeout    = 30 * time.Second
+	fcSocketTimeout = 5 * time.Second
+)
+
+// snapshotMetadata is kept next to the vm state and memory files of a
+// snapshot. The guest resumes with the network settings it was snapshotted
+// with, so the address is needed to recreate its tap device.
+type snapshotMetadata struct {
+	types.Snapshot
+	IpAddress string `json:"IpAddress,omitempty"`
+}
+
+func (p *FirecrackerProvider) getSnapshotMetadataPath(snapshotName string) string {
+	return filepath.Join(p.getSnapshotDir(snapshotName), "snapshot.json")
+}
+
+func (p *FirecrackerProvider) getSnapshotStatePath(snapshotName string) string {
+	return filepath.Join(p.getSnapshotDir(snapshotName), "vm.snap")
+}
+
+func (p *FirecrackerProvider) getSnapshotMemoryPath(snapshotName string) string {
+	return filepath.Join(p.getSnapshotDir(snapshotName), "mem.snap")
+}
+
+func (p *FirecrackerProvider) getSocketPath(instanceId string) string {
+	return filepath.Join(p.getInstanceDir(instanceId), "firecracker.sock")
+}
+
+// SnapshotInstance pauses a running microVM and saves a full snapshot of
+// it. Disks are not copied: restored instances use the image and volume
+// files of the snapshotted one.
+func (p *FirecrackerProvider) SnapshotInstance(params types.SnapshotInstanceParams) (_ *types.Snapshot, err error) {
+	logger := kutil.LogEntry(params.Logger)
+	instance, err := p.GetInstance(params.InstanceId)
+	if err != nil {
+		return nil, errors.New("retrieving instance "+params.InstanceId, err)
+	}
+	if instance.State != types.InstanceState_Running {
+		return nil, errors.New("instance "+instance.Name+" is "+string(instance.State)+", only running instances can be snapshotted", nil)
+	}
+	name := params.Name
+	if name == "" {
+		name = fmt.Sprintf("%s-%d", instance.Name, time.Now().Unix())
+	}
+	if !common.ValidName(name) {
+		return nil, errors.New("invalid snapshot name "+name, nil)
+	}
+	if _, err := os.Stat(p.getSnapshotDir(name)); err == nil {
+		return nil, errors.New("snapshot "+name+" already exists", nil)
+	}
+
+	logger.WithField("instance", instance).Infof("snapshotting instance as %s", name)
+
+	sock := p.getSocketPath(instance.Id)
+	if err := fcApiRequest(sock, http.MethodPatch, "/vm", map[string]string{"state": "Paused"}); err != nil {
+		return nil, errors.New("pausing instance "+instance.Name, err)
+	}
+	defer func() {
+		if err == nil && params.Stop {
+			if stopErr := p.StopInstance(instance.Id); stopErr != nil {
+				logger.WithError(stopErr).Warnf("stopping instance %s after snapshot", instance.Name)
+			}
+			return
+		}
+		if resumeErr := fcApiRequest(sock, http.MethodPatch, "/vm", map[string]string{"state": "Resumed"}); resumeErr != nil {
+			logger.WithError(resumeErr).Errorf("resuming instance %s after snapshot", instance.Name)
+		}
+	}()
+
+	if err := os.MkdirAll(p.getSnapshotDir(name), 0755); err != nil {
+		return nil, errors.New("creating snapshot directory", err)
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(p.getSnapshotDir(name))
+		}
+	}()
+
+	if err := fcApiRequest(sock, http.MethodPut, "/snapshot/create", map[string]string{
+		"snapshot_type": "Full",
+		"snapshot_path": p.getSnapshotStatePath(name),
+		"mem_file_path": p.getSnapshotMemoryPath(name),
+	}); err != nil {
+		return nil, errors.New("creating snapshot of instance "+instance.Name, err)
+	}
+
+	metadata := &snapshotMetadata{
+		Snapshot: types.Snapshot{
+			Id:             name,
+			Name:           name,
+			InstanceName:   instance.Name,
+			ImageId:        instance.ImageId,
+			Infrastructure: types.Infrastructure_FIRECRACKER,
+			SizeMb:         common.DirSizeMb(p.getSnapshotDir(name)),
+			Created:        time.Now(),
+		},
+		IpAddress: instance.IpAddress,
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, errors.New("marshalling snapshot metadata", err)
+	}
+	if err := ioutil.WriteFile(p.getSnapshotMetadataPath(name), data, 0644); err != nil {
+		return nil, errors.New("writing snapshot metadata", err)
+	}
+
+	logger.WithField("snapshot", metadata.Snapshot).Infof("snapshot created successfully")
+	return &metadata.Snapshot, nil
+}
+
+// RestoreSnapshot starts a new firecracker process and loads the snapshot
+// into it instead of booting a kernel, so the guest continues where the
+// snapshotted instance was paused. The snapshotted instance must be gone,
+// the guest comes back with its address and disks.
+func (p *FirecrackerProvider) RestoreSnapshot(params types.RestoreSnapshotParams) (_ *types.Instance, err error) {
+	logger := kutil.LogEntry(params.Logger)
+	snapshot, err := common.GetSnapshot(p, params.SnapshotId)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := p.readSnapshotMetadata(snapshot.Name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.GetImage(metadata.ImageId); err != nil {
+		return nil, errors.New("image "+metadata.ImageId+" of snapshot "+snapshot.Name+" no longer exists", err)
+	}
+	name := params.InstanceName
+	if name == "" {
+		name = metadata.InstanceName
+	}
+	if !common.ValidName(name) {
+		return nil, errors.New("invalid instance name "+name, nil)
+	}
+	if _, err := p.GetInstance(name); err == nil {
+		return nil, errors.New("instance with name "+name+" already exists. firecracker provider requires unique names for instances", nil)
+	}
+	// the guest keeps the address and disks it was snapshotted with, which
+	// the snapshotted instance still holds
+	if source, err := common.FindInstanceByName(p, metadata.InstanceName); err != nil {
+		return nil, err
+	} else if source != nil {
+		return nil, errors.New("instance "+metadata.InstanceName+" of snapshot "+snapshot.Name+" still exists and holds its address and disks, delete it before restoring", nil)
+	}
+
+	logger.WithField("snapshot", snapshot).Infof("restoring instance %s", name)
+
+	instanceId := name
+	instanceDir := p.getInstanceDir(instanceId)
+	if err := os.MkdirAll(instanceDir, 0755); err != nil {
+		return nil, errors.New("can't create instance dir", err)
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(instanceDir)
+		}
+	}()
+
+	var taps []string
+	if metadata.IpAddress != "" {
+		tap, release, err := p.reserveNetwork(metadata.IpAddress)
+		if err != nil {
+			return nil, errors.New("reserving network of snapshot "+snapshot.Name, err)
+		}
+		defer func() {
+			if err != nil {
+				release()
+			}
+		}()
+		taps = append(taps, tap)
+	}
+
+	logs, err := p.openInstanceLogs(instanceId)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			logs.Close()
+		}
+	}()
+
+	sock := p.getSocketPath(instanceId)
+	cmd, console, err := p.buildCommand(context.Background(), sock, logs)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil && console != nil {
+			console.Close()
+		}
+	}()
+	if err := cmd.Start(); err != nil {
+		return nil, errors.New("can't start firecracker - make sure it's in your path.", err)
+	}
+	defer func() {
+		if err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}
+	}()
+	if err := waitForSocket(sock, fcSocketTimeout); err != nil {
+		return nil, err
+	}
+
+	metricsFifo := filepath.Join(instanceDir, "metrics.fifo")
+	if err := syscall.Mkfifo(metricsFifo, 0700); err != nil {
+		return nil, errors.New("creating metrics fifo", err)
+	}
+	if err := logs.captureMetrics(metricsFifo).Fn(context.Background(), nil); err != nil {
+		return nil, err
+	}
+	if err := fcApiRequest(sock, http.MethodPut, "/metrics", map[string]string{"metrics_path": metricsFifo}); err != nil {
+		return nil, errors.New("configuring metrics", err)
+	}
+
+	if err := fcApiRequest(sock, http.MethodPut, "/snapshot/load", map[string]interface{}{
+		"snapshot_path": p.getSnapshotStatePath(snapshot.Name),
+		"mem_file_path": p.getSnapshotMemoryPath(snapshot.Name),
+	}); err != nil {
+		return nil, errors.New("loading snapshot "+snapshot.Name, err)
+	}
+	if err := fcApiRequest(sock, http.MethodPatch, "/vm", map[string]string{"state": "Resumed"}); err != nil {
+		return nil, errors.New("resuming restored instance "+name, err)
+	}
+
+	if err := ioutil.WriteFile(p.getPidPath(instanceId), []byte(strconv.Itoa(cmd.Process.Pid)), 0644); err != nil {
+		logger.WithError(err).Warnf("writing pid file of instance %s", instanceId)
+	}
+
+	p.registerConsole(instanceId, console)
+	go func() {
+		reason := common.ExitReason(cmd.Wait())
+		p.instanceExited(instanceId, metadata.IpAddress, taps, logs, reason)
+	}()
+
+	instance := &types.Instance{
+		Id:             instanceId,
+		Name:           name,
+		State:          types.InstanceState_Running,
+		IpAddress:      metadata.IpAddress,
+		Infrastructure: types.Infrastructure_FIRECRACKER,
+		ImageId:        metadata.ImageId,
+		Created:        time.Now(),
+	}
+	if err := p.state.ModifyInstances(func(instances map[string]*types.Instance) error {
+		instances[instance.Id] = instance
+		return nil
+	}); err != nil {
+		return nil, errors.New("modifying instance map in state", err)
+	}
+
+	logger.WithField("instance", instance).Infof("instance restored successfully")
+	return instance, nil
+}
+
+func (p *FirecrackerProvider) ListSnapshots() ([]*types.Snapshot, error) {
+	names, err := common.ListDirs(p.snapshotsDirectory())
+	if err != nil {
+		return nil, errors.New("listing snapshot directories", err)
+	}
+	snapshots := []*types.Snapshot{}
+	for _, name := range names {
+		metadata, err := p.readSnapshotMetadata(name)
+		if err != nil {
+			logrus.WithError(err).Warnf("skipping snapshot %s", name)
+			continue
+		}
+		snapshots = append(snapshots, &metadata.Snapshot)
+	}
+	return snapshots, nil
+}
+
+func (p *FirecrackerProvider) DeleteSnapshot(id string) error {
+	snapshot, err := common.GetSnapshot(p, id)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(p.getSnapshotDir(snapshot.Name))
+}
+
+func (p *FirecrackerProvider) readSnapshotMetadata(snapshotName string) (*snapshotMetadata, error) {
+	data, err := ioutil.ReadFile(p.getSnapshotMetadataPath(snapshotName))
+	if err != nil {
+		return nil, errors.New("reading metadata of snapshot "+snapshotName, err)
+	}
+	var metadata snapshotMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, errors.New("parsing metadata of snapshot "+snapshotName, err)
+	}
+	return &metadata, nil
+}
+
+func waitForSocket(sock string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			conn.Close()
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return errors.New("firecracker api socket "+sock+" did not come up within "+timeout.String(), nil)
+}
+
+// fcApiRequest calls the firecracker API of a microVM directly. The
+// vendored sdk predates the snapshot endpoints, which need firecracker
+// v0.24 or later.
+func fcApiRequest(sock, method, path string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return errors.New("marshalling request body", err)
+	}
+	client := &http.Client{
+		Timeout: fcApiTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", sock)
+			},
+		},
+	}
+	req, err := http.NewRequest(method, "http://localhost"+path, bytes.NewReader(data))
+	if err != nil {
+		return errors.New("building request", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.New(method+" "+path+" failed", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var fault struct {
+			FaultMessage string `json:"fault_message"`
+		}
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(respBody, &fault) != nil || fault.FaultMessage == "" {
+			fault.FaultMessage = string(respBody)
+		}
+		return errors.New(fmt.Sprintf("%s %s failed with status %v: %s", method, path, resp.StatusCode, fault.FaultMessage), nil)
+	}
+	return nil
+}
@@ -21,17 +21,25 @@ package firecracker
 // THE SOFTWARE.
 
 import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/bhojpur/kernel/pkg/compilers"
+	"github.com/bhojpur/kernel/pkg/compilers/bhojpur"
 	kos "github.com/bhojpur/kernel/pkg/os"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
 	"github.com/sirupsen/logrus"
 )
 
 func (p *FirecrackerProvider) Stage(params types.StageImageParams) (_ *types.Image, err error) {
+	logger := kutil.LogEntry(params.Logger)
 	images, err := p.ListImages()
 	if err != nil {
 		return nil, errors.New("retrieving image list for existing image", err)
@@ -41,15 +49,15 @@ func (p *FirecrackerProvider) Stage(params types.StageImageParams) (_ *types.Ima
 			if !params.Force {
 				return nil, errors.New("an image already exists with name '"+params.Name+"', try again with --force", nil)
 			} else {
-				logrus.WithField("image", image).Warnf("force: deleting previous image with name " + params.Name)
+				logger.WithField("image", image).Warnf("force: deleting previous image with name " + params.Name)
 				if err := p.DeleteImage(image.Id, true); err != nil {
-					logrus.Warn("failed to remove previously existing image", err)
+					logger.Warn("failed to remove previously existing image", err)
 				}
 			}
 		}
 	}
-	imagePath := getImagePath(params.Name)
-	logrus.Debugf("making directory: %s", filepath.Dir(imagePath))
+	imagePath := p.getImagePath(params.Name)
+	logger.Debugf("making directory: %s", filepath.Dir(imagePath))
 	if err := os.MkdirAll(filepath.Dir(imagePath), 0777); err != nil {
 		return nil, errors.New("creating directory for boot image", err)
 	}
@@ -59,9 +67,23 @@ func (p *FirecrackerProvider) Stage(params types.StageImageParams) (_ *types.Ima
 		}
 	}()
 
-	logrus.Debugf("copying rootfs")
-	if err := kos.CopyFile(params.RawImage.LocalImagePath, getImagePath(params.Name)); err != nil {
-		return nil, errors.New("copying bootable image to image dir", err)
+	if compilers.CompilerType(params.RawImage.RunSpec.Compiler).Base() == compilers.Bhojpur {
+		logger.Debugf("staging Bhojpur Go kernel and its multiboot loader")
+		loaderFile := filepath.Join(filepath.Dir(params.RawImage.LocalImagePath), bhojpur.LoaderFile)
+		if err := checkBootableLoader(loaderFile); err != nil {
+			return nil, err
+		}
+		if err := kos.CopyFile(params.RawImage.LocalImagePath, imagePath); err != nil {
+			return nil, errors.New("copying kernel to image dir", err)
+		}
+		if err := kos.CopyFile(loaderFile, p.getLoaderPath(params.Name)); err != nil {
+			return nil, errors.New("copying multiboot loader to image dir", err)
+		}
+	} else {
+		logger.Debugf("copying rootfs")
+		if err := kos.CopyFile(params.RawImage.LocalImagePath, imagePath); err != nil {
+			return nil, errors.New("copying bootable image to image dir", err)
+		}
 	}
 
 	imagePathInfo, err := os.Stat(imagePath)
@@ -70,7 +92,7 @@ func (p *FirecrackerProvider) Stage(params types.StageImageParams) (_ *types.Ima
 	}
 	sizeMb := imagePathInfo.Size() >> 20
 
-	logrus.WithFields(logrus.Fields{
+	logger.WithFields(logrus.Fields{
 		"name": params.Name,
 		"id":   params.Name,
 		"size": sizeMb,
@@ -93,6 +115,58 @@ func (p *FirecrackerProvider) Stage(params types.StageImageParams) (_ *types.Ima
 		return nil, errors.New("modifying image map in state", err)
 	}
 
-	logrus.WithFields(logrus.Fields{"image": image}).Infof("image created succesfully")
+	logger.WithFields(logrus.Fields{"image": image}).Infof("image created succesfully")
 	return image, nil
 }
+
+// xenElfnotePhys32Entry is the ELF note type holding the 32-bit PVH entry
+// point, the only way firecracker can enter a kernel that is not Linux.
+const xenElfnotePhys32Entry = 18
+
+// checkBootableLoader makes sure firecracker can load the loader at path.
+// Firecracker only boots 64-bit ELF kernels through their PVH entry note,
+// so the loader must be multiboot64.elf and not the 32-bit multiboot.elf
+// that qemu boots.
+func checkBootableLoader(path string) error {
+	f, err := elf.Open(path)
+	if err != nil {
+		return errors.New("reading multiboot loader", err)
+	}
+	defer f.Close()
+	if f.Class != elf.ELFCLASS64 {
+		return errors.New(fmt.Sprintf("multiboot loader is a %v binary, firecracker can only boot 64-bit ELF kernels", f.Class), nil)
+	}
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_NOTE {
+			continue
+		}
+		notes := make([]byte, prog.Filesz)
+		if _, err := prog.ReadAt(notes, 0); err != nil {
+			return errors.New("reading multiboot loader notes", err)
+		}
+		if hasPvhEntry(f.ByteOrder, notes) {
+			return nil
+		}
+	}
+	return errors.New("multiboot loader has no PVH entry note, firecracker cannot boot it", nil)
+}
+
+// hasPvhEntry walks the ELF notes in buf looking for the Xen PVH entry.
+func hasPvhEntry(order binary.ByteOrder, buf []byte) bool {
+	align := func(n uint32) uint32 { return (n + 3) &^ 3 }
+	for len(buf) >= 12 {
+		namesz := order.Uint32(buf[0:])
+		descsz := order.Uint32(buf[4:])
+		typ := order.Uint32(buf[8:])
+		buf = buf[12:]
+		if uint64(align(namesz))+uint64(align(descsz)) > uint64(len(buf)) {
+			return false
+		}
+		name := strings.TrimRight(string(buf[:namesz]), "\x00")
+		if name == "Xen" && typ == xenElfnotePhys32Entry && descsz >= 4 {
+			return true
+		}
+		buf = buf[align(namesz)+align(descsz):]
+	}
+	return false
+}
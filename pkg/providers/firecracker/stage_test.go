@@ -0,0 +1,120 @@
+package firecracker
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// buildLoaders builds multiboot.elf and multiboot64.elf from the loader
+// sources the same way the Multiboot and Multiboot64 build targets do.
+func buildLoaders(t *testing.T) (string, string) {
+	for _, tool := range []string{"gcc", "ld", "objcopy"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is needed to build the multiboot loader", tool)
+		}
+	}
+	src, err := filepath.Abs(filepath.Join("..", "..", "base"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "firecracker-loader-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	run := func(name string, args ...string) {
+		cmd := exec.Command(name, args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s %v: %v\n%s", name, args, err, out)
+		}
+	}
+	cc := func(file, arch string) {
+		obj := filepath.Base(file)
+		obj = obj[:len(obj)-len(filepath.Ext(obj))] + ".o"
+		run("gcc", "-fno-pic", "-static", "-fno-builtin", "-fno-strict-aliasing", "-O2", "-Wall", "-Werror",
+			"-fno-omit-frame-pointer", "-I"+src, "-nostdinc", "-fno-stack-protector", "-fno-pie",
+			arch, "-c", filepath.Join(src, file), "-o", obj)
+	}
+	cc("boot/boot64.S", "-m64")
+	cc("boot/boot64main.c", "-m64")
+	cc("boot/multiboot.c", "-m32")
+	cc("boot/multiboot_header.S", "-m32")
+	run("ld", "-N", "-e", "_start", "-Ttext", "0x3200000", "-m", "elf_x86_64", "-o", "boot64.elf", "boot64.o", "boot64main.o")
+	run("ld", "-N", "-e", "_start", "-Ttext", "0x3300000", "-m", "elf_i386", "-o", "multiboot.elf",
+		"multiboot.o", "multiboot_header.o", "-b", "binary", "boot64.elf")
+	run("ld", "-N", "-e", "_start", "-Ttext-segment", "0x3300000", "-m", "elf_i386", "-o", "multiboot32.elf",
+		"multiboot.o", "multiboot_header.o", "-b", "binary", "boot64.elf")
+	run("objcopy", "-I", "elf32-i386", "-O", "elf64-x86-64", "multiboot32.elf", "multiboot64.elf")
+	return filepath.Join(dir, "multiboot.elf"), filepath.Join(dir, "multiboot64.elf")
+}
+
+func TestCheckBootableLoader(t *testing.T) {
+	loader32, loader64 := buildLoaders(t)
+	if err := checkBootableLoader(loader64); err != nil {
+		t.Errorf("multiboot64.elf should be bootable: %v", err)
+	}
+	if err := checkBootableLoader(loader32); err == nil {
+		t.Errorf("multiboot.elf should be rejected")
+	}
+}
+
+func TestAllowedKernel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "firecracker-kernels-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	kernels := filepath.Join(dir, "kernels")
+	if err := os.Mkdir(kernels, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{filepath.Join(kernels, "vmlinux"), filepath.Join(dir, "secret")} {
+		if err := ioutil.WriteFile(name, []byte("kernel"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(dir, "secret"), filepath.Join(kernels, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &FirecrackerProvider{}
+	if _, err := p.allowedKernel("vmlinux"); err == nil {
+		t.Errorf("kernels must be refused without a kernels dir")
+	}
+	p.config.KernelsDir = kernels
+	for _, path := range []string{"vmlinux", filepath.Join(kernels, "vmlinux")} {
+		if _, err := p.allowedKernel(path); err != nil {
+			t.Errorf("%s should be allowed: %v", path, err)
+		}
+	}
+	for _, path := range []string{"../secret", filepath.Join(dir, "secret"), "link", "/etc/passwd", "."} {
+		if _, err := p.allowedKernel(path); err == nil {
+			t.Errorf("%s should be refused", path)
+		}
+	}
+}
@@ -21,6 +21,9 @@ package firecracker
 // THE SOFTWARE.
 
 import (
+	"os"
+	"syscall"
+
 	"github.com/bhojpur/kernel/pkg/types"
 	"github.com/bhojpur/kernel/pkg/util/errors"
 	"github.com/sirupsen/logrus"
@@ -37,7 +40,13 @@ func (p *FirecrackerProvider) StopInstance(id string) error {
 	p.mapLock.RUnlock()
 
 	if m == nil {
-		logrus.WithField("instance", instance).Warn("instance not available in runtime")
+		// started before the daemon restarted
+		if pid, ok := p.readPid(instance.Id); ok {
+			logrus.WithField("instance", instance).Infof("stopping firecracker process %d", pid)
+			syscall.Kill(pid, syscall.SIGTERM)
+		} else {
+			logrus.WithField("instance", instance).Warn("instance not available in runtime")
+		}
 	} else {
 		p.mapLock.Lock()
 		delete(p.runningMachines, id)
@@ -57,5 +66,8 @@ func (p *FirecrackerProvider) StopInstance(id string) error {
 		}
 	}
 
-	return p.state.RemoveInstance(instance)
+	if err := p.state.RemoveInstance(instance); err != nil {
+		return errors.New("removing instance from state", err)
+	}
+	return os.RemoveAll(p.getInstanceDir(instance.Id))
 }
@@ -27,13 +27,15 @@ import (
 
 	"github.com/bhojpur/kernel/pkg/providers/common"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/api/compute/v1"
 )
 
 func (p *GcloudProvider) RunInstance(params types.RunInstanceParams) (_ *types.Instance, err error) {
-	logrus.WithFields(logrus.Fields{
+	logger := kutil.LogEntry(params.Logger)
+	logger.WithFields(logrus.Fields{
 		"image-id": params.ImageId,
 		"mounts":   params.MntPointsToVolumeIds,
 		"env":      params.Env,
@@ -43,19 +45,19 @@ func (p *GcloudProvider) RunInstance(params types.RunInstanceParams) (_ *types.I
 
 	defer func() {
 		if err != nil {
-			logrus.WithError(err).Errorf("gcloud running instance encountered an error")
+			logger.WithError(err).Errorf("gcloud running instance encountered an error")
 			if instanceId != "" {
 				if params.NoCleanup {
-					logrus.Warnf("because --no-cleanup flag was provided, not cleaning up failed instance %s0", instanceId)
+					logger.Warnf("because --no-cleanup flag was provided, not cleaning up failed instance %s0", instanceId)
 					return
 				}
-				logrus.Warnf("cleaning up instance %s", instanceId)
+				logger.Warnf("cleaning up instance %s", instanceId)
 				p.compute().Instances.Delete(p.config.ProjectID, p.config.Zone, instanceId)
 				if cleanupErr := p.state.ModifyInstances(func(instances map[string]*types.Instance) error {
 					delete(instances, instanceId)
 					return nil
 				}); cleanupErr != nil {
-					logrus.Error(errors.New("modifying instance map in state", cleanupErr))
+					logger.Error(errors.New("modifying instance map in state", cleanupErr))
 				}
 			}
 		}
@@ -133,7 +135,7 @@ func (p *GcloudProvider) RunInstance(params types.RunInstanceParams) (_ *types.I
 	if err != nil {
 		return nil, errors.New("creating instance on gcloud failed", err)
 	}
-	logrus.Infof("gcloud instance created: %+v", gInstance)
+	logger.Infof("gcloud instance created: %+v", gInstance)
 
 	instanceId = params.Name
 
@@ -154,7 +156,7 @@ func (p *GcloudProvider) RunInstance(params types.RunInstanceParams) (_ *types.I
 		return nil, errors.New("modifying instance map in state", err)
 	}
 
-	logrus.WithFields(logrus.Fields{"instance": instance}).Infof("instance created succesfully")
+	logger.WithFields(logrus.Fields{"instance": instance}).Infof("instance created succesfully")
 
 	return instance, nil
 }
@@ -39,6 +39,7 @@ import (
 )
 
 func (p *GcloudProvider) Stage(params types.StageImageParams) (_ *types.Image, err error) {
+	logger := util.LogEntry(params.Logger)
 	images, err := p.ListImages()
 	if err != nil {
 		return nil, errors.New("retrieving image list for existing image", err)
@@ -49,7 +50,7 @@ func (p *GcloudProvider) Stage(params types.StageImageParams) (_ *types.Image, e
 			if !params.Force {
 				return nil, errors.New("an image already exists with name '"+params.Name+"', try again with --force", nil)
 			} else {
-				logrus.WithField("image", image).Warnf("force: deleting previous image with name " + params.Name)
+				logger.WithField("image", image).Warnf("force: deleting previous image with name " + params.Name)
 				err = p.DeleteImage(image.Id, true)
 				if err != nil {
 					return nil, errors.New("removing previously existing image", err)
@@ -58,7 +59,7 @@ func (p *GcloudProvider) Stage(params types.StageImageParams) (_ *types.Image, e
 		}
 	}
 
-	logrus.WithField("raw-image", params.RawImage).WithField("project id", p.config.ProjectID).Infof("creating google image from raw image")
+	logger.WithField("raw-image", params.RawImage).WithField("project id", p.config.ProjectID).Infof("creating google image from raw image")
 
 	rawImageFile, err := os.Stat(params.RawImage.LocalImagePath)
 	if err != nil {
@@ -74,15 +75,15 @@ func (p *GcloudProvider) Stage(params types.StageImageParams) (_ *types.Image, e
 			return nil, errors.New("creating tmp file for raw image", err)
 		}
 		defer os.Remove(rawImage.Name())
-		logrus.Debugf("need to convert %v to image format RAW", params.RawImage.StageSpec.ImageFormat)
-		if err := common.ConvertRawImage(params.RawImage.StageSpec.ImageFormat, types.ImageFormat_RAW, params.RawImage.LocalImagePath, rawImage.Name()); err != nil {
+		logger.Debugf("need to convert %v to image format RAW", params.RawImage.StageSpec.ImageFormat)
+		if err := common.ConvertRawImage(params.RawImage.StageSpec.ImageFormat, types.ImageFormat_RAW, params.RawImage.LocalImagePath, rawImage.Name(), params.Containers); err != nil {
 			return nil, errors.New("converting qcow2 to vhd image", err)
 		}
 		os.Remove(params.RawImage.LocalImagePath)
 		//point at the new image
 		params.RawImage.LocalImagePath = rawImage.Name()
 		params.RawImage.StageSpec.ImageFormat = types.ImageFormat_RAW
-		imageSize, err = common.GetVirtualImageSize(params.RawImage.LocalImagePath, params.RawImage.StageSpec.ImageFormat)
+		imageSize, err = common.GetVirtualImageSize(params.RawImage.LocalImagePath, params.RawImage.StageSpec.ImageFormat, params.Containers)
 		if err != nil {
 			return nil, errors.New("getting virtual image size", err)
 		}
@@ -120,10 +121,10 @@ func (p *GcloudProvider) Stage(params types.StageImageParams) (_ *types.Image, e
 	if !params.NoCleanup {
 		defer func() {
 			if err := p.storage().Objects.Delete(bucketName, objectName).Do(); err != nil {
-				logrus.Warnf("failed to clean up object %v: %v", objectName, err)
+				logger.Warnf("failed to clean up object %v: %v", objectName, err)
 			}
 			if err := p.storage().Buckets.Delete(bucketName).Do(); err != nil {
-				logrus.Warnf("failed to clean up buket %v: %v", bucketName, err)
+				logger.Warnf("failed to clean up buket %v: %v", bucketName, err)
 			}
 		}()
 	}
@@ -132,7 +133,7 @@ func (p *GcloudProvider) Stage(params types.StageImageParams) (_ *types.Image, e
 	if err != nil {
 		return nil, errors.New("creating bucket "+bucketName, err)
 	}
-	logrus.Debug("created bucket ", bucket)
+	logger.Debug("created bucket ", bucket)
 
 	imageTar := filepath.Join(destDir, objectName)
 	file, err := os.Open(imageTar)
@@ -143,7 +144,7 @@ func (p *GcloudProvider) Stage(params types.StageImageParams) (_ *types.Image, e
 	if err != nil {
 		return nil, errors.New("uploading file "+imageTar, err)
 	}
-	logrus.Debug("uploaded object ", obj.Bucket)
+	logger.Debug("uploaded object ", obj.Bucket)
 
 	imageSpec := &compute.Image{
 		Name: params.Name,
@@ -152,7 +153,7 @@ func (p *GcloudProvider) Stage(params types.StageImageParams) (_ *types.Image, e
 		},
 	}
 
-	logrus.Debugf("creating image from " + imageSpec.RawDisk.Source)
+	logger.Debugf("creating image from " + imageSpec.RawDisk.Source)
 
 	operation, err := p.compute().Images.Insert(p.config.ProjectID, imageSpec).Do()
 	if err != nil {
@@ -163,7 +164,7 @@ func (p *GcloudProvider) Stage(params types.StageImageParams) (_ *types.Image, e
 		return nil, errors.New("waiting for image create operation to finish", err)
 	}
 
-	logrus.Infof("created google image successfully: %+v", operation)
+	logger.Infof("created google image successfully: %+v", operation)
 
 	sizeMb := imageSize >> 20
 
@@ -183,6 +184,6 @@ func (p *GcloudProvider) Stage(params types.StageImageParams) (_ *types.Image, e
 		return nil, errors.New("modifying image map in state", err)
 	}
 
-	logrus.WithFields(logrus.Fields{"image": image}).Infof("image created succesfully")
+	logger.WithFields(logrus.Fields{"image": image}).Infof("image created succesfully")
 	return image, nil
 }
@@ -21,6 +21,10 @@ package providers
 // THE SOFTWARE.
 
 import (
+	"io"
+	"sort"
+	"strings"
+
 	"github.com/bhojpur/kernel/pkg/types"
 	"github.com/bhojpur/kernel/pkg/util/errors"
 )
@@ -53,6 +57,53 @@ type Provider interface {
 	RemoteDeleteImage(params types.RemoteDeleteImagePararms) error
 }
 
+// InstancePauser is implemented by providers that can freeze a running
+// instance in place and resume it later.
+type InstancePauser interface {
+	PauseInstance(id string) error
+	ResumeInstance(id string) error
+}
+
+// InstanceMetricsGetter is implemented by providers that collect runtime
+// metrics from the hypervisor for each instance.
+type InstanceMetricsGetter interface {
+	GetInstanceMetrics(id string) (map[string]interface{}, error)
+}
+
+// ConsoleAttacher is implemented by providers that can connect a client
+// to the serial console of a running instance. Closing the returned
+// stream detaches the client without affecting the instance.
+type ConsoleAttacher interface {
+	AttachConsole(id string) (io.ReadWriteCloser, error)
+}
+
+// InstanceSnapshotter is implemented by providers that can save the
+// memory and device state of a running instance and start new instances
+// from it.
+type InstanceSnapshotter interface {
+	SnapshotInstance(params types.SnapshotInstanceParams) (*types.Snapshot, error)
+	RestoreSnapshot(params types.RestoreSnapshotParams) (*types.Instance, error)
+	ListSnapshots() ([]*types.Snapshot, error)
+	DeleteSnapshot(id string) error
+}
+
+// ResourceObserver is implemented by providers that can inspect their
+// infrastructure directly instead of trusting their state. The daemon's
+// reconciler uses it to find instances that died, VMs it lost track of and
+// files nothing refers to.
+type ResourceObserver interface {
+	ObserveResources() (*ObservedResources, error)
+}
+
+// ObservedResources is what a provider found on its infrastructure.
+type ObservedResources struct {
+	// Instances found, keyed by name, with their real Id and State
+	Instances map[string]*types.Instance
+	// Names of the images and volumes found
+	Images  []string
+	Volumes []string
+}
+
 type ProviderConfig struct {
 	UsePartitionTables bool
 }
@@ -67,6 +118,58 @@ func (providers Providers) Keys() []string {
 	return keys
 }
 
+// Lookup returns the provider registered under name. Accounts are
+// registered as "type/name"; a bare type matches when exactly one
+// account of that type is configured.
+func (providers Providers) Lookup(name string) (Provider, error) {
+	if provider, ok := providers[name]; ok {
+		return provider, nil
+	}
+	var matches []string
+	if !strings.Contains(name, "/") {
+		for key := range providers {
+			if ProviderType(key) == name {
+				matches = append(matches, key)
+			}
+		}
+	}
+	switch len(matches) {
+	case 1:
+		return providers[matches[0]], nil
+	case 0:
+		keys := providers.Keys()
+		sort.Strings(keys)
+		return nil, errors.New(name+" is not a known provider. Available: "+strings.Join(keys, "|"), nil)
+	default:
+		sort.Strings(matches)
+		return nil, errors.New(name+" has several accounts, choose one of: "+strings.Join(matches, "|"), nil)
+	}
+}
+
+// ProviderType strips the account name from a provider key,
+// e.g. "aws/us-east-1-prod" becomes "aws".
+func ProviderType(key string) string {
+	return strings.SplitN(key, "/", 2)[0]
+}
+
+// KeyOf returns the key p is registered under, or "" if it is not.
+func (providers Providers) KeyOf(p Provider) string {
+	for key, provider := range providers {
+		if provider == p {
+			return key
+		}
+	}
+	return ""
+}
+
+// ProviderKey is the key an account of providerType is registered under.
+func ProviderKey(providerType, name string) string {
+	if name == "" {
+		return providerType
+	}
+	return providerType + "/" + name
+}
+
 func (providers Providers) ProviderForImage(imageId string) (Provider, error) {
 	for _, provider := range providers {
 		_, err := provider.GetImage(imageId)
@@ -87,6 +190,25 @@ func (providers Providers) ProviderForInstance(instanceId string) (Provider, err
 	return nil, errors.New("instance "+instanceId+" not found", nil)
 }
 
+func (providers Providers) ProviderForSnapshot(snapshotId string) (Provider, error) {
+	for _, provider := range providers {
+		snapshotter, ok := provider.(InstanceSnapshotter)
+		if !ok {
+			continue
+		}
+		snapshots, err := snapshotter.ListSnapshots()
+		if err != nil {
+			continue
+		}
+		for _, snapshot := range snapshots {
+			if strings.Contains(snapshot.Id, snapshotId) || strings.Contains(snapshot.Name, snapshotId) {
+				return provider, nil
+			}
+		}
+	}
+	return nil, errors.New("snapshot "+snapshotId+" not found", nil)
+}
+
 func (providers Providers) ProviderForVolume(volumeId string) (Provider, error) {
 	for _, provider := range providers {
 		_, err := provider.GetVolume(volumeId)
@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
@@ -33,9 +34,10 @@ import (
 const DEFAULT_INSTANCE_DISKMB int = 10 * 1024 // 10 GB
 
 func (p *OpenstackProvider) RunInstance(params types.RunInstanceParams) (_ *types.Instance, err error) {
+	logger := kutil.LogEntry(params.Logger)
 	// return nil, errors.New("not yet supportded for openstack", nil)
 
-	logrus.WithFields(logrus.Fields{
+	logger.WithFields(logrus.Fields{
 		"image-id": params.ImageId,
 		"mounts":   params.MntPointsToVolumeIds,
 		"env":      params.Env,
@@ -94,7 +96,7 @@ func (p *OpenstackProvider) RunInstance(params types.RunInstanceParams) (_ *type
 		return nil, errors.New("failed to modify instance map in state", err)
 	}
 
-	logrus.WithFields(logrus.Fields{"instance": instance}).Infof("instance created succesfully")
+	logger.WithFields(logrus.Fields{"instance": instance}).Infof("instance created succesfully")
 
 	return instance, nil
 }
@@ -28,6 +28,7 @@ import (
 
 	kos "github.com/bhojpur/kernel/pkg/os"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
@@ -37,6 +38,7 @@ import (
 )
 
 func (p *OpenstackProvider) Stage(params types.StageImageParams) (_ *types.Image, err error) {
+	logger := kutil.LogEntry(params.Logger)
 	imageList, err := p.ListImages()
 	if err != nil {
 		return nil, errors.New("failed to retrieve image list", err)
@@ -48,7 +50,7 @@ func (p *OpenstackProvider) Stage(params types.StageImageParams) (_ *types.Image
 			if !params.Force {
 				return nil, errors.New(fmt.Sprintf("an image already exists with name '%s', try again with --force", params.Name), nil)
 			} else {
-				logrus.WithField("image", image).Warnf("force: deleting previous image with name '%s'", params.Name)
+				logger.WithField("image", image).Warnf("force: deleting previous image with name '%s'", params.Name)
 				err = p.DeleteImage(image.Id, true)
 				if err != nil {
 					return nil, errors.New("failed to remove existing image", err)
@@ -66,7 +68,7 @@ func (p *OpenstackProvider) Stage(params types.StageImageParams) (_ *types.Image
 		return nil, errors.New("creating new nova client session", err)
 	}
 
-	logrus.WithFields(logrus.Fields{
+	logger.WithFields(logrus.Fields{
 		"params": params,
 	}).Info("creating boot image from raw image")
 
@@ -85,7 +87,7 @@ func (p *OpenstackProvider) Stage(params types.StageImageParams) (_ *types.Image
 		return nil, errors.New("picking a flavor", err)
 	}
 
-	logrus.WithFields(logrus.Fields{
+	logger.WithFields(logrus.Fields{
 		"imageSizeB":  imageSizeB,
 		"imageSizeMB": imageSizeMB,
 		"flavor":      flavor,
@@ -115,7 +117,7 @@ func (p *OpenstackProvider) Stage(params types.StageImageParams) (_ *types.Image
 		return nil, errors.New("failed to modify image map in state", err)
 	}
 
-	logrus.WithFields(logrus.Fields{"image": image}).Infof("image created succesfully")
+	logger.WithFields(logrus.Fields{"image": image}).Infof("image created succesfully")
 	return image, nil
 }
 
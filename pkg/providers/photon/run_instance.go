@@ -26,6 +26,7 @@ import (
 
 	"github.com/bhojpur/kernel/pkg/providers/common"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/vmware/photon-controller-go-sdk/photon"
@@ -73,7 +74,8 @@ func (p *PhotonProvider) getKernelFlavor(kind string) (*photon.Flavor, error) {
 }
 
 func (p *PhotonProvider) RunInstance(params types.RunInstanceParams) (_ *types.Instance, err error) {
-	logrus.WithFields(logrus.Fields{
+	logger := kutil.LogEntry(params.Logger)
+	logger.WithFields(logrus.Fields{
 		"image-id": params.ImageId,
 		"mounts":   params.MntPointsToVolumeIds,
 		"env":      params.Env,
@@ -151,7 +153,7 @@ func (p *PhotonProvider) RunInstance(params types.RunInstanceParams) (_ *types.I
 		return nil, errors.New("modifying instance map in state", err)
 	}
 
-	logrus.WithField("instance", instance).Infof("instance created successfully")
+	logger.WithField("instance", instance).Infof("instance created successfully")
 
 	return instance, p.StartInstance(instance.Id)
 }
@@ -28,12 +28,14 @@ import (
 
 	"github.com/bhojpur/kernel/pkg/providers/common"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/vmware/photon-controller-go-sdk/photon"
 )
 
 func createVmdk(params types.StageImageParams, workVmdk func(file string) (string, error)) (string, int64, error) {
+	logger := kutil.LogEntry(params.Logger)
 
 	localVmdkDir, err := ioutil.TempDir("", "vmdkdir.")
 	if err != nil {
@@ -42,8 +44,8 @@ func createVmdk(params types.StageImageParams, workVmdk func(file string) (strin
 	defer os.RemoveAll(localVmdkDir)
 	localVmdkFile := filepath.Join(localVmdkDir, "boot.vmdk")
 
-	logrus.WithField("raw-image", params.RawImage).Infof("creating boot volume from raw image")
-	if err := common.ConvertRawToNewVmdk(params.RawImage.LocalImagePath, localVmdkFile); err != nil {
+	logger.WithField("raw-image", params.RawImage).Infof("creating boot volume from raw image")
+	if err := common.ConvertRawToNewVmdk(params.RawImage.LocalImagePath, localVmdkFile, params.Containers); err != nil {
 		return "", 0, errors.New("converting raw image to vmdk", err)
 	}
 
@@ -53,7 +55,7 @@ func createVmdk(params types.StageImageParams, workVmdk func(file string) (strin
 	}
 	sizeMb := rawImageFile.Size() >> 20
 
-	logrus.WithFields(logrus.Fields{
+	logger.WithFields(logrus.Fields{
 		"name": params.Name,
 		"id":   params.Name,
 		"size": sizeMb,
@@ -65,6 +67,7 @@ func createVmdk(params types.StageImageParams, workVmdk func(file string) (strin
 }
 
 func (p *PhotonProvider) Stage(params types.StageImageParams) (_ *types.Image, err error) {
+	logger := kutil.LogEntry(params.Logger)
 	images, err := p.ListImages()
 	if err != nil {
 		return nil, errors.New("retrieving image list for existing image", err)
@@ -74,9 +77,9 @@ func (p *PhotonProvider) Stage(params types.StageImageParams) (_ *types.Image, e
 			if !params.Force {
 				return nil, errors.New("an image already exists with name '"+params.Name+"', try again with --force", nil)
 			} else {
-				logrus.WithField("image", image).Warnf("force: deleting previous image with name " + params.Name)
+				logger.WithField("image", image).Warnf("force: deleting previous image with name " + params.Name)
 				if err := p.DeleteImage(image.Id, true); err != nil {
-					logrus.Warn(errors.New("failed removing previously existing image", err))
+					logger.Warn(errors.New("failed removing previously existing image", err))
 				}
 			}
 		}
@@ -121,6 +124,6 @@ func (p *PhotonProvider) Stage(params types.StageImageParams) (_ *types.Image, e
 		return nil, errors.New("modifying image map in state", err)
 	}
 
-	logrus.WithFields(logrus.Fields{"image": image}).Infof("image created succesfully")
+	logger.WithFields(logrus.Fields{"image": image}).Infof("image created succesfully")
 	return image, nil
 }
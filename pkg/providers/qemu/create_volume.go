@@ -27,30 +27,31 @@ import (
 
 	"github.com/bhojpur/kernel/pkg/providers/common"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
-	"github.com/sirupsen/logrus"
 )
 
 func (p *QemuProvider) CreateVolume(params types.CreateVolumeParams) (_ *types.Volume, err error) {
+	logger := kutil.LogEntry(params.Logger)
 	if _, volumeErr := p.GetImage(params.Name); volumeErr == nil {
 		return nil, errors.New("volume already exists", nil)
 	}
 
-	volumePath := getVolumePath(params.Name)
+	volumePath := p.getVolumePath(params.Name)
 	if err := os.MkdirAll(filepath.Dir(volumePath), 0755); err != nil {
 		return nil, errors.New("creating directory for volume file", err)
 	}
 	defer func() {
 		if err != nil {
 			if params.NoCleanup {
-				logrus.Warnf("because --no-cleanup flag was provided, not cleaning up failed volume %s at %s", params.Name, volumePath)
+				logger.Warnf("because --no-cleanup flag was provided, not cleaning up failed volume %s at %s", params.Name, volumePath)
 			} else {
 				os.RemoveAll(filepath.Dir(volumePath))
 			}
 		}
 	}()
-	logrus.WithField("raw-image", params.ImagePath).Infof("creating volume from raw image")
-	if err := common.ConvertRawImage(types.ImageFormat_RAW, types.ImageFormat_QCOW2, params.ImagePath, volumePath); err != nil {
+	logger.WithField("raw-image", params.ImagePath).Infof("creating volume from raw image")
+	if err := common.ConvertRawImage(types.ImageFormat_RAW, types.ImageFormat_QCOW2, params.ImagePath, volumePath, nil); err != nil {
 		return nil, errors.New("converting raw image to vmdk", err)
 	}
 
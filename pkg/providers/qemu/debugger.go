@@ -30,7 +30,7 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func startDebuggerListener(port int) error {
+func (p *QemuProvider) startDebuggerListener(port int) error {
 	addr := fmt.Sprintf(":%v", port)
 	ln, err := net.Listen("tcp", addr)
 	if err != nil {
@@ -44,20 +44,20 @@ func startDebuggerListener(port int) error {
 				logrus.WithError(err).Warnf("failed to accept debugger connection")
 				continue
 			}
-			go connectDebugger(conn)
+			go p.connectDebugger(conn)
 		}
 	}()
 	return nil
 }
 
-func connectDebugger(conn net.Conn) {
-	if debuggerTargetImageName == "" {
+func (p *QemuProvider) connectDebugger(conn net.Conn) {
+	if p.debuggerTargetImageName == "" {
 		logrus.Error("no debug instance is currently running")
 		return
 	}
 	container := kutil.NewContainer("rump-debugger-qemu").
 		WithNet("host").
-		WithVolume(filepath.Dir(getKernelPath(debuggerTargetImageName)), "/opt/prog/").
+		WithVolume(filepath.Dir(p.getKernelPath(p.debuggerTargetImageName)), "/opt/prog/").
 		Interactive(true)
 
 	cmd := container.BuildCmd(
@@ -76,7 +76,7 @@ func connectDebugger(conn net.Conn) {
 	}
 	defer func() {
 		//reset debugger target
-		debuggerTargetImageName = ""
+		p.debuggerTargetImageName = ""
 		container.Stop()
 	}()
 
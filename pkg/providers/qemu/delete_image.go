@@ -52,7 +52,7 @@ func (p *QemuProvider) DeleteImage(id string, force bool) error {
 		}
 	}
 
-	imagePath := getImagePath(image.Name)
+	imagePath := p.getImagePath(image.Name)
 	logrus.Warnf("deleting image file at %s", imagePath)
 	if err := os.RemoveAll(filepath.Dir(imagePath)); err != nil {
 		return errors.New("deleing image file at "+imagePath, err)
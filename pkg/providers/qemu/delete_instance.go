@@ -20,6 +20,21 @@ package qemu
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
+import (
+	"os"
+
+	"github.com/bhojpur/kernel/pkg/util/errors"
+)
+
 func (p *QemuProvider) DeleteInstance(id string, force bool) error {
-	return p.StopInstance(id)
+	instance, err := p.GetInstance(id)
+	if err != nil {
+		return errors.New("retrieving instance "+id, err)
+	}
+	if err := p.stopInstance(instance); err != nil {
+		return errors.New("stopping instance "+instance.Name, err)
+	}
+	os.RemoveAll(p.getInstanceDir(instance.Name))
+
+	return p.state.RemoveInstance(instance)
 }
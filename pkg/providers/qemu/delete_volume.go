@@ -40,7 +40,7 @@ func (p *QemuProvider) DeleteVolume(id string, force bool) error {
 			return errors.New("volume "+volume.Id+" is attached to instance."+volume.Attachment+", try again with --force or detach volume first", err)
 		}
 	}
-	volumePath := getVolumePath(volume.Name)
+	volumePath := p.getVolumePath(volume.Name)
 	err = os.Remove(volumePath)
 	if err != nil {
 		return errors.New("could not delete volume at path "+volumePath, err)
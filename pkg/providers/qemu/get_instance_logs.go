@@ -20,8 +20,21 @@ package qemu
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
-import "github.com/bhojpur/kernel/pkg/util/errors"
+import (
+	"github.com/bhojpur/kernel/pkg/util"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+)
 
 func (p *QemuProvider) GetInstanceLogs(id string) (string, error) {
-	return "", errors.New("not supported", nil)
+	instance, err := p.GetInstance(id)
+	if err != nil {
+		return "", errors.New("retrieving instance "+id, err)
+	}
+	p.captureSerialLog(instance.Name)
+
+	logdata, err := util.ReadRotatingFile(p.getSerialLogPath(instance.Name))
+	if err != nil {
+		return "", errors.New("reading serial log for instance "+instance.Name, err)
+	}
+	return string(logdata), nil
 }
@@ -0,0 +1,143 @@
+package qemu
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/bhojpur/kernel/pkg/providers/common"
+	"github.com/bhojpur/kernel/pkg/types"
+	"github.com/bhojpur/kernel/pkg/util"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const powerdownTimeout = 10 * time.Second
+
+// saveLaunchArgs persists the qemu arguments of an instance so it can be
+// started again after it has been stopped, even across daemon restarts.
+func (p *QemuProvider) saveLaunchArgs(instanceName string, args []string) error {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return errors.New("marshalling launch arguments", err)
+	}
+	if err := ioutil.WriteFile(p.getLaunchArgsPath(instanceName), data, 0644); err != nil {
+		return errors.New("writing launch arguments for instance "+instanceName, err)
+	}
+	return nil
+}
+
+func (p *QemuProvider) loadLaunchArgs(instanceName string) ([]string, error) {
+	data, err := ioutil.ReadFile(p.getLaunchArgsPath(instanceName))
+	if err != nil {
+		return nil, errors.New("reading launch arguments for instance "+instanceName, err)
+	}
+	var args []string
+	if err := json.Unmarshal(data, &args); err != nil {
+		return nil, errors.New("parsing launch arguments for instance "+instanceName, err)
+	}
+	return args, nil
+}
+
+func (p *QemuProvider) launch(instanceName string, qemuArgs []string) (*exec.Cmd, error) {
+	cmd := exec.Command("qemu-system-x86_64", qemuArgs...)
+
+	util.LogCommand(cmd, true)
+
+	if err := cmd.Start(); err != nil {
+		return nil, errors.New("can't start qemu - make sure it's in your path.", nil)
+	}
+	// qemu holds the guest until the serial console is connected, so an
+	// instance that cannot be captured would hang forever
+	capturing := p.claimSerialCapture(instanceName)
+	conn, err := p.connectSerial(instanceName)
+	if err != nil {
+		if capturing {
+			p.releaseSerialCapture(instanceName, nil)
+		}
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, errors.New("qemu did not open the serial console", err)
+	}
+	if capturing {
+		go p.copySerial(instanceName, conn)
+	} else {
+		// an earlier capture of the instance is still shutting down
+		conn.Close()
+	}
+	// close command resources, and keep why qemu exited for the supervisor
+	go func() {
+		reason := common.ExitReason(cmd.Wait())
+		pid := strconv.Itoa(cmd.Process.Pid)
+		p.state.ModifyInstances(func(instances map[string]*types.Instance) error {
+			if instance, ok := instances[pid]; ok {
+				instance.LastExitReason = reason
+			}
+			return nil
+		})
+	}()
+
+	return cmd, nil
+}
+
+// shutdown asks the guest to power down through QMP and falls back to
+// quitting qemu, then to SIGKILL, if the instance does not exit in time.
+func (p *QemuProvider) shutdown(instanceName string, pid int, paused bool) {
+	// a paused guest cannot react to ACPI events
+	if !paused {
+		if _, err := p.qmpExecute(instanceName, "system_powerdown", nil); err != nil {
+			logrus.WithError(err).Warnf("graceful powerdown of instance %s failed", instanceName)
+		} else if waitForExit(pid, powerdownTimeout) {
+			return
+		} else {
+			logrus.Warnf("instance %s did not power down within %v", instanceName, powerdownTimeout)
+		}
+	}
+	if _, err := p.qmpExecute(instanceName, "quit", nil); err == nil && waitForExit(pid, qmpTimeout) {
+		return
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		logrus.Warn("failed finding instance, assuming instance has externally terminated", err)
+		return
+	}
+	if err := process.Signal(syscall.SIGKILL); err != nil {
+		logrus.Warn("failed terminating instance, assuming instance has externally terminated", err)
+	}
+}
+
+func waitForExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if err := detectInstance(pid); err != nil {
+			return true
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	return false
+}
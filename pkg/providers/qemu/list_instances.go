@@ -38,6 +38,10 @@ func (p *QemuProvider) ListInstances() ([]*types.Instance, error) {
 
 	var instances []*types.Instance
 	for _, instance := range p.state.GetInstances() {
+		if instance.State == types.InstanceState_Stopped {
+			instances = append(instances, instance)
+			continue
+		}
 		pid, err := strconv.Atoi(instance.Id)
 		if err != nil {
 			logrus.WithField("instance", instance).Warn("invalid pid - removing instance")
@@ -45,9 +49,16 @@ func (p *QemuProvider) ListInstances() ([]*types.Instance, error) {
 			continue
 		}
 		if err := detectInstance(pid); err != nil {
-			logrus.WithField("instance", instance).Debug("Instance is not running; removing")
-			p.state.RemoveInstance(instance)
-			continue
+			if _, err := os.Stat(p.getLaunchArgsPath(instance.Name)); err != nil {
+				logrus.WithField("instance", instance).Debug("Instance is not running; removing")
+				p.state.RemoveInstance(instance)
+				continue
+			}
+			logrus.WithField("instance", instance).Debug("Instance is not running; marking stopped")
+			if err := p.setInstanceState(instance, types.InstanceState_Stopped); err != nil {
+				return nil, err
+			}
+			instance.State = types.InstanceState_Stopped
 		}
 		instances = append(instances, instance)
 	}
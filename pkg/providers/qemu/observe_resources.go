@@ -0,0 +1,115 @@
+package qemu
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/bhojpur/kernel/pkg/providers"
+	"github.com/bhojpur/kernel/pkg/providers/common"
+	"github.com/bhojpur/kernel/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// ObserveResources looks for qemu processes and launch files of every
+// instance directory, and for image and volume directories on disk.
+func (p *QemuProvider) ObserveResources() (*providers.ObservedResources, error) {
+	observed := &providers.ObservedResources{Instances: map[string]*types.Instance{}}
+
+	instanceNames, err := common.ListDirs(p.instancesDirectory())
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range instanceNames {
+		instance := &types.Instance{
+			Name:           name,
+			Infrastructure: types.Infrastructure_QEMU,
+		}
+		if pid := p.findQemuPid(name); pid > 0 {
+			instance.Id = strconv.Itoa(pid)
+			switch p.qmpStatus(name) {
+			case "paused":
+				instance.State = types.InstanceState_Paused
+			case "internal-error", "io-error", "guest-panicked":
+				instance.State = types.InstanceState_Error
+			default:
+				instance.State = types.InstanceState_Running
+			}
+		} else if _, err := os.Stat(p.getLaunchArgsPath(name)); err == nil {
+			instance.State = types.InstanceState_Stopped
+		} else {
+			continue
+		}
+		if info, err := os.Stat(p.getInstanceDir(name)); err == nil {
+			instance.Created = info.ModTime()
+		}
+		observed.Instances[name] = instance
+	}
+
+	if observed.Images, err = common.ListDirs(p.imagesDirectory()); err != nil {
+		return nil, err
+	}
+	if observed.Volumes, err = common.ListDirs(p.volumesDirectory()); err != nil {
+		return nil, err
+	}
+	return observed, nil
+}
+
+// findQemuPid returns the pid of the qemu process serving the instance's
+// qmp socket, or 0 if there is none.
+func (p *QemuProvider) findQemuPid(instanceName string) int {
+	socket := []byte(p.getQmpSocketPath(instanceName) + ",")
+	procs, err := filepath.Glob("/proc/[0-9]*/cmdline")
+	if err != nil {
+		return 0
+	}
+	for _, cmdlinePath := range procs {
+		cmdline, err := ioutil.ReadFile(cmdlinePath)
+		if err != nil || !bytes.Contains(cmdline, []byte("qemu-system")) || !bytes.Contains(cmdline, socket) {
+			continue
+		}
+		pid, err := strconv.Atoi(filepath.Base(filepath.Dir(cmdlinePath)))
+		if err == nil {
+			return pid
+		}
+	}
+	return 0
+}
+
+func (p *QemuProvider) qmpStatus(instanceName string) string {
+	data, err := p.qmpExecute(instanceName, "query-status", nil)
+	if err != nil {
+		logrus.WithError(err).Debugf("querying status of instance %s", instanceName)
+		return ""
+	}
+	var status struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return ""
+	}
+	return status.Status
+}
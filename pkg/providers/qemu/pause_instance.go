@@ -0,0 +1,54 @@
+package qemu
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"github.com/bhojpur/kernel/pkg/types"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+)
+
+func (p *QemuProvider) PauseInstance(id string) error {
+	instance, err := p.GetInstance(id)
+	if err != nil {
+		return errors.New("retrieving instance "+id, err)
+	}
+	if instance.State != types.InstanceState_Running {
+		return errors.New("instance "+instance.Name+" is "+string(instance.State)+", only running instances can be paused", nil)
+	}
+	if _, err := p.qmpExecute(instance.Name, "stop", nil); err != nil {
+		return errors.New("pausing instance "+instance.Name, err)
+	}
+	return p.setInstanceState(instance, types.InstanceState_Paused)
+}
+
+func (p *QemuProvider) ResumeInstance(id string) error {
+	instance, err := p.GetInstance(id)
+	if err != nil {
+		return errors.New("retrieving instance "+id, err)
+	}
+	if instance.State != types.InstanceState_Paused {
+		return errors.New("instance "+instance.Name+" is "+string(instance.State)+", only paused instances can be resumed", nil)
+	}
+	if _, err := p.qmpExecute(instance.Name, "cont", nil); err != nil {
+		return errors.New("resuming instance "+instance.Name, err)
+	}
+	return p.setInstanceState(instance, types.InstanceState_Running)
+}
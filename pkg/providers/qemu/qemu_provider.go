@@ -23,52 +23,85 @@ package qemu
 import (
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/bhojpur/kernel/pkg/config"
+	"github.com/bhojpur/kernel/pkg/providers/common"
 	"github.com/bhojpur/kernel/pkg/state"
+	"github.com/bhojpur/kernel/pkg/types"
 	"github.com/bhojpur/kernel/pkg/util/errors"
 )
 
-var debuggerTargetImageName string
-
 type QemuProvider struct {
 	config config.Qemu
 	state  state.State
+	// dir holds the images, instances, volumes and snapshots of this account
+	dir string
+
+	// image of the instance started in debug mode, the debugger attaches to it
+	debuggerTargetImageName string
+
+	// serial consoles of instances, keyed by name; nil while connecting
+	serialCaptures map[string]*common.Console
+	serialLock     sync.Mutex
 }
 
 func QemuStateFile() string {
 	return filepath.Join(config.Internal.KernelHome, "qemu/state.json")
 
 }
-func qemuImagesDirectory() string {
-	return filepath.Join(config.Internal.KernelHome, "qemu/images/")
+
+// QemuDirectory is where the account called name keeps its files. Named
+// accounts get their own directory next to their state file, so several
+// accounts never share images or instances.
+func QemuDirectory(name string) string {
+	return filepath.Join(config.Internal.KernelHome, "qemu", name)
 }
 
-func qemuInstancesDirectory() string {
-	return filepath.Join(config.Internal.KernelHome, "qemu/instances/")
+func (p *QemuProvider) imagesDirectory() string {
+	return filepath.Join(p.dir, "images")
 }
 
-func qemuVolumesDirectory() string {
-	return filepath.Join(config.Internal.KernelHome, "qemu/volumes/")
+func (p *QemuProvider) instancesDirectory() string {
+	return filepath.Join(p.dir, "instances")
 }
 
-func NewQemuProvider(config config.Qemu) (*QemuProvider, error) {
+func (p *QemuProvider) volumesDirectory() string {
+	return filepath.Join(p.dir, "volumes")
+}
 
-	os.MkdirAll(qemuImagesDirectory(), 0777)
-	os.MkdirAll(qemuInstancesDirectory(), 0777)
-	os.MkdirAll(qemuVolumesDirectory(), 0777)
+func (p *QemuProvider) snapshotsDirectory() string {
+	return filepath.Join(p.dir, "snapshots")
+}
 
-	if config.DebuggerPort == 0 {
+func NewQemuProvider(config config.Qemu) (*QemuProvider, error) {
+	// named accounts only listen for debuggers on the port they are given,
+	// so several of them never compete for the default one
+	if config.DebuggerPort == 0 && config.Name == "" {
 		config.DebuggerPort = 3001
 	}
 
-	if err := startDebuggerListener(config.DebuggerPort); err != nil {
-		return nil, errors.New("establishing debugger tcp listener", err)
+	if config.SerialLogMaxMb == 0 {
+		config.SerialLogMaxMb = 10
 	}
 
+	dir := QemuDirectory(config.Name)
 	p := &QemuProvider{
-		config: config,
-		state:  state.NewBasicState(QemuStateFile()),
+		config:         config,
+		state:          state.NewBasicState(filepath.Join(dir, "state.json")),
+		dir:            dir,
+		serialCaptures: map[string]*common.Console{},
+	}
+
+	os.MkdirAll(p.imagesDirectory(), 0777)
+	os.MkdirAll(p.instancesDirectory(), 0777)
+	os.MkdirAll(p.volumesDirectory(), 0777)
+	os.MkdirAll(p.snapshotsDirectory(), 0777)
+
+	if config.DebuggerPort != 0 {
+		if err := p.startDebuggerListener(config.DebuggerPort); err != nil {
+			return nil, errors.New("establishing debugger tcp listener", err)
+		}
 	}
 
 	return p, nil
@@ -76,21 +109,56 @@ func NewQemuProvider(config config.Qemu) (*QemuProvider, error) {
 
 func (p *QemuProvider) WithState(state state.State) *QemuProvider {
 	p.state = state
+	// resume capturing the serial output of instances that outlived a
+	// daemon restart
+	for _, instance := range state.GetInstances() {
+		if instance.State != types.InstanceState_Stopped {
+			p.captureSerialLog(instance.Name)
+		}
+	}
 	return p
 }
 
-func getImagePath(imageName string) string {
-	return filepath.Join(qemuImagesDirectory(), imageName, "boot.img")
+func (p *QemuProvider) getImagePath(imageName string) string {
+	return filepath.Join(p.imagesDirectory(), imageName, "boot.img")
+}
+
+func (p *QemuProvider) getKernelPath(imageName string) string {
+	return filepath.Join(p.imagesDirectory(), imageName, "program.bin")
+}
+
+func (p *QemuProvider) getLoaderPath(imageName string) string {
+	return filepath.Join(p.imagesDirectory(), imageName, "loader.elf")
+}
+
+func (p *QemuProvider) getCmdlinePath(imageName string) string {
+	return filepath.Join(p.imagesDirectory(), imageName, "cmdline")
+}
+
+func (p *QemuProvider) getVolumePath(volumeName string) string {
+	return filepath.Join(p.volumesDirectory(), volumeName, "data.img")
+}
+
+func (p *QemuProvider) getInstanceDir(instanceName string) string {
+	return filepath.Join(p.instancesDirectory(), instanceName)
+}
+
+func (p *QemuProvider) getSnapshotDir(snapshotName string) string {
+	return filepath.Join(p.snapshotsDirectory(), snapshotName)
+}
+
+func (p *QemuProvider) getSerialSocketPath(instanceName string) string {
+	return filepath.Join(p.instancesDirectory(), instanceName, "serial.sock")
 }
 
-func getKernelPath(imageName string) string {
-	return filepath.Join(qemuImagesDirectory(), imageName, "program.bin")
+func (p *QemuProvider) getSerialLogPath(instanceName string) string {
+	return filepath.Join(p.instancesDirectory(), instanceName, "serial.log")
 }
 
-func getCmdlinePath(imageName string) string {
-	return filepath.Join(qemuImagesDirectory(), imageName, "cmdline")
+func (p *QemuProvider) getQmpSocketPath(instanceName string) string {
+	return filepath.Join(p.instancesDirectory(), instanceName, "qmp.sock")
 }
 
-func getVolumePath(volumeName string) string {
-	return filepath.Join(qemuVolumesDirectory(), volumeName, "data.img")
+func (p *QemuProvider) getLaunchArgsPath(instanceName string) string {
+	return filepath.Join(p.instancesDirectory(), instanceName, "launch.json")
 }
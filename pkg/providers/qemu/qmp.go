@@ -0,0 +1,90 @@
+package qemu
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"time"
+
+	"github.com/bhojpur/kernel/pkg/util/errors"
+)
+
+const qmpTimeout = 5 * time.Second
+
+type qmpCommand struct {
+	Execute   string      `json:"execute"`
+	Arguments interface{} `json:"arguments,omitempty"`
+}
+
+type qmpResponse struct {
+	Return json.RawMessage `json:"return"`
+	Event  string          `json:"event"`
+	Error  *struct {
+		Class string `json:"class"`
+		Desc  string `json:"desc"`
+	} `json:"error"`
+}
+
+// qmpExecute connects to the QMP control socket of an instance, negotiates
+// capabilities and runs a single command, returning its raw result.
+func (p *QemuProvider) qmpExecute(instanceName, command string, arguments interface{}) (json.RawMessage, error) {
+	conn, err := net.DialTimeout("unix", p.getQmpSocketPath(instanceName), qmpTimeout)
+	if err != nil {
+		return nil, errors.New("connecting to qmp socket of instance "+instanceName, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(qmpTimeout))
+
+	decoder := json.NewDecoder(bufio.NewReader(conn))
+	encoder := json.NewEncoder(conn)
+
+	// greeting
+	var greeting map[string]interface{}
+	if err := decoder.Decode(&greeting); err != nil {
+		return nil, errors.New("reading qmp greeting", err)
+	}
+	if _, err := qmpRoundTrip(decoder, encoder, qmpCommand{Execute: "qmp_capabilities"}); err != nil {
+		return nil, errors.New("negotiating qmp capabilities", err)
+	}
+	return qmpRoundTrip(decoder, encoder, qmpCommand{Execute: command, Arguments: arguments})
+}
+
+func qmpRoundTrip(decoder *json.Decoder, encoder *json.Encoder, command qmpCommand) (json.RawMessage, error) {
+	if err := encoder.Encode(command); err != nil {
+		return nil, errors.New("sending qmp command "+command.Execute, err)
+	}
+	for {
+		var resp qmpResponse
+		if err := decoder.Decode(&resp); err != nil {
+			return nil, errors.New("reading qmp response to "+command.Execute, err)
+		}
+		// asynchronous events may arrive before the reply
+		if resp.Event != "" {
+			continue
+		}
+		if resp.Error != nil {
+			return nil, errors.New("qmp command "+command.Execute+" failed: "+resp.Error.Class+": "+resp.Error.Desc, nil)
+		}
+		return resp.Return, nil
+	}
+}
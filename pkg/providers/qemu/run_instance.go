@@ -23,7 +23,6 @@ package qemu
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"strings"
 	"time"
 
@@ -32,13 +31,14 @@ import (
 	"github.com/bhojpur/kernel/pkg/compilers"
 	"github.com/bhojpur/kernel/pkg/providers/common"
 	"github.com/bhojpur/kernel/pkg/types"
-	"github.com/bhojpur/kernel/pkg/util"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
 	"github.com/sirupsen/logrus"
 )
 
 func (p *QemuProvider) RunInstance(params types.RunInstanceParams) (_ *types.Instance, err error) {
-	logrus.WithFields(logrus.Fields{
+	logger := kutil.LogEntry(params.Logger)
+	logger.WithFields(logrus.Fields{
 		"image-id": params.ImageId,
 		"mounts":   params.MntPointsToVolumeIds,
 		"env":      params.Env,
@@ -68,7 +68,7 @@ func (p *QemuProvider) RunInstance(params types.RunInstanceParams) (_ *types.Ins
 		volumeIdInOrder[controllerPort] = volumeId
 	}
 
-	logrus.Debugf("creating qemu vm")
+	logger.Debugf("creating qemu vm")
 
 	volImagesInOrder, err := p.getVolumeImages(volumeIdInOrder)
 	if err != nil {
@@ -81,14 +81,33 @@ func (p *QemuProvider) RunInstance(params types.RunInstanceParams) (_ *types.Ins
 		params.InstanceMemory = image.RunSpec.DefaultInstanceMemory
 	}
 
+	instanceDir := p.getInstanceDir(params.Name)
+	if err := os.MkdirAll(instanceDir, 0755); err != nil {
+		return nil, errors.New("creating directory for instance", err)
+	}
+	defer func() {
+		if err != nil && !params.NoCleanup {
+			os.RemoveAll(instanceDir)
+		}
+	}()
+
+	isBhojpur := compilers.CompilerType(image.RunSpec.Compiler).Base() == compilers.Bhojpur
+
+	nicModel := image.RunSpec.NicModel
+	if nicModel == "" {
+		nicModel = "virtio"
+	}
 	qemuArgs := []string{"-m", fmt.Sprintf("%v", params.InstanceMemory), "-net",
-		"nic,model=virtio,netdev=mynet0", "-netdev", "user,id=mynet0,net=192.168.76.0/24,dhcpstart=192.168.76.9",
+		"nic,model=" + nicModel + ",netdev=mynet0", "-netdev", "user,id=mynet0,net=192.168.76.0/24,dhcpstart=192.168.76.9",
 	}
 
-	cmdlinedata, err := ioutil.ReadFile(getCmdlinePath(image.Name))
-	if err != nil {
-		logrus.Debugf("cmdLine not found, assuming classic bootloader")
-		qemuArgs = append(qemuArgs, "-drive", fmt.Sprintf("file=%s,format=raw,if=ide", getImagePath(image.Name)))
+	cmdlinedata, err := ioutil.ReadFile(p.getCmdlinePath(image.Name))
+	if isBhojpur {
+		// boot the multiboot loader, which loads the kernel from its module
+		qemuArgs = append(qemuArgs, "-kernel", p.getLoaderPath(image.Name), "-initrd", p.getImagePath(image.Name))
+	} else if err != nil {
+		logger.Debugf("cmdLine not found, assuming classic bootloader")
+		qemuArgs = append(qemuArgs, "-drive", fmt.Sprintf("file=%s,format=raw,if=ide", p.getImagePath(image.Name)))
 	} else {
 		// inject env for rump:
 		cmdline := string(cmdlinedata)
@@ -99,32 +118,44 @@ func (p *QemuProvider) RunInstance(params types.RunInstanceParams) (_ *types.Ins
 		// qemu escape
 		cmdline = strings.Replace(cmdline, ",", ",,", -1)
 
-		if _, err := os.Stat(getImagePath(image.Name)); err == nil {
+		if _, err := os.Stat(p.getImagePath(image.Name)); err == nil {
 			qemuArgs = append(qemuArgs, "-device", "virtio-blk-pci,id=blk0,drive=hd0")
-			qemuArgs = append(qemuArgs, "-drive", fmt.Sprintf("file=%s,format=qcow2,if=none,id=hd0", getImagePath(image.Name)))
+			qemuArgs = append(qemuArgs, "-drive", fmt.Sprintf("file=%s,format=qcow2,if=none,id=hd0", p.getImagePath(image.Name)))
 		}
 
-		qemuArgs = append(qemuArgs, "-kernel", getKernelPath(image.Name))
+		qemuArgs = append(qemuArgs, "-kernel", p.getKernelPath(image.Name))
 		qemuArgs = append(qemuArgs, "-append", cmdline)
 	}
 
 	if params.DebugMode {
-		logrus.Debugf("running instance in debug mode.\nattach Bhojpur Kernel debugger to port :%v", p.config.DebuggerPort)
+		if p.config.DebuggerPort == 0 {
+			return nil, errors.New("debug mode needs a debugger_port in the config of qemu account "+p.config.Name, nil)
+		}
+		logger.Debugf("running instance in debug mode.\nattach Bhojpur Kernel debugger to port :%v", p.config.DebuggerPort)
 		qemuArgs = append(qemuArgs, "-s", "-S")
-		debuggerTargetImageName = image.Name
+		p.debuggerTargetImageName = image.Name
 	}
 
 	if p.config.NoGraphic {
 		qemuArgs = append(qemuArgs, "-nographic", "-vga", "none")
 	}
 
+	// without nowait qemu holds the guest until the serial capture is
+	// connected, so the log starts with the very first line of output;
+	// launch kills qemu if it cannot connect
+	qemuArgs = append(qemuArgs, "-chardev", fmt.Sprintf("socket,id=serial0,path=%s,server", p.getSerialSocketPath(params.Name)))
+	qemuArgs = append(qemuArgs, "-serial", "chardev:serial0")
+	qemuArgs = append(qemuArgs, "-qmp", fmt.Sprintf("unix:%s,server,nowait", p.getQmpSocketPath(params.Name)))
+
 	qemuArgs = append(qemuArgs, volArgs...)
-	cmd := exec.Command("qemu-system-x86_64", qemuArgs...)
 
-	util.LogCommand(cmd, true)
+	if err := p.saveLaunchArgs(params.Name, qemuArgs); err != nil {
+		return nil, err
+	}
 
-	if err := cmd.Start(); err != nil {
-		return nil, errors.New("can't start qemu - make sure it's in your path.", nil)
+	cmd, err := p.launch(params.Name, qemuArgs)
+	if err != nil {
+		return nil, err
 	}
 
 	var instanceIp string
@@ -146,7 +177,7 @@ func (p *QemuProvider) RunInstance(params types.RunInstanceParams) (_ *types.Ins
 		return nil, errors.New("modifying instance map in state", err)
 	}
 
-	logrus.WithField("instance", instance).Infof("instance created successfully")
+	logger.WithField("instance", instance).Infof("instance created successfully")
 
 	return instance, nil
 }
@@ -159,7 +190,7 @@ func (p *QemuProvider) getVolumeImages(volumeIdInOrder []string) ([]string, erro
 		if err != nil {
 			return nil, err
 		}
-		volPath = append(volPath, getVolumePath(v.Name))
+		volPath = append(volPath, p.getVolumePath(v.Name))
 	}
 	return volPath, nil
 }
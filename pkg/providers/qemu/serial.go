@@ -0,0 +1,145 @@
+package qemu
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"github.com/bhojpur/kernel/pkg/providers/common"
+	"github.com/bhojpur/kernel/pkg/types"
+	"github.com/bhojpur/kernel/pkg/util"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// serialConnectRetries bounds how long the daemon waits for qemu to
+// create the serial socket, even on a busy host
+const serialConnectRetries = 120
+
+// connectSerial connects to the serial socket of an instance. qemu does
+// not boot the guest until this connects.
+func (p *QemuProvider) connectSerial(instanceName string) (net.Conn, error) {
+	var conn net.Conn
+	if err := util.Retry(serialConnectRetries, 250*time.Millisecond, func() error {
+		var err error
+		conn, err = net.Dial("unix", p.getSerialSocketPath(instanceName))
+		return err
+	}); err != nil {
+		return nil, errors.New("connecting to serial console of instance "+instanceName, err)
+	}
+	return conn, nil
+}
+
+// captureSerialLog resumes capturing the serial output of an instance
+// that is not being captured, e.g. after a daemon restart. qemu keeps
+// listening on the socket, so connecting again picks up where the last
+// capture stopped.
+func (p *QemuProvider) captureSerialLog(instanceName string) {
+	if !p.claimSerialCapture(instanceName) {
+		return
+	}
+	go func() {
+		conn, err := p.connectSerial(instanceName)
+		if err != nil {
+			logrus.WithError(err).Warnf("failed capturing serial console of instance %s", instanceName)
+			p.releaseSerialCapture(instanceName, nil)
+			return
+		}
+		p.copySerial(instanceName, conn)
+	}()
+}
+
+// claimSerialCapture marks instanceName as captured, reporting false if
+// it already was.
+func (p *QemuProvider) claimSerialCapture(instanceName string) bool {
+	p.serialLock.Lock()
+	defer p.serialLock.Unlock()
+	if _, ok := p.serialCaptures[instanceName]; ok {
+		return false
+	}
+	p.serialCaptures[instanceName] = nil
+	return true
+}
+
+func (p *QemuProvider) releaseSerialCapture(instanceName string, console *common.Console) {
+	p.serialLock.Lock()
+	delete(p.serialCaptures, instanceName)
+	p.serialLock.Unlock()
+	if console != nil {
+		console.Close()
+	}
+}
+
+// copySerial copies everything the guest writes to its serial port into
+// the instance's serial log and to attached consoles until conn closes.
+// qemu accepts a single client on the serial socket, so consoles share
+// this connection.
+func (p *QemuProvider) copySerial(instanceName string, conn net.Conn) {
+	var console *common.Console
+	defer func() {
+		p.releaseSerialCapture(instanceName, console)
+	}()
+	defer conn.Close()
+
+	logFile, err := util.NewRotatingFile(p.getSerialLogPath(instanceName), int64(p.config.SerialLogMaxMb)<<20)
+	if err != nil {
+		logrus.WithError(err).Warnf("failed creating serial log for instance %s", instanceName)
+		return
+	}
+	defer logFile.Close()
+
+	console = common.NewConsole(conn)
+	p.serialLock.Lock()
+	p.serialCaptures[instanceName] = console
+	p.serialLock.Unlock()
+
+	if _, err := io.Copy(io.MultiWriter(logFile, console), conn); err != nil {
+		logrus.WithError(err).Debugf("serial console of instance %s closed", instanceName)
+	}
+}
+
+func (p *QemuProvider) AttachConsole(id string) (io.ReadWriteCloser, error) {
+	instance, err := p.GetInstance(id)
+	if err != nil {
+		return nil, errors.New("retrieving instance "+id, err)
+	}
+	if instance.State == types.InstanceState_Stopped {
+		return nil, errors.New("instance "+instance.Name+" is stopped", nil)
+	}
+	p.captureSerialLog(instance.Name)
+
+	// the capture may still be connecting to the serial socket
+	var console *common.Console
+	if err := util.Retry(20, 250*time.Millisecond, func() error {
+		p.serialLock.Lock()
+		console = p.serialCaptures[instance.Name]
+		p.serialLock.Unlock()
+		if console == nil {
+			return errors.New("serial console of instance "+instance.Name+" is not connected", nil)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return console.Attach()
+}
@@ -0,0 +1,470 @@
+package qemu
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bhojpur/kernel/pkg/providers/common"
+	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const snapshotTimeout = 5 * time.Minute
+
+func (p *QemuProvider) getSnapshotMetadataPath(snapshotName string) string {
+	return filepath.Join(p.getSnapshotDir(snapshotName), "snapshot.json")
+}
+
+func (p *QemuProvider) getSnapshotStatePath(snapshotName string) string {
+	return filepath.Join(p.getSnapshotDir(snapshotName), "vm.state")
+}
+
+func (p *QemuProvider) getSnapshotLaunchArgsPath(snapshotName string) string {
+	return filepath.Join(p.getSnapshotDir(snapshotName), "launch.json")
+}
+
+// SnapshotInstance pauses the instance, migrates its memory and device
+// state into a file and copies its disks, so the snapshot stays usable
+// while the instance runs on.
+func (p *QemuProvider) SnapshotInstance(params types.SnapshotInstanceParams) (_ *types.Snapshot, err error) {
+	logger := kutil.LogEntry(params.Logger)
+	instance, err := p.GetInstance(params.InstanceId)
+	if err != nil {
+		return nil, errors.New("retrieving instance "+params.InstanceId, err)
+	}
+	switch instance.State {
+	case types.InstanceState_Running, types.InstanceState_Paused:
+	default:
+		return nil, errors.New("instance "+instance.Name+" is "+string(instance.State)+", only running or paused instances can be snapshotted", nil)
+	}
+	name := params.Name
+	if name == "" {
+		name = fmt.Sprintf("%s-%d", instance.Name, time.Now().Unix())
+	}
+	if !common.ValidName(name) {
+		return nil, errors.New("invalid snapshot name "+name, nil)
+	}
+	if _, err := os.Stat(p.getSnapshotDir(name)); err == nil {
+		return nil, errors.New("snapshot "+name+" already exists", nil)
+	}
+	launchArgs, err := p.loadLaunchArgs(instance.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.WithField("instance", instance).Infof("snapshotting instance as %s", name)
+
+	if instance.State == types.InstanceState_Running {
+		if _, err := p.qmpExecute(instance.Name, "stop", nil); err != nil {
+			return nil, errors.New("pausing instance "+instance.Name, err)
+		}
+		defer func() {
+			if err == nil && params.Stop {
+				if stopErr := p.stopInstance(instance); stopErr != nil {
+					logger.WithError(stopErr).Warnf("stopping instance %s after snapshot", instance.Name)
+				}
+				return
+			}
+			if _, resumeErr := p.qmpExecute(instance.Name, "cont", nil); resumeErr != nil {
+				logger.WithError(resumeErr).Errorf("resuming instance %s after snapshot", instance.Name)
+			}
+		}()
+	}
+
+	if err := os.MkdirAll(p.getSnapshotDir(name), 0755); err != nil {
+		return nil, errors.New("creating snapshot directory", err)
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(p.getSnapshotDir(name))
+		}
+	}()
+
+	if _, err := p.qmpExecute(instance.Name, "migrate", map[string]string{
+		"uri": "exec:cat > " + common.ShellQuote(p.getSnapshotStatePath(name)),
+	}); err != nil {
+		return nil, errors.New("saving state of instance "+instance.Name, err)
+	}
+	if err := p.waitForMigration(instance.Name, snapshotTimeout); err != nil {
+		return nil, err
+	}
+	// the guest is still paused, so the disks match the saved state
+	launchArgs, err = copyDrives(launchArgs, p.getSnapshotDir(name))
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(launchArgs)
+	if err != nil {
+		return nil, errors.New("marshalling launch arguments", err)
+	}
+	if err := ioutil.WriteFile(p.getSnapshotLaunchArgsPath(name), data, 0644); err != nil {
+		return nil, errors.New("writing launch arguments of snapshot", err)
+	}
+
+	snapshot := &types.Snapshot{
+		Id:             name,
+		Name:           name,
+		InstanceName:   instance.Name,
+		ImageId:        instance.ImageId,
+		Infrastructure: types.Infrastructure_QEMU,
+		SizeMb:         common.DirSizeMb(p.getSnapshotDir(name)),
+		Created:        time.Now(),
+	}
+	data, err = json.Marshal(snapshot)
+	if err != nil {
+		return nil, errors.New("marshalling snapshot metadata", err)
+	}
+	if err := ioutil.WriteFile(p.getSnapshotMetadataPath(name), data, 0644); err != nil {
+		return nil, errors.New("writing snapshot metadata", err)
+	}
+
+	logger.WithField("snapshot", snapshot).Infof("snapshot created successfully")
+	return snapshot, nil
+}
+
+// RestoreSnapshot launches qemu with the arguments of the snapshotted
+// instance and feeds it the saved state as an incoming migration. The
+// restored instance writes to overlays of the snapshot's disks in its own
+// directory, so the snapshotted instance may keep running.
+func (p *QemuProvider) RestoreSnapshot(params types.RestoreSnapshotParams) (_ *types.Instance, err error) {
+	logger := kutil.LogEntry(params.Logger)
+	snapshot, err := common.GetSnapshot(p, params.SnapshotId)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.GetImage(snapshot.ImageId); err != nil {
+		return nil, errors.New("image "+snapshot.ImageId+" of snapshot "+snapshot.Name+" no longer exists", err)
+	}
+	name := params.InstanceName
+	if name == "" {
+		name = snapshot.InstanceName
+	}
+	if !common.ValidName(name) {
+		return nil, errors.New("invalid instance name "+name, nil)
+	}
+	if _, err := p.GetInstance(name); err == nil {
+		return nil, errors.New("instance with name "+name+" already exists. qemu provider requires unique names for instances", nil)
+	}
+	snapshotArgs, err := p.loadSnapshotLaunchArgs(snapshot.Name)
+	if err != nil {
+		return nil, err
+	}
+	// snapshots taken before disks were copied use the disks of the
+	// snapshotted instance
+	if !drivesIn(snapshotArgs, p.getSnapshotDir(snapshot.Name)) {
+		if source, err := common.FindInstanceByName(p, snapshot.InstanceName); err != nil {
+			return nil, err
+		} else if source != nil {
+			return nil, errors.New("instance "+snapshot.InstanceName+" of snapshot "+snapshot.Name+" still exists and uses its disks, delete it before restoring", nil)
+		}
+	}
+
+	logger.WithField("snapshot", snapshot).Infof("restoring instance %s", name)
+
+	instanceDir := p.getInstanceDir(name)
+	if err := os.MkdirAll(instanceDir, 0755); err != nil {
+		return nil, errors.New("creating directory for instance", err)
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(instanceDir)
+		}
+	}()
+
+	// the serial and qmp sockets live in the instance directory
+	qemuArgs := make([]string, len(snapshotArgs))
+	for i, arg := range snapshotArgs {
+		qemuArgs[i] = strings.Replace(arg, p.getInstanceDir(snapshot.InstanceName), instanceDir, -1)
+	}
+	if qemuArgs, err = overlayDrives(qemuArgs, p.getSnapshotDir(snapshot.Name), instanceDir); err != nil {
+		return nil, err
+	}
+	// later starts of the instance boot it afresh
+	if err := p.saveLaunchArgs(name, qemuArgs); err != nil {
+		return nil, err
+	}
+
+	cmd, err := p.launch(name, append(qemuArgs, "-incoming", "exec:cat "+common.ShellQuote(p.getSnapshotStatePath(snapshot.Name))))
+	if err != nil {
+		return nil, err
+	}
+	if err := p.waitForStatus(name, "running", snapshotTimeout); err != nil {
+		cmd.Process.Kill()
+		return nil, errors.New("restoring snapshot "+snapshot.Name, err)
+	}
+
+	instance := &types.Instance{
+		Id:             fmt.Sprintf("%d", cmd.Process.Pid),
+		Name:           name,
+		State:          types.InstanceState_Running,
+		Infrastructure: types.Infrastructure_QEMU,
+		ImageId:        snapshot.ImageId,
+		Created:        time.Now(),
+	}
+	if err := p.state.ModifyInstances(func(instances map[string]*types.Instance) error {
+		instances[instance.Id] = instance
+		return nil
+	}); err != nil {
+		return nil, errors.New("modifying instance map in state", err)
+	}
+
+	logger.WithField("instance", instance).Infof("instance restored successfully")
+	return instance, nil
+}
+
+func (p *QemuProvider) ListSnapshots() ([]*types.Snapshot, error) {
+	names, err := common.ListDirs(p.snapshotsDirectory())
+	if err != nil {
+		return nil, errors.New("listing snapshot directories", err)
+	}
+	snapshots := []*types.Snapshot{}
+	for _, name := range names {
+		data, err := ioutil.ReadFile(p.getSnapshotMetadataPath(name))
+		if err != nil {
+			logrus.WithError(err).Warnf("skipping snapshot %s", name)
+			continue
+		}
+		var snapshot types.Snapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			logrus.WithError(err).Warnf("skipping snapshot %s", name)
+			continue
+		}
+		snapshots = append(snapshots, &snapshot)
+	}
+	return snapshots, nil
+}
+
+// DeleteSnapshot refuses to delete snapshots whose disks back restored
+// instances.
+func (p *QemuProvider) DeleteSnapshot(id string) error {
+	snapshot, err := common.GetSnapshot(p, id)
+	if err != nil {
+		return err
+	}
+	dir := p.getSnapshotDir(snapshot.Name)
+	for _, instance := range p.state.GetInstances() {
+		args, err := p.loadLaunchArgs(instance.Name)
+		if err != nil {
+			continue
+		}
+		if overlaysOf(args, dir) {
+			return errors.New("snapshot "+snapshot.Name+" backs the disks of instance "+instance.Name+", delete the instance first", nil)
+		}
+	}
+	return os.RemoveAll(dir)
+}
+
+func (p *QemuProvider) loadSnapshotLaunchArgs(snapshotName string) ([]string, error) {
+	data, err := ioutil.ReadFile(p.getSnapshotLaunchArgsPath(snapshotName))
+	if err != nil {
+		return nil, errors.New("reading launch arguments of snapshot "+snapshotName, err)
+	}
+	var args []string
+	if err := json.Unmarshal(data, &args); err != nil {
+		return nil, errors.New("parsing launch arguments of snapshot "+snapshotName, err)
+	}
+	return args, nil
+}
+
+// driveOption returns the value of key in the options of a -drive
+// argument.
+func driveOption(drive, key string) string {
+	for _, option := range strings.Split(drive, ",") {
+		if strings.HasPrefix(option, key+"=") {
+			return strings.TrimPrefix(option, key+"=")
+		}
+	}
+	return ""
+}
+
+// withDriveOptions replaces, or adds, options of a -drive argument.
+func withDriveOptions(drive string, values map[string]string) string {
+	options := strings.Split(drive, ",")
+	set := map[string]bool{}
+	for i, option := range options {
+		key := strings.SplitN(option, "=", 2)[0]
+		if value, ok := values[key]; ok {
+			options[i] = key + "=" + value
+			set[key] = true
+		}
+	}
+	for key, value := range values {
+		if !set[key] {
+			options = append(options, key+"="+value)
+		}
+	}
+	return strings.Join(options, ",")
+}
+
+// eachDrive calls f with the index in args of the options of every -drive
+// that has a file.
+func eachDrive(args []string, f func(i int, file string) error) error {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] != "-drive" {
+			continue
+		}
+		if file := driveOption(args[i+1], "file"); file != "" {
+			if err := f(i+1, file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// copyDrives copies the disks of a paused instance into dir, and returns
+// args using the copies.
+func copyDrives(args []string, dir string) ([]string, error) {
+	res := append([]string{}, args...)
+	n := 0
+	err := eachDrive(res, func(i int, file string) error {
+		format := driveOption(res[i], "format")
+		if format == "" {
+			format = "raw"
+		}
+		dst := filepath.Join(dir, fmt.Sprintf("disk%d.%s", n, format))
+		n++
+		// -U: the paused qemu still holds its lock on the disk
+		if out, err := exec.Command("qemu-img", "convert", "-U", "-f", format, "-O", format, file, dst).CombinedOutput(); err != nil {
+			return errors.New("copying disk "+file+": "+string(out), err)
+		}
+		res[i] = withDriveOptions(res[i], map[string]string{"file": dst})
+		return nil
+	})
+	return res, err
+}
+
+// overlayDrives creates qcow2 overlays in instanceDir for the disks of
+// args that live in snapshotDir, and returns args using the overlays.
+func overlayDrives(args []string, snapshotDir, instanceDir string) ([]string, error) {
+	res := append([]string{}, args...)
+	err := eachDrive(res, func(i int, file string) error {
+		if filepath.Dir(file) != snapshotDir {
+			return nil
+		}
+		format := driveOption(res[i], "format")
+		if format == "" {
+			format = "raw"
+		}
+		overlay := filepath.Join(instanceDir, strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))+".qcow2")
+		if out, err := exec.Command("qemu-img", "create", "-f", "qcow2", "-b", file, "-F", format, overlay).CombinedOutput(); err != nil {
+			return errors.New("creating overlay of disk "+file+": "+string(out), err)
+		}
+		res[i] = withDriveOptions(res[i], map[string]string{"file": overlay, "format": "qcow2"})
+		return nil
+	})
+	return res, err
+}
+
+// drivesIn reports whether all disks of args live in dir.
+func drivesIn(args []string, dir string) bool {
+	all := true
+	eachDrive(args, func(i int, file string) error {
+		if filepath.Dir(file) != dir {
+			all = false
+		}
+		return nil
+	})
+	return all
+}
+
+// overlaysOf reports whether any disk of args is backed by a disk in
+// snapshotDir, i.e. belongs to an instance restored from that snapshot.
+func overlaysOf(args []string, snapshotDir string) bool {
+	found := false
+	eachDrive(args, func(i int, file string) error {
+		out, err := exec.Command("qemu-img", "info", "-U", "--output=json", file).Output()
+		if err != nil {
+			return nil
+		}
+		var info struct {
+			BackingFilename string `json:"backing-filename"`
+		}
+		if json.Unmarshal(out, &info) == nil && filepath.Dir(info.BackingFilename) == snapshotDir {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
+// waitForMigration polls an outgoing migration until it completes.
+func (p *QemuProvider) waitForMigration(instanceName string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		result, err := p.qmpExecute(instanceName, "query-migrate", nil)
+		if err != nil {
+			return errors.New("querying migration status", err)
+		}
+		var info struct {
+			Status    string `json:"status"`
+			ErrorDesc string `json:"error-desc"`
+		}
+		if err := json.Unmarshal(result, &info); err != nil {
+			return errors.New("parsing migration status", err)
+		}
+		switch info.Status {
+		case "completed":
+			return nil
+		case "failed", "cancelled":
+			return errors.New("saving state of instance "+instanceName+" "+info.Status+": "+info.ErrorDesc, nil)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return errors.New("saving state of instance "+instanceName+" did not finish within "+timeout.String(), nil)
+}
+
+// waitForStatus polls the run state of an instance, tolerating the qmp
+// socket not being up yet.
+func (p *QemuProvider) waitForStatus(instanceName, status string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	var lastErr error
+	for time.Now().Before(deadline) {
+		result, err := p.qmpExecute(instanceName, "query-status", nil)
+		if err == nil {
+			var info struct {
+				Status string `json:"status"`
+			}
+			if err := json.Unmarshal(result, &info); err != nil {
+				return errors.New("parsing instance status", err)
+			}
+			if info.Status == status {
+				return nil
+			}
+			lastErr = errors.New("instance "+instanceName+" is "+info.Status, nil)
+		} else {
+			lastErr = err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return errors.New("instance "+instanceName+" did not reach state "+status+" within "+timeout.String(), lastErr)
+}
@@ -25,14 +25,18 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/bhojpur/kernel/pkg/compilers"
+	"github.com/bhojpur/kernel/pkg/compilers/bhojpur"
 	kos "github.com/bhojpur/kernel/pkg/os"
 	"github.com/bhojpur/kernel/pkg/providers/common"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
 	"github.com/sirupsen/logrus"
 )
 
 func (p *QemuProvider) Stage(params types.StageImageParams) (_ *types.Image, err error) {
+	logger := kutil.LogEntry(params.Logger)
 	images, err := p.ListImages()
 	if err != nil {
 		return nil, errors.New("retrieving image list for existing image", err)
@@ -42,15 +46,15 @@ func (p *QemuProvider) Stage(params types.StageImageParams) (_ *types.Image, err
 			if !params.Force {
 				return nil, errors.New("an image already exists with name '"+params.Name+"', try again with --force", nil)
 			} else {
-				logrus.WithField("image", image).Warnf("force: deleting previous image with name " + params.Name)
+				logger.WithField("image", image).Warnf("force: deleting previous image with name " + params.Name)
 				if err := p.DeleteImage(image.Id, true); err != nil {
-					logrus.Warn("failed to remove previously existing image", err)
+					logger.Warn("failed to remove previously existing image", err)
 				}
 			}
 		}
 	}
-	imagePath := getImagePath(params.Name)
-	logrus.Debugf("making directory: %s", filepath.Dir(imagePath))
+	imagePath := p.getImagePath(params.Name)
+	logger.Debugf("making directory: %s", filepath.Dir(imagePath))
 	if err := os.MkdirAll(filepath.Dir(imagePath), 0777); err != nil {
 		return nil, errors.New("creating directory for boot image", err)
 	}
@@ -61,24 +65,33 @@ func (p *QemuProvider) Stage(params types.StageImageParams) (_ *types.Image, err
 	}()
 
 	kernelPath := filepath.Join(filepath.Dir(params.RawImage.LocalImagePath), "program.bin")
-	if _, err := os.Stat(kernelPath); os.IsNotExist(err) {
-		logrus.Debugf("program.bin does not exist, assuming classic bootloader")
-		if err := kos.CopyFile(params.RawImage.LocalImagePath, getImagePath(params.Name)); err != nil {
+	if compilers.CompilerType(params.RawImage.RunSpec.Compiler).Base() == compilers.Bhojpur {
+		logger.Debugf("staging Bhojpur Go kernel and its multiboot loader")
+		if err := kos.CopyFile(params.RawImage.LocalImagePath, imagePath); err != nil {
+			return nil, errors.New("copying kernel to image dir", err)
+		}
+		loaderFile := filepath.Join(filepath.Dir(params.RawImage.LocalImagePath), bhojpur.LoaderFile)
+		if err := kos.CopyFile(loaderFile, p.getLoaderPath(params.Name)); err != nil {
+			return nil, errors.New("copying multiboot loader to image dir", err)
+		}
+	} else if _, err := os.Stat(kernelPath); os.IsNotExist(err) {
+		logger.Debugf("program.bin does not exist, assuming classic bootloader")
+		if err := kos.CopyFile(params.RawImage.LocalImagePath, p.getImagePath(params.Name)); err != nil {
 			return nil, errors.New("copying bootable image to image dir", err)
 		}
 	} else {
-		logrus.WithField("raw-image", params.RawImage).Infof("creating boot volume from raw image")
-		if err := common.ConvertRawImage(params.RawImage.StageSpec.ImageFormat, types.ImageFormat_QCOW2, params.RawImage.LocalImagePath, imagePath); err != nil {
+		logger.WithField("raw-image", params.RawImage).Infof("creating boot volume from raw image")
+		if err := common.ConvertRawImage(params.RawImage.StageSpec.ImageFormat, types.ImageFormat_QCOW2, params.RawImage.LocalImagePath, imagePath, params.Containers); err != nil {
 			return nil, errors.New("converting raw image to qcow2", err)
 		}
 
 		kernelFile := filepath.Join(filepath.Dir(params.RawImage.LocalImagePath), "program.bin")
-		if err := kos.CopyFile(kernelFile, getKernelPath(params.Name)); err != nil {
+		if err := kos.CopyFile(kernelFile, p.getKernelPath(params.Name)); err != nil {
 			return nil, errors.New("copying kernel file to image dir", err)
 		}
 
 		cmdlineFile := filepath.Join(filepath.Dir(params.RawImage.LocalImagePath), "cmdline")
-		if err := kos.CopyFile(cmdlineFile, getCmdlinePath(params.Name)); err != nil {
+		if err := kos.CopyFile(cmdlineFile, p.getCmdlinePath(params.Name)); err != nil {
 			return nil, errors.New("copying cmdline file to image dir", err)
 		}
 	}
@@ -89,7 +102,7 @@ func (p *QemuProvider) Stage(params types.StageImageParams) (_ *types.Image, err
 	}
 	sizeMb := imagePathInfo.Size() >> 20
 
-	logrus.WithFields(logrus.Fields{
+	logger.WithFields(logrus.Fields{
 		"name": params.Name,
 		"id":   params.Name,
 		"size": sizeMb,
@@ -112,6 +125,6 @@ func (p *QemuProvider) Stage(params types.StageImageParams) (_ *types.Image, err
 		return nil, errors.New("modifying image map in state", err)
 	}
 
-	logrus.WithFields(logrus.Fields{"image": image}).Infof("image created succesfully")
+	logger.WithFields(logrus.Fields{"image": image}).Infof("image created succesfully")
 	return image, nil
 }
@@ -21,11 +21,50 @@ package qemu
 // THE SOFTWARE.
 
 import (
+	"fmt"
+
+	"github.com/bhojpur/kernel/pkg/types"
 	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/sirupsen/logrus"
 )
 
 func (p *QemuProvider) StartInstance(id string) error {
+	instance, err := p.GetInstance(id)
+	if err != nil {
+		return errors.New("retrieving instance "+id, err)
+	}
+
+	switch instance.State {
+	case types.InstanceState_Paused:
+		return p.ResumeInstance(instance.Id)
+	case types.InstanceState_Stopped:
+	default:
+		return errors.New("instance "+instance.Name+" is "+string(instance.State)+", only stopped or paused instances can be started", nil)
+	}
+
+	qemuArgs, err := p.loadLaunchArgs(instance.Name)
+	if err != nil {
+		return err
+	}
+
+	cmd, err := p.launch(instance.Name, qemuArgs)
+	if err != nil {
+		return err
+	}
+
+	// the instance id is the qemu pid, so it changes with every start
+	oldId := instance.Id
+	instance.Id = fmt.Sprintf("%d", cmd.Process.Pid)
+	instance.State = types.InstanceState_Running
 
-	return errors.New("not supported", nil)
+	if err := p.state.ModifyInstances(func(instances map[string]*types.Instance) error {
+		delete(instances, oldId)
+		instances[instance.Id] = instance
+		return nil
+	}); err != nil {
+		return errors.New("modifying instance map in state", err)
+	}
 
+	logrus.WithField("instance", instance).Infof("instance started successfully")
+	return nil
 }
@@ -1,6 +1,3 @@
-//go:build cgo
-// +build cgo
-
 package qemu
 
 // Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
@@ -24,9 +21,7 @@ package qemu
 // THE SOFTWARE.
 
 import (
-	"os"
 	"strconv"
-	"syscall"
 
 	"github.com/bhojpur/kernel/pkg/types"
 	"github.com/bhojpur/kernel/pkg/util/errors"
@@ -38,32 +33,35 @@ func (p *QemuProvider) StopInstance(id string) error {
 	if err != nil {
 		return errors.New("retrieving instance "+id, err)
 	}
+	return p.stopInstance(instance)
+}
+
+func (p *QemuProvider) stopInstance(instance *types.Instance) error {
+	if instance.State == types.InstanceState_Stopped {
+		logrus.WithField("instance", instance).Infof("instance is already stopped")
+		return nil
+	}
 
-	// kill qemu
 	pid, err := strconv.Atoi(instance.Id)
 	if err != nil {
 		return errors.New("invalid instance id (should be qemu pid)", err)
 	}
 
-	process, err := os.FindProcess(pid)
-	if err != nil {
-		logrus.Warn("failed finding instance, assuming instance has externally terminated", err)
-	} else {
-		if err := process.Signal(syscall.SIGKILL); err != nil {
-			logrus.Warn("failed terminating instance, assuming instance has externally terminated", err)
-		}
-	}
+	p.shutdown(instance.Name, pid, instance.State == types.InstanceState_Paused)
 
-	volumesToDetach := []*types.Volume{}
-	volumes, err := p.ListVolumes()
-	if err != nil {
-		return errors.New("getting volume list", err)
-	}
-	for _, volume := range volumes {
-		if volume.Attachment == instance.Id {
-			volumesToDetach = append(volumesToDetach, volume)
+	return p.setInstanceState(instance, types.InstanceState_Stopped)
+}
+
+func (p *QemuProvider) setInstanceState(instance *types.Instance, instanceState types.InstanceState) error {
+	if err := p.state.ModifyInstances(func(instances map[string]*types.Instance) error {
+		stored, ok := instances[instance.Id]
+		if !ok {
+			return errors.New("no record of "+instance.Id+" in the state", nil)
 		}
+		stored.State = instanceState
+		return nil
+	}); err != nil {
+		return errors.New("modifying instance map in state", err)
 	}
-
-	return p.state.RemoveInstance(instance)
+	return nil
 }
@@ -1,7 +1,4 @@
-//go:build !cgo
-// +build !cgo
-
-package qemu
+package ukvm
 
 // Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
 
@@ -23,9 +20,22 @@ package qemu
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
-import "github.com/bhojpur/kernel/pkg/util/errors"
-
-func (p *QemuProvider) StopInstance(id string) error {
-
-	return errors.New("Stopping qemu instance is not supported without cgo", nil)
+import (
+	"io"
+
+	"github.com/bhojpur/kernel/pkg/util/errors"
+)
+
+func (p *UkvmProvider) AttachConsole(id string) (io.ReadWriteCloser, error) {
+	instance, err := p.GetInstance(id)
+	if err != nil {
+		return nil, errors.New("retrieving instance "+id, err)
+	}
+	p.consoleLock.Lock()
+	console := p.consoles[instance.Name]
+	p.consoleLock.Unlock()
+	if console == nil {
+		return nil, errors.New("console of instance "+instance.Name+" is not available. It has exited or was started before the daemon restarted", nil)
+	}
+	return console.Attach()
 }
@@ -27,11 +27,12 @@ import (
 
 	kos "github.com/bhojpur/kernel/pkg/os"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
-	"github.com/sirupsen/logrus"
 )
 
 func (p *UkvmProvider) CreateVolume(params types.CreateVolumeParams) (_ *types.Volume, err error) {
+	logger := kutil.LogEntry(params.Logger)
 	if _, volumeErr := p.GetImage(params.Name); volumeErr == nil {
 		return nil, errors.New("volume already exists", nil)
 	}
@@ -43,13 +44,13 @@ func (p *UkvmProvider) CreateVolume(params types.CreateVolumeParams) (_ *types.V
 	defer func() {
 		if err != nil {
 			if params.NoCleanup {
-				logrus.Warnf("because --no-cleanup flag was provided, not cleaning up failed volume %s at %s", params.Name, volumePath)
+				logger.Warnf("because --no-cleanup flag was provided, not cleaning up failed volume %s at %s", params.Name, volumePath)
 			} else {
 				os.RemoveAll(filepath.Dir(volumePath))
 			}
 		}
 	}()
-	logrus.WithField("raw-image", params.ImagePath).Infof("creating volume from raw image")
+	logger.WithField("raw-image", params.ImagePath).Infof("creating volume from raw image")
 	if err := kos.CopyFile(params.ImagePath, volumePath); err != nil {
 		return nil, errors.New("Copying volume", err)
 	}
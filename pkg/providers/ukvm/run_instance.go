@@ -23,6 +23,7 @@ package ukvm
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"time"
@@ -36,7 +37,8 @@ import (
 )
 
 func (p *UkvmProvider) RunInstance(params types.RunInstanceParams) (_ *types.Instance, err error) {
-	logrus.WithFields(logrus.Fields{
+	logger := util.LogEntry(params.Logger)
+	logger.WithFields(logrus.Fields{
 		"image-id": params.ImageId,
 		"mounts":   params.MntPointsToVolumeIds,
 		"env":      params.Env,
@@ -70,7 +72,7 @@ func (p *UkvmProvider) RunInstance(params types.RunInstanceParams) (_ *types.Ins
 		volumeIdInOrder[controllerPort] = volumeId
 	}
 
-	logrus.Debugf("creating ukvm vm")
+	logger.Debugf("creating ukvm vm")
 
 	volImagesInOrder, err := p.getVolumeImages(volumeIdInOrder)
 	if err != nil {
@@ -90,30 +92,51 @@ func (p *UkvmProvider) RunInstance(params types.RunInstanceParams) (_ *types.Ins
 	ukvmArgs = append(ukvmArgs, getKernelPath(image.Name))
 	cmd := exec.Command(getUkvmPath(image.Name), ukvmArgs...)
 
-	stdout, err := cmd.StdoutPipe()
+	instanceLogName := getInstanceLogName(params.Name)
+
+	var stdout io.Writer = ioutil.Discard
+	f, err := os.Create(instanceLogName)
 	if err != nil {
-		logrus.WithError(err).Warning("Can't get stdout for logs")
+		logger.WithError(err).Warning("Failed to create stdout log for instance " + params.Name)
+	} else {
+		stdout = f
 	}
 
-	instanceLogName := getInstanceLogName(params.Name)
-
-	go func() {
-		f, err := os.Create(instanceLogName)
-		if err != nil {
-			logrus.WithError(err).Warning("Failed to create stdout log for instance " + params.Name)
+	console, err := common.NewProcessConsole()
+	if err != nil {
+		if f != nil {
+			f.Close()
 		}
-		defer f.Close()
-		io.Copy(f, stdout)
-
-	}()
+		return nil, err
+	}
+	cmd.Stdin = console.Stdin
+	cmd.Stdout = io.MultiWriter(stdout, console)
 
 	util.LogCommand(cmd, true)
 
 	if err := cmd.Start(); err != nil {
+		console.Close()
+		if f != nil {
+			f.Close()
+		}
 		return nil, errors.New("can't start ukvm.", nil)
 	}
+	console.Started()
+	p.consoleLock.Lock()
+	p.consoles[params.Name] = console
+	p.consoleLock.Unlock()
+
 	// close command resources
-	go cmd.Wait()
+	go func() {
+		cmd.Wait()
+		p.consoleLock.Lock()
+		delete(p.consoles, params.Name)
+		p.consoleLock.Unlock()
+		console.Close()
+		if f != nil {
+			f.Close()
+		}
+	}()
 
 	var instanceIp string
 
@@ -134,7 +157,7 @@ func (p *UkvmProvider) RunInstance(params types.RunInstanceParams) (_ *types.Ins
 		return nil, errors.New("modifying instance map in state", err)
 	}
 
-	logrus.WithField("instance", instance).Infof("instance created successfully")
+	logger.WithField("instance", instance).Infof("instance created successfully")
 
 	return instance, nil
 }
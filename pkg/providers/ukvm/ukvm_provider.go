@@ -23,14 +23,20 @@ package ukvm
 import (
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/bhojpur/kernel/pkg/config"
+	"github.com/bhojpur/kernel/pkg/providers/common"
 	"github.com/bhojpur/kernel/pkg/state"
 )
 
 type UkvmProvider struct {
 	config config.Ukvm
 	state  state.State
+
+	// consoles of running instances, keyed by name
+	consoles    map[string]*common.ProcessConsole
+	consoleLock sync.Mutex
 }
 
 func UkvmStateFile() string {
@@ -56,8 +62,9 @@ func NewUkvmProvider(config config.Ukvm) (*UkvmProvider, error) {
 	os.MkdirAll(ukvmVolumesDirectory(), 0777)
 
 	p := &UkvmProvider{
-		config: config,
-		state:  state.NewBasicState(UkvmStateFile()),
+		config:   config,
+		state:    state.NewBasicState(UkvmStateFile()),
+		consoles: map[string]*common.ProcessConsole{},
 	}
 
 	return p, nil
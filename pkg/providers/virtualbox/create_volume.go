@@ -27,11 +27,12 @@ import (
 
 	"github.com/bhojpur/kernel/pkg/providers/common"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
-	"github.com/sirupsen/logrus"
 )
 
 func (p *VirtualboxProvider) CreateVolume(params types.CreateVolumeParams) (_ *types.Volume, err error) {
+	logger := kutil.LogEntry(params.Logger)
 	if _, volumeErr := p.GetImage(params.Name); volumeErr == nil {
 		return nil, errors.New("volume already exists", nil)
 	}
@@ -41,15 +42,15 @@ func (p *VirtualboxProvider) CreateVolume(params types.CreateVolumeParams) (_ *t
 	}
 	defer func() {
 		if params.NoCleanup {
-			logrus.Warnf("because --no-cleanup flag was provided, not cleaning up failed volume %s at %s", params.Name, volumePath)
+			logger.Warnf("because --no-cleanup flag was provided, not cleaning up failed volume %s at %s", params.Name, volumePath)
 			return
 		}
 		if err != nil {
 			os.RemoveAll(filepath.Dir(volumePath))
 		}
 	}()
-	logrus.WithField("raw-image", params.ImagePath).Infof("creating volume from raw image")
-	if err := common.ConvertRawImage(types.ImageFormat_RAW, types.ImageFormat_VMDK, params.ImagePath, volumePath); err != nil {
+	logger.WithField("raw-image", params.ImagePath).Infof("creating volume from raw image")
+	if err := common.ConvertRawImage(types.ImageFormat_RAW, types.ImageFormat_VMDK, params.ImagePath, volumePath, nil); err != nil {
 		return nil, errors.New("converting raw image to vmdk", err)
 	}
 
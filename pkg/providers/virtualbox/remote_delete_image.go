@@ -23,14 +23,15 @@ package virtualbox
 import (
 	"github.com/bhojpur/kernel/pkg/providers/common"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
-	"github.com/sirupsen/logrus"
 )
 
 func (p *VirtualboxProvider) RemoteDeleteImage(params types.RemoteDeleteImagePararms) error {
+	logger := kutil.LogEntry(params.Logger)
 	if err := common.RemoteDeleteImage(params.Config, getImagePath(params.ImageName)); err != nil {
 		return errors.New("deleting image "+params.ImageName, err)
 	}
-	logrus.Infof("pushed image %v to %v", params.ImageName, params.Config.URL)
+	logger.Infof("pushed image %v to %v", params.ImageName, params.Config.URL)
 	return nil
 }
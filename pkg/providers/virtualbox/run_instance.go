@@ -30,13 +30,15 @@ import (
 	"github.com/bhojpur/kernel/pkg/providers/common"
 	"github.com/bhojpur/kernel/pkg/providers/virtualbox/virtualboxclient"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
 	"github.com/layer-x/layerx-commons/lxhttpclient"
 	"github.com/sirupsen/logrus"
 )
 
 func (p *VirtualboxProvider) RunInstance(params types.RunInstanceParams) (_ *types.Instance, err error) {
-	logrus.WithFields(logrus.Fields{
+	logger := kutil.LogEntry(params.Logger)
+	logger.WithFields(logrus.Fields{
 		"image-id": params.ImageId,
 		"mounts":   params.MntPointsToVolumeIds,
 		"env":      params.Env,
@@ -59,15 +61,15 @@ func (p *VirtualboxProvider) RunInstance(params types.RunInstanceParams) (_ *typ
 
 	portsUsed := []int{}
 
-	logrus.Debugf("using storage controller %s", image.RunSpec.StorageDriver)
+	logger.Debugf("using storage controller %s", image.RunSpec.StorageDriver)
 
 	defer func() {
 		if err != nil {
 			if params.NoCleanup {
-				logrus.Warnf("because --no-cleanup flag was provided, not cleaning up failed instance %s.2", params.Name)
+				logger.Warnf("because --no-cleanup flag was provided, not cleaning up failed instance %s.2", params.Name)
 				return
 			}
-			logrus.WithError(err).Errorf("error encountered, ensuring vm and disks are destroyed")
+			logger.WithError(err).Errorf("error encountered, ensuring vm and disks are destroyed")
 			virtualboxclient.PowerOffVm(params.Name)
 			for _, portUsed := range portsUsed {
 				virtualboxclient.DetachDisk(params.Name, portUsed, image.RunSpec.StorageDriver)
@@ -82,13 +84,13 @@ func (p *VirtualboxProvider) RunInstance(params types.RunInstanceParams) (_ *typ
 		params.InstanceMemory = image.RunSpec.DefaultInstanceMemory
 	}
 
-	logrus.Debugf("creating virtualbox vm")
+	logger.Debugf("creating virtualbox vm")
 
 	if err := virtualboxclient.CreateVm(params.Name, virtualboxInstancesDirectory(), params.InstanceMemory, p.config.AdapterName, p.config.VirtualboxAdapterType, image.RunSpec.StorageDriver); err != nil {
 		return nil, errors.New("creating vm", err)
 	}
 
-	logrus.Debugf("copying source boot vmdk")
+	logger.Debugf("copying source boot vmdk")
 	instanceBootImage := filepath.Join(instanceDir, "boot.vmdk")
 	if err := kos.CopyFile(getImagePath(image.Name), instanceBootImage); err != nil {
 		return nil, errors.New("copying base boot image", err)
@@ -118,7 +120,7 @@ func (p *VirtualboxProvider) RunInstance(params types.RunInstanceParams) (_ *typ
 		portsUsed = append(portsUsed, controllerPort)
 	}
 
-	logrus.Debugf("setting instance id from mac address")
+	logger.Debugf("setting instance id from mac address")
 	vm, err := virtualboxclient.GetVm(params.Name)
 	if err != nil {
 		return nil, errors.New("retrieving created vm from vbox", err)
@@ -131,12 +133,12 @@ func (p *VirtualboxProvider) RunInstance(params types.RunInstanceParams) (_ *typ
 		return nil, errors.New("failed to retrieve instance listener ip. is Bhojpur Kernel instance listener running?", err)
 	}
 
-	logrus.Debugf("sending env to listener")
+	logger.Debugf("sending env to listener")
 	if _, _, err := lxhttpclient.Post(instanceListenerIp+":3000", "/set_instance_env?mac_address="+macAddr, nil, params.Env); err != nil {
 		return nil, errors.New("sending instance env to listener", err)
 	}
 
-	logrus.Debugf("powering on vm")
+	logger.Debugf("powering on vm")
 	if err := virtualboxclient.PowerOnVm(params.Name); err != nil {
 		return nil, errors.New("powering on vm", err)
 	}
@@ -158,7 +160,7 @@ func (p *VirtualboxProvider) RunInstance(params types.RunInstanceParams) (_ *typ
 		return nil, errors.New("modifying instance map in state", err)
 	}
 
-	logrus.WithField("instance", instance).Infof("instance created successfully")
+	logger.WithField("instance", instance).Infof("instance created successfully")
 
 	return instance, nil
 }
@@ -27,11 +27,13 @@ import (
 
 	"github.com/bhojpur/kernel/pkg/providers/common"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
 	"github.com/sirupsen/logrus"
 )
 
 func (p *VirtualboxProvider) Stage(params types.StageImageParams) (_ *types.Image, err error) {
+	logger := kutil.LogEntry(params.Logger)
 	images, err := p.ListImages()
 	if err != nil {
 		return nil, errors.New("retrieving image list for existing image", err)
@@ -41,15 +43,15 @@ func (p *VirtualboxProvider) Stage(params types.StageImageParams) (_ *types.Imag
 			if !params.Force {
 				return nil, errors.New("an image already exists with name '"+params.Name+"', try again with --force", nil)
 			} else {
-				logrus.WithField("image", image).Warnf("force: deleting previous image with name " + params.Name)
+				logger.WithField("image", image).Warnf("force: deleting previous image with name " + params.Name)
 				if err := p.DeleteImage(image.Id, true); err != nil {
-					logrus.Warn(errors.New("failed removing previously existing image", err))
+					logger.Warn(errors.New("failed removing previously existing image", err))
 				}
 			}
 		}
 	}
 	imagePath := getImagePath(params.Name)
-	logrus.Debugf("making directory: %s", filepath.Dir(imagePath))
+	logger.Debugf("making directory: %s", filepath.Dir(imagePath))
 	if err := os.MkdirAll(filepath.Dir(imagePath), 0755); err != nil {
 		return nil, errors.New("creating directory for boot image", err)
 	}
@@ -59,8 +61,8 @@ func (p *VirtualboxProvider) Stage(params types.StageImageParams) (_ *types.Imag
 		}
 	}()
 
-	logrus.WithField("raw-image", params.RawImage).Infof("creating boot volume from raw image")
-	if err := common.ConvertRawImage(params.RawImage.StageSpec.ImageFormat, types.ImageFormat_VMDK, params.RawImage.LocalImagePath, imagePath); err != nil {
+	logger.WithField("raw-image", params.RawImage).Infof("creating boot volume from raw image")
+	if err := common.ConvertRawImage(params.RawImage.StageSpec.ImageFormat, types.ImageFormat_VMDK, params.RawImage.LocalImagePath, imagePath, params.Containers); err != nil {
 		return nil, errors.New("converting raw image to vmdk", err)
 	}
 
@@ -70,7 +72,7 @@ func (p *VirtualboxProvider) Stage(params types.StageImageParams) (_ *types.Imag
 	}
 	sizeMb := vmdkFile.Size() >> 20
 
-	logrus.WithFields(logrus.Fields{
+	logger.WithFields(logrus.Fields{
 		"name": params.Name,
 		"id":   params.Name,
 		"size": sizeMb,
@@ -93,6 +95,6 @@ func (p *VirtualboxProvider) Stage(params types.StageImageParams) (_ *types.Imag
 		return nil, errors.New("modifying image map in state", err)
 	}
 
-	logrus.WithFields(logrus.Fields{"image": image}).Infof("image created succesfully")
+	logger.WithFields(logrus.Fields{"image": image}).Infof("image created succesfully")
 	return image, nil
 }
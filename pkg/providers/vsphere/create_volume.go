@@ -28,11 +28,12 @@ import (
 
 	"github.com/bhojpur/kernel/pkg/providers/common"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
-	"github.com/sirupsen/logrus"
 )
 
 func (p *VsphereProvider) CreateVolume(params types.CreateVolumeParams) (_ *types.Volume, err error) {
+	logger := kutil.LogEntry(params.Logger)
 	if _, volumeErr := p.GetImage(params.Name); volumeErr == nil {
 		return nil, errors.New("volume already exists", nil)
 	}
@@ -44,8 +45,8 @@ func (p *VsphereProvider) CreateVolume(params types.CreateVolumeParams) (_ *type
 	}
 	defer os.RemoveAll(localVmdkDir)
 	localVmdkFile := filepath.Join(localVmdkDir, "data.vmdk")
-	logrus.WithField("raw-image", params.ImagePath).Infof("creating vmdk from raw image")
-	if err := common.ConvertRawImage(types.ImageFormat_RAW, types.ImageFormat_VMDK, params.ImagePath, localVmdkFile); err != nil {
+	logger.WithField("raw-image", params.ImagePath).Infof("creating vmdk from raw image")
+	if err := common.ConvertRawImage(types.ImageFormat_RAW, types.ImageFormat_VMDK, params.ImagePath, localVmdkFile, nil); err != nil {
 		return nil, errors.New("converting raw image to vmdk", err)
 	}
 
@@ -62,10 +63,10 @@ func (p *VsphereProvider) CreateVolume(params types.CreateVolumeParams) (_ *type
 	defer func() {
 		if err != nil {
 			if params.NoCleanup {
-				logrus.Warnf("because --no-cleanup flag was provided, not cleaning up failed volume %s at %s", params.Name, vsphereVolumeDir)
+				logger.Warnf("because --no-cleanup flag was provided, not cleaning up failed volume %s at %s", params.Name, vsphereVolumeDir)
 				return
 			}
-			logrus.WithError(err).Warnf("creating volume failed, cleaning up volume on datastore")
+			logger.WithError(err).Warnf("creating volume failed, cleaning up volume on datastore")
 			c.Rmdir(vsphereVolumeDir)
 		}
 	}()
@@ -26,13 +26,15 @@ import (
 
 	"github.com/bhojpur/kernel/pkg/providers/common"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
 	"github.com/layer-x/layerx-commons/lxhttpclient"
 	"github.com/sirupsen/logrus"
 )
 
 func (p *VsphereProvider) RunInstance(params types.RunInstanceParams) (_ *types.Instance, err error) {
-	logrus.WithFields(logrus.Fields{
+	logger := kutil.LogEntry(params.Logger)
+	logger.WithFields(logrus.Fields{
 		"image-id": params.ImageId,
 		"mounts":   params.MntPointsToVolumeIds,
 		"env":      params.Env,
@@ -60,10 +62,10 @@ func (p *VsphereProvider) RunInstance(params types.RunInstanceParams) (_ *types.
 	defer func() {
 		if err != nil {
 			if params.NoCleanup {
-				logrus.Warnf("because --no-cleanup flag was provided, not cleaning up failed instance %s001", params.Name)
+				logger.Warnf("because --no-cleanup flag was provided, not cleaning up failed instance %s001", params.Name)
 				return
 			}
-			logrus.WithError(err).Warnf("error encountered, ensuring vm and disks are destroyed")
+			logger.WithError(err).Warnf("error encountered, ensuring vm and disks are destroyed")
 			c.PowerOffVm(params.Name)
 			for _, portUsed := range portsUsed {
 				c.DetachDisk(params.Name, portUsed, image.RunSpec.StorageDriver)
@@ -73,7 +75,7 @@ func (p *VsphereProvider) RunInstance(params types.RunInstanceParams) (_ *types.
 		}
 	}()
 
-	logrus.Debugf("creating vsphere vm")
+	logger.Debugf("creating vsphere vm")
 
 	//if not set, use default
 	if params.InstanceMemory <= 0 {
@@ -84,7 +86,7 @@ func (p *VsphereProvider) RunInstance(params types.RunInstanceParams) (_ *types.
 		return nil, errors.New("creating vm", err)
 	}
 
-	logrus.Debugf("powering on vm to assign mac addr")
+	logger.Debugf("powering on vm to assign mac addr")
 	if err := c.PowerOnVm(params.Name); err != nil {
 		return nil, errors.New("failed to power on vm to assign mac addr", err)
 	}
@@ -104,14 +106,14 @@ func (p *VsphereProvider) RunInstance(params types.RunInstanceParams) (_ *types.
 		}
 	}
 	if macAddr == "" {
-		logrus.WithFields(logrus.Fields{"vm": vm}).Warnf("vm found, cannot identify mac addr")
+		logger.WithFields(logrus.Fields{"vm": vm}).Warnf("vm found, cannot identify mac addr")
 		return nil, errors.New("could not find mac addr on vm", nil)
 	}
 	if err := c.PowerOffVm(params.Name); err != nil {
 		return nil, errors.New("failed to power off vm after retrieving mac addr", err)
 	}
 
-	logrus.Debugf("copying base boot vmdk to instance dir")
+	logger.Debugf("copying base boot vmdk to instance dir")
 	instanceBootImagePath := instanceDir + "/boot.vmdk"
 	if err := c.CopyFile(getImageDatastorePath(image.Name), instanceBootImagePath); err != nil {
 		return nil, errors.New("copying base boot.vmdk", err)
@@ -143,12 +145,12 @@ func (p *VsphereProvider) RunInstance(params types.RunInstanceParams) (_ *types.
 		return nil, errors.New("failed to retrieve instance listener ip. is Bhojpur Kernel instance listener running?", err)
 	}
 
-	logrus.Debugf("sending env to listener")
+	logger.Debugf("sending env to listener")
 	if _, _, err := lxhttpclient.Post(instanceListenerIp+":3000", "/set_instance_env?mac_address="+macAddr, nil, params.Env); err != nil {
 		return nil, errors.New("sending instance env to listener", err)
 	}
 
-	logrus.Debugf("powering on vm")
+	logger.Debugf("powering on vm")
 	if err := c.PowerOnVm(params.Name); err != nil {
 		return nil, errors.New("powering on vm", err)
 	}
@@ -172,7 +174,7 @@ func (p *VsphereProvider) RunInstance(params types.RunInstanceParams) (_ *types.
 		return nil, errors.New("modifying instance map in state", err)
 	}
 
-	logrus.WithField("instance", instance).Infof("instance created successfully")
+	logger.WithField("instance", instance).Infof("instance created successfully")
 
 	return instance, nil
 }
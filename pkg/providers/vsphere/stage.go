@@ -29,11 +29,13 @@ import (
 
 	"github.com/bhojpur/kernel/pkg/providers/common"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
 	"github.com/sirupsen/logrus"
 )
 
 func (p *VsphereProvider) Stage(params types.StageImageParams) (_ *types.Image, err error) {
+	logger := kutil.LogEntry(params.Logger)
 	images, err := p.ListImages()
 	if err != nil {
 		return nil, errors.New("retrieving image list for existing image", err)
@@ -43,9 +45,9 @@ func (p *VsphereProvider) Stage(params types.StageImageParams) (_ *types.Image,
 			if !params.Force {
 				return nil, errors.New("an image already exists with name '"+params.Name+"', try again with --force", nil)
 			} else {
-				logrus.WithField("image", image).Warnf("force: deleting previous image with name " + params.Name)
+				logger.WithField("image", image).Warnf("force: deleting previous image with name " + params.Name)
 				if err := p.DeleteImage(image.Id, true); err != nil {
-					logrus.Warn(errors.New("failed removing previously existing image", err))
+					logger.Warn(errors.New("failed removing previously existing image", err))
 				}
 			}
 		}
@@ -57,7 +59,7 @@ func (p *VsphereProvider) Stage(params types.StageImageParams) (_ *types.Image,
 	}
 	defer func() {
 		if err != nil {
-			logrus.WithError(err).Warnf("creating image failed, cleaning up image on datastore")
+			logger.WithError(err).Warnf("creating image failed, cleaning up image on datastore")
 			c.Rmdir(vsphereImageDir)
 		}
 	}()
@@ -69,8 +71,8 @@ func (p *VsphereProvider) Stage(params types.StageImageParams) (_ *types.Image,
 	defer os.RemoveAll(localVmdkDir)
 	localVmdkFile := filepath.Join(localVmdkDir, "boot.vmdk")
 
-	logrus.WithField("raw-image", params.RawImage).Infof("creating boot volume from raw image")
-	if err := common.ConvertRawImage(params.RawImage.StageSpec.ImageFormat, types.ImageFormat_VMDK, params.RawImage.LocalImagePath, localVmdkFile); err != nil {
+	logger.WithField("raw-image", params.RawImage).Infof("creating boot volume from raw image")
+	if err := common.ConvertRawImage(params.RawImage.StageSpec.ImageFormat, types.ImageFormat_VMDK, params.RawImage.LocalImagePath, localVmdkFile, params.Containers); err != nil {
 		return nil, errors.New("converting raw image to vmdk", err)
 	}
 
@@ -80,7 +82,7 @@ func (p *VsphereProvider) Stage(params types.StageImageParams) (_ *types.Image,
 	}
 	sizeMb := rawImageFile.Size() >> 20
 
-	logrus.WithFields(logrus.Fields{
+	logger.WithFields(logrus.Fields{
 		"name":           params.Name,
 		"id":             params.Name,
 		"size":           sizeMb,
@@ -109,6 +111,6 @@ func (p *VsphereProvider) Stage(params types.StageImageParams) (_ *types.Image,
 		return nil, errors.New("modifying image map in state", err)
 	}
 
-	logrus.WithFields(logrus.Fields{"image": image}).Infof("image created succesfully")
+	logger.WithFields(logrus.Fields{"image": image}).Infof("image created succesfully")
 	return image, nil
 }
@@ -26,11 +26,12 @@ import (
 	"time"
 
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
-	"github.com/sirupsen/logrus"
 )
 
 func (p *XenProvider) CreateVolume(params types.CreateVolumeParams) (_ *types.Volume, err error) {
+	logger := kutil.LogEntry(params.Logger)
 	if _, volumeErr := p.GetImage(params.Name); volumeErr == nil {
 		return nil, errors.New("volume already exists", nil)
 	}
@@ -42,13 +43,13 @@ func (p *XenProvider) CreateVolume(params types.CreateVolumeParams) (_ *types.Vo
 	defer func() {
 		if err != nil {
 			if params.NoCleanup {
-				logrus.Warnf("because --no-cleanup flag was provided, not cleaning up failed volume %s at %s", params.Name, volumePath)
+				logger.Warnf("because --no-cleanup flag was provided, not cleaning up failed volume %s at %s", params.Name, volumePath)
 			} else {
 				os.RemoveAll(filepath.Dir(volumePath))
 			}
 		}
 	}()
-	logrus.WithField("raw-image", params.ImagePath).Infof("creating volume from raw image")
+	logger.WithField("raw-image", params.ImagePath).Infof("creating volume from raw image")
 
 	rawImageFile, err := os.Stat(params.ImagePath)
 	if err != nil {
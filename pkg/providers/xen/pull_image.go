@@ -27,11 +27,12 @@ import (
 
 	"github.com/bhojpur/kernel/pkg/providers/common"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
-	"github.com/sirupsen/logrus"
 )
 
 func (p *XenProvider) PullImage(params types.PullImagePararms) error {
+	logger := kutil.LogEntry(params.Logger)
 	images, err := p.ListImages()
 	if err != nil {
 		return errors.New("retrieving image list for existing image", err)
@@ -41,9 +42,9 @@ func (p *XenProvider) PullImage(params types.PullImagePararms) error {
 			if !params.Force {
 				return errors.New("an image already exists with name '"+params.ImageName+"', try again with --force", nil)
 			} else {
-				logrus.WithField("image", image).Warnf("force: deleting previous image with name " + params.ImageName)
+				logger.WithField("image", image).Warnf("force: deleting previous image with name " + params.ImageName)
 				if err := p.DeleteImage(image.Id, true); err != nil {
-					logrus.Warn(errors.New("failed removing previously existing image", err))
+					logger.Warn(errors.New("failed removing previously existing image", err))
 				}
 			}
 		}
@@ -70,6 +71,6 @@ func (p *XenProvider) PullImage(params types.PullImagePararms) error {
 	}); err != nil {
 		return errors.New("modifying image map in state", err)
 	}
-	logrus.Infof("image %v pulled successfully from %v", err)
+	logger.Infof("image %v pulled successfully from %v", params.ImageName, params.Config.URL)
 	return nil
 }
@@ -30,12 +30,14 @@ import (
 	"github.com/bhojpur/kernel/pkg/providers/common"
 	"github.com/bhojpur/kernel/pkg/providers/xen/xenclient"
 	"github.com/bhojpur/kernel/pkg/types"
+	kutil "github.com/bhojpur/kernel/pkg/util"
 	"github.com/bhojpur/kernel/pkg/util/errors"
 	"github.com/sirupsen/logrus"
 )
 
 func (p *XenProvider) RunInstance(params types.RunInstanceParams) (_ *types.Instance, err error) {
-	logrus.WithFields(logrus.Fields{
+	logger := kutil.LogEntry(params.Logger)
+	logger.WithFields(logrus.Fields{
 		"image-id": params.ImageId,
 		"mounts":   params.MntPointsToVolumeIds,
 		"env":      params.Env,
@@ -74,7 +76,7 @@ func (p *XenProvider) RunInstance(params types.RunInstanceParams) (_ *types.Inst
 		}
 	}
 
-	logrus.Debugf("creating xen vm")
+	logger.Debugf("creating xen vm")
 
 	// TODO add support for boot drive mapping.
 
@@ -141,7 +143,7 @@ func (p *XenProvider) RunInstance(params types.RunInstanceParams) (_ *types.Inst
 		return nil, errors.New("modifying instance map in state", err)
 	}
 
-	logrus.WithField("instance", instance).Infof("instance created successfully")
+	logger.WithField("instance", instance).Infof("instance created successfully")
 
 	return instance, nil
 }
@@ -142,13 +142,46 @@ func (s *basicState) save() error {
 		return errors.New("failed to marshal memory state to json", err)
 	}
 	os.MkdirAll(filepath.Dir(s.saveFile), 0755)
-	err = ioutil.WriteFile(s.saveFile, data, 0644)
-	if err != nil {
+	if err := writeFileAtomic(s.saveFile, data, 0644); err != nil {
 		return errors.New("writing save file "+s.saveFile, err)
 	}
 	return nil
 }
 
+// writeFileAtomic replaces path with data so that a crash leaves either the
+// old or the new contents, never a truncated file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp.")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	// persist the rename itself
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
 func (s *basicState) RemoveImage(image *types.Image) error {
 	if err := s.ModifyImages(func(images map[string]*types.Image) error {
 		delete(images, image.Id)
@@ -0,0 +1,324 @@
+package state
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bhojpur/kernel/pkg/types"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	imagesBucket    = []byte("images")
+	instancesBucket = []byte("instances")
+	volumesBucket   = []byte("volumes")
+)
+
+// OpenBoltDB opens (creating if needed) the database that holds the state
+// of all providers. bolt locks the file, so a daemon opens it once and
+// shares it between providers.
+func OpenBoltDB(path string) (*bolt.DB, error) {
+	os.MkdirAll(filepath.Dir(path), 0755)
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, errors.New("opening state database "+path, err)
+	}
+	return db, nil
+}
+
+// boltState keeps one provider's state in its own bucket of a bolt
+// database. Every Modify* runs in a single transaction: if modify fails or
+// the daemon dies midway, the previous state is kept.
+type boltState struct {
+	db        *bolt.DB
+	namespace []byte
+}
+
+func NewBoltState(db *bolt.DB, namespace string) (*boltState, error) {
+	s := &boltState{db: db, namespace: []byte(namespace)}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists(s.namespace)
+		if err != nil {
+			return err
+		}
+		for _, name := range [][]byte{imagesBucket, instancesBucket, volumesBucket} {
+			if _, err := root.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.New("creating state buckets for "+namespace, err)
+	}
+	return s, nil
+}
+
+func (s *boltState) bucket(tx *bolt.Tx, name []byte) *bolt.Bucket {
+	return tx.Bucket(s.namespace).Bucket(name)
+}
+
+// Empty reports whether nothing has been stored for this namespace yet.
+func (s *boltState) Empty() bool {
+	empty := true
+	s.db.View(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{imagesBucket, instancesBucket, volumesBucket} {
+			if k, _ := s.bucket(tx, name).Cursor().First(); k != nil {
+				empty = false
+			}
+		}
+		return nil
+	})
+	return empty
+}
+
+// Import copies the state saved by a basic state in jsonFile and renames
+// the file so it is imported only once.
+func (s *boltState) Import(jsonFile string) error {
+	basic, err := BasicStateFromFile(jsonFile)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := putAll(s.bucket(tx, imagesBucket), imagesToValues(basic.Images)); err != nil {
+			return err
+		}
+		if err := putAll(s.bucket(tx, instancesBucket), instancesToValues(basic.Instances)); err != nil {
+			return err
+		}
+		return putAll(s.bucket(tx, volumesBucket), volumesToValues(basic.Volumes))
+	}); err != nil {
+		return errors.New("importing "+jsonFile, err)
+	}
+	if err := os.Rename(jsonFile, jsonFile+".imported"); err != nil {
+		return errors.New("renaming imported state file "+jsonFile, err)
+	}
+	return nil
+}
+
+func (s *boltState) GetImages() map[string]*types.Image {
+	images := make(map[string]*types.Image)
+	s.db.View(func(tx *bolt.Tx) error {
+		return readImages(s.bucket(tx, imagesBucket), images)
+	})
+	return images
+}
+
+func (s *boltState) GetInstances() map[string]*types.Instance {
+	instances := make(map[string]*types.Instance)
+	s.db.View(func(tx *bolt.Tx) error {
+		return readInstances(s.bucket(tx, instancesBucket), instances)
+	})
+	return instances
+}
+
+func (s *boltState) GetVolumes() map[string]*types.Volume {
+	volumes := make(map[string]*types.Volume)
+	s.db.View(func(tx *bolt.Tx) error {
+		return readVolumes(s.bucket(tx, volumesBucket), volumes)
+	})
+	return volumes
+}
+
+func (s *boltState) ModifyImages(modify func(images map[string]*types.Image) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := s.bucket(tx, imagesBucket)
+		images := make(map[string]*types.Image)
+		if err := readImages(bucket, images); err != nil {
+			return err
+		}
+		if err := modify(images); err != nil {
+			return errors.New("modifying Images", err)
+		}
+		return replaceAll(bucket, imagesToValues(images))
+	})
+}
+
+func (s *boltState) ModifyInstances(modify func(instances map[string]*types.Instance) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := s.bucket(tx, instancesBucket)
+		instances := make(map[string]*types.Instance)
+		if err := readInstances(bucket, instances); err != nil {
+			return err
+		}
+		if err := modify(instances); err != nil {
+			return errors.New("modifying Instances", err)
+		}
+		return replaceAll(bucket, instancesToValues(instances))
+	})
+}
+
+func (s *boltState) ModifyVolumes(modify func(volumes map[string]*types.Volume) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := s.bucket(tx, volumesBucket)
+		volumes := make(map[string]*types.Volume)
+		if err := readVolumes(bucket, volumes); err != nil {
+			return err
+		}
+		if err := modify(volumes); err != nil {
+			return errors.New("modifying Volumes", err)
+		}
+		return replaceAll(bucket, volumesToValues(volumes))
+	})
+}
+
+func (s *boltState) RemoveImage(image *types.Image) error {
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		return s.bucket(tx, imagesBucket).Delete([]byte(image.Id))
+	}); err != nil {
+		return errors.New("removing image from state", err)
+	}
+	return nil
+}
+
+// RemoveInstance also detaches the instance's volumes, in the same
+// transaction.
+func (s *boltState) RemoveInstance(instance *types.Instance) error {
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := s.bucket(tx, instancesBucket).Delete([]byte(instance.Id)); err != nil {
+			return err
+		}
+		bucket := s.bucket(tx, volumesBucket)
+		volumes := make(map[string]*types.Volume)
+		if err := readVolumes(bucket, volumes); err != nil {
+			return err
+		}
+		for id, volume := range volumes {
+			if volume.Attachment != instance.Id {
+				continue
+			}
+			volume.Attachment = ""
+			data, err := json.Marshal(volume)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(id), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return errors.New("removing instance from state", err)
+	}
+	return nil
+}
+
+func (s *boltState) RemoveVolume(volume *types.Volume) error {
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		return s.bucket(tx, volumesBucket).Delete([]byte(volume.Id))
+	}); err != nil {
+		return errors.New("removing volume from state", err)
+	}
+	return nil
+}
+
+func readImages(bucket *bolt.Bucket, images map[string]*types.Image) error {
+	return bucket.ForEach(func(k, v []byte) error {
+		var image types.Image
+		if err := json.Unmarshal(v, &image); err != nil {
+			return errors.New("unmarshalling image "+string(k), err)
+		}
+		images[string(k)] = &image
+		return nil
+	})
+}
+
+func readInstances(bucket *bolt.Bucket, instances map[string]*types.Instance) error {
+	return bucket.ForEach(func(k, v []byte) error {
+		var instance types.Instance
+		if err := json.Unmarshal(v, &instance); err != nil {
+			return errors.New("unmarshalling instance "+string(k), err)
+		}
+		instances[string(k)] = &instance
+		return nil
+	})
+}
+
+func readVolumes(bucket *bolt.Bucket, volumes map[string]*types.Volume) error {
+	return bucket.ForEach(func(k, v []byte) error {
+		var volume types.Volume
+		if err := json.Unmarshal(v, &volume); err != nil {
+			return errors.New("unmarshalling volume "+string(k), err)
+		}
+		volumes[string(k)] = &volume
+		return nil
+	})
+}
+
+func imagesToValues(images map[string]*types.Image) map[string]interface{} {
+	values := make(map[string]interface{}, len(images))
+	for id, image := range images {
+		values[id] = image
+	}
+	return values
+}
+
+func instancesToValues(instances map[string]*types.Instance) map[string]interface{} {
+	values := make(map[string]interface{}, len(instances))
+	for id, instance := range instances {
+		values[id] = instance
+	}
+	return values
+}
+
+func volumesToValues(volumes map[string]*types.Volume) map[string]interface{} {
+	values := make(map[string]interface{}, len(volumes))
+	for id, volume := range volumes {
+		values[id] = volume
+	}
+	return values
+}
+
+func putAll(bucket *bolt.Bucket, values map[string]interface{}) error {
+	for id, value := range values {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return errors.New("marshalling "+id, err)
+		}
+		if err := bucket.Put([]byte(id), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceAll makes the bucket hold exactly values.
+func replaceAll(bucket *bolt.Bucket, values map[string]interface{}) error {
+	var stale [][]byte
+	if err := bucket.ForEach(func(k, _ []byte) error {
+		if _, ok := values[string(k)]; !ok {
+			stale = append(stale, append([]byte{}, k...))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, k := range stale {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+	return putAll(bucket, values)
+}
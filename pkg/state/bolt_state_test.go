@@ -0,0 +1,106 @@
+package state
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bhojpur/kernel/pkg/types"
+	"github.com/bhojpur/kernel/pkg/util/errors"
+)
+
+func TestBoltStateImportAndModify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bolt-state-test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	jsonFile := filepath.Join(dir, "qemu", "state.json")
+	basic := NewBasicState(jsonFile)
+	if err := basic.ModifyInstances(func(instances map[string]*types.Instance) error {
+		instances["i1"] = &types.Instance{Id: "i1", Name: "web"}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := basic.ModifyVolumes(func(volumes map[string]*types.Volume) error {
+		volumes["v1"] = &types.Volume{Id: "v1", Attachment: "i1"}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := OpenBoltDB(filepath.Join(dir, "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s, err := NewBoltState(db, "qemu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Empty() {
+		t.Fatal("new state is not empty")
+	}
+	if err := s.Import(jsonFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(jsonFile); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be renamed after import", jsonFile)
+	}
+	if instance := s.GetInstances()["i1"]; instance == nil || instance.Name != "web" {
+		t.Fatalf("instance not imported: %v", s.GetInstances())
+	}
+
+	// a failing modify must leave the state untouched
+	if err := s.ModifyInstances(func(instances map[string]*types.Instance) error {
+		delete(instances, "i1")
+		return errors.New("boom", nil)
+	}); err == nil {
+		t.Fatal("expected modify error")
+	}
+	if _, ok := s.GetInstances()["i1"]; !ok {
+		t.Fatal("failed modify was not rolled back")
+	}
+
+	if err := s.RemoveInstance(&types.Instance{Id: "i1"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.GetInstances()) != 0 {
+		t.Fatalf("instance not removed: %v", s.GetInstances())
+	}
+	if volume := s.GetVolumes()["v1"]; volume == nil || volume.Attachment != "" {
+		t.Fatalf("volume not detached: %v", s.GetVolumes())
+	}
+
+	// namespaces are independent
+	other, err := NewBoltState(db, "aws/prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !other.Empty() {
+		t.Fatal("namespaces share state")
+	}
+}
@@ -20,7 +20,11 @@ package types
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
-import "github.com/bhojpur/kernel/pkg/config"
+import (
+	"github.com/bhojpur/kernel/pkg/config"
+	"github.com/bhojpur/kernel/pkg/util"
+	"github.com/sirupsen/logrus"
+)
 
 type RunInstanceParams struct {
 	Name                 string
@@ -30,6 +34,35 @@ type RunInstanceParams struct {
 	InstanceMemory       int
 	NoCleanup            bool
 	DebugMode            bool
+	// machine settings; currently only honoured by the firecracker
+	// provider, which falls back to its configured defaults when unset
+	VcpuCount   int
+	CpuTemplate string
+	KernelArgs  string
+	KernelPath  string
+	// enforced by the daemon's supervisor, not the provider
+	RestartPolicy RestartPolicy
+	HealthCheck   *HealthCheck
+	// Logger, when set, is used for the log lines of the call, e.g. to
+	// tag them with the id of the daemon request; see util.LogEntry
+	Logger *logrus.Entry `json:"-"`
+}
+
+type SnapshotInstanceParams struct {
+	InstanceId string
+	Name       string
+	// Stop stops the instance once the snapshot is taken instead of
+	// resuming it
+	Stop   bool
+	Logger *logrus.Entry `json:"-"`
+}
+
+type RestoreSnapshotParams struct {
+	SnapshotId string
+	// InstanceName names the restored instance; it defaults to the name
+	// of the snapshotted instance
+	InstanceName string
+	Logger       *logrus.Entry `json:"-"`
 }
 
 type StageImageParams struct {
@@ -37,12 +70,17 @@ type StageImageParams struct {
 	RawImage  *RawImage
 	Force     bool
 	NoCleanup bool
+	// Containers, when set, receives the output of and can cancel the
+	// containers run while staging
+	Containers *util.ContainerGroup
+	Logger     *logrus.Entry `json:"-"`
 }
 
 type CreateVolumeParams struct {
 	Name      string
 	ImagePath string
 	NoCleanup bool
+	Logger    *logrus.Entry `json:"-"`
 }
 
 type CompileImageParams struct {
@@ -51,20 +89,27 @@ type CompileImageParams struct {
 	MntPoints  []string
 	NoCleanup  bool
 	SizeMB     int
+	// Containers, when set, receives the output of and can cancel the
+	// containers the compiler runs
+	Containers *util.ContainerGroup
+	Logger     *logrus.Entry `json:"-"`
 }
 
 type PullImagePararms struct {
 	Config    config.HubConfig
 	ImageName string
 	Force     bool
+	Logger    *logrus.Entry `json:"-"`
 }
 
 type PushImagePararms struct {
 	Config    config.HubConfig
 	ImageName string
+	Logger    *logrus.Entry `json:"-"`
 }
 
 type RemoteDeleteImagePararms struct {
 	Config    config.HubConfig
 	ImageName string
+	Logger    *logrus.Entry `json:"-"`
 }
@@ -22,7 +22,11 @@ package types
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/bhojpur/kernel/pkg/util/errors"
 )
 
 type InstanceState string
@@ -63,6 +67,83 @@ type Image struct {
 	RunSpec        RunSpec        `json:"RunSpec"`
 }
 
+type BuildState string
+
+const (
+	BuildState_Queued    BuildState = "queued"
+	BuildState_Running   BuildState = "running"
+	BuildState_Succeeded BuildState = "succeeded"
+	BuildState_Failed    BuildState = "failed"
+	BuildState_Cancelled BuildState = "cancelled"
+)
+
+// BuildJob is an image build the daemon runs in the background.
+type BuildJob struct {
+	Id        string     `json:"Id"`
+	ImageName string     `json:"ImageName"`
+	Compiler  string     `json:"Compiler"`
+	Provider  string     `json:"Provider"`
+	State     BuildState `json:"State"`
+	Error     string     `json:"Error,omitempty"`
+	Image     *Image     `json:"Image,omitempty"`
+	Created   time.Time  `json:"Created"`
+	Finished  time.Time  `json:"Finished,omitempty"`
+}
+
+func (job BuildJob) Done() bool {
+	return job.State == BuildState_Succeeded || job.State == BuildState_Failed || job.State == BuildState_Cancelled
+}
+
+type EventKind string
+
+const (
+	EventKind_Image    EventKind = "image"
+	EventKind_Instance EventKind = "instance"
+	EventKind_Volume   EventKind = "volume"
+)
+
+type EventAction string
+
+const (
+	EventAction_Created EventAction = "created"
+	EventAction_Updated EventAction = "updated"
+	EventAction_Removed EventAction = "removed"
+)
+
+// Event describes a change to an image, instance or volume in a
+// provider's state. Exactly one of Image, Instance and Volume is set, holding
+// the object after the change (before it, for removals).
+type Event struct {
+	Time     time.Time   `json:"Time"`
+	Kind     EventKind   `json:"Kind"`
+	Action   EventAction `json:"Action"`
+	Provider string      `json:"Provider"`
+	Id       string      `json:"Id"`
+	Name     string      `json:"Name"`
+	Image    *Image      `json:"Image,omitempty"`
+	Instance *Instance   `json:"Instance,omitempty"`
+	Volume   *Volume     `json:"Volume,omitempty"`
+}
+
+// Drift is a difference the reconciler found between a provider's state
+// and what actually exists on its infrastructure.
+type Drift struct {
+	Provider string    `json:"Provider"`
+	Kind     EventKind `json:"Kind"`
+	Id       string    `json:"Id,omitempty"`
+	Name     string    `json:"Name"`
+	Problem  string    `json:"Problem"`
+	// Action taken to fix the state; empty when the drift is only reported
+	Action string `json:"Action,omitempty"`
+}
+
+// DriftReport is the outcome of a reconciliation pass over all providers.
+type DriftReport struct {
+	Time   time.Time         `json:"Time"`
+	Drift  []Drift           `json:"Drift"`
+	Errors map[string]string `json:"Errors,omitempty"`
+}
+
 // For Bhojpur Kernel Hub
 type UserImage struct {
 	*Image `json:"image"`
@@ -84,6 +165,111 @@ type Instance struct {
 	ImageId        string         `json:"ImageId"`
 	Infrastructure Infrastructure `json:"Infrastructure"`
 	Created        time.Time      `json:"Created"`
+	// set by the daemon's supervisor for instances run with a restart
+	// policy or health check
+	RestartPolicy  RestartPolicyName `json:"RestartPolicy,omitempty"`
+	Restarts       int               `json:"Restarts,omitempty"`
+	Health         HealthStatus      `json:"Health,omitempty"`
+	LastExitReason string            `json:"LastExitReason,omitempty"`
+}
+
+type RestartPolicyName string
+
+const (
+	RestartPolicy_Never     RestartPolicyName = "never"
+	RestartPolicy_OnFailure RestartPolicyName = "on-failure"
+	RestartPolicy_Always    RestartPolicyName = "always"
+)
+
+// RestartPolicy decides what happens when an instance exits or fails its
+// health check. The zero value never restarts.
+type RestartPolicy struct {
+	Name RestartPolicyName `json:"Name,omitempty"`
+	// MaxRetries limits on-failure restarts; 0 means no limit
+	MaxRetries int `json:"MaxRetries,omitempty"`
+}
+
+// ParseRestartPolicy parses never, always, on-failure or on-failure:N.
+func ParseRestartPolicy(s string) (RestartPolicy, error) {
+	policy := RestartPolicy{Name: RestartPolicyName(s)}
+	if i := strings.Index(s, ":"); i >= 0 {
+		policy.Name = RestartPolicyName(s[:i])
+		n, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return policy, errors.New(fmt.Sprintf("invalid retry count in restart policy %q", s), nil)
+		}
+		if n == 0 {
+			// on-failure:0 would read as never restarting
+			return policy, errors.New("restart policy retry count must be positive", nil)
+		}
+		policy.MaxRetries = n
+	}
+	return policy, policy.Validate()
+}
+
+func (policy RestartPolicy) Validate() error {
+	switch policy.Name {
+	case "", RestartPolicy_Never, RestartPolicy_Always, RestartPolicy_OnFailure:
+	default:
+		return errors.New(fmt.Sprintf("unknown restart policy %q. Available: never|on-failure[:N]|always", policy.Name), nil)
+	}
+	if policy.MaxRetries < 0 {
+		return errors.New("restart policy retry count must not be negative", nil)
+	}
+	if policy.MaxRetries > 0 && policy.Name != RestartPolicy_OnFailure {
+		return errors.New(fmt.Sprintf("restart policy %s does not take a retry count", policy.Name), nil)
+	}
+	return nil
+}
+
+func (policy RestartPolicy) String() string {
+	if policy.Name == RestartPolicy_OnFailure && policy.MaxRetries > 0 {
+		return fmt.Sprintf("%s:%d", policy.Name, policy.MaxRetries)
+	}
+	return string(policy.Name)
+}
+
+type HealthStatus string
+
+const (
+	HealthStatus_Starting  HealthStatus = "starting"
+	HealthStatus_Healthy   HealthStatus = "healthy"
+	HealthStatus_Unhealthy HealthStatus = "unhealthy"
+	// HealthStatus_Unprobeable means the provider reports no address the
+	// health check could reach
+	HealthStatus_Unprobeable HealthStatus = "unprobeable"
+)
+
+// HealthCheck probes an instance at its IpAddress. An instance that fails
+// FailureThreshold probes in a row is unhealthy, and restarted unless its
+// restart policy is never.
+type HealthCheck struct {
+	// Type is http or tcp
+	Type string `json:"Type"`
+	Port int    `json:"Port"`
+	// Path is requested by http probes, which pass on a 2xx or 3xx status
+	Path             string `json:"Path,omitempty"`
+	IntervalSeconds  int    `json:"IntervalSeconds,omitempty"`
+	TimeoutSeconds   int    `json:"TimeoutSeconds,omitempty"`
+	FailureThreshold int    `json:"FailureThreshold,omitempty"`
+	// GracePeriodSeconds is how long after starting failed probes are
+	// not counted
+	GracePeriodSeconds int `json:"GracePeriodSeconds,omitempty"`
+}
+
+func (check *HealthCheck) Validate() error {
+	switch check.Type {
+	case "http", "tcp":
+	default:
+		return errors.New(fmt.Sprintf("unknown health check type %q. Available: http|tcp", check.Type), nil)
+	}
+	if check.Port <= 0 || check.Port > 65535 {
+		return errors.New(fmt.Sprintf("invalid health check port %d", check.Port), nil)
+	}
+	if check.IntervalSeconds < 0 || check.TimeoutSeconds < 0 || check.FailureThreshold < 0 || check.GracePeriodSeconds < 0 {
+		return errors.New("health check settings must not be negative", nil)
+	}
+	return nil
 }
 
 func (instance *Instance) String() string {
@@ -109,6 +295,25 @@ func (volume *Volume) String() string {
 	return fmt.Sprintf("%+v", *volume)
 }
 
+// Snapshot is the saved memory and device state of an instance, from
+// which new instances resume where the snapshotted one left off.
+type Snapshot struct {
+	Id             string         `json:"Id"`
+	Name           string         `json:"Name"`
+	InstanceName   string         `json:"InstanceName"`
+	ImageId        string         `json:"ImageId"`
+	Infrastructure Infrastructure `json:"Infrastructure"`
+	SizeMb         int64          `json:"SizeMb"`
+	Created        time.Time      `json:"Created"`
+}
+
+func (snapshot *Snapshot) String() string {
+	if snapshot == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("%+v", *snapshot)
+}
+
 type RawImage struct {
 	LocalImagePath string    `json:"LocalImagePath"`
 	StageSpec      StageSpec `json:"StageSpec"`
@@ -160,6 +365,9 @@ type RunSpec struct {
 	StorageDriver         StorageDriver      `json:"StorageDriver,omitempty"`
 	VsphereNetworkType    VsphereNetworkType `json:"VsphereNetworkType"`
 	Compiler              string             `json:"Compiler,omitempty"`
+	// NicModel is the qemu network card the image has a driver for,
+	// virtio when empty
+	NicModel string `json:"NicModel,omitempty"`
 }
 
 type DeviceMapping struct {
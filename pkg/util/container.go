@@ -59,6 +59,7 @@ type Container struct {
 	containerName string
 	name          string
 	entrypoint    string
+	group         *ContainerGroup
 }
 
 func NewContainer(imageName string) *Container {
@@ -120,11 +121,27 @@ func (c *Container) Privileged(p bool) *Container {
 	return c
 }
 
+// InGroup adds the container to g when it runs; a nil group is ignored.
+func (c *Container) InGroup(g *ContainerGroup) *Container {
+	c.group = g
+	return c
+}
+
 func (c *Container) Run(arguments ...string) error {
 	cmd := c.BuildCmd(arguments...)
 
-	LogCommand(cmd, true)
+	if c.group == nil {
+		LogCommand(cmd, true)
+		return cmd.Run()
+	}
 
+	if err := c.group.add(c); err != nil {
+		return errors.New("not running container "+c.name, err)
+	}
+	defer c.group.remove(c)
+	logrus.WithField("command", cmd.Args).Debugf("running command")
+	cmd.Stdout = c.group.Output()
+	cmd.Stderr = c.group.Output()
 	return cmd.Run()
 }
 
@@ -133,7 +150,14 @@ func (c *Container) Output(arguments ...string) ([]byte, error) {
 }
 
 func (c *Container) CombinedOutput(arguments ...string) ([]byte, error) {
-	return c.BuildCmd(arguments...).CombinedOutput()
+	cmd := c.BuildCmd(arguments...)
+	if c.group != nil {
+		if err := c.group.add(c); err != nil {
+			return nil, errors.New("not running container "+c.name, err)
+		}
+		defer c.group.remove(c)
+	}
+	return cmd.CombinedOutput()
 }
 
 func (c *Container) Stop() error {
@@ -0,0 +1,86 @@
+package util
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io"
+	"sync"
+
+	"github.com/bhojpur/kernel/pkg/util/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ContainerGroup collects the containers started for one piece of work,
+// such as a build job, so that their output can be captured in one place
+// and they can all be stopped at once.
+type ContainerGroup struct {
+	output     io.Writer
+	containers map[*Container]bool
+	cancelled  bool
+	lock       sync.Mutex
+}
+
+func NewContainerGroup(output io.Writer) *ContainerGroup {
+	return &ContainerGroup{
+		output:     output,
+		containers: map[*Container]bool{},
+	}
+}
+
+// Output is where containers in the group write stdout and stderr.
+func (g *ContainerGroup) Output() io.Writer {
+	return g.output
+}
+
+// Cancel stops all running containers of the group. Containers added to
+// the group afterwards fail to start.
+func (g *ContainerGroup) Cancel() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.cancelled = true
+	for c := range g.containers {
+		if err := c.Stop(); err != nil {
+			logrus.WithError(err).Warnf("failed stopping container %s", c.containerName)
+		}
+	}
+}
+
+func (g *ContainerGroup) Cancelled() bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.cancelled
+}
+
+func (g *ContainerGroup) add(c *Container) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.cancelled {
+		return errors.New("cancelled", nil)
+	}
+	g.containers[c] = true
+	return nil
+}
+
+func (g *ContainerGroup) remove(c *Container) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	delete(g.containers, c)
+}
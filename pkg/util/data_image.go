@@ -35,7 +35,9 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func BuildRawDataImageWithType(dataTar io.ReadCloser, size kos.MegaBytes, volType string, usePartitionTables bool) (string, error) {
+// BuildRawDataImageWithType runs the image-creator container in containers,
+// if given, so that it can be cancelled with them.
+func BuildRawDataImageWithType(dataTar io.ReadCloser, size kos.MegaBytes, volType string, usePartitionTables bool, containers *ContainerGroup) (string, error) {
 	buildDir, err := ioutil.TempDir("", ".raw_data_image_folder.")
 	if err != nil {
 		return "", errors.New("creating tmp build folder", err)
@@ -53,7 +55,7 @@ func BuildRawDataImageWithType(dataTar io.ReadCloser, size kos.MegaBytes, volTyp
 	}
 
 	container := NewContainer("image-creator").Privileged(true).WithVolume("/dev/", "/dev/").
-		WithVolume(buildDir+"/", "/opt/vol")
+		WithVolume(buildDir+"/", "/opt/vol").InGroup(containers)
 
 	tmpResultFile, err := ioutil.TempFile(buildDir, "data.image.result.img.")
 	if err != nil {
@@ -93,9 +95,12 @@ func BuildRawDataImageWithType(dataTar io.ReadCloser, size kos.MegaBytes, volTyp
 }
 
 func BuildRawDataImage(dataTar io.ReadCloser, size kos.MegaBytes, usePartitionTables bool) (string, error) {
-	return BuildRawDataImageWithType(dataTar, size, "ext2", usePartitionTables)
+	return BuildRawDataImageWithType(dataTar, size, "ext2", usePartitionTables, nil)
 }
-func BuildEmptyDataVolumeWithType(size kos.MegaBytes, volType string) (string, error) {
+
+// BuildEmptyDataVolumeWithType runs the image-creator container in
+// containers, if given, so that it can be cancelled with them.
+func BuildEmptyDataVolumeWithType(size kos.MegaBytes, volType string, containers *ContainerGroup) (string, error) {
 
 	if size < 1 {
 		return "", errors.New("must specify size > 0", nil)
@@ -109,7 +114,7 @@ func BuildEmptyDataVolumeWithType(size kos.MegaBytes, volType string) (string, e
 	buildDir := filepath.Dir(dataFolder)
 
 	container := NewContainer("image-creator").Privileged(true).WithVolume("/dev/", "/dev/").
-		WithVolume(buildDir+"/", "/opt/vol")
+		WithVolume(buildDir+"/", "/opt/vol").InGroup(containers)
 
 	tmpResultFile, err := ioutil.TempFile(buildDir, "data.image.result.img.")
 	if err != nil {
@@ -139,5 +144,5 @@ func BuildEmptyDataVolumeWithType(size kos.MegaBytes, volType string) (string, e
 }
 
 func BuildEmptyDataVolume(size kos.MegaBytes) (string, error) {
-	return BuildEmptyDataVolumeWithType(size, "ext2")
+	return BuildEmptyDataVolumeWithType(size, "ext2", nil)
 }
@@ -0,0 +1,114 @@
+package util
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bhojpur/kernel/pkg/util/errors"
+)
+
+// DefaultDetachKeys detach from a console, as in docker.
+const DefaultDetachKeys = "ctrl-p,ctrl-q"
+
+// ErrDetached is returned by a DetachReader once it has read the detach
+// sequence.
+var ErrDetached error = errors.New("detached", nil)
+
+// ParseDetachKeys parses a comma separated key sequence such as
+// "ctrl-p,ctrl-q". A key is a single character or ctrl- followed by a
+// letter or one of @[\]^_.
+func ParseDetachKeys(keys string) ([]byte, error) {
+	var sequence []byte
+	for _, key := range strings.Split(keys, ",") {
+		switch {
+		case len(key) == 1:
+			sequence = append(sequence, key[0])
+		case strings.HasPrefix(strings.ToLower(key), "ctrl-") && len(key) == len("ctrl-")+1:
+			c := strings.ToLower(key)[len(key)-1]
+			switch {
+			case c >= 'a' && c <= 'z':
+				sequence = append(sequence, c-'a'+1)
+			case strings.IndexByte("@[\\]^_", c) >= 0:
+				sequence = append(sequence, c-'@')
+			default:
+				return nil, errors.New(fmt.Sprintf("invalid detach key %q", key), nil)
+			}
+		default:
+			return nil, errors.New(fmt.Sprintf("invalid detach key %q", key), nil)
+		}
+	}
+	return sequence, nil
+}
+
+// DetachReader passes reads through until it reads the detach sequence,
+// then returns ErrDetached. Input that could be the start of the sequence
+// is held back until it turns out not to be.
+type DetachReader struct {
+	r       io.Reader
+	keys    []byte
+	matched int
+	pending []byte
+	buf     [1024]byte
+	err     error
+}
+
+func NewDetachReader(r io.Reader, keys []byte) *DetachReader {
+	return &DetachReader{r: r, keys: keys}
+}
+
+func (d *DetachReader) Read(p []byte) (int, error) {
+	if len(d.keys) == 0 {
+		return d.r.Read(p)
+	}
+	for len(d.pending) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		n, err := d.r.Read(d.buf[:])
+		for _, b := range d.buf[:n] {
+			if b != d.keys[d.matched] {
+				// not the sequence after all
+				d.pending = append(d.pending, d.keys[:d.matched]...)
+				d.matched = 0
+				if b != d.keys[0] {
+					d.pending = append(d.pending, b)
+					continue
+				}
+			}
+			d.matched++
+			if d.matched == len(d.keys) {
+				d.err = ErrDetached
+				break
+			}
+		}
+		if err != nil && d.err == nil {
+			d.pending = append(d.pending, d.keys[:d.matched]...)
+			d.matched = 0
+			d.err = err
+		}
+	}
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
@@ -0,0 +1,89 @@
+package util
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestParseDetachKeys(t *testing.T) {
+	keys, err := ParseDetachKeys(DefaultDetachKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(keys, []byte{0x10, 0x11}) {
+		t.Errorf("expected ctrl-p,ctrl-q to be 0x10 0x11, got % x", keys)
+	}
+	keys, err = ParseDetachKeys("ctrl-],x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(keys, []byte{0x1d, 'x'}) {
+		t.Errorf("expected ctrl-],x to be 0x1d 0x78, got % x", keys)
+	}
+	for _, invalid := range []string{"", "ctrl-", "ctrl-1", "alt-x", "xy"} {
+		if _, err := ParseDetachKeys(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestDetachReader(t *testing.T) {
+	keys := []byte{0x10, 0x11}
+	for _, test := range []struct {
+		input    string
+		expected string
+		detached bool
+	}{
+		{"ls\r", "ls\r", false},
+		{"ls\r\x10\x11echo", "ls\r", true},
+		// a lone first key is passed on once the next key breaks the sequence
+		{"\x10a\x10\x10\x11", "\x10a\x10", true},
+		{"abc\x10", "abc\x10", false},
+	} {
+		output, err := ioutil.ReadAll(NewDetachReader(strings.NewReader(test.input), keys))
+		if test.detached && err != ErrDetached {
+			t.Errorf("%q: expected ErrDetached, got %v", test.input, err)
+		}
+		if !test.detached && err != nil {
+			t.Errorf("%q: unexpected error %v", test.input, err)
+		}
+		if string(output) != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.input, test.expected, output)
+		}
+	}
+
+	// the sequence is recognized across reads
+	r, w := io.Pipe()
+	go func() {
+		w.Write([]byte("a\x10"))
+		w.Write([]byte("\x11b"))
+		w.Close()
+	}()
+	output, err := ioutil.ReadAll(NewDetachReader(r, keys))
+	if err != ErrDetached || string(output) != "a" {
+		t.Errorf("expected %q and ErrDetached, got %q and %v", "a", output, err)
+	}
+}
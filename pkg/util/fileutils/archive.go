@@ -21,61 +21,16 @@ package fileutils
 // THE SOFTWARE.
 
 import (
-	"archive/tar"
 	"io"
-	"os"
 	"os/exec"
-	"path"
 
+	kos "github.com/bhojpur/kernel/pkg/os"
 	"github.com/bhojpur/kernel/pkg/util/errors"
-	log "github.com/sirupsen/logrus"
 )
 
+// ExtractTar is kept for existing callers, see kos.ExtractTar.
 func ExtractTar(tarArchive io.ReadCloser, localFolder string) error {
-	tr := tar.NewReader(tarArchive)
-	for {
-		hdr, err := tr.Next()
-		if err == io.EOF {
-			// end of tar archive
-			break
-		}
-		if err != nil {
-			return errors.New("reading tar archive", err)
-		}
-		log.WithField("file", hdr.Name).Debug("Extracting file")
-		switch hdr.Typeflag {
-		case tar.TypeDir:
-			err = os.MkdirAll(path.Join(localFolder, hdr.Name), 0755)
-			if err != nil {
-				return errors.New("making folder", err)
-			}
-
-		case tar.TypeReg:
-			fallthrough
-		case tar.TypeRegA:
-			dir, _ := path.Split(hdr.Name)
-			if err := os.MkdirAll(path.Join(localFolder, dir), 0755); err != nil {
-				return errors.New("making parent folder for file", err)
-			}
-
-			outputFile, err := os.Create(path.Join(localFolder, hdr.Name))
-			if err != nil {
-				return errors.New("creating output file", err)
-			}
-
-			if _, err := io.Copy(outputFile, tr); err != nil {
-				outputFile.Close()
-				return errors.New("writing output file", err)
-				return err
-			}
-			outputFile.Close()
-
-		default:
-			continue
-		}
-	}
-
-	return nil
+	return kos.ExtractTar(tarArchive, localFolder)
 }
 
 func Compress(source, destination string) error {
@@ -90,6 +90,15 @@ func (h *AddTraceHook) addTrace(message string) string {
 	return message
 }
 
+// LogEntry returns entry, or an entry of the standard logger when it is
+// nil, so that callers of providers may leave the Logger of params unset.
+func LogEntry(entry *logrus.Entry) *logrus.Entry {
+	if entry == nil {
+		return logrus.NewEntry(logrus.StandardLogger())
+	}
+	return entry
+}
+
 func LogCommand(cmd *exec.Cmd, asDebug bool) {
 	logrus.WithField("command", cmd.Args).Debugf("running command")
 	stdout, err := cmd.StdoutPipe()
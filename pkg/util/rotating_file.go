@@ -0,0 +1,117 @@
+package util
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/bhojpur/kernel/pkg/util/errors"
+)
+
+// RotatingFile is an io.WriteCloser that moves the file it writes to
+// aside once it grows beyond maxSize bytes. Only the previous generation
+// is kept, at path + ".1".
+type RotatingFile struct {
+	path    string
+	maxSize int64
+	size    int64
+	file    *os.File
+	lock    sync.Mutex
+}
+
+func NewRotatingFile(path string, maxSize int64) (*RotatingFile, error) {
+	f := &RotatingFile{
+		path:    path,
+		maxSize: maxSize,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.New("opening "+f.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.New("statting "+f.path, err)
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return errors.New("closing "+f.path, err)
+	}
+	if err := os.Rename(f.path, f.path+".1"); err != nil {
+		return errors.New("moving "+f.path+" aside", err)
+	}
+	return f.open()
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// ReadRotatingFile returns the contents of the file at path, preceded by
+// its previous generation if one has been rotated out.
+func ReadRotatingFile(path string) ([]byte, error) {
+	previous, err := ioutil.ReadFile(path + ".1")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.New("reading "+path+".1", err)
+	}
+	current, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.New("reading "+path, err)
+	}
+	return append(previous, current...), nil
+}